@@ -6,16 +6,21 @@ import (
 	"github.com/carlosroman/go-chip-8/internal/pkg/noop"
 	"github.com/carlosroman/go-chip-8/pkg/cpu"
 	log "github.com/sirupsen/logrus"
+	"os"
 )
 
 func main() {
 	log.SetLevel(log.InfoLevel)
 	s := &noop.Screen{}
-	ctx, _ := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	c := cmd.GetCommand(ctx, s, cpu.NewKeyboard(), s, func() (ap cmd.AudioPlayer, err error) {
 		return &audioPlayer{}, nil
 	})
 	if err := c.Execute(); err != nil {
+		if e, ok := err.(*cmd.ExitError); ok {
+			os.Exit(e.Code)
+		}
 		log.WithError(err).Fatal("app crashed")
 	}
 }
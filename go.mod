@@ -1,12 +1,14 @@
 module github.com/carlosroman/go-chip-8
 
 require (
+	github.com/gorilla/websocket v1.4.2
 	github.com/hajimehoshi/oto v0.2.2
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/sirupsen/logrus v1.2.0
 	github.com/spf13/cobra v0.0.3
 	github.com/spf13/pflag v1.0.3 // indirect
 	github.com/stretchr/testify v1.2.2
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
 	golang.org/x/time v0.0.0-20181108054448-85acf8d2951c
 )
 
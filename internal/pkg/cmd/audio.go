@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"github.com/carlosroman/go-chip-8/pkg/control"
 	"github.com/hajimehoshi/oto"
 	log "github.com/sirupsen/logrus"
 	"io"
@@ -31,6 +32,49 @@ func (s *soundCard) ProcessSound(soundChan <-chan byte) (err error) {
 	return err
 }
 
+// speedPlayer is an AudioPlayer that passes on the sound of each emulated
+// frame for as long as the frame lasts at the speed the emulator runs, so
+// a sound card playing a 60th of a second each time keeps up with it. At
+// twice the speed every other frame is passed on, at half the speed each
+// is passed on twice, and unthrottled none are.
+type speedPlayer struct {
+	next       AudioPlayer
+	multiplier func() float64
+}
+
+func (s *speedPlayer) ProcessSound(soundChan <-chan byte) (err error) {
+	out := make(chan byte, cap(soundChan))
+	done := make(chan error, 1)
+	go func() {
+		done <- s.next.ProcessSound(out)
+	}()
+	owed := 0.0
+	for b := range soundChan {
+		m := s.multiplier()
+		if m == control.Unthrottled {
+			owed = 0
+			continue
+		}
+		// A frame lasts 1 / m 60ths of a second
+		for owed++; owed >= m; owed -= m {
+			out <- b
+		}
+	}
+	close(out)
+	return <-done
+}
+
+// speedSoundCard returns sound cards that play at the speed multiplier
+// returns.
+func speedSoundCard(getSoundCard func() (ap AudioPlayer, err error), multiplier func() float64) func() (ap AudioPlayer, err error) {
+	return func() (ap AudioPlayer, err error) {
+		if ap, err = getSoundCard(); err != nil {
+			return ap, err
+		}
+		return &speedPlayer{next: ap, multiplier: multiplier}, nil
+	}
+}
+
 func newSoundCard(sample []byte, player io.Writer) (s *soundCard) {
 	return &soundCard{
 		player: player,
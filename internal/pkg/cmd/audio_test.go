@@ -53,6 +53,37 @@ func TestSoundCard_error(t *testing.T) {
 	w.AssertExpectations(t)
 }
 
+func TestSpeedPlayer(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name       string
+		multiplier float64
+		got        []byte
+	}{
+		{"normal", 1, []byte{4, 3, 2, 1}},
+		{"twice as fast", 2, []byte{3, 1}},
+		{"half as fast", 0.5, []byte{4, 4, 3, 3, 2, 2, 1, 1}},
+		{"slower", 0.75, []byte{4, 3, 2, 2, 1}},
+		{"unthrottled", 0, nil},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			next := &channelPlayer{}
+			s := &speedPlayer{next: next, multiplier: func() float64 { return tc.multiplier }}
+			sc := make(chan byte, 4)
+			sc <- 4
+			sc <- 3
+			sc <- 2
+			sc <- 1
+			close(sc)
+			assert.EqualError(t, s.ProcessSound(sc), "done", "the error of the sound card")
+			assert.Equal(t, tc.got, next.got)
+		})
+	}
+}
+
 func TestGenerateSample(t *testing.T) {
 	t.Parallel()
 	a := generateSample()
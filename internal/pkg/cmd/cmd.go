@@ -1,13 +1,30 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/internal/pkg/rpc"
+	"github.com/carlosroman/go-chip-8/internal/pkg/tty"
+	"github.com/carlosroman/go-chip-8/internal/pkg/vnc"
+	"github.com/carlosroman/go-chip-8/internal/pkg/web"
+	"github.com/carlosroman/go-chip-8/pkg/control"
+	"github.com/carlosroman/go-chip-8/pkg/coverage"
 	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/carlosroman/go-chip-8/pkg/profile"
+	"github.com/carlosroman/go-chip-8/pkg/record"
 	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/carlosroman/go-chip-8/pkg/symbols"
+	"github.com/carlosroman/go-chip-8/pkg/trace"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"io/ioutil"
 	"math/rand"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -19,77 +36,465 @@ const (
 	defaultSOneHundredHz = 100
 )
 
+// runOptions are the flags of the commands that run a rom.
+type runOptions struct {
+	romPath      string
+	romEntry     string
+	rom          []byte         // Read from romPath
+	syms         *symbols.Table // Read from labelsPath or next to romPath
+	tracePath    string
+	traceFilter  trace.Filter
+	coveragePath string
+	profilePath  string
+	profileRate  uint64
+	labelsPath   string
+	frontend     string
+	addr         string
+	renderer     string
+	scale        int
+	palette      string
+	keymap       string
+	keyHold      time.Duration
+	recordPath   string
+	recordScale  int
+	shotPath     string
+	y4mPath      string
+	wavPath      string
+	display      display.Options
+	orFrames     bool
+	wrap         bool
+	controlAddr  string
+	ipf          int
+	ips          int
+	catchUp      int
+	skipIdle     bool
+	speedsPath   string
+	seed         int64
+
+	headless          bool
+	stop              stopOptions
+	untilPC           string // Resolved into stop.pc
+	dumpScreenPath    string
+	dumpRegistersPath string
+}
+
 func GetCommand(ctx context.Context, screen cpu.Screen, keyboard cpu.Keyboard, loop Loop, getSoundCard func() (ap AudioPlayer, err error)) *cobra.Command {
-	var romPath string
-	timer := time.Second / defaultSixtyHz          // 60hz
-	cpuClock := time.Second / defaultSOneHundredHz // 100hz
-	runCmd := &cobra.Command{
-		Use:   "chip8",
-		Short: "Chip8 is a Chip 8 emulator",
-		Long:  "Chip8 is a Chip 8 emulator",
+	runCmd := newRunCommand("chip8", "", ctx, screen, keyboard, loop, getSoundCard)
+	runCmd.Short = "Chip8 is a Chip 8 emulator"
+	runCmd.Long = "Chip8 is a Chip 8 emulator\n\n" + romHelp + "\n\n" + controlsHelp + "\n\n" + headlessHelp
+	run := newRunCommand("run", "", ctx, screen, keyboard, loop, getSoundCard)
+	run.Short = "Run a rom"
+	run.Long = "Run a rom\n\n" + romHelp + "\n\n" + controlsHelp + "\n\n" + headlessHelp
+	serve := newRunCommand("serve", "web", ctx, screen, keyboard, loop, getSoundCard)
+	serve.Short = "Run a rom to play in a web browser"
+	serve.Long = "Run a rom to play in a web browser\n\n" + romHelp + "\n\n" + controlsHelp
+	runCmd.AddCommand(run, serve, newDecompileCommand(), newRecompileCommand(), newTraceDiffCommand(), newCoverageCommand(), newSelftestCommand())
+	return runCmd
+}
+
+func newRunCommand(use, frontend string, ctx context.Context, screen cpu.Screen, keyboard cpu.Keyboard, loop Loop, getSoundCard func() (ap AudioPlayer, err error)) *cobra.Command {
+	o := &runOptions{}
+	c := &cobra.Command{
+		Use: use,
 		//Args:  cobra.MinimumNArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
-			sc := make(chan byte, 60)
-			ti := cpu.NewTimer(sc)
-			wg := sync.WaitGroup{}
-			s, err := getSoundCard()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			screen, keyboard, loop := screen, keyboard, loop
+			if err := o.loadROM(cmd); err != nil {
+				return err
+			}
+			if err := o.loadSymbols(); err != nil {
+				return err
+			}
+			p, err := o.imagePalette()
 			if err != nil {
-				log.WithError(err).Fatal("Could not create sound card")
+				return err
 			}
-			wg.Add(4)
-
-			go func(w *sync.WaitGroup) {
-				defer w.Done()
+			if o.recordPath != "" {
+				if _, err = recordFormat(o.recordPath); err != nil {
+					return err
+				}
+			}
+			if err = o.checkVideo(); err != nil {
+				return err
+			}
+			if err = o.checkSpeed(); err != nil {
+				return err
+			}
+			if err = o.checkHeadless(); err != nil {
+				return err
+			}
+			if o.headless {
+				return runHeadless(ctx, cmd, o, p)
+			}
+			var rs *record.Screen
+			var ctl *control.Controller
+			// The sound card plays at the speed the controller runs at
+			getSoundCard := speedSoundCard(getSoundCard, func() float64 { return ctl.Multiplier() })
+			if o.y4mPath != "" || o.wavPath != "" {
+				v, err := openVideo(cmd.OutOrStdout(), o, p)
 				if err != nil {
-					log.WithError(err).Fatal("Could not create sound card")
+					return err
 				}
-				go func() {
-					<-ctx.Done()
-					close(sc)
+				defer func() {
+					if err := v.Close(); err != nil {
+						log.WithError(err).Error("Could not close video")
+					}
 				}()
-				if err = s.ProcessSound(sc); err != nil {
-					log.WithError(err).Fatal("Sound card crashed")
+				getSoundCard = videoSoundCard(getSoundCard, v, func() []byte { return rs.Frame() })
+			}
+			switch o.frontend {
+			case "":
+			case "tty":
+				to, err := o.ttyOptions()
+				if err != nil {
+					return err
 				}
-			}(&wg)
-
-			go func(w *sync.WaitGroup) {
-				defer w.Done()
-				log.Warn("Starting loop")
-				if err := loop.Run(ctx); err != nil {
-					log.WithError(err).Fatal("Loop failed")
+				to.Hotkeys = controlHotkeys(o, func() *control.Controller { return ctl })
+				to.Hotkeys[tty.CtrlS] = func() { takeScreenshot(o, rs, p) }
+				if !tty.IsTerminal(os.Stdin) {
+					return fmt.Errorf("the tty frontend needs a terminal to read keys from")
 				}
-				log.Warn("Stopping loop")
-			}(&wg)
-			go func(w *sync.WaitGroup) {
-				defer wg.Done()
-				log.Warn("Starting timer")
-				ti.Start(ctx, timer)
-				log.Warn("Stopping timer")
-			}(&wg)
-			go func(w *sync.WaitGroup) {
-				defer w.Done()
-				m := state.InitMemory()
-				f, err := os.Open(romPath)
+				k := cpu.NewKeyboard()
+				t := tty.New(os.Stdin, os.Stdout, k, to, cancel)
+				screen, keyboard, loop = t, k, t
+				// Anything logged would be drawn over the screen
+				out := log.StandardLogger().Out
+				log.SetOutput(ioutil.Discard)
+				defer log.SetOutput(out)
+			case "web":
+				k := cpu.NewKeyboard()
+				w := web.New(o.listenAddr("127.0.0.1:8080"), k, p)
+				screen, keyboard, loop = w, k, w
+				getSoundCard = beepSoundCard(getSoundCard, w.Sound)
+			case "vnc":
+				vo, err := o.vncOptions()
 				if err != nil {
-					log.WithError(err).Panicf("Could not open file '%s'", romPath)
+					return err
 				}
-				err = m.LoadMemory(f)
-				if err != nil {
-					log.WithError(err).Panicf("Could not load memory with file '%s'", romPath)
+				k := cpu.NewKeyboard()
+				v := vnc.New(o.listenAddr("127.0.0.1:5900"), k, vo)
+				screen, keyboard, loop = v, k, v
+				getSoundCard = beepSoundCard(getSoundCard, v.Sound)
+			default:
+				return fmt.Errorf("unknown frontend '%s'", o.frontend)
+			}
+			ips, err := o.speed(o.rom)
+			if err != nil {
+				return err
+			}
+			in, err := o.instrument(o.rom)
+			if err != nil {
+				return err
+			}
+			var l net.Listener
+			if o.controlAddr != "" {
+				if l, err = rpc.Listen(o.controlAddr); err != nil {
+					in.stop()
+					return err
 				}
-				s := rand.NewSource(time.Now().UnixNano())
-				r := rand.New(s)
-				c := cpu.NewCPU(m, r, keyboard, ti, screen)
-				cpu.Start("cpu", ctx, cpuClock, c.Tick)
-			}(&wg)
-			wg.Wait()
+			}
+			rs = record.NewScreen(screen)
+			recorded := make(chan struct{})
+			if o.recordPath != "" {
+				rs.Record(o.recordScale, p)
+				go func() {
+					defer close(recorded)
+					cpu.Start("record", ctx, time.Second/defaultSixtyHz, rs.Tick)
+				}()
+			} else {
+				close(recorded)
+			}
+			run(ctx, o, ips, rs, keyboard, loop, getSoundCard, l, in, func(c *control.Controller) { ctl = c })
+			<-recorded
+			if o.shotPath != "" {
+				if err = saveScreenshot(o.shotPath, rs, o.recordScale, p); err != nil {
+					return err
+				}
+			}
+			if r := rs.Stop(); r != nil {
+				return saveRecording(o.recordPath, r)
+			}
+			return nil
 		},
 	}
-	runCmd.Flags().StringVarP(&romPath, "rom", "r", "", "Path of rom to load (required)")
-	if err := runCmd.MarkFlagRequired("rom"); err != nil {
+	c.Flags().StringVarP(&o.romPath, "rom", "r", "", "Path of rom to load (required)")
+	c.Flags().StringVar(&o.romEntry, "rom-entry", "", "Name of the rom to load from an archive of several")
+	usage := "Frontend to play with, tty to play in the terminal, web in a browser or vnc in VNC viewers"
+	if frontend == "" {
+		usage += " (default the one built in)"
+	}
+	c.Flags().StringVar(&o.frontend, "frontend", frontend, usage)
+	c.Flags().StringVar(&o.addr, "addr", "", "Address the web and vnc frontends serve on (default 127.0.0.1:8080 for web and 127.0.0.1:5900 for vnc)")
+	c.Flags().StringVar(&o.renderer, "renderer", "auto", "How the tty frontend draws: text, sixel, kitty or auto to ask the terminal")
+	c.Flags().IntVar(&o.scale, "scale", 0, "Size of a pixel of sixel and kitty images and of the vnc desktop (default about 512 pixels wide)")
+	c.Flags().StringVar(&o.palette, "palette", "ffffff,000000", "Colours of pixels that are on and off in images, recordings and screenshots, or one of the presets "+strings.Join(display.PresetNames(), ", "))
+	c.Flags().Float64Var(&o.display.Decay, "phosphor", 0, "Share of its brightness a pixel keeps each frame once turned off, from 0 to less than 1, for it to fade out")
+	c.Flags().IntVar(&o.display.Blend, "blend", 0, "Number of frames to blend together, to soften flicker")
+	c.Flags().BoolVar(&o.orFrames, "or-frames", false, "Show pixels that were on at all during a frame, to stop sprites that are redrawn from flickering")
+	c.Flags().StringVar(&o.keymap, "keymap", tty.DefaultKeymap, "Keys for the keypad of the tty and vnc frontends, row by row: 123C 456D 789E A0BF")
+	c.Flags().DurationVar(&o.keyHold, "key-hold", tty.DefaultHold, "How long the tty frontend holds a key down after the terminal last sent it")
+	c.Flags().StringVar(&o.recordPath, "record", "", "Path of an animated .gif or .png (APNG) file to record the session to at 60 frames a second")
+	c.Flags().StringVar(&o.shotPath, "screenshot", "", "Path of a PNG file to write the last frame to when the rom stops, Ctrl+S takes one with the tty frontend")
+	c.Flags().StringVar(&o.y4mPath, "y4m", "", "Path of a YUV4MPEG2 video to write a frame of each emulated 60th of a second to, - for stdout")
+	c.Flags().StringVar(&o.wavPath, "wav", "", "Path of a WAV file to write the sound of each emulated 60th of a second to")
+	c.Flags().IntVar(&o.recordScale, "record-scale", 4, "Size of a pixel of recordings, videos and screenshots")
+	c.Flags().BoolVar(&o.wrap, "wrap", false, "Wrap sprites drawn past the edges of the screen around to the other side instead of clipping them")
+	c.Flags().IntVar(&o.ipf, "ipf", 0, "Instructions to execute each frame, a 60th of a second (default 100 instructions a second, or what the speeds file recommends)")
+	c.Flags().IntVar(&o.ips, "ips", 0, "Instructions to execute a second, instead of --ipf")
+	c.Flags().IntVar(&o.catchUp, "catch-up", control.DefaultCatchUp, "Most frames to run at once to catch up when the computer falls behind, the rest are skipped")
+	c.Flags().BoolVar(&o.skipIdle, "skip-idle", true, "Skip the instructions of loops that only wait for the delay timer or a key, which changes nothing but how busy the computer is")
+	c.Flags().StringVar(&o.speedsPath, "speeds", "", "Path of a file of the instructions a frame to run roms at, a line each of a rom's file name or SHA-1 and its speed (default "+speedsFile+" next to the rom)")
+	c.Flags().Int64Var(&o.seed, "seed", 0, "Seed of the random numbers, for runs to be the same each time (default a different one each run)")
+	c.Flags().BoolVar(&o.headless, "headless", false, "Run without a frontend, sound or pacing until a stop condition, exiting with a status that tells which")
+	c.Flags().Uint64Var(&o.stop.frames, "frames", 0, "Frames to run headless before stopping (default no limit)")
+	c.Flags().Uint64Var(&o.stop.cycles, "cycles", 0, "Instructions to execute headless before stopping (default no limit)")
+	c.Flags().StringVar(&o.untilPC, "until-pc", "", "Address or label to stop headless at when the program counter reaches it")
+	c.Flags().BoolVar(&o.stop.halt, "stop-on-halt", true, "Stop headless when the program jumps to itself or waits for a key")
+	c.Flags().DurationVar(&o.stop.timeout, "timeout", 0, "How long to run headless for before stopping (default no limit)")
+	c.Flags().StringVar(&o.dumpScreenPath, "dump-screen", "", "Path to write the screen to when headless stops, a PNG for .png files and text otherwise, - for stdout")
+	c.Flags().StringVar(&o.dumpRegistersPath, "dump-registers", "", "Path to write the registers to as JSON when headless stops, - for stdout")
+	c.Flags().StringVar(&o.controlAddr, "control", "", "Address of a JSON-RPC socket to pause, step, inspect and change the running rom with, unix:PATH or tcp:HOST:PORT, files being sent as data rather than paths over TCP")
+	c.Flags().StringVar(&o.tracePath, "trace", "", "Path of a JSON Lines file to write every instruction executed to")
+	c.Flags().Uint16Var(&o.traceFilter.From, "trace-from", 0, "Lowest address to trace")
+	c.Flags().Uint16Var(&o.traceFilter.To, "trace-to", 0, "Highest address to trace (default no limit)")
+	c.Flags().Uint64Var(&o.traceFilter.Start, "trace-start", 0, "First cycle to trace")
+	c.Flags().Uint64Var(&o.traceFilter.End, "trace-end", 0, "Last cycle to trace (default no limit)")
+	c.Flags().StringVar(&o.coveragePath, "coverage", "", "Path of a JSON file to write how often each address was executed, read and written to")
+	c.Flags().StringVar(&o.profilePath, "profile", "", "Path of a pprof profile to write where the program spends its instructions to")
+	c.Flags().Uint64Var(&o.profileRate, "profile-rate", 1, "Number of instructions between samples of the profile")
+	c.Flags().StringVar(&o.labelsPath, "labels", "", "Path of a symbol file naming addresses in traces and profiles (default the .sym, .labels or .json file next to the rom)")
+	if err := c.MarkFlagRequired("rom"); err != nil {
 		log.WithError(err).Fatal("Could not create command.")
 	}
-	return runCmd
+	return c
+}
+
+// ttyOptions returns the options of the tty frontend.
+func (o *runOptions) ttyOptions() (to tty.Options, err error) {
+	if to.Keymap, err = tty.ParseKeymap(o.keymap); err != nil {
+		return to, err
+	}
+	if to.Palette, err = display.ParsePalette(o.palette); err != nil {
+		return to, err
+	}
+	if o.scale < 0 {
+		return to, fmt.Errorf("invalid scale %d", o.scale)
+	}
+	to.Scale, to.Hold = o.scale, o.keyHold
+	switch o.renderer {
+	case "auto":
+	case "text":
+		to.Renderer = tty.NewAuto()
+	case "sixel":
+		to.Renderer = tty.NewSixel(to.Scale, to.Palette)
+	case "kitty":
+		to.Renderer = tty.NewKitty(to.Scale, to.Palette)
+	default:
+		return to, fmt.Errorf("unknown renderer '%s'", o.renderer)
+	}
+	return to, err
+}
+
+// vncOptions returns the options of the vnc frontend.
+func (o *runOptions) vncOptions() (vo vnc.Options, err error) {
+	if vo.Keymap, err = tty.ParseKeymap(o.keymap); err != nil {
+		return vo, err
+	}
+	if vo.Palette, err = display.ParsePalette(o.palette); err != nil {
+		return vo, err
+	}
+	if o.scale < 0 {
+		return vo, fmt.Errorf("invalid scale %d", o.scale)
+	}
+	vo.Scale, vo.Name = o.scale, filepath.Base(o.romPath)
+	return vo, nil
+}
+
+// listenAddr returns the address to serve on, def unless one was given.
+func (o *runOptions) listenAddr(def string) string {
+	if o.addr == "" {
+		return def
+	}
+	return o.addr
+}
+
+func run(ctx context.Context, o *runOptions, ips int, screen cpu.Screen, keyboard cpu.Keyboard, loop Loop, getSoundCard func() (ap AudioPlayer, err error), l net.Listener, in *instruments, started func(ctl *control.Controller)) {
+	sc := make(chan byte, 60)
+	ti := cpu.NewTimer(sc)
+	wg := sync.WaitGroup{}
+	s, err := getSoundCard()
+	if err != nil {
+		log.WithError(err).Fatal("Could not create sound card")
+	}
+	vblank := func() error { return nil }
+	if o.display.Enabled() {
+		pl := display.NewPipeline(screen, o.display)
+		screen, vblank = pl, pl.Tick
+	}
+	m := state.InitMemory()
+	rom := o.rom
+	err = m.LoadMemory(bytes.NewReader(rom))
+	if err != nil {
+		log.WithError(err).Panicf("Could not load memory with file '%s'", o.romPath)
+	}
+	c := cpu.NewCPU(m, o.random(), keyboard, ti, screen)
+	c.SetOrFrames(o.orFrames)
+	c.SetWrap(o.wrap)
+	in.add(c)
+	ctl := control.New(c, keyboard, control.Options{
+		Speed:    ips,
+		CatchUp:  o.catchUp,
+		ROM:      rom,
+		SkipIdle: o.skipIdle,
+		// Each tick of the timers is a frame, presented before the
+		// timers count down
+		Present: func() error {
+			if err := c.VBlank(); err != nil {
+				return err
+			}
+			return vblank()
+		},
+		Timers: ti.Tick,
+	})
+	started(ctl)
+	wg.Add(3)
+
+	go func(w *sync.WaitGroup) {
+		defer w.Done()
+		if err = s.ProcessSound(sc); err != nil {
+			log.WithError(err).Fatal("Sound card crashed")
+		}
+	}(&wg)
+
+	go func(w *sync.WaitGroup) {
+		defer w.Done()
+		log.Warn("Starting loop")
+		if err := loop.Run(ctx); err != nil {
+			log.WithError(err).Fatal("Loop failed")
+		}
+		log.Warn("Stopping loop")
+	}(&wg)
+	if l != nil {
+		wg.Add(1)
+		go func(w *sync.WaitGroup) {
+			defer w.Done()
+			p, _ := o.imagePalette()
+			if err := rpc.New(ctl, rpc.Options{Scale: o.recordScale, Palette: p, Symbols: o.syms}).Serve(ctx, l); err != nil {
+				log.WithError(err).Error("Control socket failed")
+			}
+		}(&wg)
+	}
+	go func(w *sync.WaitGroup) {
+		defer w.Done()
+		// The timers stop sending sound once the controller has stopped
+		defer close(sc)
+		defer in.stop()
+		log.Warn("Starting cpu")
+		ctl.Run(ctx)
+		log.Warn("Stopping cpu")
+	}(&wg)
+	wg.Wait()
+}
+
+// random returns the random numbers of the rom, from the seed when there
+// is one.
+func (o *runOptions) random() *rand.Rand {
+	seed := o.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// instrumented is a CPU that tracers and memory watchers can be added to.
+type instrumented interface {
+	AddTracer(t cpu.Tracer)
+	AddMemoryWatcher(w cpu.MemoryWatcher)
+}
+
+// instruments are the tracers the flags ask for, opened before the rom
+// runs for a bad flag to be an error rather than a crash.
+type instruments struct {
+	tracers  []cpu.Tracer
+	watchers []cpu.MemoryWatcher
+	stops    []func()
+}
+
+// instrument opens the tracers the flags ask for to run rom with.
+func (o *runOptions) instrument(rom []byte) (*instruments, error) {
+	in := &instruments{}
+	if o.tracePath != "" {
+		w, closeTrace, err := openTrace(o.tracePath, o.traceFilter)
+		if err != nil {
+			return nil, fmt.Errorf("could not create trace file '%s': %v", o.tracePath, err)
+		}
+		in.stops = append(in.stops, closeTrace)
+		w.SetNames(o.syms.Name)
+		in.tracers = append(in.tracers, w)
+	}
+	if o.coveragePath != "" {
+		f, err := os.Create(o.coveragePath)
+		if err != nil {
+			in.stop()
+			return nil, fmt.Errorf("could not create coverage file '%s': %v", o.coveragePath, err)
+		}
+		rec := coverage.NewRecorder(rom, 0x200)
+		in.tracers = append(in.tracers, rec)
+		in.watchers = append(in.watchers, rec)
+		in.stops = append(in.stops, func() {
+			if err := saveCoverage(f, rec); err != nil {
+				log.WithError(err).Errorf("Could not write coverage file '%s'", o.coveragePath)
+			}
+		})
+	}
+	if o.profilePath != "" {
+		f, err := os.Create(o.profilePath)
+		if err != nil {
+			in.stop()
+			return nil, fmt.Errorf("could not create profile '%s': %v", o.profilePath, err)
+		}
+		p := profile.NewProfiler(o.profileRate, o.syms.Name)
+		in.tracers = append(in.tracers, p)
+		in.stops = append(in.stops, func() {
+			if err := saveProfile(f, o.romPath, p); err != nil {
+				log.WithError(err).Errorf("Could not write profile '%s'", o.profilePath)
+			}
+		})
+	}
+	return in, nil
+}
+
+// add adds the tracers to c.
+func (in *instruments) add(c instrumented) {
+	for _, t := range in.tracers {
+		c.AddTracer(t)
+	}
+	for _, w := range in.watchers {
+		c.AddMemoryWatcher(w)
+	}
+}
+
+// stop writes out what the tracers found once the rom stops.
+func (in *instruments) stop() {
+	for i := len(in.stops) - 1; i >= 0; i-- {
+		in.stops[i]()
+	}
+}
+
+// beepSoundCard returns sound cards that also tell a frontend that beeps
+// itself whether the sound is on each frame.
+func beepSoundCard(getSoundCard func() (ap AudioPlayer, err error), beep func(on bool)) func() (ap AudioPlayer, err error) {
+	return func() (ap AudioPlayer, err error) {
+		if ap, err = getSoundCard(); err != nil {
+			return ap, err
+		}
+		return &framePlayer{next: ap, frame: func(sound byte) error {
+			beep(sound > 0)
+			return nil
+		}}, nil
+	}
 }
 
 type Loop interface {
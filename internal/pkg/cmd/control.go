@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"github.com/carlosroman/go-chip-8/internal/pkg/tty"
+	"github.com/carlosroman/go-chip-8/pkg/control"
+	"github.com/carlosroman/go-chip-8/pkg/rom"
+	log "github.com/sirupsen/logrus"
+)
+
+// controlsHelp tells how to control the emulator while it runs.
+const controlsHelp = `With the tty frontend, Ctrl+P pauses and resumes, Ctrl+N advances a frame,
+Ctrl+R resets, Ctrl+X resets the memory too, Ctrl+O loads the rom again,
+Ctrl+F and Ctrl+B run faster and slower, from 0.25x to unthrottled, and Ctrl+S
+takes a screenshot. The --control socket does all of this from scripts.`
+
+// controlHotkeys returns the hotkeys of the tty frontend that control the
+// emulator that ctl returns once it runs.
+func controlHotkeys(o *runOptions, ctl func() *control.Controller) map[byte]func() {
+	return map[byte]func(){
+		tty.CtrlP: func() {
+			if c := ctl(); c.Paused() {
+				c.Resume()
+			} else {
+				c.Pause()
+			}
+		},
+		tty.CtrlN: func() {
+			if _, err := ctl().FrameAdvance(); err != nil {
+				log.WithError(err).Error("Could not advance a frame")
+			}
+		},
+		tty.CtrlR: func() { ctl().Reset() },
+		tty.CtrlX: func() {
+			if err := ctl().HardReset(); err != nil {
+				log.WithError(err).Error("Could not reset")
+			}
+		},
+		tty.CtrlO: func() { reloadROM(o.romPath, o.romEntry, ctl()) },
+		tty.CtrlF: func() { log.WithField("multiplier", ctl().Faster()).Info("Faster") },
+		tty.CtrlB: func() { log.WithField("multiplier", ctl().Slower()).Info("Slower") },
+	}
+}
+
+// reloadROM loads the rom at path again, entry of it when it is an
+// archive, to play a new build of it.
+func reloadROM(path, entry string, ctl *control.Controller) {
+	r, err := rom.Load(path, entryChooser(entry))
+	if err == nil {
+		err = ctl.LoadROM(r.Data)
+	}
+	if err != nil {
+		log.WithError(err).Errorf("Could not load rom '%s'", path)
+	}
+}
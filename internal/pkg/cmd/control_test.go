@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/carlosroman/go-chip-8/internal/pkg/tty"
+	"github.com/carlosroman/go-chip-8/pkg/control"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestControlHotkeys(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "hotkeys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rom.ch8")
+	// V0 += 1, jump back
+	assert.NoError(t, ioutil.WriteFile(path, []byte{0x70, 0x01, 0x12, 0x00}, 0644))
+
+	m := state.InitMemory()
+	copy(m[0x200:], []byte{0x70, 0x01, 0x12, 0x00})
+	k := cpu.NewKeyboard()
+	c := cpu.NewCPU(m, rand.New(rand.NewSource(42)), k, cpu.NewTimer(make(chan byte, 60)), &noopScreen{})
+	ctl := control.New(c, k, control.Options{Speed: 120})
+	h := controlHotkeys(&runOptions{romPath: path}, func() *control.Controller { return ctl })
+
+	h[tty.CtrlP]()
+	assert.True(t, ctl.Paused())
+	h[tty.CtrlP]()
+	assert.False(t, ctl.Paused())
+
+	h[tty.CtrlN]()
+	assert.True(t, ctl.Paused(), "advancing a frame pauses")
+	assert.Equal(t, uint64(2), ctl.Status().Cycle)
+	assert.Equal(t, byte(1), ctl.Registers().V[0])
+
+	h[tty.CtrlR]()
+	assert.Equal(t, byte(0), ctl.Registers().V[0])
+
+	h[tty.CtrlF]()
+	assert.Equal(t, 2.0, ctl.Multiplier())
+	h[tty.CtrlB]()
+	h[tty.CtrlB]()
+	assert.Equal(t, 0.5, ctl.Multiplier())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte{0x61, 0x07}, 0644))
+	h[tty.CtrlO]()
+	assert.Equal(t, uint16(0x6107), ctl.Registers().Opcode, "the rom is loaded again")
+	assert.NoError(t, ctl.WriteMemory(0x200, []byte{0x00}))
+	h[tty.CtrlX]()
+	assert.Equal(t, uint16(0x6107), ctl.Registers().Opcode, "a hard reset loads the rom loaded last")
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/coverage"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+// saveCoverage writes what r has recorded to f and closes it.
+func saveCoverage(f io.WriteCloser, r *coverage.Recorder) error {
+	if err := r.Profile().Save(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func newCoverageCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "coverage",
+		Short: "Work with coverage recorded with --coverage",
+	}
+	c.AddCommand(newCoverageReportCommand())
+	return c
+}
+
+func newCoverageReportCommand() *cobra.Command {
+	var format, outPath string
+	c := &cobra.Command{
+		Use:   "report <coverage.json>",
+		Short: "Report the coverage recorded with --coverage",
+		Long: "Report the coverage recorded with --coverage as a disassembly annotated with how often each " +
+			"instruction was executed, regions that never were and how often each address was read and written. " +
+			"The HTML report also has a heat map of all of memory.",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			p, err := coverage.Load(in)
+			if err != nil {
+				return fmt.Errorf("could not read coverage '%s': %v", args[0], err)
+			}
+			var write func(w io.Writer) error
+			switch format {
+			case "text":
+				write = p.WriteText
+			case "html":
+				write = p.WriteHTML
+			default:
+				return fmt.Errorf("unknown format '%s', expected text or html", format)
+			}
+			if outPath == "" {
+				return write(cmd.OutOrStdout())
+			}
+			out, err := os.Create(outPath)
+			if err != nil {
+				return err
+			}
+			if err = write(out); err != nil {
+				_ = out.Close()
+				return err
+			}
+			return out.Close()
+		},
+	}
+	c.Flags().StringVarP(&format, "format", "f", "text", "Format of the report, text or html")
+	c.Flags().StringVarP(&outPath, "out", "o", "", "Path to write the report to (default stdout)")
+	return c
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"github.com/carlosroman/go-chip-8/pkg/coverage"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetCommand_coverage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coverage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "coverage.json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	c := GetCommand(ctx, &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	c.SetArgs([]string{"--rom", bcChip8TestPath, "--coverage", path})
+	_, err = c.ExecuteC()
+	assert.NoError(t, err)
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	p, err := coverage.Load(f)
+	assert.NoError(t, err)
+	rom, err := ioutil.ReadFile(bcChip8TestPath)
+	assert.NoError(t, err)
+	assert.Equal(t, rom, p.ROM)
+	assert.Equal(t, uint16(0x200), p.Origin)
+	assert.Equal(t, uint64(1), p.Exec[0x200])
+}
+
+func TestCoverageReportCommand(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "coverage-report")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "coverage.json")
+	p := &coverage.Profile{
+		ROM:    []byte{0x00, 0xE0, 0x12, 0x02, 0x00, 0xEE},
+		Origin: 0x200,
+		Exec:   map[uint16]uint64{0x200: 1, 0x202: 7},
+		Read:   map[uint16]uint64{},
+		Write:  map[uint16]uint64{},
+	}
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Save(f))
+	assert.NoError(t, f.Close())
+
+	tests := []struct {
+		name     string
+		args     []string
+		contains string
+	}{
+		{"text", []string{}, "       7        -        -  0x202  12 02             jump 0x202\n"},
+		{"html", []string{"--format", "html"}, "<td>0x202</td><td>12 02</td><td>jump 0x202</td>"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCoverageCommand()
+			out := &bytes.Buffer{}
+			c.SetOutput(out)
+			c.SetArgs(append([]string{"report", path}, tt.args...))
+			assert.NoError(t, c.Execute())
+			assert.Contains(t, out.String(), tt.contains)
+			assert.Contains(t, out.String(), "never executed: 0x204-0x205 (2 bytes)")
+		})
+	}
+
+	outPath := filepath.Join(dir, "report.html")
+	c := newCoverageCommand()
+	c.SetArgs([]string{"report", path, "-f", "html", "-o", outPath})
+	assert.NoError(t, c.Execute())
+	html, err := ioutil.ReadFile(outPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "<title>CHIP-8 coverage</title>")
+
+	c = newCoverageCommand()
+	c.SetOutput(&bytes.Buffer{})
+	c.SetArgs([]string{"report", path, "--format", "pdf"})
+	assert.EqualError(t, c.Execute(), "unknown format 'pdf', expected text or html")
+}
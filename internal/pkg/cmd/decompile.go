@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/octo"
+	"github.com/carlosroman/go-chip-8/pkg/rom"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+)
+
+func newDecompileCommand() *cobra.Command {
+	var outPath, labelsPath string
+	c := &cobra.Command{
+		Use:   "decompile <rom>",
+		Short: "Decompile a ROM to Octo source",
+		Long: "Decompile a ROM to Octo source, recovering subroutines, `if ... then` skips, " +
+			"`loop ... again` structures and sprite data. The source assembles back to the same ROM. " +
+			"Labels are named from a symbol file when there is one.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := rom.Load(args[0], nil)
+			if err != nil {
+				return err
+			}
+			syms, err := loadSymbols(labelsPath, args[0])
+			if err != nil {
+				return err
+			}
+			src := octo.Decompile(r.Data, syms.Name)
+			if outPath != "" {
+				return ioutil.WriteFile(outPath, []byte(src), 0644)
+			}
+			_, err = cmd.OutOrStdout().Write([]byte(src))
+			return err
+		},
+	}
+	c.Flags().StringVarP(&outPath, "out", "o", "", "Path to write the Octo source to (default stdout)")
+	c.Flags().StringVar(&labelsPath, "labels", "", "Path of a symbol file to name labels with (default the .sym, .labels or .json file next to the rom)")
+	return c
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/octo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompileCommand(t *testing.T) {
+	t.Parallel()
+	c := newDecompileCommand()
+	out := &bytes.Buffer{}
+	c.SetOutput(out)
+	c.SetArgs([]string{bcChip8TestPath})
+	err := c.Execute()
+	assert.NoError(t, err)
+	p, err := octo.Assemble(out.String())
+	assert.NoError(t, err)
+	rom, err := ioutil.ReadFile(bcChip8TestPath)
+	assert.NoError(t, err)
+	assert.Equal(t, rom, p.ROM)
+}
+
+func TestDecompileCommand_out(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "decompile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "BC_test.8o")
+	c := newDecompileCommand()
+	c.SetArgs([]string{bcChip8TestPath, "-o", path})
+	err = c.Execute()
+	assert.NoError(t, err)
+	src, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), ": main\n")
+}
+
+func TestDecompileCommand_labels(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "decompile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rom, err := ioutil.ReadFile(bcChip8TestPath)
+	assert.NoError(t, err)
+	romPath := filepath.Join(dir, "BC_test.ch8")
+	assert.NoError(t, ioutil.WriteFile(romPath, rom, 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "BC_test.sym"), []byte("0x200 start\n"), 0644))
+	labels := filepath.Join(dir, "labels.json")
+	assert.NoError(t, ioutil.WriteFile(labels, []byte(`{"begin": "0x200"}`), 0644))
+
+	tests := []struct {
+		name string
+		args []string
+		exp  string
+	}{
+		{"sidecar", []string{romPath}, ": start\n"},
+		{"flag", []string{romPath, "--labels", labels}, ": begin\n"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := newDecompileCommand()
+			out := &bytes.Buffer{}
+			c.SetOutput(out)
+			c.SetArgs(tt.args)
+			assert.NoError(t, c.Execute())
+			assert.Contains(t, out.String(), tt.exp)
+			p, err := octo.Assemble(out.String())
+			assert.NoError(t, err)
+			assert.Equal(t, rom, p.ROM)
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/control"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/carlosroman/go-chip-8/pkg/record"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exit statuses of headless runs, telling why they stopped.
+const (
+	exitExited  = 0 // The program exited with 00FD
+	exitFrames  = 3 // It ran --frames frames
+	exitCycles  = 4 // It executed --cycles instructions
+	exitPC      = 5 // It reached --until-pc
+	exitHalted  = 6 // It jumped to itself
+	exitTimeout = 7 // It ran for --timeout
+	exitFailed  = 8 // The CPU failed
+	exitWaiting = 9 // It waits for a key nobody can press
+)
+
+// headlessHelp tells how headless runs stop.
+const headlessHelp = `With --headless the rom runs without a frontend, sound or pacing, as fast as
+it can, until it exits with 00FD (status 0), has run --frames frames (3) or
+--cycles instructions (4), reaches --until-pc (5), jumps to itself (6), has
+run for --timeout (7), the CPU fails (8) or it waits for a key with FX0A (9),
+as no keys are pressed headless. --dump-screen and --dump-registers write
+where it stopped for scripts to check. --record, --screenshot, --y4m and
+--wav are written as in other runs, a frame for each emulated 60th of a
+second however fast it runs.`
+
+// ExitError is the error of a command that exits with a status that tells
+// a script what happened, such as why a headless run stopped.
+type ExitError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ExitError) Error() string {
+	return e.Reason
+}
+
+// stopOptions are the flags that stop headless runs.
+type stopOptions struct {
+	frames  uint64
+	cycles  uint64
+	pc      uint16
+	halt    bool
+	timeout time.Duration
+}
+
+// headlessResult is where and why a headless run stopped.
+type headlessResult struct {
+	code   int
+	reason string
+	r      cpu.Step
+	fb     []byte
+}
+
+// discardScreen is the screen of headless runs, which nobody looks at.
+type discardScreen struct{}
+
+func (discardScreen) Draw(frameBuffer []byte) {}
+
+// checkHeadless checks the flags of headless runs.
+func (o *runOptions) checkHeadless() error {
+	switch {
+	case !o.headless:
+	case o.frontend != "":
+		return fmt.Errorf("--headless runs without a frontend, not %s", o.frontend)
+	case o.controlAddr != "":
+		return fmt.Errorf("--headless can't be controlled with --control")
+	case o.stop.timeout < 0:
+		return fmt.Errorf("invalid timeout %s", o.stop.timeout)
+	case o.y4mPath == "-" && (o.dumpScreenPath == "-" || o.dumpRegistersPath == "-"):
+		return fmt.Errorf("can't write both video and dumps to stdout")
+	}
+	if o.untilPC != "" {
+		pc, err := o.syms.Resolve(o.untilPC)
+		if err != nil {
+			return fmt.Errorf("invalid --until-pc: %v", err)
+		}
+		o.stop.pc = pc
+	}
+	return nil
+}
+
+// runHeadless runs the rom until one of the stop conditions is met, dumps
+// where it stopped and returns an ExitError telling why, unless the program
+// exited.
+func runHeadless(ctx context.Context, cmd *cobra.Command, o *runOptions, p display.Palette) (err error) {
+	if level := log.GetLevel(); level > log.WarnLevel {
+		// Every instruction is logged otherwise
+		log.SetLevel(log.WarnLevel)
+		defer log.SetLevel(level)
+	}
+	rom := o.rom
+	m := state.InitMemory()
+	if err := m.LoadMemory(bytes.NewReader(rom)); err != nil {
+		return err
+	}
+	ips, err := o.speed(rom)
+	if err != nil {
+		return err
+	}
+	in, err := o.instrument(rom)
+	if err != nil {
+		return err
+	}
+	defer in.stop()
+	var v *video
+	if o.y4mPath != "" || o.wavPath != "" {
+		if v, err = openVideo(cmd.OutOrStdout(), o, p); err != nil {
+			return err
+		}
+		defer func() {
+			if e := v.Close(); err == nil {
+				err = e
+			}
+		}()
+	}
+	writing := v != nil
+	rs := record.NewScreen(discardScreen{})
+	if o.recordPath != "" {
+		rs.Record(o.recordScale, p)
+	}
+	var screen cpu.Screen = rs
+	vblank := func() error { return nil }
+	if o.display.Enabled() {
+		pl := display.NewPipeline(screen, o.display)
+		screen, vblank = pl, pl.Tick
+	}
+	stopped := make(chan struct{})
+	k := cpu.NewKeyboard()
+	k.Clear()
+	// The timer sends the sound timer each tick, taken straight back to
+	// write the frame of video that goes with it
+	sc := make(chan byte, 1)
+	ti := cpu.NewTimer(sc)
+	c := cpu.NewCPU(m, o.random(), k, ti, screen)
+	c.SetOrFrames(o.orFrames)
+	c.SetWrap(o.wrap)
+	in.add(c)
+	ctl := control.New(c, k, control.Options{
+		Speed:    ips,
+		ROM:      rom,
+		SkipIdle: o.skipIdle,
+		Present: func() error {
+			if err := c.VBlank(); err != nil {
+				return err
+			}
+			if err := vblank(); err != nil {
+				return err
+			}
+			return rs.Tick()
+		},
+		Timers: func() error {
+			if err := ti.Tick(); err != nil {
+				return err
+			}
+			sound := <-sc
+			if !writing {
+				return nil
+			}
+			if err := v.frame(sound, rs.Frame()); err != nil {
+				log.WithError(err).Error("Could not record frame, stopped recording")
+				writing = false
+			}
+			return nil
+		},
+	})
+	if o.stop.pc != 0 {
+		ctl.AddBreakpoint(o.stop.pc)
+	}
+	ctl.BreakAtCycle(o.stop.cycles)
+
+	var lock sync.Mutex
+	last := headlessResult{r: ctl.Registers(), fb: ctl.FrameBuffer()}
+	done := make(chan headlessResult, 1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		res := runFrames(ctl, o.stop, stopped, func(r headlessResult) {
+			lock.Lock()
+			defer lock.Unlock()
+			last = r
+		})
+		done <- res
+	}()
+	var timeout <-chan time.Time
+	if o.stop.timeout > 0 {
+		t := time.NewTimer(o.stop.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var res headlessResult
+	select {
+	case res = <-done:
+	case <-timeout:
+		lock.Lock()
+		res = last
+		lock.Unlock()
+		res.code, res.reason = exitTimeout, fmt.Sprintf("ran for %s", o.stop.timeout)
+	case <-ctx.Done():
+		close(stopped)
+		<-finished
+		return ctx.Err()
+	}
+	close(stopped)
+	<-finished
+	if o.shotPath != "" {
+		if err = saveScreenshot(o.shotPath, rs, o.recordScale, p); err != nil {
+			return err
+		}
+	}
+	if r := rs.Stop(); r != nil {
+		if err = saveRecording(o.recordPath, r); err != nil {
+			return err
+		}
+	}
+	return stopHeadless(cmd, o, res)
+}
+
+// runFrames runs frames until one of the stop conditions other than the
+// timeout is met or stopped is closed, telling frame where each left the
+// CPU. A program that jumps to itself or waits for a key is stopped at the
+// end of the frame.
+func runFrames(ctl *control.Controller, o stopOptions, stopped <-chan struct{}, frame func(r headlessResult)) headlessResult {
+	events, unsubscribe := ctl.Subscribe()
+	defer unsubscribe()
+	for frames := uint64(0); ; frames++ {
+		res := headlessResult{r: ctl.Registers(), fb: ctl.FrameBuffer()}
+		if o.frames > 0 && frames >= o.frames {
+			res.code, res.reason = exitFrames, fmt.Sprintf("ran %d frames", frames)
+			return res
+		}
+		select {
+		case <-stopped:
+			return res
+		default:
+		}
+		r, err := ctl.FrameAdvance()
+		res = headlessResult{r: r, fb: ctl.FrameBuffer()}
+		if err != nil {
+			res.code, res.reason = exitFailed, fmt.Sprintf("could not run a frame: %v", err)
+			return res
+		}
+		frame(res)
+		for len(events) > 0 {
+			e := <-events
+			switch {
+			case e.Type == control.Breakpoint && o.pc != 0 && e.PC == o.pc:
+				res.code, res.reason = exitPC, fmt.Sprintf("reached %#03x", e.PC)
+			case e.Type == control.Breakpoint:
+				res.code, res.reason = exitCycles, fmt.Sprintf("executed %d instructions", e.Cycle)
+			case e.Type == control.Halted && e.Error == cpu.ErrExit.Error():
+				res.code, res.reason = exitExited, cpu.ErrExit.Error()
+			case e.Type == control.Halted && e.Error != "":
+				res.code, res.reason = exitFailed, e.Error
+			case e.Type == control.Halted && o.halt:
+				res.code, res.reason = exitHalted, fmt.Sprintf("halted at %#03x", e.PC)
+			case e.Type == control.Waiting && o.halt:
+				res.code, res.reason = exitWaiting, fmt.Sprintf("waiting for a key at %#03x", e.PC)
+			default:
+				continue
+			}
+			return res
+		}
+	}
+}
+
+// stopHeadless reports why a headless run stopped, dumps where, and returns
+// the ExitError of the reason.
+func stopHeadless(cmd *cobra.Command, o *runOptions, res headlessResult) error {
+	fmt.Fprintf(cmd.OutOrStderr(), "Stopped at %#03x after %d instructions: %s\n", res.r.PC, res.r.Cycle, res.reason)
+	if err := dump(cmd.OutOrStdout(), o.dumpScreenPath, func(w io.Writer) error {
+		return dumpScreen(w, o, res.fb)
+	}); err != nil {
+		return err
+	}
+	if err := dump(cmd.OutOrStdout(), o.dumpRegistersPath, func(w io.Writer) error {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(res.r)
+	}); err != nil {
+		return err
+	}
+	if res.code == exitExited {
+		return nil
+	}
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+	return &ExitError{Code: res.code, Reason: res.reason}
+}
+
+// dump writes to path with write, to stdout when path is -, or not at all
+// when there is no path.
+func dump(stdout io.Writer, path string, write func(w io.Writer) error) error {
+	switch path {
+	case "":
+		return nil
+	case "-":
+		return write(stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dumpScreen writes a frame buffer as a PNG when the screen is dumped to a
+// .png file, and as text, a # for each pixel on and a . for each off,
+// otherwise.
+func dumpScreen(w io.Writer, o *runOptions, fb []byte) error {
+	if strings.ToLower(filepath.Ext(o.dumpScreenPath)) == ".png" {
+		p, err := o.imagePalette()
+		if err != nil {
+			return err
+		}
+		return png.Encode(w, record.Image(fb, o.recordScale, p))
+	}
+	_, err := io.WriteString(w, strings.Join(record.Text(fb), "\n")+"\n")
+	return err
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runHeadlessROM runs rom headless with args, returning what it wrote and
+// the status it exits with.
+func runHeadlessROM(t *testing.T, rom []byte, args ...string) (stdout string, code int) {
+	stdout, err := runHeadlessFile(t, "rom.ch8", rom, append([]string{"--ipf", "10"}, args...)...)
+	if e, ok := err.(*ExitError); ok {
+		return stdout, e.Code
+	}
+	assert.NoError(t, err)
+	return stdout, 0
+}
+
+// runHeadlessFile runs data, in a file called name, headless with args,
+// returning what it wrote and the error it stopped with.
+func runHeadlessFile(t *testing.T, name string, data []byte, args ...string) (stdout string, err error) {
+	dir, err := ioutil.TempDir("", "headless")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+	assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+	c := GetCommand(context.Background(), &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		return &mockAudioPlayer{}, nil
+	})
+	var out bytes.Buffer
+	c.SetOutput(&out)
+	c.SetArgs(append([]string{"run", "--headless", "--rom", path}, args...))
+	_, err = c.ExecuteC()
+	return out.String(), err
+}
+
+func TestRunHeadless(t *testing.T) {
+	t.Parallel()
+	count := []byte{0x70, 0x01, 0x12, 0x00}   // V0 += 1, jump back
+	halt := []byte{0x60, 0x05, 0x12, 0x02}    // V0 = 5, jump to itself
+	exit := []byte{0x60, 0x05, 0x00, 0xFD}    // V0 = 5, exit
+	waitKey := []byte{0x60, 0x05, 0xF1, 0x0A} // V0 = 5, wait for a key
+	testCases := []struct {
+		name  string
+		rom   []byte
+		args  []string
+		code  int
+		pc    uint16
+		cycle uint64 // Not checked when 0, for runs that stop after a time
+	}{
+		{"exit", exit, nil, exitExited, 0x202, 2},
+		{"frames", count, []string{"--frames", "3"}, exitFrames, 0x200, 30},
+		{"cycles", count, []string{"--cycles", "25"}, exitCycles, 0x202, 25},
+		{"cycles in an idle loop", halt, []string{"--cycles", "25", "--stop-on-halt=false"}, exitCycles, 0x202, 25},
+		{"until pc", count, []string{"--until-pc", "0x202", "--frames", "3"}, exitPC, 0x202, 1},
+		{"halt", halt, nil, exitHalted, 0x202, 10},
+		{"not stopping on halt", halt, []string{"--stop-on-halt=false", "--frames", "2"}, exitFrames, 0x202, 20},
+		{"waiting for a key", waitKey, nil, exitWaiting, 0x202, 10},
+		{"timeout", waitKey, []string{"--timeout", "100ms", "--stop-on-halt=false"}, exitTimeout, 0x202, 0},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			out, code := runHeadlessROM(t, tc.rom, append(tc.args, "--dump-registers", "-")...)
+			assert.Equal(t, tc.code, code)
+			var r cpu.Step
+			assert.NoError(t, json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &r))
+			assert.Equal(t, tc.pc, r.PC)
+			if tc.cycle > 0 {
+				assert.Equal(t, tc.cycle, r.Cycle)
+			}
+		})
+	}
+}
+
+func TestRunHeadless_untilLabel(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "headless-labels")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	labels := filepath.Join(dir, "labels.txt")
+	assert.NoError(t, ioutil.WriteFile(labels, []byte("0x202 again\n"), 0644))
+	count := []byte{0x70, 0x01, 0x12, 0x00} // V0 += 1, jump back
+
+	out, code := runHeadlessROM(t, count, "--until-pc", "again", "--labels", labels)
+	assert.Equal(t, exitPC, code)
+	assert.Contains(t, out, "reached 0x202")
+
+	_, err = runHeadlessFile(t, "rom.ch8", count, "--until-pc", "nowhere", "--labels", labels)
+	assert.EqualError(t, err, "invalid --until-pc: unknown symbol 'nowhere'")
+}
+
+func TestRunHeadless_dumpScreen(t *testing.T) {
+	t.Parallel()
+	// I = sprite, draw it at V0, V0, jump to itself
+	rom := []byte{0xA2, 0x06, 0xD0, 0x01, 0x12, 0x04, 0xC0}
+	out, code := runHeadlessROM(t, rom, "--dump-screen", "-")
+	assert.Equal(t, exitHalted, code)
+	lines := strings.Split(out, "\n")
+	assert.Equal(t, "Stopped at 0x204 after 10 instructions: halted at 0x204", lines[0])
+	assert.Equal(t, "##"+strings.Repeat(".", 62), lines[1])
+	assert.Equal(t, strings.Repeat(".", 64), lines[2])
+	assert.Len(t, lines, 1+32+1)
+
+	dir, err := ioutil.TempDir("", "headless-screen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "screen.png")
+	_, code = runHeadlessROM(t, rom, "--dump-screen", path, "--record-scale", "2")
+	assert.Equal(t, exitHalted, code)
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 128, img.Bounds().Dx())
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xFFFF), r, "on")
+	r, _, _, _ = img.At(4, 0).RGBA()
+	assert.Equal(t, uint32(0), r, "off")
+}
+
+func TestRunHeadless_record(t *testing.T) {
+	t.Parallel()
+	// I = sprite, draw it at V0, V0, V0 += 0 and jump back forever
+	rom := []byte{0xA2, 0x08, 0xD0, 0x01, 0x70, 0x00, 0x12, 0x04, 0xC0}
+	dir, err := ioutil.TempDir("", "headless-record")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	gifPath := filepath.Join(dir, "session.gif")
+	shot := filepath.Join(dir, "last.png")
+	y4m := filepath.Join(dir, "session.y4m")
+	wav := filepath.Join(dir, "sound.wav")
+
+	_, code := runHeadlessROM(t, rom, "--frames", "30", "--record", gifPath, "--screenshot", shot,
+		"--y4m", y4m, "--wav", wav, "--record-scale", "1")
+	assert.Equal(t, exitFrames, code)
+
+	f, err := os.Open(gifPath)
+	assert.NoError(t, err)
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, g.Image)
+	assert.Equal(t, 64, g.Config.Width)
+
+	f, err = os.Open(shot)
+	assert.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xFFFF), r, "on")
+
+	raw, err := ioutil.ReadFile(y4m)
+	assert.NoError(t, err)
+	header := "YUV4MPEG2 W64 H32 F60:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n"
+	assert.True(t, strings.HasPrefix(string(raw), header))
+	assert.Len(t, raw, len(header)+30*(len("FRAME\n")+64*32*3/2), "a frame for each frame run")
+
+	raw, err = ioutil.ReadFile(wav)
+	assert.NoError(t, err)
+	assert.Len(t, raw, 44+30*bufferSize)
+}
+
+func TestRunHeadless_videoAndDumpToStdout(t *testing.T) {
+	_, err := runHeadlessFile(t, "rom.ch8", []byte{0x00, 0xFD}, "--y4m", "-", "--dump-registers", "-")
+	assert.EqualError(t, err, "can't write both video and dumps to stdout")
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/profile"
+	"io"
+	"path/filepath"
+)
+
+// saveProfile writes what p has sampled from the ROM at romPath to f and
+// closes it.
+func saveProfile(f io.WriteCloser, romPath string, p *profile.Profiler) error {
+	if err := p.Write(f, filepath.Base(romPath)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
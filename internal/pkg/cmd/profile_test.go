@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"context"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetCommand_profile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "profile.pb.gz")
+	labels := filepath.Join(dir, "labels.txt")
+	assert.NoError(t, ioutil.WriteFile(labels, []byte("0x200 start\n"), 0644))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	c := GetCommand(ctx, &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	c.SetArgs([]string{"--rom", bcChip8TestPath, "--profile", path, "--labels", labels})
+	_, err = c.ExecuteC()
+	assert.NoError(t, err)
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	raw, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), "BC_test.ch8")
+	assert.Contains(t, string(raw), "start")
+}
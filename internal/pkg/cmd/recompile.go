@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/recompile"
+	"github.com/carlosroman/go-chip-8/pkg/rom"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func newRecompileCommand() *cobra.Command {
+	var outPath string
+	c := &cobra.Command{
+		Use:   "recompile <rom>",
+		Short: "Recompile a ROM to a Go program",
+		Long: "Recompile a ROM to a Go program. Each reachable basic block is translated to Go, " +
+			"computed jumps and self-modified code fall back to the interpreter. " +
+			"The program runs headless and prints the hash of the frame buffer when it finishes. " +
+			"It imports the cpu and recompile packages of github.com/carlosroman/go-chip-8, " +
+			"so the module it is built in has to require that one.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := rom.Load(args[0], nil)
+			if err != nil {
+				return err
+			}
+			src, err := recompile.Recompile(r.Data, filepath.Base(args[0]))
+			if err != nil {
+				return err
+			}
+			if outPath != "" {
+				return ioutil.WriteFile(outPath, src, 0644)
+			}
+			_, err = cmd.OutOrStdout().Write(src)
+			return err
+		},
+	}
+	c.Flags().StringVarP(&outPath, "out", "o", "", "Path to write the Go program to (default stdout)")
+	return c
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecompileCommand(t *testing.T) {
+	t.Parallel()
+	c := newRecompileCommand()
+	out := &bytes.Buffer{}
+	c.SetOutput(out)
+	c.SetArgs([]string{bcChip8TestPath})
+	err := c.Execute()
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "// Code generated by chip8 recompile from BC_test.ch8. DO NOT EDIT.")
+	assert.Contains(t, out.String(), "recompile.Main(rom, blocks)")
+}
+
+func TestRecompileCommand_out(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "recompile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "game.go")
+	c := newRecompileCommand()
+	c.SetArgs([]string{bcChip8TestPath, "-o", path})
+	err = c.Execute()
+	assert.NoError(t, err)
+	src, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(src), "package main")
+}
+
+func TestRecompileCommand_missingRom(t *testing.T) {
+	t.Parallel()
+	c := newRecompileCommand()
+	c.SetOutput(&bytes.Buffer{})
+	c.SetArgs([]string{"does-not-exist.ch8"})
+	err := c.Execute()
+	assert.Error(t, err)
+}
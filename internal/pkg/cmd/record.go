@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/carlosroman/go-chip-8/pkg/record"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// imagePalette returns the colours of screenshots and recordings.
+func (o *runOptions) imagePalette() (display.Palette, error) {
+	return display.ParsePalette(o.palette)
+}
+
+// recordFormat returns the format to record to path in from its extension.
+func recordFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		return "gif", nil
+	case ".png", ".apng":
+		return "apng", nil
+	}
+	return "", fmt.Errorf("recording '%s' must be a .gif, .png or .apng file", path)
+}
+
+// saveRecording writes r to path in the format its extension is for.
+func saveRecording(path string, r *record.Recording) error {
+	format, err := recordFormat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = record.Write(f, r, format); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// saveScreenshot writes the last frame s drew as a PNG to path.
+func saveScreenshot(path string, s *record.Screen, scale int, p display.Palette) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = s.Screenshot(f, scale, p); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// screenshotName returns the name of a screenshot of the ROM at romPath
+// taken at t.
+func screenshotName(romPath string, t time.Time) string {
+	base := strings.TrimSuffix(filepath.Base(romPath), filepath.Ext(romPath))
+	return fmt.Sprintf("%s-%s.png", base, t.Format("20060102-150405.000"))
+}
+
+// takeScreenshot writes a screenshot of what s shows into the current
+// directory, as the screenshot hotkey does.
+func takeScreenshot(o *runOptions, s *record.Screen, p display.Palette) {
+	path := screenshotName(o.romPath, time.Now())
+	if err := saveScreenshot(path, s, o.recordScale, p); err != nil {
+		log.WithError(err).Errorf("Could not write screenshot '%s'", path)
+	}
+}
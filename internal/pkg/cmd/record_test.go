@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetCommand_record(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.gif")
+	shot := filepath.Join(dir, "last.png")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	c := GetCommand(ctx, &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	c.SetArgs([]string{"--rom", bcChip8TestPath, "--record", path, "--screenshot", shot, "--record-scale", "2", "--palette", "00ff00,000000"})
+	_, err = c.ExecuteC()
+	assert.NoError(t, err)
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, g.Image)
+	assert.Equal(t, 128, g.Config.Width)
+
+	f, err = os.Open(shot)
+	assert.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 128, img.Bounds().Dx())
+}
+
+func TestGetCommand_record_errors(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"unknown format", []string{"--record", "session.mp4"}, "recording 'session.mp4' must be a .gif, .png or .apng file"},
+		{"invalid palette", []string{"--palette", "red"}, "palette 'red' must be two colours, on and off, or one of amber, deuteranopia, green, inverse, lcd, protanopia, tritanopia, white"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := GetCommand(context.Background(), &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+				return &mockAudioPlayer{}, nil
+			})
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs(append([]string{"--rom", bcChip8TestPath}, tc.args...))
+			_, err := c.ExecuteC()
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestRecordFormat(t *testing.T) {
+	t.Parallel()
+	for path, format := range map[string]string{"a.gif": "gif", "a.GIF": "gif", "a.png": "apng", "dir/a.apng": "apng"} {
+		got, err := recordFormat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, format, got, path)
+	}
+}
+
+func TestScreenshotName(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	assert.Equal(t, "BC_test-20200102-030405.006.png", screenshotName("roms/BC_test.ch8", at))
+}
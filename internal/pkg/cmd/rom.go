@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/internal/pkg/tty"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/carlosroman/go-chip-8/pkg/rom"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+)
+
+// romHelp tells what roms can be loaded from.
+const romHelp = `Roms are loaded from raw images (.ch8, .c8, .sc8 and .xo8), gzip and zip
+archives of them, Intel HEX files, hex listings and Octo cartridges (.gif).
+When an archive holds several roms, --rom-entry names the one to run, or it
+is asked for on a terminal. The options a cartridge was saved with set the
+speed, colours and wrapping unless their flags are given.`
+
+// loadROM reads the rom the flags name, asking which one on the terminal
+// when it is an archive of several, and applies the options of cartridges.
+func (o *runOptions) loadROM(cmd *cobra.Command) error {
+	choose := entryChooser(o.romEntry)
+	if choose == nil && tty.IsTerminal(os.Stdin) {
+		choose = promptChooser(os.Stdin, cmd.OutOrStderr())
+	}
+	r, err := rom.Load(o.romPath, func(names []string) (string, error) {
+		if choose == nil {
+			return "", fmt.Errorf("'%s' has %d roms, choose one of %s with --rom-entry", o.romPath, len(names), strings.Join(names, ", "))
+		}
+		entry, err := choose(names)
+		// Reloading the rom loads the same one again
+		o.romEntry = entry
+		return entry, err
+	})
+	if err != nil {
+		return err
+	}
+	if r.Format != "raw" {
+		log.Infof("Loaded %d bytes from %s '%s'", len(r.Data), r.Format, r.Name)
+	}
+	o.rom = r.Data
+	if r.Options != nil {
+		o.applyCartridge(cmd, r.Options)
+	}
+	return nil
+}
+
+// applyCartridge sets the options of a cartridge that no flag was given for,
+// and warns of the quirks it asks for that the CPU doesn't have.
+func (o *runOptions) applyCartridge(cmd *cobra.Command, co *rom.Options) {
+	flags := cmd.Flags()
+	if co.TickRate > 0 && !flags.Changed("ipf") && !flags.Changed("ips") {
+		o.ipf = co.TickRate
+	}
+	if !flags.Changed("wrap") {
+		o.wrap = !co.ClipQuirks
+	}
+	if co.FillColor != "" && co.BackgroundColor != "" && !flags.Changed("palette") {
+		palette := co.FillColor + "," + co.BackgroundColor
+		if _, err := display.ParsePalette(palette); err != nil {
+			log.WithError(err).Warn("Ignoring the colours of the cartridge")
+		} else {
+			o.palette = palette
+		}
+	}
+	// What the CPU does, as Octo names it
+	quirks := []struct {
+		name      string
+		want, has bool
+	}{
+		{"shiftQuirks", co.ShiftQuirks, true},
+		{"loadStoreQuirks", co.LoadStoreQuirks, true},
+		{"vfOrderQuirks", co.VFOrderQuirks, false},
+		{"jumpQuirks", co.JumpQuirks, false},
+		{"logicQuirks", co.LogicQuirks, false},
+		{"vBlankQuirks", co.VBlankQuirks, false},
+	}
+	for _, q := range quirks {
+		if q.want != q.has {
+			log.Warnf("The cartridge wants %s %t, which isn't supported, it may not run as it should", q.name, q.want)
+		}
+	}
+}
+
+// entryChooser returns what picks entry from an archive, nil when there is
+// no entry to pick.
+func entryChooser(entry string) rom.Chooser {
+	if entry == "" {
+		return nil
+	}
+	return func([]string) (string, error) { return entry, nil }
+}
+
+// promptChooser returns what asks which rom of an archive to run, listing
+// them on out and reading the name of one from in.
+func promptChooser(in io.Reader, out io.Writer) rom.Chooser {
+	return func(names []string) (string, error) {
+		fmt.Fprintln(out, "Roms:")
+		for _, name := range names {
+			fmt.Fprintf(out, "  %s\n", name)
+		}
+		fmt.Fprint(out, "Rom to run: ")
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("no rom was chosen: %v", err)
+		}
+		return strings.TrimSpace(line), nil
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/rom"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+func TestRunHeadless_romFormats(t *testing.T) {
+	t.Parallel()
+	count := []byte{0x70, 0x01, 0x12, 0x00} // V0 += 1, jump back
+	exit := []byte{0x60, 0x05, 0x00, 0xFD}  // V0 = 5, exit
+	testCases := []struct {
+		name  string
+		file  string
+		data  []byte
+		args  []string
+		cycle uint64
+	}{
+		{"gzip", "count.ch8.gz", gzipROM(count), []string{"--ipf", "10"}, 10},
+		{"zip", "roms.zip", zipROMs("count.ch8", count), []string{"--ipf", "10"}, 10},
+		{"zip entry", "roms.zip", zipROMs("count.ch8", count, "exit.ch8", exit), []string{"--ipf", "10", "--rom-entry", "exit.ch8"}, 2},
+		{"hex listing", "count.txt", []byte("7001 1200\n"), []string{"--ipf", "10"}, 10},
+		{"cartridge", "count.gif", cartridgeROM(`{"program": "loop v0 += 1 again", "options": {"tickrate": 7}}`), nil, 7},
+		{"cartridge with ipf", "count.gif", cartridgeROM(`{"program": "loop v0 += 1 again", "options": {"tickrate": 7}}`), []string{"--ipf", "3"}, 3},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			out, err := runHeadlessFile(t, tc.file, tc.data, append(tc.args, "--frames", "1", "--dump-registers", "-")...)
+			if _, ok := err.(*ExitError); !ok {
+				assert.NoError(t, err)
+			}
+			var r cpu.Step
+			assert.NoError(t, json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &r))
+			assert.Equal(t, tc.cycle, r.Cycle)
+		})
+	}
+}
+
+func TestRunHeadless_romErrors(t *testing.T) {
+	t.Parallel()
+	_, err := runHeadlessFile(t, "big.ch8", make([]byte, 4000))
+	assert.EqualError(t, err, "rom 'big.ch8' is 4000 bytes, at most 3584 bytes fit in memory")
+
+	_, err = runHeadlessFile(t, "roms.zip", zipROMs("a.ch8", []byte{0x00, 0xFD}, "b.ch8", []byte{0x00, 0xFD}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "roms.zip' has 2 roms, choose one of a.ch8, b.ch8 with --rom-entry")
+
+	_, err = runHeadlessFile(t, "roms.zip", zipROMs("a.ch8", []byte{0x00, 0xFD}, "b.ch8", []byte{0x00, 0xFD}), "--rom-entry", "c.ch8")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "there is no rom 'c.ch8' in 'roms.zip', choose one of a.ch8, b.ch8")
+}
+
+func TestRunOptions_applyCartridge(t *testing.T) {
+	t.Parallel()
+	options := &rom.Options{TickRate: 20, FillColor: "#FFCC00", BackgroundColor: "#996600", ShiftQuirks: true, LoadStoreQuirks: true}
+	newCommand := func(o *runOptions) *cobra.Command {
+		c := &cobra.Command{}
+		c.Flags().StringVar(&o.palette, "palette", "ffffff,000000", "")
+		c.Flags().BoolVar(&o.wrap, "wrap", false, "")
+		c.Flags().IntVar(&o.ipf, "ipf", 0, "")
+		c.Flags().IntVar(&o.ips, "ips", 0, "")
+		return c
+	}
+
+	o := &runOptions{}
+	c := newCommand(o)
+	o.applyCartridge(c, options)
+	assert.Equal(t, 20, o.ipf)
+	assert.True(t, o.wrap)
+	assert.Equal(t, "#FFCC00,#996600", o.palette)
+
+	o = &runOptions{}
+	c = newCommand(o)
+	assert.NoError(t, c.Flags().Parse([]string{"--ips", "500", "--wrap=false", "--palette", "amber"}))
+	o.applyCartridge(c, options)
+	assert.Equal(t, 0, o.ipf)
+	assert.False(t, o.wrap)
+	assert.Equal(t, "amber", o.palette)
+
+	o = &runOptions{}
+	c = newCommand(o)
+	o.applyCartridge(c, &rom.Options{FillColor: "red", BackgroundColor: "#000000", ClipQuirks: true})
+	assert.Equal(t, 0, o.ipf)
+	assert.False(t, o.wrap)
+	assert.Equal(t, "ffffff,000000", o.palette)
+}
+
+func TestPromptChooser(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	entry, err := promptChooser(strings.NewReader(" b.ch8 \n"), &out)([]string{"a.ch8", "b.ch8"})
+	assert.NoError(t, err)
+	assert.Equal(t, "b.ch8", entry)
+	assert.Equal(t, "Roms:\n  a.ch8\n  b.ch8\nRom to run: ", out.String())
+
+	_, err = promptChooser(strings.NewReader(""), &out)([]string{"a.ch8", "b.ch8"})
+	assert.EqualError(t, err, "no rom was chosen: EOF")
+}
+
+func gzipROM(data []byte) []byte {
+	var b bytes.Buffer
+	z := gzip.NewWriter(&b)
+	z.Write(data)
+	z.Close()
+	return b.Bytes()
+}
+
+// zipROMs returns a zip archive of roms, pairs of names and contents.
+func zipROMs(roms ...interface{}) []byte {
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for i := 0; i < len(roms); i += 2 {
+		w, _ := z.Create(roms[i].(string))
+		w.Write(roms[i+1].([]byte))
+	}
+	z.Close()
+	return b.Bytes()
+}
+
+// cartridgeROM returns an Octo cartridge holding cartridge, its JSON, in
+// the low two bits of the pixels of a GIF.
+func cartridgeROM(cartridge string) []byte {
+	payload := make([]byte, 4, 4+len(cartridge))
+	binary.BigEndian.PutUint32(payload, uint32(len(cartridge)))
+	payload = append(payload, cartridge...)
+	frame := image.NewPaletted(image.Rect(0, 0, 64, 32), color.Palette{color.Black, color.White, color.Black, color.White})
+	for i, b := range payload {
+		for j := 0; j < 4; j++ {
+			frame.Pix[i*4+j] = b >> uint(6-2*j) & 0x3
+		}
+	}
+	var b bytes.Buffer
+	if err := gif.Encode(&b, frame, nil); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,361 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"github.com/carlosroman/go-chip-8/internal/pkg/tty"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"image"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetCommand_run(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	s := &countingScreen{}
+	c := GetCommand(ctx, s, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	c.SetArgs([]string{"run", "--rom", bcChip8TestPath})
+	_, err := c.ExecuteC()
+	assert.NoError(t, err)
+	assert.True(t, s.draws > 0, "the built in frontend is used")
+}
+
+func TestGetCommand_run_frontendErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"unknown frontend", []string{"--frontend", "sdl"}, "unknown frontend 'sdl'"},
+		{"invalid keymap", []string{"--frontend", "tty", "--keymap", "wasd"}, "keymap 'wasd' must have 16 characters, has 4"},
+		{"unknown renderer", []string{"--frontend", "tty", "--renderer", "braille"}, "unknown renderer 'braille'"},
+		{"invalid palette", []string{"--frontend", "tty", "--palette", "red,blue"}, "invalid colour 'red' in palette 'red,blue'"},
+		{"invalid scale", []string{"--frontend", "tty", "--scale", "-1"}, "invalid scale -1"},
+		{"not a terminal", []string{"--frontend", "tty"}, "the tty frontend needs a terminal to read keys from"},
+		{"invalid vnc keymap", []string{"--frontend", "vnc", "--keymap", "wasd"}, "keymap 'wasd' must have 16 characters, has 4"},
+		{"invalid vnc scale", []string{"--frontend", "vnc", "--scale", "-2"}, "invalid scale -2"},
+		{"both speeds", []string{"--ipf", "10", "--ips", "600"}, "only one of --ipf and --ips can be set"},
+		{"invalid catch-up", []string{"--catch-up", "0"}, "invalid catch-up 0"},
+		{"headless frontend", []string{"--headless", "--frontend", "tty"}, "--headless runs without a frontend, not tty"},
+		{"headless control", []string{"--headless", "--control", "unix:/tmp/chip8.sock"}, "--headless can't be controlled with --control"},
+		{"invalid control address", []string{"--control", "localhost:9000"}, "control address 'localhost:9000' must be unix:PATH or tcp:HOST:PORT"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := GetCommand(context.Background(), &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+				return &mockAudioPlayer{}, nil
+			})
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs(append([]string{"run", "--rom", bcChip8TestPath}, tc.args...))
+			_, err := c.ExecuteC()
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+type countingScreen struct {
+	draws int
+}
+
+func (s *countingScreen) Draw(frameBuffer []byte) {
+	s.draws++
+}
+
+func TestRunOptions_ttyOptions(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		renderer string
+		exp      tty.Renderer
+	}{
+		{"auto", nil},
+		{"text", tty.NewAuto()},
+		{"sixel", tty.NewSixel(2, display.DefaultPalette)},
+		{"kitty", tty.NewKitty(2, display.DefaultPalette)},
+	}
+	for _, tc := range testCases {
+		o := &runOptions{renderer: tc.renderer, scale: 2, palette: "ffffff,000000", keymap: tty.DefaultKeymap, keyHold: time.Second}
+		to, err := o.ttyOptions()
+		assert.NoError(t, err)
+		assert.IsType(t, tc.exp, to.Renderer, tc.renderer)
+		assert.Equal(t, 2, to.Scale)
+		assert.Equal(t, display.DefaultPalette, to.Palette)
+		assert.Equal(t, time.Second, to.Hold)
+		assert.Len(t, to.Keymap, 28)
+	}
+}
+
+type levelScreen struct {
+	lock   sync.Mutex
+	levels map[byte]bool
+}
+
+func (s *levelScreen) Draw(frameBuffer []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, px := range frameBuffer {
+		s.levels[px] = true
+	}
+}
+
+func TestGetCommand_run_display(t *testing.T) {
+	dir, err := ioutil.TempDir("", "display")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rom := filepath.Join(dir, "draw.ch8")
+	// Draw the 0 of the font and loop
+	assert.NoError(t, ioutil.WriteFile(rom, []byte{0x60, 0x00, 0xF0, 0x29, 0xD0, 0x05, 0x12, 0x06}, 0644))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	s := &levelScreen{levels: map[byte]bool{}}
+	c := GetCommand(ctx, s, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	c.SetArgs([]string{"run", "--rom", rom, "--or-frames", "--phosphor", "0.5", "--blend", "2", "--palette", "amber"})
+	_, err = c.ExecuteC()
+	assert.NoError(t, err)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	assert.True(t, s.levels[255], "drawn through the pipeline")
+	assert.False(t, s.levels[1], "not by the CPU")
+}
+
+// dirtyScreen counts how often frames are drawn whole and in part.
+type dirtyScreen struct {
+	lock          sync.Mutex
+	draws, dirtys int
+}
+
+func (s *dirtyScreen) Draw(frameBuffer []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.draws++
+}
+
+func (s *dirtyScreen) DrawDirty(frameBuffer []byte, dirty image.Rectangle) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dirtys++
+}
+
+func TestGetCommand_run_drawDirty(t *testing.T) {
+	for _, args := range [][]string{nil, {"--phosphor", "0.5", "--blend", "2"}} {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		s := &dirtyScreen{}
+		c := GetCommand(ctx, s, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+			m := mockAudioPlayer{}
+			m.On("ProcessSound", mock.Anything).Return(nil)
+			return &m, nil
+		})
+		c.SetArgs(append([]string{"run", "--rom", bcChip8TestPath}, args...))
+		_, err := c.ExecuteC()
+		cancel()
+		assert.NoError(t, err)
+		s.lock.Lock()
+		assert.True(t, s.dirtys > 0, "only what changed is drawn through the screens in between, %v", args)
+		assert.Equal(t, 0, s.draws, "%v", args)
+		s.lock.Unlock()
+	}
+}
+
+type lastFrameScreen struct {
+	lock sync.Mutex
+	fb   []byte
+}
+
+func (s *lastFrameScreen) Draw(frameBuffer []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.fb = append(s.fb[:0], frameBuffer...)
+}
+
+func TestGetCommand_run_wrap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rom := filepath.Join(dir, "edge.ch8")
+	// Draw the 0 of the font at 62, 0 and loop
+	assert.NoError(t, ioutil.WriteFile(rom, []byte{0x60, 0x3E, 0x61, 0x00, 0xA0, 0x00, 0xD0, 0x15, 0x12, 0x08}, 0644))
+
+	for _, wrap := range []bool{false, true} {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		s := &lastFrameScreen{}
+		c := GetCommand(ctx, s, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+			m := mockAudioPlayer{}
+			m.On("ProcessSound", mock.Anything).Return(nil)
+			return &m, nil
+		})
+		args := []string{"run", "--rom", rom}
+		if wrap {
+			args = append(args, "--wrap")
+		}
+		c.SetArgs(args)
+		_, err = c.ExecuteC()
+		cancel()
+		assert.NoError(t, err)
+		s.lock.Lock()
+		assert.Equal(t, byte(1), s.fb[62])
+		assert.Equal(t, wrap, s.fb[0] == 1, "wrapped to the left edge")
+		s.lock.Unlock()
+	}
+}
+
+func TestGetCommand_serve(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := &countingScreen{}
+	c := GetCommand(ctx, s, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	c.SetArgs([]string{"serve", "--rom", bcChip8TestPath, "--addr", addr})
+	done := make(chan error)
+	go func() {
+		_, err := c.ExecuteC()
+		done <- err
+	}()
+
+	var conn *websocket.Conn
+	for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if conn, _, err = websocket.DefaultDialer.Dial("ws://"+addr+"/ws", nil); err == nil {
+			break
+		}
+	}
+	if !assert.NoError(t, err, "serving") {
+		return
+	}
+	defer conn.Close()
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 64, 32}, msg[:3], "a frame of the rom")
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 0, s.draws, "the web frontend is used")
+}
+
+func TestGetCommand_run_vnc(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := &countingScreen{}
+	c := GetCommand(ctx, s, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	c.SetArgs([]string{"run", "--rom", bcChip8TestPath, "--frontend", "vnc", "--addr", addr})
+	done := make(chan error)
+	go func() {
+		_, err := c.ExecuteC()
+		done <- err
+	}()
+
+	var conn net.Conn
+	for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+	}
+	if !assert.NoError(t, err, "serving") {
+		return
+	}
+	defer conn.Close()
+	assert.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	version := make([]byte, 12)
+	_, err = io.ReadFull(conn, version)
+	assert.NoError(t, err)
+	assert.Equal(t, "RFB 003.008\n", string(version))
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 0, s.draws, "the vnc frontend is used")
+}
+
+func TestGetCommand_run_control(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c := GetCommand(ctx, &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	c.SetArgs([]string{"run", "--rom", bcChip8TestPath, "--control", "tcp:" + addr})
+	done := make(chan error)
+	go func() {
+		_, err := c.ExecuteC()
+		done <- err
+	}()
+
+	var conn net.Conn
+	for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+	}
+	if !assert.NoError(t, err, "listening") {
+		cancel()
+		<-done
+		return
+	}
+	defer conn.Close()
+	assert.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.WriteString(conn, `{"jsonrpc":"2.0","id":1,"method":"pause"}`+"\n")
+	assert.NoError(t, err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Contains(t, line, `"paused":true`)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestRunOptions_vncOptions(t *testing.T) {
+	t.Parallel()
+	o := &runOptions{romPath: "roms/pong.ch8", keymap: tty.DefaultKeymap, palette: "amber", scale: 3}
+	vo, err := o.vncOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, vo.Scale)
+	assert.Equal(t, "pong.ch8", vo.Name)
+	assert.Equal(t, display.Presets["amber"], vo.Palette)
+	assert.Equal(t, byte(0xF), vo.Keymap['v'])
+
+	assert.Equal(t, "127.0.0.1:5900", o.listenAddr("127.0.0.1:5900"))
+	o.addr = ":5901"
+	assert.Equal(t, ":5901", o.listenAddr("127.0.0.1:5900"))
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/selftest"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newSelftestCommand() *cobra.Command {
+	var update bool
+	c := &cobra.Command{
+		Use:   "selftest [dir]",
+		Short: "Check that the test roms in a directory pass",
+		Long: "Check that the test roms in a directory, test/roms by default, pass. Each rom has a manifest " +
+			"next to it, BC_test.test.json for BC_test.ch8, that gives the quirks to run it with, the " +
+			"instructions to execute, the keys to press and the screen it should leave, as text or a " +
+			"SHA-256 of the frame buffer. A table of which passed is printed, then how the screens of " +
+			"those that failed differ from what was expected.",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "test/roms"
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			paths, err := selftest.Find(dir)
+			if err != nil {
+				return err
+			}
+			if level := log.GetLevel(); level > log.WarnLevel {
+				// Every instruction is logged otherwise
+				log.SetLevel(log.WarnLevel)
+				defer log.SetLevel(level)
+			}
+			var results []selftest.Result
+			for _, path := range paths {
+				m, err := selftest.Load(path)
+				if err != nil {
+					return err
+				}
+				r := selftest.Run(m)
+				if update && r.Err == nil && !r.Passed() {
+					r.Update()
+					if err = m.Save(); err != nil {
+						return err
+					}
+					log.Warnf("Updated '%s'", path)
+				}
+				results = append(results, r)
+			}
+			if err = selftest.Report(cmd.OutOrStdout(), results); err != nil {
+				return err
+			}
+			failed := 0
+			for _, r := range results {
+				if !r.Passed() {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d roms failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+	c.Flags().BoolVar(&update, "update", false, "Update the manifests of roms that ran to the end to expect the screens they left")
+	return c
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelftestCommand(t *testing.T) {
+	c := newSelftestCommand()
+	var out bytes.Buffer
+	c.SetOutput(&out)
+	c.SetArgs([]string{"../../../test/roms"})
+	assert.NoError(t, c.Execute())
+	assert.Contains(t, out.String(), "BC_test.ch8  300     pass")
+}
+
+func TestSelftestCommand_fail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selftest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// Draw the 0 of the font, jump to itself
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "zero.ch8"), []byte{0xD0, 0x05, 0x12, 0x02}, 0644))
+	blank := `"` + strings.Repeat(".", 64) + `"`
+	screen := strings.Repeat(blank+",", 31) + blank
+	manifest := filepath.Join(dir, "zero.test.json")
+	assert.NoError(t, ioutil.WriteFile(manifest, []byte(`{"cycles": 10, "screen": [`+screen+`]}`), 0644))
+
+	c := newSelftestCommand()
+	var out bytes.Buffer
+	c.SetOutput(&out)
+	c.SetArgs([]string{dir})
+	assert.EqualError(t, c.Execute(), "1 of 1 roms failed")
+	assert.Contains(t, out.String(), "zero.ch8  10      FAIL\n")
+	assert.Contains(t, out.String(), "\n-"+strings.Repeat(".", 64)+"\n+####"+strings.Repeat(".", 60)+"\n")
+
+	c = newSelftestCommand()
+	c.SetOutput(&out)
+	c.SetArgs([]string{dir, "--update"})
+	assert.NoError(t, c.Execute())
+	b, err := ioutil.ReadFile(manifest)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"####`+strings.Repeat(".", 60)+`"`)
+}
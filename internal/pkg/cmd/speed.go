@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// speedsFile is the file of speeds looked for next to a rom.
+const speedsFile = "speeds.txt"
+
+// checkSpeed checks the flags that set how fast the rom runs.
+func (o *runOptions) checkSpeed() error {
+	switch {
+	case o.ipf < 0:
+		return fmt.Errorf("invalid ipf %d", o.ipf)
+	case o.ips < 0:
+		return fmt.Errorf("invalid ips %d", o.ips)
+	case o.ipf > 0 && o.ips > 0:
+		return fmt.Errorf("only one of --ipf and --ips can be set")
+	case o.catchUp < 1:
+		return fmt.Errorf("invalid catch-up %d", o.catchUp)
+	}
+	return nil
+}
+
+// speed returns how many instructions a second to run rom at, as the flags
+// say or else as its speeds file recommends.
+func (o *runOptions) speed(rom []byte) (ips int, err error) {
+	if o.ipf > 0 {
+		return o.ipf * defaultSixtyHz, nil
+	}
+	if o.ips > 0 {
+		return o.ips, nil
+	}
+	ipf, path, err := romSpeed(o.speedsPath, o.romPath, rom)
+	if err != nil || ipf == 0 {
+		return defaultSOneHundredHz, err
+	}
+	log.Infof("Running %d instructions a frame as '%s' recommends", ipf, path)
+	return ipf * defaultSixtyHz, nil
+}
+
+// romSpeed returns the instructions a frame the speeds file at path, or
+// else the one next to the rom at romPath, recommends for rom, and the
+// path of the file. ipf is 0 when there is no file or it has no speed for
+// rom.
+func romSpeed(path, romPath string, rom []byte) (ipf int, from string, err error) {
+	if path == "" {
+		path = filepath.Join(filepath.Dir(romPath), speedsFile)
+		if _, err = os.Stat(path); err != nil {
+			return 0, "", nil
+		}
+	}
+	speeds, err := loadSpeeds(path)
+	if err != nil {
+		return 0, path, err
+	}
+	sum := sha1.Sum(rom)
+	if ipf, ok := speeds[hex.EncodeToString(sum[:])]; ok {
+		return ipf, path, nil
+	}
+	return speeds[filepath.Base(romPath)], path, nil
+}
+
+// loadSpeeds reads a file of the speeds recommended for roms, a line each of
+// the file name or SHA-1 of a rom and how many instructions to run it at a
+// frame, and comments after a #:
+//
+//	# Paddles are too fast any faster
+//	pong.ch8 7
+//	a9e4ba4d8e06c2ec9b28a8ad6da2ee64ac03a1c6 15
+func loadSpeeds(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	speeds := make(map[string]int)
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d of '%s' must be a rom and its instructions a frame", n, path)
+		}
+		ipf, err := strconv.Atoi(fields[1])
+		if err != nil || ipf < 1 {
+			return nil, fmt.Errorf("invalid instructions a frame '%s' on line %d of '%s'", fields[1], n, path)
+		}
+		rom := fields[0]
+		if _, err := hex.DecodeString(rom); err == nil && len(rom) == 2*sha1.Size {
+			rom = strings.ToLower(rom)
+		}
+		speeds[rom] = ipf
+	}
+	return speeds, s.Err()
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSpeeds(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "speeds")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(src string) string {
+		f, err := ioutil.TempFile(dir, "speeds")
+		assert.NoError(t, err)
+		_, err = f.WriteString(src)
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		return f.Name()
+	}
+
+	path := write("# Speeds\n\npong.ch8 7 # too fast any faster\nA9E4BA4D8E06C2EC9B28A8AD6DA2EE64AC03A1C6\t15\n")
+	speeds, err := loadSpeeds(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"pong.ch8": 7, "a9e4ba4d8e06c2ec9b28a8ad6da2ee64ac03a1c6": 15}, speeds)
+
+	path = write("pong.ch8\n")
+	_, err = loadSpeeds(path)
+	assert.EqualError(t, err, "line 1 of '"+path+"' must be a rom and its instructions a frame")
+	path = write("\npong.ch8 fast\n")
+	_, err = loadSpeeds(path)
+	assert.EqualError(t, err, "invalid instructions a frame 'fast' on line 2 of '"+path+"'")
+	path = write("pong.ch8 0\n")
+	_, err = loadSpeeds(path)
+	assert.EqualError(t, err, "invalid instructions a frame '0' on line 1 of '"+path+"'")
+}
+
+func TestRunOptions_speed(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "speeds")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rom := []byte{0x12, 0x00}
+	sum := sha1.Sum(rom)
+	romPath := filepath.Join(dir, "loop.ch8")
+	other := filepath.Join(dir, "other.ch8")
+	speeds := filepath.Join(dir, "fast.txt")
+	assert.NoError(t, ioutil.WriteFile(speeds, []byte("loop.ch8 20\n"), 0644))
+
+	testCases := []struct {
+		name string
+		o    runOptions
+		rom  []byte
+		ips  int
+	}{
+		{"default", runOptions{romPath: romPath}, nil, 100},
+		{"ipf", runOptions{romPath: romPath, ipf: 10}, rom, 600},
+		{"ips", runOptions{romPath: romPath, ips: 500}, rom, 500},
+		{"speeds file", runOptions{romPath: romPath, speedsPath: speeds}, rom, 1200},
+		{"not in speeds file", runOptions{romPath: other, speedsPath: speeds}, rom, 100},
+		{"flags first", runOptions{romPath: romPath, speedsPath: speeds, ipf: 3}, rom, 180},
+		{"next to the rom by name", runOptions{romPath: filepath.Join(dir, "pong.ch8")}, nil, 420},
+		{"next to the rom by sha1", runOptions{romPath: other}, rom, 900},
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, speedsFile), []byte("pong.ch8 7\n"+hex.EncodeToString(sum[:])+" 15\n"), 0644))
+	for _, tc := range testCases {
+		ips, err := tc.o.speed(tc.rom)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.ips, ips, tc.name)
+	}
+
+	o := runOptions{romPath: romPath, speedsPath: filepath.Join(dir, "missing.txt")}
+	_, err = o.speed(rom)
+	assert.Error(t, err, "a speeds file given must be there")
+}
+
+func TestGetCommand_speedsError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "speeds")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	speeds := filepath.Join(dir, "speeds.txt")
+	assert.NoError(t, ioutil.WriteFile(speeds, []byte("BC_test.ch8 fast\n"), 0644))
+
+	for _, args := range [][]string{nil, {"--headless", "--frames", "1"}} {
+		c := GetCommand(context.Background(), &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+			return &mockAudioPlayer{}, nil
+		})
+		c.SetOutput(&bytes.Buffer{})
+		c.SetArgs(append([]string{"--rom", bcChip8TestPath, "--speeds", speeds}, args...))
+		_, err = c.ExecuteC()
+		assert.EqualError(t, err, "invalid instructions a frame 'fast' on line 1 of '"+speeds+"'", "%v", args)
+	}
+}
+
+func TestRunOptions_checkSpeed(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		o   runOptions
+		err string
+	}{
+		{runOptions{catchUp: 4}, ""},
+		{runOptions{ipf: 10, catchUp: 1}, ""},
+		{runOptions{ipf: -1, catchUp: 4}, "invalid ipf -1"},
+		{runOptions{ips: -1, catchUp: 4}, "invalid ips -1"},
+		{runOptions{ipf: 10, ips: 600, catchUp: 4}, "only one of --ipf and --ips can be set"},
+		{runOptions{catchUp: 0}, "invalid catch-up 0"},
+	}
+	for _, tc := range testCases {
+		err := tc.o.checkSpeed()
+		if tc.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.err)
+		}
+	}
+}
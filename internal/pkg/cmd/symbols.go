@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/symbols"
+	log "github.com/sirupsen/logrus"
+)
+
+// loadSymbols loads the symbol table at path or, when path is blank, the
+// one next to the ROM at romPath if there is one.
+func loadSymbols(path, romPath string) (*symbols.Table, error) {
+	if path != "" {
+		return symbols.Load(path)
+	}
+	t, path, err := symbols.LoadSidecar(romPath)
+	if path != "" && err == nil {
+		log.Infof("Loaded %d symbols from '%s'", t.Len(), path)
+	}
+	return t, err
+}
+
+// loadSymbols reads the symbols of the rom, from --labels or else the file
+// next to it, for traces and profiles to name addresses with and for users
+// to give addresses by name.
+func (o *runOptions) loadSymbols() (err error) {
+	if o.syms, err = loadSymbols(o.labelsPath, o.romPath); err != nil {
+		return fmt.Errorf("could not read symbols for '%s': %v", o.romPath, err)
+	}
+	return nil
+}
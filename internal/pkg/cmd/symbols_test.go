@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSymbols(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "symbols")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rom := filepath.Join(dir, "game.ch8")
+	labels := filepath.Join(dir, "labels.txt")
+	assert.NoError(t, ioutil.WriteFile(labels, []byte("0x2A4 draw_player\n"), 0644))
+
+	s, err := loadSymbols("", rom)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, s.Len(), "no sidecar")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "game.sym"), []byte(":const start 0x200\n"), 0644))
+	s, err = loadSymbols("", rom)
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint16]string{0x200: "start"}, s.Labels())
+
+	s, err = loadSymbols(labels, rom)
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint16]string{0x2A4: "draw_player"}, s.Labels(), "the flag wins over the sidecar")
+
+	_, err = loadSymbols(filepath.Join(dir, "missing.sym"), rom)
+	assert.Error(t, err)
+}
+
+func TestGetCommand_labelsError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "symbols")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	labels := filepath.Join(dir, "labels.txt")
+	assert.NoError(t, ioutil.WriteFile(labels, []byte("draw_player\n"), 0644))
+
+	for _, args := range [][]string{nil, {"--headless", "--frames", "1"}} {
+		c := GetCommand(context.Background(), &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+			return &mockAudioPlayer{}, nil
+		})
+		c.SetOutput(&bytes.Buffer{})
+		c.SetArgs(append([]string{"--rom", bcChip8TestPath, "--labels", labels}, args...))
+		_, err = c.ExecuteC()
+		assert.EqualError(t, err, "could not read symbols for '"+bcChip8TestPath+"': "+labels+": line 1: expected an address and a name", "%v", args)
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/trace"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// exitTracesDiverge is the exit status of trace-diff when the traces
+// disagree, for scripts to tell from them failing to be read.
+const exitTracesDiverge = 1
+
+// openTrace creates a trace writer for path, the returned function flushes
+// and closes it.
+func openTrace(path string, f trace.Filter) (w *trace.Writer, closeTrace func(), err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return w, closeTrace, err
+	}
+	w = trace.NewWriter(file, f)
+	return w, func() {
+		if err := w.Flush(); err != nil {
+			log.WithError(err).Errorf("Could not write trace file '%s'", path)
+		}
+		if err := file.Close(); err != nil {
+			log.WithError(err).Errorf("Could not close trace file '%s'", path)
+		}
+	}, err
+}
+
+func newTraceDiffCommand() *cobra.Command {
+	var context int
+	c := &cobra.Command{
+		Use:          "trace-diff <a.jsonl> <b.jsonl>",
+		Short:        "Find the first instruction two traces disagree on",
+		Long:         "Find the first instruction two traces written with --trace disagree on and show the instructions leading up to it. Exits with status 1 when they disagree.",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer a.Close()
+			b, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer b.Close()
+			d, err := trace.Diff(a, b, context)
+			if err != nil {
+				return err
+			}
+			if d == nil {
+				fmt.Fprintln(cmd.OutOrStdout(), "traces are the same")
+				return nil
+			}
+			fmt.Fprint(cmd.OutOrStdout(), d)
+			cmd.SilenceErrors, cmd.SilenceUsage = true, true
+			return &ExitError{Code: exitTracesDiverge, Reason: "traces diverge"}
+		},
+	}
+	c.Flags().IntVarP(&context, "context", "c", 5, "Number of instructions to show before the divergence")
+	return c
+}
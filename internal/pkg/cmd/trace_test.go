@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetCommand_trace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	c := GetCommand(ctx, &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	c.SetArgs([]string{"--rom", bcChip8TestPath, "--trace", path, "--trace-from", "0x202"})
+	_, err = c.ExecuteC()
+	assert.NoError(t, err)
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	d := json.NewDecoder(f)
+	var first trace.Entry
+	assert.NoError(t, d.Decode(&first))
+	assert.Equal(t, uint64(1), first.Cycle, "0x200 is filtered out")
+	assert.Equal(t, uint16(0x202), first.PC)
+	assert.Equal(t, "v3 := 0x00", first.Mnemonic)
+}
+
+func TestGetCommand_instrumentErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "missing", "out")
+
+	testCases := []struct {
+		flag string
+		err  string
+	}{
+		{"--trace", "could not create trace file '" + path + "': open " + path + ": no such file or directory"},
+		{"--coverage", "could not create coverage file '" + path + "': open " + path + ": no such file or directory"},
+		{"--profile", "could not create profile '" + path + "': open " + path + ": no such file or directory"},
+	}
+	for _, tc := range testCases {
+		for _, args := range [][]string{nil, {"--headless", "--frames", "1"}} {
+			c := GetCommand(context.Background(), &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+				return &mockAudioPlayer{}, nil
+			})
+			c.SetOutput(&bytes.Buffer{})
+			c.SetArgs(append([]string{"--rom", bcChip8TestPath, tc.flag, path}, args...))
+			_, err = c.ExecuteC()
+			assert.EqualError(t, err, tc.err, "%s %v", tc.flag, args)
+		}
+	}
+}
+
+func TestTraceDiffCommand(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "trace-diff")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	a := writeTrace(t, filepath.Join(dir, "a.jsonl"), 0x200, 0x202, 0x204)
+	b := writeTrace(t, filepath.Join(dir, "b.jsonl"), 0x200, 0x202, 0x206)
+
+	c := newTraceDiffCommand()
+	out := &bytes.Buffer{}
+	c.SetOutput(out)
+	c.SetArgs([]string{a, b, "--context", "1"})
+	err = c.Execute()
+	assert.Equal(t, &ExitError{Code: exitTracesDiverge, Reason: "traces diverge"}, err)
+	assert.Contains(t, out.String(), "traces diverge at line 3 (pc)\n  #1 0x202")
+	assert.NotContains(t, out.String(), "Usage:")
+	assert.NotContains(t, out.String(), "Error:")
+
+	c = newTraceDiffCommand()
+	out = &bytes.Buffer{}
+	c.SetOutput(out)
+	c.SetArgs([]string{a, a})
+	err = c.Execute()
+	assert.NoError(t, err)
+	assert.Equal(t, "traces are the same\n", out.String())
+}
+
+func writeTrace(t *testing.T, path string, pcs ...uint16) string {
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	w := trace.NewWriter(f, trace.Filter{})
+	for c, pc := range pcs {
+		w.Trace(cpu.Step{Cycle: uint64(c), PC: pc})
+	}
+	assert.NoError(t, w.Flush())
+	return path
+}
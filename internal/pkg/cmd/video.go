@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/carlosroman/go-chip-8/pkg/record"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+)
+
+// video writes what is shown and heard each emulated frame as a Y4M stream
+// and a WAV file, either of which can be left out.
+type video struct {
+	y4m     *record.Y4M
+	wav     *record.WAV
+	files   []*os.File
+	sample  []byte
+	silence []byte
+}
+
+// openVideo creates the files of the video, a Y4M path of - being written
+// to stdout.
+func openVideo(stdout io.Writer, o *runOptions, p display.Palette) (v *video, err error) {
+	v = &video{sample: generateSample()}
+	v.silence = make([]byte, len(v.sample))
+	defer func() {
+		if err != nil {
+			_ = v.Close()
+		}
+	}()
+	switch o.y4mPath {
+	case "":
+	case "-":
+		v.y4m = record.NewY4M(stdout, o.recordScale, p)
+	default:
+		f, err := os.Create(o.y4mPath)
+		if err != nil {
+			return v, err
+		}
+		v.files = append(v.files, f)
+		v.y4m = record.NewY4M(f, o.recordScale, p)
+	}
+	if o.wavPath != "" {
+		f, err := os.Create(o.wavPath)
+		if err != nil {
+			return v, err
+		}
+		v.files = append(v.files, f)
+		if v.wav, err = record.NewWAV(f, sampleRate); err != nil {
+			return v, err
+		}
+	}
+	return v, err
+}
+
+// frame writes a frame of video and the 60th of a second of sound that
+// goes with it, the tone the sound card plays when the sound timer is set.
+func (v *video) frame(sound byte, frameBuffer []byte) error {
+	if v.y4m != nil {
+		if err := v.y4m.WriteFrame(frameBuffer); err != nil {
+			return err
+		}
+	}
+	if v.wav != nil {
+		s := v.silence
+		if sound > 0 {
+			s = v.sample
+		}
+		if _, err := v.wav.Write(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close fills in the WAV header and closes the files.
+func (v *video) Close() (err error) {
+	if v.wav != nil {
+		err = v.wav.Close()
+	}
+	for _, f := range v.files {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// framePlayer is an AudioPlayer that calls frame before passing on what
+// the sound timer is set to. The timer sends it once each emulated frame,
+// so what is recorded keeps time however fast the emulator runs.
+type framePlayer struct {
+	next  AudioPlayer
+	frame func(sound byte) error
+}
+
+func (f *framePlayer) ProcessSound(soundChan <-chan byte) (err error) {
+	out := make(chan byte, cap(soundChan))
+	done := make(chan error, 1)
+	go func() {
+		done <- f.next.ProcessSound(out)
+	}()
+	recording := true
+	for b := range soundChan {
+		if recording {
+			if err := f.frame(b); err != nil {
+				log.WithError(err).Error("Could not record frame, stopped recording")
+				recording = false
+			}
+		}
+		out <- b
+	}
+	close(out)
+	return <-done
+}
+
+// videoSoundCard returns what gets the sound card of a run that writes
+// frames to v too.
+func videoSoundCard(getSoundCard func() (ap AudioPlayer, err error), v *video, frame func() []byte) func() (ap AudioPlayer, err error) {
+	return func() (ap AudioPlayer, err error) {
+		if ap, err = getSoundCard(); err != nil {
+			return ap, err
+		}
+		return &framePlayer{next: ap, frame: func(sound byte) error {
+			return v.frame(sound, frame())
+		}}, nil
+	}
+}
+
+// checkVideo checks the video can be written with the frontend.
+func (o *runOptions) checkVideo() error {
+	if o.y4mPath == "-" && o.frontend != "" {
+		return fmt.Errorf("can't write video to stdout with the %s frontend", o.frontend)
+	}
+	return nil
+}
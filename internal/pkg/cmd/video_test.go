@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetCommand_video(t *testing.T) {
+	dir, err := ioutil.TempDir("", "video")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	wav := filepath.Join(dir, "sound.wav")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	c := GetCommand(ctx, &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		m := mockAudioPlayer{}
+		m.On("ProcessSound", mock.Anything).Return(nil)
+		return &m, nil
+	})
+	var out bytes.Buffer
+	c.SetOutput(&out)
+	c.SetArgs([]string{"--rom", bcChip8TestPath, "--y4m", "-", "--wav", wav, "--record-scale", "1"})
+	_, err = c.ExecuteC()
+	assert.NoError(t, err)
+
+	header := "YUV4MPEG2 W64 H32 F60:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n"
+	assert.True(t, strings.HasPrefix(out.String(), header))
+	frames := strings.Count(out.String(), "FRAME\n")
+	assert.True(t, frames > 0)
+	assert.Equal(t, len(header)+frames*(len("FRAME\n")+64*32*3/2), out.Len())
+
+	raw, err := ioutil.ReadFile(wav)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(frames*bufferSize), binary.LittleEndian.Uint32(raw[40:]), "a 60th of a second of sound a frame")
+	assert.Len(t, raw, 44+frames*bufferSize)
+}
+
+func TestGetCommand_video_stdoutWithTty(t *testing.T) {
+	c := GetCommand(context.Background(), &noopScreen{}, cpu.NewKeyboard(), &ctxLoop{}, func() (ap AudioPlayer, err error) {
+		return &mockAudioPlayer{}, nil
+	})
+	c.SetOutput(&bytes.Buffer{})
+	c.SetArgs([]string{"--rom", bcChip8TestPath, "--frontend", "tty", "--y4m", "-"})
+	_, err := c.ExecuteC()
+	assert.EqualError(t, err, "can't write video to stdout with the tty frontend")
+}
+
+type channelPlayer struct {
+	got []byte
+}
+
+func (p *channelPlayer) ProcessSound(soundChan <-chan byte) (err error) {
+	for b := range soundChan {
+		p.got = append(p.got, b)
+	}
+	return errors.New("done")
+}
+
+func TestFramePlayer(t *testing.T) {
+	t.Parallel()
+	next := &channelPlayer{}
+	var frames []byte
+	f := &framePlayer{next: next, frame: func(sound byte) error {
+		frames = append(frames, sound)
+		if len(frames) == 2 {
+			return errors.New("disk full")
+		}
+		return nil
+	}}
+	sc := make(chan byte, 4)
+	sc <- 3
+	sc <- 2
+	sc <- 1
+	close(sc)
+	assert.EqualError(t, f.ProcessSound(sc), "done", "the error of the sound card")
+	assert.Equal(t, []byte{3, 2, 1}, next.got, "all passed on")
+	assert.Equal(t, []byte{3, 2}, frames, "stops recording on an error")
+}
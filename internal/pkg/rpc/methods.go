@@ -0,0 +1,335 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/carlosroman/go-chip-8/pkg/control"
+	"github.com/carlosroman/go-chip-8/pkg/record"
+	"github.com/carlosroman/go-chip-8/pkg/rom"
+	"image/png"
+	"io/ioutil"
+)
+
+// maxStep is the most instructions a step executes, which it does with the
+// controller locked.
+const maxStep = 100000
+
+type stepParams struct {
+	Count int `json:"count"`
+}
+
+type keyParams struct {
+	Key *byte `json:"key"`
+}
+
+type memoryParams struct {
+	Address *uint16 `json:"address"`
+	Length  int     `json:"length"`
+	Data    string  `json:"data"` // Hex, to write
+}
+
+type memoryResult struct {
+	Address uint16 `json:"address"`
+	Data    string `json:"data"`
+}
+
+type fileParams struct {
+	Path  string `json:"path"`
+	Scale int    `json:"scale"`
+	Data  []byte `json:"data"` // Base64, of a state or rom to load
+}
+
+type fileResult struct {
+	Path string `json:"path,omitempty"`
+	Data []byte `json:"data,omitempty"`
+}
+
+type speedParams struct {
+	Speed int `json:"speed"`
+}
+
+type multiplierParams struct {
+	Multiplier *float64 `json:"multiplier"`
+}
+
+type breakpointParams struct {
+	Address *uint16 `json:"address"`
+	Symbol  string  `json:"symbol"` // Instead of the address, a label or an address in hex
+}
+
+type subscribeParams struct {
+	Events []string `json:"events"`
+}
+
+// call calls a method, returning its result or why it failed.
+func (s *Server) call(c *conn, method string, raw json.RawMessage) (interface{}, *Error) {
+	switch method {
+	case "status":
+		return s.c.Status(), nil
+	case "pause":
+		s.c.Pause()
+		return s.c.Status(), nil
+	case "resume":
+		s.c.Resume()
+		return s.c.Status(), nil
+	case "reset":
+		s.c.Reset()
+		return s.c.Status(), nil
+	case "hardReset":
+		if err := s.c.HardReset(); err != nil {
+			return nil, errorf(serverError, "could not reset: %v", err)
+		}
+		return s.c.Status(), nil
+	case "loadRom":
+		var p fileParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if (p.Path == "") == (p.Data == nil) {
+			return nil, errorf(invalidParams, "one of path or data is required")
+		}
+		if err := c.path(p.Path); err != nil {
+			return nil, err
+		}
+		if p.Path != "" {
+			r, err := rom.Load(p.Path, nil)
+			if err != nil {
+				return nil, errorf(serverError, "could not read rom: %v", err)
+			}
+			p.Data = r.Data
+		}
+		if err := s.c.LoadROM(p.Data); err != nil {
+			return nil, errorf(serverError, "could not load rom: %v", err)
+		}
+		return s.c.Status(), nil
+	case "frameAdvance":
+		r, err := s.c.FrameAdvance()
+		if err != nil {
+			return nil, errorf(serverError, "could not advance a frame: %v", err)
+		}
+		return r, nil
+	case "step":
+		p := stepParams{Count: 1}
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if p.Count < 1 {
+			return nil, errorf(invalidParams, "count %d must be at least 1", p.Count)
+		}
+		if p.Count > maxStep {
+			return nil, errorf(invalidParams, "count %d must be at most %d", p.Count, maxStep)
+		}
+		return s.c.Step(p.Count), nil
+	case "pressKey", "releaseKey":
+		var p keyParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if p.Key == nil {
+			return nil, errorf(invalidParams, "key is required")
+		}
+		press := s.c.PressKey
+		if method == "releaseKey" {
+			press = s.c.ReleaseKey
+		}
+		if err := press(*p.Key); err != nil {
+			return nil, errorf(invalidParams, "%v", err)
+		}
+		return true, nil
+	case "registers":
+		return s.c.Registers(), nil
+	case "readMemory":
+		var p memoryParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if p.Address == nil {
+			return nil, errorf(invalidParams, "address is required")
+		}
+		b, err := s.c.ReadMemory(*p.Address, p.Length)
+		if err != nil {
+			return nil, errorf(invalidParams, "%v", err)
+		}
+		return memoryResult{Address: *p.Address, Data: hex.EncodeToString(b)}, nil
+	case "writeMemory":
+		var p memoryParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if p.Address == nil {
+			return nil, errorf(invalidParams, "address is required")
+		}
+		b, err := hex.DecodeString(p.Data)
+		if err != nil {
+			return nil, errorf(invalidParams, "data is not hex: %v", err)
+		}
+		if err = s.c.WriteMemory(*p.Address, b); err != nil {
+			return nil, errorf(invalidParams, "%v", err)
+		}
+		return true, nil
+	case "screenshot":
+		p := fileParams{Scale: s.o.Scale}
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if p.Scale < 1 {
+			return nil, errorf(invalidParams, "scale %d must be at least 1", p.Scale)
+		}
+		var b bytes.Buffer
+		if err := png.Encode(&b, record.Image(s.c.FrameBuffer(), p.Scale, s.o.Palette)); err != nil {
+			return nil, errorf(serverError, "could not encode screenshot: %v", err)
+		}
+		return s.save(c, p.Path, b.Bytes())
+	case "saveState":
+		var p fileParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := s.c.SaveState(&b); err != nil {
+			return nil, errorf(serverError, "could not save state: %v", err)
+		}
+		return s.save(c, p.Path, b.Bytes())
+	case "loadState":
+		var p fileParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if (p.Path == "") == (p.Data == nil) {
+			return nil, errorf(invalidParams, "one of path or data is required")
+		}
+		if err := c.path(p.Path); err != nil {
+			return nil, err
+		}
+		if p.Path != "" {
+			var err error
+			if p.Data, err = ioutil.ReadFile(p.Path); err != nil {
+				return nil, errorf(serverError, "could not read state: %v", err)
+			}
+		}
+		if err := s.c.LoadState(bytes.NewReader(p.Data)); err != nil {
+			return nil, errorf(serverError, "could not load state: %v", err)
+		}
+		return s.c.Status(), nil
+	case "setSpeed":
+		var p speedParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if err := s.c.SetSpeed(p.Speed); err != nil {
+			return nil, errorf(invalidParams, "%v", err)
+		}
+		return s.c.Status(), nil
+	case "setMultiplier":
+		var p multiplierParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if p.Multiplier == nil {
+			return nil, errorf(invalidParams, "multiplier is required")
+		}
+		if err := s.c.SetMultiplier(*p.Multiplier); err != nil {
+			return nil, errorf(invalidParams, "%v", err)
+		}
+		return s.c.Status(), nil
+	case "addBreakpoint", "removeBreakpoint":
+		var p breakpointParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		if (p.Address == nil) == (p.Symbol == "") {
+			return nil, errorf(invalidParams, "one of address or symbol is required")
+		}
+		if p.Symbol != "" {
+			a, err := s.o.Symbols.Resolve(p.Symbol)
+			if err != nil {
+				return nil, errorf(invalidParams, "%v", err)
+			}
+			p.Address = &a
+		}
+		if method == "addBreakpoint" {
+			s.c.AddBreakpoint(*p.Address)
+		} else {
+			s.c.RemoveBreakpoint(*p.Address)
+		}
+		return s.c.Breakpoints(), nil
+	case "breakpoints":
+		return s.c.Breakpoints(), nil
+	case "subscribe":
+		var p subscribeParams
+		if err := params(raw, &p); err != nil {
+			return nil, err
+		}
+		types := make(map[string]bool)
+		for _, t := range p.Events {
+			if t != control.Breakpoint && t != control.Sound && t != control.Halted && t != control.Waiting {
+				return nil, errorf(invalidParams, "unknown event '%s'", t)
+			}
+			types[t] = true
+		}
+		s.subscribe(c, types)
+		return true, nil
+	case "unsubscribe":
+		c.lock.Lock()
+		unsubscribe := c.unsubscribe
+		c.unsubscribe = nil
+		c.lock.Unlock()
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+		return true, nil
+	}
+	return nil, errorf(methodNotFound, "method '%s' not found", method)
+}
+
+// path checks that the client may use a file at path, when there is one.
+func (c *conn) path(path string) *Error {
+	if path != "" && !c.files {
+		return errorf(invalidParams, "path is only allowed over a Unix domain socket, send data instead")
+	}
+	return nil
+}
+
+// save writes b to path, or returns it when there is no path.
+func (s *Server) save(c *conn, path string, b []byte) (interface{}, *Error) {
+	if path == "" {
+		return fileResult{Data: b}, nil
+	}
+	if err := c.path(path); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return nil, errorf(serverError, "could not write '%s': %v", path, err)
+	}
+	return fileResult{Path: path}, nil
+}
+
+// subscribe sends the client the events of the types given, or of every
+// type when none are given, instead of those it subscribed to before.
+func (s *Server) subscribe(c *conn, types map[string]bool) {
+	events, unsubscribe := s.c.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case e := <-events:
+				if len(types) == 0 || types[e.Type] {
+					c.write(notification{JSONRPC: "2.0", Method: "event", Params: e})
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	c.lock.Lock()
+	previous := c.unsubscribe
+	c.unsubscribe = func() {
+		unsubscribe()
+		close(done)
+	}
+	c.lock.Unlock()
+	if previous != nil {
+		previous()
+	}
+}
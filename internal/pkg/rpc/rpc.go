@@ -0,0 +1,225 @@
+// Package rpc serves a JSON-RPC 2.0 endpoint to automate a running
+// emulator, one request or response per line of a Unix domain socket or TCP
+// connection. Anyone who can connect to a TCP port can send requests, so
+// files are only read and written by path over a Unix domain socket, which
+// its permissions protect, and sent as data over TCP.
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/control"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/carlosroman/go-chip-8/pkg/symbols"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Codes of errors, as JSON-RPC 2.0 defines them.
+const (
+	parseError     = -32700
+	invalidRequest = -32600
+	methodNotFound = -32601
+	invalidParams  = -32602
+	serverError    = -32000
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// Error is the error of a request that failed.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func errorf(code int, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// Options configure a Server.
+type Options struct {
+	Scale   int // Size of a pixel of screenshots
+	Palette display.Palette
+	Symbols *symbols.Table // Names breakpoints can be added at
+}
+
+// Server serves the methods of a controller to whoever connects.
+type Server struct {
+	c *control.Controller
+	o Options
+}
+
+func New(c *control.Controller, o Options) *Server {
+	if o.Scale < 1 {
+		o.Scale = 1
+	}
+	return &Server{c: c, o: o}
+}
+
+// Listen listens on addr, unix:PATH for a Unix domain socket or
+// tcp:HOST:PORT.
+func Listen(addr string) (net.Listener, error) {
+	i := strings.Index(addr, ":")
+	if i < 0 || addr[i+1:] == "" || (addr[:i] != "unix" && addr[:i] != "tcp") {
+		return nil, fmt.Errorf("control address '%s' must be unix:PATH or tcp:HOST:PORT", addr)
+	}
+	network, address := addr[:i], addr[i+1:]
+	if network == "unix" {
+		// Left behind by an emulator that did not stop cleanly
+		if fi, err := os.Stat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(address)
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// Serve serves everyone that connects to l until ctx is done.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	files := l.Addr().Network() == "unix"
+	conns := make(map[net.Conn]struct{})
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+		lock.Lock()
+		defer lock.Unlock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		lock.Lock()
+		conns[conn] = struct{}{}
+		lock.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serve(conn, files)
+			lock.Lock()
+			defer lock.Unlock()
+			delete(conns, conn)
+		}()
+	}
+}
+
+// conn is a connection to a client, which writes one line at a time.
+type conn struct {
+	lock        sync.Mutex
+	w           io.Writer
+	files       bool // Whether the client may read and write files by path
+	unsubscribe func()
+}
+
+func (c *conn) write(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.WithError(err).Error("Could not encode response")
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, err = c.w.Write(append(b, '\n')); err != nil {
+		log.WithError(err).Debug("Could not write response")
+	}
+}
+
+// serve answers the requests of a client until it disconnects, letting it
+// read and write files by path when files is true.
+func (s *Server) serve(rw io.ReadWriteCloser, files bool) {
+	defer func() { _ = rw.Close() }()
+	c := &conn{w: rw, files: files}
+	defer func() {
+		if c.unsubscribe != nil {
+			c.unsubscribe()
+		}
+	}()
+	r := bufio.NewReader(rw)
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			s.handle(c, line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a request, unless it is a notification.
+func (s *Server) handle(c *conn, line []byte) {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		c.write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: errorf(parseError, "could not parse request: %v", err)})
+		return
+	}
+	if req.ID == nil {
+		req.ID = json.RawMessage("null")
+		if req.JSONRPC == "2.0" && req.Method != "" {
+			// A notification, which is not answered
+			_, _ = s.call(c, req.Method, req.Params)
+			return
+		}
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		c.write(response{JSONRPC: "2.0", ID: req.ID, Error: errorf(invalidRequest, "request must have jsonrpc 2.0 and a method")})
+		return
+	}
+	result, err := s.call(c, req.Method, req.Params)
+	if err != nil {
+		c.write(response{JSONRPC: "2.0", ID: req.ID, Error: err})
+		return
+	}
+	c.write(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+// params decodes the params of a request into v, which may be left as it
+// is when there are none.
+func params(raw json.RawMessage, v interface{}) *Error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return errorf(invalidParams, "invalid params: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/carlosroman/go-chip-8/pkg/control"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/carlosroman/go-chip-8/pkg/symbols"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type screenMock struct{}
+
+func (s *screenMock) Draw(frameBuffer []byte) {}
+
+// client talks to a server over a pipe.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newClient connects to a server of a paused CPU that runs program, as if
+// over a Unix domain socket.
+func newClient(t *testing.T, program []byte) (*client, *control.Controller) {
+	m := state.InitMemory()
+	copy(m[0x200:], program)
+	k := cpu.NewKeyboard()
+	c := cpu.NewCPU(m, rand.New(rand.NewSource(42)), k, cpu.NewTimer(make(chan byte, 60)), &screenMock{})
+	ctl := control.New(c, k, control.Options{ROM: program, Present: c.VBlank})
+	ctl.Pause()
+	s := New(ctl, Options{Palette: display.DefaultPalette, Symbols: symbols.New(map[uint16]string{0x300: "draw_player"})})
+	server, conn := net.Pipe()
+	go s.serve(server, true)
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}, ctl
+}
+
+func (c *client) send(line string) {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := c.conn.Write([]byte(line + "\n"))
+	assert.NoError(c.t, err)
+}
+
+// receive returns the next message from the server.
+func (c *client) receive() map[string]interface{} {
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.r.ReadBytes('\n')
+	if !assert.NoError(c.t, err) {
+		return nil
+	}
+	var m map[string]interface{}
+	assert.NoError(c.t, json.Unmarshal(line, &m))
+	return m
+}
+
+// call sends a request and returns its response.
+func (c *client) call(line string) map[string]interface{} {
+	c.send(line)
+	return c.receive()
+}
+
+func TestServer_methods(t *testing.T) {
+	t.Parallel()
+	// V0 = 5, V0 += 1, jump to itself
+	c, _ := newClient(t, []byte{0x60, 0x05, 0x70, 0x01, 0x12, 0x04})
+	defer c.conn.Close()
+
+	assert.Equal(t, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1.0,
+		"result":  map[string]interface{}{"paused": true, "pc": float64(0x200), "cycle": 0.0, "speed": 100.0, "multiplier": 1.0},
+	}, c.call(`{"jsonrpc":"2.0","id":1,"method":"status"}`))
+
+	r := c.call(`{"jsonrpc":"2.0","id":"a","method":"step","params":{"count":2}}`)
+	assert.Equal(t, "a", r["id"])
+	regs := r["result"].(map[string]interface{})
+	assert.Equal(t, float64(0x204), regs["pc"])
+	assert.Equal(t, 6.0, regs["v"].([]interface{})[0])
+
+	assert.Equal(t, map[string]interface{}{"address": float64(0x200), "data": "60057001"},
+		c.call(`{"jsonrpc":"2.0","id":2,"method":"readMemory","params":{"address":512,"length":4}}`)["result"])
+	assert.Equal(t, true, c.call(`{"jsonrpc":"2.0","id":3,"method":"writeMemory","params":{"address":513,"data":"2a"}}`)["result"])
+	c.call(`{"jsonrpc":"2.0","id":4,"method":"reset"}`)
+	regs = c.call(`{"jsonrpc":"2.0","id":5,"method":"step"}`)["result"].(map[string]interface{})
+	assert.Equal(t, 42.0, regs["v"].([]interface{})[0])
+
+	assert.Equal(t, []interface{}{float64(0x202), float64(0x300)}, func() interface{} {
+		c.call(`{"jsonrpc":"2.0","id":6,"method":"addBreakpoint","params":{"address":768}}`)
+		return c.call(`{"jsonrpc":"2.0","id":7,"method":"addBreakpoint","params":{"address":514}}`)["result"]
+	}())
+	assert.Equal(t, []interface{}{float64(0x202)}, c.call(`{"jsonrpc":"2.0","id":8,"method":"removeBreakpoint","params":{"address":768}}`)["result"])
+	assert.Equal(t, []interface{}{float64(0x202), float64(0x300)}, c.call(`{"jsonrpc":"2.0","id":8,"method":"addBreakpoint","params":{"symbol":"draw_player"}}`)["result"])
+	assert.Equal(t, []interface{}{float64(0x300)}, c.call(`{"jsonrpc":"2.0","id":8,"method":"removeBreakpoint","params":{"symbol":"0x202"}}`)["result"])
+
+	assert.Equal(t, 250.0, c.call(`{"jsonrpc":"2.0","id":9,"method":"setSpeed","params":{"speed":250}}`)["result"].(map[string]interface{})["speed"])
+	assert.Equal(t, 0.5, c.call(`{"jsonrpc":"2.0","id":12,"method":"setMultiplier","params":{"multiplier":0.5}}`)["result"].(map[string]interface{})["multiplier"])
+	assert.Equal(t, false, c.call(`{"jsonrpc":"2.0","id":10,"method":"resume"}`)["result"].(map[string]interface{})["paused"])
+	assert.Equal(t, true, c.call(`{"jsonrpc":"2.0","id":11,"method":"pause"}`)["result"].(map[string]interface{})["paused"])
+}
+
+func TestServer_state(t *testing.T) {
+	t.Parallel()
+	c, ctl := newClient(t, []byte{0x60, 0x05, 0x70, 0x01, 0x12, 0x04})
+	defer c.conn.Close()
+	ctl.Step(2)
+
+	data := c.call(`{"jsonrpc":"2.0","id":1,"method":"saveState"}`)["result"].(map[string]interface{})["data"].(string)
+	ctl.Reset()
+	r := c.call(`{"jsonrpc":"2.0","id":2,"method":"loadState","params":{"data":"` + data + `"}}`)
+	assert.Equal(t, float64(0x204), r["result"].(map[string]interface{})["pc"])
+
+	dir, err := ioutil.TempDir("", "rpc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state")
+	assert.Equal(t, map[string]interface{}{"path": path},
+		c.call(`{"jsonrpc":"2.0","id":3,"method":"saveState","params":{"path":"` + path + `"}}`)["result"])
+	ctl.Reset()
+	r = c.call(`{"jsonrpc":"2.0","id":4,"method":"loadState","params":{"path":"` + path + `"}}`)
+	assert.Equal(t, float64(0x204), r["result"].(map[string]interface{})["pc"])
+
+	shot := filepath.Join(dir, "shot.png")
+	c.call(`{"jsonrpc":"2.0","id":5,"method":"screenshot","params":{"path":"` + shot + `","scale":2}}`)
+	b, err := ioutil.ReadFile(shot)
+	assert.NoError(t, err)
+	assert.Equal(t, "\x89PNG", string(b[:4]))
+	assert.NotEmpty(t, c.call(`{"jsonrpc":"2.0","id":6,"method":"screenshot"}`)["result"].(map[string]interface{})["data"])
+}
+
+func TestServer_roms(t *testing.T) {
+	t.Parallel()
+	// V0 = 5, V0 += 1, jump to itself
+	c, _ := newClient(t, []byte{0x60, 0x05, 0x70, 0x01, 0x12, 0x04})
+	defer c.conn.Close()
+
+	regs := c.call(`{"jsonrpc":"2.0","id":1,"method":"frameAdvance"}`)["result"].(map[string]interface{})
+	assert.Equal(t, 1.0, regs["cycle"], "100 instructions a second is 1 in the first frame")
+	c.call(`{"jsonrpc":"2.0","id":2,"method":"writeMemory","params":{"address":513,"data":"2a"}}`)
+	assert.Equal(t, float64(0x200), c.call(`{"jsonrpc":"2.0","id":3,"method":"hardReset"}`)["result"].(map[string]interface{})["pc"])
+	assert.Equal(t, "6005", c.call(`{"jsonrpc":"2.0","id":4,"method":"readMemory","params":{"address":512,"length":2}}`)["result"].(map[string]interface{})["data"])
+
+	dir, err := ioutil.TempDir("", "rpc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rom.ch8")
+	assert.NoError(t, ioutil.WriteFile(path, []byte{0x61, 0x07}, 0644))
+	c.call(`{"jsonrpc":"2.0","id":5,"method":"loadRom","params":{"path":"` + path + `"}}`)
+	assert.Equal(t, "6107", c.call(`{"jsonrpc":"2.0","id":6,"method":"readMemory","params":{"address":512,"length":2}}`)["result"].(map[string]interface{})["data"])
+	c.call(`{"jsonrpc":"2.0","id":7,"method":"loadRom","params":{"data":"YgI="}}`)
+	assert.Equal(t, "6202", c.call(`{"jsonrpc":"2.0","id":8,"method":"readMemory","params":{"address":512,"length":2}}`)["result"].(map[string]interface{})["data"])
+}
+
+func TestServer_keys(t *testing.T) {
+	t.Parallel()
+	c, _ := newClient(t, nil)
+	defer c.conn.Close()
+	assert.Equal(t, true, c.call(`{"jsonrpc":"2.0","id":1,"method":"pressKey","params":{"key":10}}`)["result"])
+	assert.Equal(t, true, c.call(`{"jsonrpc":"2.0","id":2,"method":"releaseKey","params":{"key":10}}`)["result"])
+}
+
+func TestServer_events(t *testing.T) {
+	t.Parallel()
+	c, ctl := newClient(t, []byte{0x60, 0x05, 0x70, 0x01, 0x12, 0x04})
+	defer c.conn.Close()
+	ctl.AddBreakpoint(0x202)
+	assert.Equal(t, true, c.call(`{"jsonrpc":"2.0","id":1,"method":"subscribe","params":{"events":["breakpoint"]}}`)["result"])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctl.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	ctl.Resume()
+	assert.Equal(t, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "event",
+		"params":  map[string]interface{}{"type": "breakpoint", "pc": float64(0x202), "cycle": 1.0},
+	}, c.receive())
+
+	// Halted is not subscribed to
+	assert.Equal(t, float64(0x204), c.call(`{"jsonrpc":"2.0","id":2,"method":"step"}`)["result"].(map[string]interface{})["pc"])
+	assert.Equal(t, true, c.call(`{"jsonrpc":"2.0","id":3,"method":"unsubscribe"}`)["result"])
+}
+
+func TestServer_errors(t *testing.T) {
+	t.Parallel()
+	c, _ := newClient(t, nil)
+	defer c.conn.Close()
+	testCases := []struct {
+		name    string
+		request string
+		code    float64
+		message string
+	}{
+		{"parse", `{"jsonrpc":`, parseError, "could not parse request: unexpected end of JSON input"},
+		{"version", `{"jsonrpc":"1.0","id":1,"method":"status"}`, invalidRequest, "request must have jsonrpc 2.0 and a method"},
+		{"method", `{"jsonrpc":"2.0","id":1,"method":"fly"}`, methodNotFound, "method 'fly' not found"},
+		{"unknown param", `{"jsonrpc":"2.0","id":1,"method":"step","params":{"n":1}}`, invalidParams, `invalid params: json: unknown field "n"`},
+		{"count", `{"jsonrpc":"2.0","id":1,"method":"step","params":{"count":0}}`, invalidParams, "count 0 must be at least 1"},
+		{"big count", `{"jsonrpc":"2.0","id":1,"method":"step","params":{"count":100001}}`, invalidParams, "count 100001 must be at most 100000"},
+		{"no key", `{"jsonrpc":"2.0","id":1,"method":"pressKey"}`, invalidParams, "key is required"},
+		{"key", `{"jsonrpc":"2.0","id":1,"method":"pressKey","params":{"key":16}}`, invalidParams, "there is no key 0x10, keys are 0x0 to 0xF"},
+		{"no address", `{"jsonrpc":"2.0","id":1,"method":"readMemory","params":{"length":1}}`, invalidParams, "address is required"},
+		{"memory", `{"jsonrpc":"2.0","id":1,"method":"readMemory","params":{"address":4095,"length":2}}`, invalidParams, "2 bytes at 0xfff are outside of memory"},
+		{"hex", `{"jsonrpc":"2.0","id":1,"method":"writeMemory","params":{"address":512,"data":"xy"}}`, invalidParams, "data is not hex: encoding/hex: invalid byte: U+0078 'x'"},
+		{"state", `{"jsonrpc":"2.0","id":1,"method":"loadState"}`, invalidParams, "one of path or data is required"},
+		{"bad state", `{"jsonrpc":"2.0","id":1,"method":"loadState","params":{"data":"AAAA"}}`, serverError, "could not load state: not a save state: unexpected EOF"},
+		{"no multiplier", `{"jsonrpc":"2.0","id":1,"method":"setMultiplier"}`, invalidParams, "multiplier is required"},
+		{"multiplier", `{"jsonrpc":"2.0","id":1,"method":"setMultiplier","params":{"multiplier":0.1}}`, invalidParams, "speed multiplier 0.1 must be at least 0.25, or 0 to run unthrottled"},
+		{"rom", `{"jsonrpc":"2.0","id":1,"method":"loadRom","params":{"data":"YgI=","path":"rom.ch8"}}`, invalidParams, "one of path or data is required"},
+		{"big rom", `{"jsonrpc":"2.0","id":1,"method":"loadRom","params":{"data":"` + strings.Repeat("A", 4800) + `"}}`, serverError, "could not load rom: rom of 3600 bytes does not fit in the 3584 bytes of memory from 0x200"},
+		{"speed", `{"jsonrpc":"2.0","id":1,"method":"setSpeed","params":{"speed":0}}`, invalidParams, "speed 0 must be at least 1 instruction a second"},
+		{"no breakpoint", `{"jsonrpc":"2.0","id":1,"method":"addBreakpoint"}`, invalidParams, "one of address or symbol is required"},
+		{"symbol", `{"jsonrpc":"2.0","id":1,"method":"addBreakpoint","params":{"symbol":"nowhere"}}`, invalidParams, "unknown symbol 'nowhere'"},
+		{"event", `{"jsonrpc":"2.0","id":1,"method":"subscribe","params":{"events":["boom"]}}`, invalidParams, "unknown event 'boom'"},
+	}
+	for _, tc := range testCases {
+		r := c.call(tc.request)
+		assert.Nil(t, r["result"], tc.name)
+		assert.Equal(t, map[string]interface{}{"code": tc.code, "message": tc.message}, r["error"], tc.name)
+	}
+
+	// Notifications are not answered
+	c.send(`{"jsonrpc":"2.0","method":"pause"}`)
+	assert.Equal(t, 1.0, c.call(`{"jsonrpc":"2.0","id":1,"method":"status"}`)["id"])
+}
+
+func TestListen(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "rpc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chip8.sock")
+	l, err := Listen("unix:" + path)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k := cpu.NewKeyboard()
+	c := cpu.NewCPU(state.InitMemory(), rand.New(rand.NewSource(42)), k, cpu.NewTimer(make(chan byte, 60)), &screenMock{})
+	served := make(chan error)
+	go func() {
+		served <- New(control.New(c, k, control.Options{}), Options{}).Serve(ctx, l)
+	}()
+	conn, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	cl := &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+	assert.Equal(t, float64(0x200), cl.call(`{"jsonrpc":"2.0","id":1,"method":"registers"}`)["result"].(map[string]interface{})["pc"])
+	cancel()
+	assert.NoError(t, <-served)
+	_, err = cl.r.ReadBytes('\n')
+	assert.Error(t, err, "disconnected")
+
+	for _, addr := range []string{"", "unix:", "udp:127.0.0.1:1", "/tmp/chip8.sock"} {
+		_, err = Listen(addr)
+		assert.EqualError(t, err, "control address '"+addr+"' must be unix:PATH or tcp:HOST:PORT")
+	}
+}
+
+func TestListen_tcp(t *testing.T) {
+	t.Parallel()
+	l, err := Listen("tcp:127.0.0.1:0")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	k := cpu.NewKeyboard()
+	c := cpu.NewCPU(state.InitMemory(), rand.New(rand.NewSource(42)), k, cpu.NewTimer(make(chan byte, 60)), &screenMock{})
+	ctl := control.New(c, k, control.Options{})
+	ctl.Pause()
+	go func() {
+		_ = New(ctl, Options{}).Serve(ctx, l)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	cl := &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+	for _, method := range []string{"loadRom", "loadState", "saveState", "screenshot"} {
+		r := cl.call(`{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":{"path":"/etc/passwd"}}`)
+		assert.Equal(t, map[string]interface{}{"code": float64(invalidParams), "message": "path is only allowed over a Unix domain socket, send data instead"}, r["error"], method)
+	}
+	r := cl.call(`{"jsonrpc":"2.0","id":2,"method":"saveState"}`)
+	assert.NotEmpty(t, r["result"].(map[string]interface{})["data"])
+	r = cl.call(`{"jsonrpc":"2.0","id":3,"method":"loadRom","params":{"data":"YQc="}}`)
+	assert.Nil(t, r["error"])
+}
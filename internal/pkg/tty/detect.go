@@ -0,0 +1,59 @@
+package tty
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"io"
+	"regexp"
+	"time"
+)
+
+// detectQuery asks whether the terminal takes kitty graphics, with a query
+// that only kitty answers, followed by the primary device attributes that
+// every terminal answers and that list Sixel as attribute 4.
+const detectQuery = "\x1b_Gi=31,s=1,v=1,a=q,t=d,f=24;AAAA\x1b\\\x1b[c"
+
+// detectTimeout is how long to wait for a terminal to answer detectQuery.
+const detectTimeout = 500 * time.Millisecond
+
+var deviceAttributes = regexp.MustCompile(`\x1b\[\?([0-9;]*)c`)
+
+// Detect returns the best renderer for a terminal that answered
+// detectQuery with answer, kitty graphics, Sixel or the text renderer.
+func Detect(answer []byte, scale int, p display.Palette) Renderer {
+	if bytes.Contains(answer, []byte("\x1b_Gi=31;OK")) {
+		return NewKitty(scale, p)
+	}
+	if m := deviceAttributes.FindSubmatch(answer); m != nil {
+		for _, a := range bytes.Split(m[1], []byte(";")) {
+			if string(a) == "4" {
+				return NewSixel(scale, p)
+			}
+		}
+	}
+	return NewAuto()
+}
+
+// query writes detectQuery and collects the answer from in, until the
+// device attributes arrive or timeout.
+func query(out io.Writer, in <-chan byte, timeout time.Duration) ([]byte, error) {
+	if _, err := out.Write([]byte(detectQuery)); err != nil {
+		return nil, err
+	}
+	var answer []byte
+	deadline := time.After(timeout)
+	for {
+		select {
+		case b, ok := <-in:
+			if !ok {
+				return answer, nil
+			}
+			answer = append(answer, b)
+			if b == 'c' && deviceAttributes.Match(answer) {
+				return answer, nil
+			}
+		case <-deadline:
+			return answer, nil
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package tty
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		answer string
+		exp    Renderer
+	}{
+		{"kitty", "\x1b_Gi=31;OK\x1b\\\x1b[?62;c", &kitty{scale: 2, p: testPalette}},
+		{"sixel", "\x1b[?62;4;22c", &sixel{scale: 2, p: testPalette}},
+		{"sixel only", "\x1b[?4c", &sixel{scale: 2, p: testPalette}},
+		{"neither", "\x1b[?62;22c", NewAuto()},
+		{"attribute 44 is not sixel", "\x1b[?62;44c", NewAuto()},
+		{"kitty without graphics", "\x1b_Gi=31;ENOTSUPPORTED\x1b\\\x1b[?62;c", NewAuto()},
+		{"no answer", "", NewAuto()},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := Detect([]byte(tc.answer), 2, testPalette)
+			if _, ok := tc.exp.(*auto); ok {
+				assert.IsType(t, tc.exp, r)
+				return
+			}
+			assert.Equal(t, tc.exp, r)
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	in := make(chan byte, 64)
+	for _, b := range []byte("\x1b[?62;4c1") {
+		in <- b
+	}
+	answer, err := query(&out, in, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, detectQuery, out.String())
+	assert.Equal(t, "\x1b[?62;4c", string(answer), "stops at the device attributes")
+	assert.Equal(t, byte('1'), <-in, "leaving what is typed after them")
+
+	in <- 'x'
+	start := time.Now()
+	answer, err = query(&out, in, 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, "x", string(answer))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond, "waits for the terminal to answer")
+
+	close(in)
+	answer, err = query(&out, in, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, answer, "the terminal was closed")
+}
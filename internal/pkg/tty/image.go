@@ -0,0 +1,13 @@
+package tty
+
+// scaleFor returns scale, or when it is 0 the scale that makes a frame
+// about 512 pixels wide.
+func scaleFor(scale, width int) int {
+	if scale > 0 {
+		return scale
+	}
+	if width >= 512 {
+		return 1
+	}
+	return 512 / width
+}
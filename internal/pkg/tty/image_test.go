@@ -0,0 +1,138 @@
+package tty
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata")
+
+// golden compares what was written with testdata/name, which is rewritten
+// when testing with -update.
+func golden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		assert.NoError(t, ioutil.WriteFile(path, got, 0644))
+	}
+	exp, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(exp, got), "output differs from %s, run the tests with -update to see how", path)
+}
+
+// testFrame is a frame with a box around the edge and a diagonal line.
+func testFrame(width, height int) []byte {
+	fb := make([]byte, width*height)
+	for x := 0; x < width; x++ {
+		fb[x] = 1
+		fb[(height-1)*width+x] = 1
+	}
+	for y := 0; y < height; y++ {
+		fb[y*width] = 1
+		fb[y*width+width-1] = 1
+		fb[y*width+y] = 1
+	}
+	return fb
+}
+
+var testPalette = display.Palette{
+	Off: color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xFF},
+	On:  color.RGBA{R: 0xFF, G: 0xB0, B: 0x00, A: 0xFF},
+}
+
+func TestRenderers_golden(t *testing.T) {
+	testCases := []struct {
+		name   string
+		r      Renderer
+		width  int
+		height int
+	}{
+		{"sixel.golden", NewSixel(1, display.DefaultPalette), 64, 32},
+		{"sixel_scale3_palette.golden", NewSixel(3, testPalette), 64, 32},
+		{"sixel_hires.golden", NewSixel(1, display.DefaultPalette), 128, 64},
+		{"kitty.golden", NewKitty(1, display.DefaultPalette), 64, 32},
+		{"kitty_scale2_palette.golden", NewKitty(2, testPalette), 64, 32},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			assert.NoError(t, tc.r.Render(&b, testFrame(tc.width, tc.height)))
+			golden(t, tc.name, b.Bytes())
+		})
+	}
+}
+
+func TestSixel_Render(t *testing.T) {
+	t.Parallel()
+	r := NewSixel(0, display.DefaultPalette)
+	var b bytes.Buffer
+	fb := testFrame(64, 32)
+	assert.NoError(t, r.Render(&b, fb))
+	assert.Contains(t, b.String(), "\x1b[H\x1bPq\"1;1;512;256#0;2;0;0;0#1;2;100;100;100", "scaled to 512 pixels wide")
+	assert.True(t, bytes.HasSuffix(b.Bytes(), []byte("\x1b\\")))
+	assert.Equal(t, 256/6, bytes.Count(b.Bytes(), []byte("-")), "a band of six rows a line")
+
+	b.Reset()
+	assert.NoError(t, r.Render(&b, fb))
+	assert.Equal(t, "", b.String(), "not drawn again when the frame is the same")
+	r.Reset()
+	assert.NoError(t, r.Render(&b, fb))
+	assert.NotEqual(t, "", b.String(), "drawn again after a reset")
+}
+
+func TestSixel_Render_levels(t *testing.T) {
+	t.Parallel()
+	r := NewSixel(1, display.DefaultPalette)
+	var b bytes.Buffer
+	fb := make([]byte, 64*32)
+	fb[0], fb[1] = 128, 255
+	assert.NoError(t, r.Render(&b, fb))
+	assert.Contains(t, b.String(), "#0;2;0;0;0#1;2;53;53;53#2;2;100;100;100", "a shade for the level")
+	assert.Contains(t, b.String(), "#0}}!62~$#1@!63?$#2?@!62?-", "a pixel of each")
+}
+
+func TestWriteRuns(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	writeRuns(&b, []byte("???~~~~~@"))
+	assert.Equal(t, "???!5~@", b.String())
+}
+
+func TestKitty_Render(t *testing.T) {
+	t.Parallel()
+	r := NewKitty(0, display.DefaultPalette)
+	var b bytes.Buffer
+	fb := testFrame(128, 64)
+	assert.NoError(t, r.Render(&b, fb))
+	out := b.String()
+	assert.Contains(t, out, "\x1b[H\x1b_Ga=T,f=24,s=512,v=256,i=1,C=1,q=2,m=1;", "scaled to 512 pixels wide")
+	chunks := bytes.Count(b.Bytes(), []byte("\x1b_G"))
+	assert.Equal(t, (512*256*3*4/3+kittyChunk-1)/kittyChunk, chunks)
+	assert.Equal(t, chunks-1, bytes.Count(b.Bytes(), []byte("m=1;")))
+	assert.Contains(t, out, "\x1b_Gm=0;")
+
+	b.Reset()
+	assert.NoError(t, r.Render(&b, fb))
+	assert.Equal(t, "", b.String(), "not drawn again when the frame is the same")
+}
+
+func TestKitty_Render_levels(t *testing.T) {
+	t.Parallel()
+	r := NewKitty(1, display.DefaultPalette)
+	var b bytes.Buffer
+	fb := make([]byte, 64*32)
+	fb[0], fb[1], fb[2] = 128, 255, 1
+	assert.NoError(t, r.Render(&b, fb))
+	data := b.String()[strings.Index(b.String(), ";")+1:]
+	rgb, err := base64.StdEncoding.DecodeString(data[:12])
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{128, 128, 128, 255, 255, 255, 255, 255, 255}, rgb)
+}
@@ -0,0 +1,98 @@
+package tty
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"sync"
+	"time"
+)
+
+// DefaultKeymap maps the left of a QWERTY keyboard onto the COSMAC VIP
+// keypad.
+const DefaultKeymap = "1234qwerasdfzxcv"
+
+// cosmac is the order of the keys on the COSMAC VIP keypad, row by row.
+var cosmac = []byte{0x1, 0x2, 0x3, 0xC, 0x4, 0x5, 0x6, 0xD, 0x7, 0x8, 0x9, 0xE, 0xA, 0x0, 0xB, 0xF}
+
+// Keymap maps what a terminal sends for a key to a CHIP-8 key.
+type Keymap map[byte]byte
+
+// ParseKeymap reads a keymap of sixteen characters, the keys to press for
+// the COSMAC VIP keypad row by row: 1 2 3 C, 4 5 6 D, 7 8 9 E and A 0 B F.
+// Letters match both cases.
+func ParseKeymap(s string) (Keymap, error) {
+	if len(s) != len(cosmac) {
+		return nil, fmt.Errorf("keymap '%s' must have %d characters, has %d", s, len(cosmac), len(s))
+	}
+	k := make(Keymap, 2*len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		for _, b := range []byte{c, lower(c), upper(c)} {
+			if o, ok := k[b]; ok && o != cosmac[i] {
+				return nil, fmt.Errorf("keymap '%s' has '%c' more than once", s, c)
+			}
+			k[b] = cosmac[i]
+		}
+	}
+	return k, nil
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// keys presses CHIP-8 keys for what is typed. Terminals only report that a
+// key was pressed, repeating it while held, so a key is released when it
+// has not been seen for hold.
+type keys struct {
+	lock    sync.Mutex
+	k       cpu.Keyboard
+	m       Keymap
+	hold    time.Duration
+	pressed int    // Key held, -1 for none
+	typing  uint64 // Counts keys typed, so a release only applies to its own
+	release *time.Timer
+}
+
+func newKeys(k cpu.Keyboard, m Keymap, hold time.Duration) *keys {
+	return &keys{k: k, m: m, hold: hold, pressed: -1}
+}
+
+// typed handles a byte read from the terminal and reports whether it was a
+// CHIP-8 key.
+func (ks *keys) typed(b byte) bool {
+	key, ok := ks.m[b]
+	if !ok {
+		return false
+	}
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	if ks.release != nil {
+		ks.release.Stop()
+	}
+	if ks.pressed != int(key) {
+		ks.pressed = int(key)
+		ks.k.KeyPressed(key)
+	}
+	ks.typing++
+	typing := ks.typing
+	ks.release = time.AfterFunc(ks.hold, func() {
+		ks.lock.Lock()
+		defer ks.lock.Unlock()
+		if ks.typing == typing {
+			ks.pressed = -1
+			ks.k.Clear()
+		}
+	})
+	return true
+}
@@ -0,0 +1,85 @@
+package tty
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseKeymap(t *testing.T) {
+	t.Parallel()
+	k, err := ParseKeymap(DefaultKeymap)
+	assert.NoError(t, err)
+	assert.Len(t, k, 16+12, "letters match both cases")
+	testCases := map[byte]byte{
+		'1': 0x1, '2': 0x2, '3': 0x3, '4': 0xC,
+		'q': 0x4, 'w': 0x5, 'e': 0x6, 'r': 0xD,
+		'a': 0x7, 's': 0x8, 'd': 0x9, 'f': 0xE,
+		'z': 0xA, 'x': 0x0, 'c': 0xB, 'v': 0xF,
+		'Q': 0x4, 'V': 0xF,
+	}
+	for c, exp := range testCases {
+		assert.Equal(t, exp, k[c], "key '%c'", c)
+	}
+
+	_, err = ParseKeymap("1234")
+	assert.EqualError(t, err, "keymap '1234' must have 16 characters, has 4")
+	_, err = ParseKeymap("1234qwerasdfzxcQ")
+	assert.EqualError(t, err, "keymap '1234qwerasdfzxcQ' has 'Q' more than once")
+}
+
+type recordingKeyboard struct {
+	lock   sync.Mutex
+	events []int // Keys pressed, -1 for a release
+}
+
+func (k *recordingKeyboard) PollKeyPressed() (key byte, ok bool) {
+	return 0, false
+}
+
+func (k *recordingKeyboard) IsKeyPressed(key byte) bool {
+	return false
+}
+
+func (k *recordingKeyboard) KeyPressed(key byte) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.events = append(k.events, int(key))
+}
+
+func (k *recordingKeyboard) Clear() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.events = append(k.events, -1)
+}
+
+func (k *recordingKeyboard) get() []int {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return append([]int{}, k.events...)
+}
+
+func TestKeys_typed(t *testing.T) {
+	t.Parallel()
+	m, err := ParseKeymap(DefaultKeymap)
+	assert.NoError(t, err)
+	kb := &recordingKeyboard{}
+	ks := newKeys(kb, m, 50*time.Millisecond)
+
+	assert.False(t, ks.typed('p'), "not on the keymap")
+	assert.True(t, ks.typed('q'))
+	assert.True(t, ks.typed('q'), "repeated while held")
+	assert.Equal(t, []int{0x4}, kb.get(), "pressed once")
+
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, ks.typed('q'))
+	time.Sleep(40 * time.Millisecond)
+	assert.Equal(t, []int{0x4}, kb.get(), "each repeat holds it for longer")
+
+	assert.True(t, ks.typed('v'))
+	assert.Equal(t, []int{0x4, 0xF}, kb.get(), "another key replaces it")
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, []int{0x4, 0xF, -1}, kb.get(), "released once it is not seen")
+}
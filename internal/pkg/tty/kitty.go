@@ -0,0 +1,67 @@
+package tty
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"io"
+)
+
+// kittyChunk is the most base64 the kitty graphics protocol takes in one
+// escape sequence.
+const kittyChunk = 4096
+
+type kitty struct {
+	scale int
+	p     display.Palette
+	prev  []byte
+}
+
+// NewKitty returns a renderer that draws frames as images with the kitty
+// graphics protocol, each pixel scale by scale pixels, or scaled to about
+// 512 pixels wide when scale is 0.
+func NewKitty(scale int, p display.Palette) Renderer {
+	return &kitty{scale: scale, p: p}
+}
+
+func (k *kitty) Reset() {
+	k.prev = nil
+}
+
+func (k *kitty) Render(w io.Writer, frameBuffer []byte) error {
+	if k.prev != nil && bytes.Equal(k.prev, frameBuffer) {
+		return nil
+	}
+	k.prev = append(k.prev[:0], frameBuffer...)
+	fw, fh := dimensions(len(frameBuffer))
+	sc := scaleFor(k.scale, fw)
+	width, height := fw*sc, fh*sc
+	rgb := make([]byte, 0, width*height*3)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := k.p.Color(display.Level(frameBuffer[(y/sc)*fw+x/sc]))
+			rgb = append(rgb, c.R, c.G, c.B)
+		}
+	}
+	data := base64.StdEncoding.EncodeToString(rgb)
+
+	var b bytes.Buffer
+	b.WriteString("\x1b[H")
+	for i := 0; i < len(data); i += kittyChunk {
+		end := i + kittyChunk
+		more := 1
+		if end >= len(data) {
+			end, more = len(data), 0
+		}
+		b.WriteString("\x1b_G")
+		if i == 0 {
+			// Transmit and display image 1, replacing the last frame,
+			// without moving the cursor or answering
+			fmt.Fprintf(&b, "a=T,f=24,s=%d,v=%d,i=1,C=1,q=2,", width, height)
+		}
+		fmt.Fprintf(&b, "m=%d;%s\x1b\\", more, data[i:end])
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
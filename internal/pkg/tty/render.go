@@ -0,0 +1,175 @@
+package tty
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"image"
+	"io"
+)
+
+// Renderer draws frame buffers to a terminal.
+type Renderer interface {
+	// Render draws frameBuffer, one byte per pixel, a row at a time.
+	Render(w io.Writer, frameBuffer []byte) error
+	// Reset forgets what is on the terminal so the next frame is drawn in
+	// full, such as after the terminal was cleared.
+	Reset()
+}
+
+// DirtyRenderer is a Renderer that can draw only the part of a frame that
+// changed since the one it drew before.
+type DirtyRenderer interface {
+	Renderer
+	// RenderDirty draws frameBuffer, of which only dirty changed.
+	RenderDirty(w io.Writer, frameBuffer []byte, dirty image.Rectangle) error
+}
+
+// dimensions returns the width and height of a frame buffer of n pixels,
+// 128x64 for a high resolution one and 64 pixels wide otherwise.
+func dimensions(n int) (width, height int) {
+	if n == 128*64 {
+		return 128, 64
+	}
+	return 64, n / 64
+}
+
+// cells renders a frame as characters that each show a block of pixels,
+// rewriting only the characters that changed since the last frame.
+type cells struct {
+	width, height int // Size of a character in pixels
+	glyph         func(bits uint) rune
+	cols, rows    int
+	prev          []rune
+}
+
+// NewHalfBlock returns a renderer that draws two pixels, one above the
+// other, per character with Unicode half blocks.
+func NewHalfBlock() Renderer {
+	return &cells{width: 1, height: 2, glyph: halfBlock}
+}
+
+// NewBraille returns a renderer that draws eight pixels, two across and
+// four down, per character with Unicode Braille patterns.
+func NewBraille() Renderer {
+	return &cells{width: 2, height: 4, glyph: braille}
+}
+
+// NewAuto returns a renderer that draws low resolution frames with half
+// blocks and high resolution ones with Braille, so both fit in 64x16
+// characters.
+func NewAuto() Renderer {
+	return &auto{low: NewHalfBlock(), high: NewBraille()}
+}
+
+func halfBlock(bits uint) rune {
+	return []rune{' ', '▀', '▄', '█'}[bits]
+}
+
+// brailleDots are the bits of the Braille pattern for each pixel of a
+// character, in the order the pixels are read.
+var brailleDots = []uint{0x01, 0x08, 0x02, 0x10, 0x04, 0x20, 0x40, 0x80}
+
+func braille(bits uint) rune {
+	r := rune(0x2800)
+	for i, d := range brailleDots {
+		if bits&(1<<uint(i)) != 0 {
+			r |= rune(d)
+		}
+	}
+	return r
+}
+
+func (c *cells) Reset() {
+	c.prev = nil
+}
+
+func (c *cells) Render(w io.Writer, frameBuffer []byte) error {
+	fw, fh := dimensions(len(frameBuffer))
+	return c.RenderDirty(w, frameBuffer, image.Rect(0, 0, fw, fh))
+}
+
+func (c *cells) RenderDirty(w io.Writer, frameBuffer []byte, dirty image.Rectangle) error {
+	fw, fh := dimensions(len(frameBuffer))
+	cols, rows := (fw+c.width-1)/c.width, (fh+c.height-1)/c.height
+	if cols != c.cols || rows != c.rows {
+		c.cols, c.rows, c.prev = cols, rows, nil
+	}
+	var b bytes.Buffer
+	full := c.prev == nil
+	// The characters that show the dirty pixels
+	rowFrom, rowTo := dirty.Min.Y/c.height, (dirty.Max.Y+c.height-1)/c.height
+	colFrom, colTo := dirty.Min.X/c.width, (dirty.Max.X+c.width-1)/c.width
+	if full {
+		c.prev = make([]rune, cols*rows)
+		b.WriteString("\x1b[H")
+		rowFrom, rowTo, colFrom, colTo = 0, rows, 0, cols
+	}
+	atRow, atCol := -1, -1 // Where the cursor is, when known
+	for row := rowFrom; row < rowTo && row < rows; row++ {
+		for col := colFrom; col < colTo && col < cols; col++ {
+			var bits, bit uint
+			for y := 0; y < c.height; y++ {
+				for x := 0; x < c.width; x++ {
+					px, py := col*c.width+x, row*c.height+y
+					if px < fw && py < fh && display.Level(frameBuffer[py*fw+px]) >= 128 {
+						bits |= 1 << bit
+					}
+					bit++
+				}
+			}
+			r := c.glyph(bits)
+			if !full && r == c.prev[row*cols+col] {
+				continue
+			}
+			c.prev[row*cols+col] = r
+			if !full && (row != atRow || col != atCol) {
+				fmt.Fprintf(&b, "\x1b[%d;%dH", row+1, col+1)
+			}
+			b.WriteRune(r)
+			atRow, atCol = row, col+1
+		}
+		if full && row+1 < rows {
+			b.WriteString("\r\n")
+		}
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+type auto struct {
+	low, high Renderer
+	last      Renderer
+}
+
+func (a *auto) Reset() {
+	a.low.Reset()
+	a.high.Reset()
+}
+
+func (a *auto) Render(w io.Writer, frameBuffer []byte) error {
+	fw, fh := dimensions(len(frameBuffer))
+	return a.RenderDirty(w, frameBuffer, image.Rect(0, 0, fw, fh))
+}
+
+func (a *auto) RenderDirty(w io.Writer, frameBuffer []byte, dirty image.Rectangle) error {
+	r := a.low
+	if fw, _ := dimensions(len(frameBuffer)); fw > 64 {
+		r = a.high
+	}
+	if r != a.last {
+		// The other renderer drew over what this one remembers
+		r.Reset()
+		if _, err := io.WriteString(w, "\x1b[2J"); err != nil {
+			return err
+		}
+		a.last = r
+	}
+	if d, ok := r.(DirtyRenderer); ok {
+		return d.RenderDirty(w, frameBuffer, dirty)
+	}
+	return r.Render(w, frameBuffer)
+}
@@ -0,0 +1,133 @@
+package tty
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"testing"
+)
+
+func frame(width, height int, pixels ...[2]int) []byte {
+	fb := make([]byte, width*height)
+	for _, p := range pixels {
+		fb[p[1]*width+p[0]] = 1
+	}
+	return fb
+}
+
+func TestDimensions(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		n, width, height int
+	}{
+		{64 * 32, 64, 32},
+		{128 * 64, 128, 64},
+		{64 * 48, 64, 48},
+	}
+	for _, tc := range testCases {
+		w, h := dimensions(tc.n)
+		assert.Equal(t, tc.width, w)
+		assert.Equal(t, tc.height, h)
+	}
+}
+
+func TestHalfBlock_Render(t *testing.T) {
+	t.Parallel()
+	r := NewHalfBlock()
+	var b bytes.Buffer
+	// Top of the first character, bottom of the second and both of the third
+	fb := frame(64, 32, [2]int{0, 0}, [2]int{1, 1}, [2]int{2, 0}, [2]int{2, 1})
+	assert.NoError(t, r.Render(&b, fb))
+	out := b.String()
+	assert.Equal(t, "\x1b[H▀▄█", out[:len("\x1b[H▀▄█")])
+	assert.Equal(t, 15, bytes.Count(b.Bytes(), []byte("\r\n")), "16 rows")
+	assert.Equal(t, 64*16, len([]rune(out))-len([]rune("\x1b[H"))-2*15)
+
+	b.Reset()
+	assert.NoError(t, r.Render(&b, fb))
+	assert.Equal(t, "", b.String(), "nothing changed")
+
+	b.Reset()
+	fb[0] = 0          // clears the first character
+	fb[63*1+64*31] = 1 // bottom right
+	fb[3] = 1          // next to the third
+	assert.NoError(t, r.Render(&b, fb))
+	assert.Equal(t, "\x1b[1;1H \x1b[1;4H▀\x1b[16;64H▄", b.String())
+
+	b.Reset()
+	r.Reset()
+	assert.NoError(t, r.Render(&b, fb))
+	assert.Contains(t, b.String(), "\x1b[H ▄█▀", "drawn in full after a reset")
+}
+
+func TestHalfBlock_RenderDirty(t *testing.T) {
+	t.Parallel()
+	r := NewHalfBlock().(DirtyRenderer)
+	var b bytes.Buffer
+	fb := frame(64, 32)
+	assert.NoError(t, r.RenderDirty(&b, fb, image.Rect(0, 0, 1, 1)))
+	assert.True(t, bytes.HasPrefix(b.Bytes(), []byte("\x1b[H")), "drawn in full the first time")
+	assert.Equal(t, 15, bytes.Count(b.Bytes(), []byte("\r\n")))
+
+	b.Reset()
+	fb[0], fb[64*3+10] = 1, 1
+	assert.NoError(t, r.RenderDirty(&b, fb, image.Rect(10, 3, 11, 4)))
+	assert.Equal(t, "\x1b[2;11H▄", b.String(), "only what is dirty")
+
+	b.Reset()
+	assert.NoError(t, r.RenderDirty(&b, fb, image.Rect(0, 0, 64, 32)))
+	assert.Equal(t, "\x1b[1;1H▀", b.String(), "the rest")
+}
+
+func TestBraille_Render(t *testing.T) {
+	t.Parallel()
+	r := NewBraille()
+	var b bytes.Buffer
+	// Every dot of the first character, the top left of the second
+	var px [][2]int
+	for y := 0; y < 4; y++ {
+		px = append(px, [2]int{0, y}, [2]int{1, y})
+	}
+	px = append(px, [2]int{2, 0}, [2]int{5, 3})
+	assert.NoError(t, r.Render(&b, frame(128, 64, px...)))
+	assert.Equal(t, "\x1b[H⣿⠁⢀", b.String()[:len("\x1b[H⣿⠁⢀")])
+	assert.Equal(t, 15, bytes.Count(b.Bytes(), []byte("\r\n")), "16 rows of 64")
+}
+
+func TestBraille(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		bits uint
+		exp  rune
+	}{
+		{0, '⠀'},
+		{1 << 0, '⠁'}, // top left
+		{1 << 1, '⠈'}, // top right
+		{1 << 2, '⠂'},
+		{1 << 3, '⠐'},
+		{1 << 4, '⠄'},
+		{1 << 5, '⠠'},
+		{1 << 6, '⡀'}, // bottom left
+		{1 << 7, '⢀'}, // bottom right
+		{0xFF, '⣿'},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, string(tc.exp), string(braille(tc.bits)))
+	}
+}
+
+func TestAuto_Render(t *testing.T) {
+	t.Parallel()
+	r := NewAuto()
+	var b bytes.Buffer
+	assert.NoError(t, r.Render(&b, frame(64, 32, [2]int{0, 0})))
+	assert.Equal(t, "\x1b[2J\x1b[H▀", b.String()[:len("\x1b[2J\x1b[H▀")])
+
+	b.Reset()
+	assert.NoError(t, r.Render(&b, frame(128, 64, [2]int{0, 0})))
+	assert.Equal(t, "\x1b[2J\x1b[H⠁", b.String()[:len("\x1b[2J\x1b[H⠁")], "switching clears the screen")
+
+	b.Reset()
+	assert.NoError(t, r.Render(&b, frame(64, 32, [2]int{0, 0})))
+	assert.Equal(t, "\x1b[2J\x1b[H▀", b.String()[:len("\x1b[2J\x1b[H▀")], "and is drawn in full when switching back")
+}
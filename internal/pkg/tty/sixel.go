@@ -0,0 +1,108 @@
+package tty
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"io"
+)
+
+// shades is the number of levels of brightness Sixel images have.
+const shades = 16
+
+type sixel struct {
+	scale int
+	p     display.Palette
+	prev  []byte
+}
+
+// NewSixel returns a renderer that draws frames as Sixel images, each
+// pixel scale by scale pixels, or scaled to about 512 pixels wide when
+// scale is 0.
+func NewSixel(scale int, p display.Palette) Renderer {
+	return &sixel{scale: scale, p: p}
+}
+
+func (s *sixel) Reset() {
+	s.prev = nil
+}
+
+func (s *sixel) Render(w io.Writer, frameBuffer []byte) error {
+	if s.prev != nil && bytes.Equal(s.prev, frameBuffer) {
+		return nil
+	}
+	s.prev = append(s.prev[:0], frameBuffer...)
+	fw, fh := dimensions(len(frameBuffer))
+	sc := scaleFor(s.scale, fw)
+	width, height := fw*sc, fh*sc
+	// The shades of the palette used, off and on at least
+	shade := func(x, y int) int {
+		return display.Shade(display.Level(frameBuffer[(y/sc)*fw+x/sc]), shades)
+	}
+	used := make([]bool, shades)
+	used[0], used[shades-1] = true, true
+	for _, px := range frameBuffer {
+		used[display.Shade(display.Level(px), shades)] = true
+	}
+	var colours []int
+	for i, u := range used {
+		if u {
+			colours = append(colours, i)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("\x1b[H\x1bPq")
+	fmt.Fprintf(&b, "\"1;1;%d;%d", width, height)
+	palette := s.p.Shades(shades)
+	for i, shade := range colours {
+		r, g, bl, _ := palette[shade].RGBA()
+		fmt.Fprintf(&b, "#%d;2;%d;%d;%d", i, percent(uint8(r>>8)), percent(uint8(g>>8)), percent(uint8(bl>>8)))
+	}
+	row := make([]byte, width)
+	for band := 0; band < height; band += 6 {
+		if band > 0 {
+			b.WriteByte('-')
+		}
+		for colour, sh := range colours {
+			for x := 0; x < width; x++ {
+				var bits byte
+				for k := 0; k < 6 && band+k < height; k++ {
+					if shade(x, band+k) == sh {
+						bits |= 1 << uint(k)
+					}
+				}
+				row[x] = '?' + bits
+			}
+			if colour > 0 {
+				b.WriteByte('$')
+			}
+			fmt.Fprintf(&b, "#%d", colour)
+			writeRuns(&b, row)
+		}
+	}
+	b.WriteString("\x1b\\")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeRuns writes sixels, repeating those that repeat with `!n`.
+func writeRuns(b *bytes.Buffer, row []byte) {
+	for i := 0; i < len(row); {
+		n := 1
+		for i+n < len(row) && row[i+n] == row[i] {
+			n++
+		}
+		if n > 3 {
+			fmt.Fprintf(b, "!%d%c", n, row[i])
+		} else {
+			b.Write(row[i : i+n])
+		}
+		i += n
+	}
+}
+
+// percent scales a colour component to the 0 to 100 Sixel uses.
+func percent(c uint8) int {
+	return (int(c)*100 + 127) / 255
+}
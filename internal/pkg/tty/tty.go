@@ -0,0 +1,200 @@
+package tty
+
+import (
+	"bufio"
+	"context"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
+	"image"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	refresh = time.Second / 60
+	ctrlC   = 0x03
+	esc     = 0x1B
+
+	// CtrlS is the key the run command takes a screenshot with.
+	CtrlS = 0x13
+
+	// Keys the run command controls the emulator with.
+	CtrlP = 0x10 // Pause or resume
+	CtrlN = 0x0E // Advance a frame
+	CtrlR = 0x12 // Reset
+	CtrlX = 0x18 // Hard reset
+	CtrlO = 0x0F // Load the rom again, to play a new build of it
+	CtrlF = 0x06 // Faster
+	CtrlB = 0x02 // Slower
+
+	// DefaultHold is how long a key stays pressed after a terminal last
+	// sent it. A key held down can be released for a moment before the
+	// terminal starts to repeat it, a longer hold bridges that but makes
+	// taps last longer.
+	DefaultHold = 250 * time.Millisecond
+)
+
+// Options configure a Terminal.
+type Options struct {
+	Renderer Renderer        // How to draw, nil to detect what the terminal can do
+	Scale    int             // Scale of images when detected, 0 for about 512 pixels wide
+	Palette  display.Palette // Colours of images when detected
+	Keymap   Keymap          // Keys for the keypad
+	Hold     time.Duration   // How long a key stays pressed, see DefaultHold
+	Hotkeys  map[byte]func() // Called when a key, such as CtrlS, is typed instead of pressing it
+}
+
+// Terminal is a frontend that plays in a terminal. It is the Screen, the
+// Loop and what presses the keys of the Keyboard.
+type Terminal struct {
+	lock  sync.Mutex
+	in    *os.File
+	out   io.Writer
+	o     Options
+	r     Renderer
+	keys  *keys
+	quit  func()
+	fb    []byte
+	dirty bool
+	rect  image.Rectangle // What changed since the last frame drawn
+}
+
+// New returns a frontend that reads keys from in, which must be a terminal,
+// presses them on k and draws to out. Typing Ctrl+C calls quit.
+func New(in *os.File, out io.Writer, k cpu.Keyboard, o Options, quit func()) *Terminal {
+	return &Terminal{
+		in:   in,
+		out:  out,
+		o:    o,
+		r:    o.Renderer,
+		keys: newKeys(k, o.Keymap, o.Hold),
+		quit: quit,
+	}
+}
+
+func (t *Terminal) Draw(frameBuffer []byte) {
+	fw, fh := dimensions(len(frameBuffer))
+	t.DrawDirty(frameBuffer, image.Rect(0, 0, fw, fh))
+}
+
+// DrawDirty draws a frame of which only dirty changed, which is all that
+// renderers that can are asked to redraw.
+func (t *Terminal) DrawDirty(frameBuffer []byte, dirty image.Rectangle) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.fb) != len(frameBuffer) {
+		t.fb = make([]byte, len(frameBuffer))
+		fw, fh := dimensions(len(frameBuffer))
+		dirty = image.Rect(0, 0, fw, fh)
+	}
+	copy(t.fb, frameBuffer)
+	t.rect = t.rect.Union(dirty)
+	t.dirty = true
+}
+
+// IsTerminal reports whether f is a terminal the frontend can run in.
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// Refresh draws the last frame if it changed since it was last drawn.
+func (t *Terminal) Refresh() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.dirty || t.r == nil {
+		return nil
+	}
+	t.dirty = false
+	rect := t.rect
+	t.rect = image.Rectangle{}
+	if d, ok := t.r.(DirtyRenderer); ok {
+		return d.RenderDirty(t.out, t.fb, rect)
+	}
+	return t.r.Render(t.out, t.fb)
+}
+
+// Run puts the terminal into raw mode and draws frames as they change until
+// ctx is done, when the terminal is put back the way it was.
+func (t *Terminal) Run(ctx context.Context) error {
+	fd := int(t.in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.WriteString(t.out, "\x1b[0m\x1b[?25h\x1b[?1049l")
+		if err := term.Restore(fd, state); err != nil {
+			log.WithError(err).Error("Could not restore terminal")
+		}
+	}()
+	// Alternate screen, hidden cursor
+	if _, err = io.WriteString(t.out, "\x1b[?1049h\x1b[?25l\x1b[2J"); err != nil {
+		return err
+	}
+	in := make(chan byte, 64)
+	go pump(bufio.NewReader(t.in), in)
+	r := t.o.Renderer
+	if r == nil {
+		answer, err := query(t.out, in, detectTimeout)
+		if err != nil {
+			return err
+		}
+		r = Detect(answer, t.o.Scale, t.o.Palette)
+	}
+	r.Reset()
+	t.lock.Lock()
+	t.r = r
+	t.lock.Unlock()
+	go t.read(in)
+	cpu.Start("tty", ctx, refresh, t.Refresh)
+	return nil
+}
+
+// pump sends what is read from r to in until the terminal is closed. It is
+// not stopped by Run returning as a read can't be interrupted.
+func pump(r io.ByteReader, in chan<- byte) {
+	defer close(in)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		in <- b
+	}
+}
+
+// read handles what is typed.
+func (t *Terminal) read(in <-chan byte) {
+	for b := range in {
+		switch b {
+		case ctrlC:
+			t.quit()
+		case esc:
+			skipEscape(in)
+		default:
+			if f, ok := t.o.Hotkeys[b]; ok {
+				f()
+				continue
+			}
+			t.keys.typed(b)
+		}
+	}
+}
+
+// skipEscape skips the rest of an escape sequence, such as the `[A` of an
+// arrow key, so its letters aren't taken for keys.
+func skipEscape(in <-chan byte) {
+	b, ok := <-in
+	if !ok || (b != '[' && b != 'O') {
+		return
+	}
+	for b = range in {
+		if b >= 0x40 && b <= 0x7E {
+			return
+		}
+	}
+}
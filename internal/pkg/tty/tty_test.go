@@ -0,0 +1,83 @@
+package tty
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTerminal_Refresh(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	term := New(nil, &b, &recordingKeyboard{}, Options{Renderer: NewHalfBlock(), Hold: DefaultHold}, func() {})
+	assert.NoError(t, term.Refresh())
+	assert.Equal(t, "", b.String(), "nothing drawn yet")
+
+	term.Draw(frame(64, 32, [2]int{0, 0}))
+	assert.NoError(t, term.Refresh())
+	assert.True(t, strings.HasPrefix(b.String(), "\x1b[H▀ "))
+
+	b.Reset()
+	assert.NoError(t, term.Refresh())
+	assert.Equal(t, "", b.String(), "not drawn again until the next frame")
+
+	fb := frame(64, 32, [2]int{0, 1})
+	term.Draw(fb)
+	fb[0] = 1 // the screen keeps a copy
+	assert.NoError(t, term.Refresh())
+	assert.Equal(t, "\x1b[1;1H▄", b.String())
+}
+
+var _ cpu.DirtyScreen = &Terminal{}
+
+func TestTerminal_DrawDirty(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	term := New(nil, &b, &recordingKeyboard{}, Options{Renderer: NewHalfBlock(), Hold: DefaultHold}, func() {})
+	term.DrawDirty(frame(64, 32), image.Rect(0, 0, 1, 1))
+	assert.NoError(t, term.Refresh())
+
+	b.Reset()
+	term.DrawDirty(frame(64, 32, [2]int{0, 0}, [2]int{5, 5}), image.Rect(5, 5, 6, 6))
+	term.DrawDirty(frame(64, 32, [2]int{0, 0}, [2]int{5, 5}, [2]int{7, 7}), image.Rect(7, 7, 8, 8))
+	assert.NoError(t, term.Refresh())
+	assert.Equal(t, "\x1b[3;6H▄\x1b[4;8H▄", b.String(), "what changed in either frame")
+}
+
+func TestTerminal_read(t *testing.T) {
+	t.Parallel()
+	m, err := ParseKeymap(DefaultKeymap)
+	assert.NoError(t, err)
+	kb := &recordingKeyboard{}
+	quit := make(chan bool, 1)
+	term := New(nil, &bytes.Buffer{}, kb, Options{Renderer: NewHalfBlock(), Keymap: m, Hold: time.Minute}, func() { quit <- true })
+	in := make(chan byte, 64)
+	pump(bufio.NewReader(strings.NewReader("1p\x1b[A\x1b[1;5Bv\x1bOP\x03")), in)
+	term.read(in)
+	assert.Equal(t, []int{0x1, 0xF}, kb.get(), "escape sequences are skipped")
+	assert.True(t, <-quit, "Ctrl+C quits")
+}
+
+func TestTerminal_read_hotkeys(t *testing.T) {
+	t.Parallel()
+	m, err := ParseKeymap(DefaultKeymap)
+	assert.NoError(t, err)
+	kb := &recordingKeyboard{}
+	shots := 0
+	term := New(nil, &bytes.Buffer{}, kb, Options{
+		Renderer: NewHalfBlock(),
+		Keymap:   m,
+		Hold:     time.Minute,
+		Hotkeys:  map[byte]func(){CtrlS: func() { shots++ }, 'v': func() { shots++ }},
+	}, func() {})
+	in := make(chan byte, 64)
+	pump(bufio.NewReader(strings.NewReader("1\x13v\x13")), in)
+	term.read(in)
+	assert.Equal(t, 3, shots)
+	assert.Equal(t, []int{0x1}, kb.get(), "hotkeys don't press keys")
+}
@@ -0,0 +1,238 @@
+package vnc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"image"
+	"io"
+)
+
+// The parts of RFB 3.8, RFC 6143, the server speaks.
+const (
+	protocolVersion = "RFB 003.008\n"
+
+	securityNone = 1
+
+	// Messages from viewers
+	msgSetPixelFormat           = 0
+	msgSetEncodings             = 2
+	msgFramebufferUpdateRequest = 3
+	msgKeyEvent                 = 4
+	msgPointerEvent             = 5
+	msgClientCutText            = 6
+
+	// Messages to viewers
+	msgFramebufferUpdate = 0
+	msgBell              = 2
+
+	encodingRaw = 0
+	encodingRRE = 2
+)
+
+// pixelFormat is how a viewer wants the colour of a pixel sent.
+type pixelFormat struct {
+	BitsPerPixel uint8
+	Depth        uint8
+	BigEndian    uint8
+	TrueColour   uint8
+	RedMax       uint16
+	GreenMax     uint16
+	BlueMax      uint16
+	RedShift     uint8
+	GreenShift   uint8
+	BlueShift    uint8
+	_            [3]byte
+}
+
+// defaultFormat is the format the server offers, 32 bits a pixel with 8
+// for each of red, green and blue.
+var defaultFormat = pixelFormat{
+	BitsPerPixel: 32,
+	Depth:        24,
+	TrueColour:   1,
+	RedMax:       0xFF,
+	GreenMax:     0xFF,
+	BlueMax:      0xFF,
+	RedShift:     16,
+	GreenShift:   8,
+}
+
+// check returns an error for formats the server can't send, which are
+// colour maps and odd sizes of pixel.
+func (f pixelFormat) check() error {
+	if f.TrueColour == 0 {
+		return fmt.Errorf("colour maps are not supported")
+	}
+	switch f.BitsPerPixel {
+	case 8, 16, 32:
+		return nil
+	}
+	return fmt.Errorf("%d bits per pixel is not supported", f.BitsPerPixel)
+}
+
+// colours are the pixels of each level of brightness, see display.Level,
+// in the format of a viewer.
+type colours [256][]byte
+
+func newColours(p display.Palette, f pixelFormat) *colours {
+	var c colours
+	for i := range c {
+		rgb := p.Color(display.Level(byte(i)))
+		v := uint32(rgb.R)*uint32(f.RedMax)/0xFF<<f.RedShift |
+			uint32(rgb.G)*uint32(f.GreenMax)/0xFF<<f.GreenShift |
+			uint32(rgb.B)*uint32(f.BlueMax)/0xFF<<f.BlueShift
+		px := make([]byte, f.BitsPerPixel/8)
+		switch {
+		case len(px) == 1:
+			px[0] = byte(v)
+		case len(px) == 2 && f.BigEndian != 0:
+			binary.BigEndian.PutUint16(px, uint16(v))
+		case len(px) == 2:
+			binary.LittleEndian.PutUint16(px, uint16(v))
+		case f.BigEndian != 0:
+			binary.BigEndian.PutUint32(px, v)
+		default:
+			binary.LittleEndian.PutUint32(px, v)
+		}
+		c[i] = px
+	}
+	return &c
+}
+
+// serverInit is sent once a viewer is let in, followed by the name.
+type serverInit struct {
+	Width, Height uint16
+	Format        pixelFormat
+	NameLength    uint32
+}
+
+// rectangle is the header of a rectangle of a FramebufferUpdate.
+type rectangle struct {
+	X, Y, Width, Height uint16
+	Encoding            int32
+}
+
+// screen is a frame drawn at a scale on a desktop of a size.
+type screen struct {
+	fb            []byte
+	width, height int // Of the frame
+	scale         int // Pixels of the desktop a side of a pixel of the frame
+	desktop       image.Rectangle
+}
+
+func newScreen(fb []byte, desktop image.Rectangle) screen {
+	w, h := dimensions(len(fb))
+	scale := desktop.Dx() / w
+	if scale < 1 {
+		scale = 1
+	}
+	return screen{fb: fb, width: w, height: h, scale: scale, desktop: desktop}
+}
+
+// at returns the pixel of the frame at a point of the desktop, off beyond
+// its edges.
+func (s screen) at(x, y int) byte {
+	x, y = x/s.scale, y/s.scale
+	if x >= s.width || y >= s.height {
+		return 0
+	}
+	return s.fb[y*s.width+x]
+}
+
+// changed returns the part of the desktop that differs from the frame
+// last sent, all of it when the frame changed size.
+func (s screen) changed(last []byte) image.Rectangle {
+	if len(last) != len(s.fb) {
+		return s.desktop
+	}
+	var r image.Rectangle
+	for i := range s.fb {
+		if s.fb[i] == last[i] {
+			continue
+		}
+		x, y := i%s.width, i/s.width
+		r = r.Union(image.Rect(x*s.scale, y*s.scale, (x+1)*s.scale, (y+1)*s.scale))
+	}
+	return r.Intersect(s.desktop)
+}
+
+// writeUpdate writes a FramebufferUpdate of the part r of the desktop.
+func writeUpdate(w io.Writer, s screen, r image.Rectangle, c *colours, rre bool) error {
+	msg := []byte{msgFramebufferUpdate, 0, 0, 1}
+	h := rectangle{
+		X:      uint16(r.Min.X),
+		Y:      uint16(r.Min.Y),
+		Width:  uint16(r.Dx()),
+		Height: uint16(r.Dy()),
+	}
+	var body []byte
+	if rre {
+		h.Encoding = encodingRRE
+		body = encodeRRE(s, r, c)
+	} else {
+		h.Encoding = encodingRaw
+		body = encodeRaw(s, r, c)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, h); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// encodeRaw encodes every pixel of r, row by row.
+func encodeRaw(s screen, r image.Rectangle, c *colours) []byte {
+	b := make([]byte, 0, r.Dx()*r.Dy()*len(c[0]))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			b = append(b, c[s.at(x, y)]...)
+		}
+	}
+	return b
+}
+
+// encodeRRE encodes r as pixels that are off with a subrectangle for each
+// run of pixels of the same brightness along a row of the frame.
+func encodeRRE(s screen, r image.Rectangle, c *colours) []byte {
+	b := make([]byte, 4, 64)
+	b = append(b, c[0]...)
+	n := uint32(0)
+	for fy := r.Min.Y / s.scale; fy*s.scale < r.Max.Y && fy < s.height; fy++ {
+		row := s.fb[fy*s.width : (fy+1)*s.width]
+		for fx := 0; fx < s.width; {
+			px := row[fx]
+			end := fx + 1
+			for end < s.width && row[end] == px {
+				end++
+			}
+			if px != 0 {
+				sub := image.Rect(fx*s.scale, fy*s.scale, end*s.scale, (fy+1)*s.scale).Intersect(r)
+				if !sub.Empty() {
+					sub = sub.Sub(r.Min)
+					b = append(b, c[px]...)
+					b = append(b,
+						byte(sub.Min.X>>8), byte(sub.Min.X),
+						byte(sub.Min.Y>>8), byte(sub.Min.Y),
+						byte(sub.Dx()>>8), byte(sub.Dx()),
+						byte(sub.Dy()>>8), byte(sub.Dy()))
+					n++
+				}
+			}
+			fx = end
+		}
+	}
+	binary.BigEndian.PutUint32(b, n)
+	return b
+}
+
+// dimensions returns the size of a frame of n pixels.
+func dimensions(n int) (width, height int) {
+	if n == 128*64 {
+		return 128, 64
+	}
+	return 64, n / 64
+}
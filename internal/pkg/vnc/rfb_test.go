@@ -0,0 +1,85 @@
+package vnc
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNewColours(t *testing.T) {
+	t.Parallel()
+	p := display.Palette{On: color.RGBA{R: 0xFF, G: 0x80, B: 0x00, A: 0xFF}, Off: color.RGBA{B: 0xFF, A: 0xFF}}
+	rgb565 := pixelFormat{BitsPerPixel: 16, Depth: 16, TrueColour: 1, RedMax: 31, GreenMax: 63, BlueMax: 31, RedShift: 11, GreenShift: 5}
+	bgr233 := pixelFormat{BitsPerPixel: 8, Depth: 8, TrueColour: 1, RedMax: 7, GreenMax: 7, BlueMax: 3, GreenShift: 3, BlueShift: 6}
+	testCases := []struct {
+		name    string
+		format  pixelFormat
+		on, off []byte
+	}{
+		{"default", defaultFormat, []byte{0x00, 0x80, 0xFF, 0x00}, []byte{0xFF, 0x00, 0x00, 0x00}},
+		{"big endian", func() pixelFormat { f := defaultFormat; f.BigEndian = 1; return f }(), []byte{0x00, 0xFF, 0x80, 0x00}, []byte{0x00, 0x00, 0x00, 0xFF}},
+		{"16 bits", rgb565, []byte{0xE0, 0xFB}, []byte{0x1F, 0x00}},
+		{"16 bits big endian", func() pixelFormat { f := rgb565; f.BigEndian = 1; return f }(), []byte{0xFB, 0xE0}, []byte{0x00, 0x1F}},
+		{"8 bits", bgr233, []byte{0x1F}, []byte{0xC0}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := newColours(p, tc.format)
+			assert.Equal(t, tc.on, c[1])
+			assert.Equal(t, tc.on, c[0xFF])
+			assert.Equal(t, tc.off, c[0])
+		})
+	}
+}
+
+func TestPixelFormat_check(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, defaultFormat.check())
+	f := defaultFormat
+	f.TrueColour = 0
+	assert.EqualError(t, f.check(), "colour maps are not supported")
+	f = defaultFormat
+	f.BitsPerPixel = 24
+	assert.EqualError(t, f.check(), "24 bits per pixel is not supported")
+}
+
+func TestScreen_changed(t *testing.T) {
+	t.Parallel()
+	desktop := image.Rect(0, 0, 128, 64)
+	fb := make([]byte, 64*32)
+	s := newScreen(fb, desktop)
+	assert.Equal(t, 2, s.scale)
+	assert.Equal(t, desktop, s.changed(nil), "nothing sent yet")
+	assert.True(t, s.changed(make([]byte, 64*32)).Empty())
+
+	fb[64+3], fb[64*5+10] = 1, 1
+	assert.Equal(t, image.Rect(6, 2, 22, 12), s.changed(make([]byte, 64*32)))
+
+	hires := newScreen(make([]byte, 128*64), desktop)
+	assert.Equal(t, 1, hires.scale)
+	assert.Equal(t, desktop, hires.changed(fb), "another size")
+}
+
+func TestEncodeRRE(t *testing.T) {
+	t.Parallel()
+	fb := make([]byte, 64*32)
+	fb[0], fb[1], fb[64*3+5] = 1, 1, 0x80
+	s := newScreen(fb, image.Rect(0, 0, 128, 64))
+	c := newColours(display.DefaultPalette, defaultFormat)
+	assert.Equal(t, []byte{
+		0, 0, 0, 2, // Subrectangles
+		0, 0, 0, 0, // Off
+		0xFF, 0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 4, 0, 2,
+		0x80, 0x80, 0x80, 0, 0, 10, 0, 6, 0, 2, 0, 2,
+	}, encodeRRE(s, s.desktop, c))
+
+	assert.Equal(t, []byte{
+		0, 0, 0, 1,
+		0, 0, 0, 0,
+		0xFF, 0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 3, 0, 1,
+	}, encodeRRE(s, image.Rect(1, 1, 8, 6), c), "clipped to the rectangle")
+}
@@ -0,0 +1,481 @@
+package vnc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/internal/pkg/tty"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	log "github.com/sirupsen/logrus"
+	"image"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+// DefaultScale makes the desktop 512 pixels wide.
+const DefaultScale = 8
+
+// Options configure a Server.
+type Options struct {
+	Scale   int             // Size of a pixel of a 64 by 32 frame, 128 by 64 frames are drawn at half of it
+	Palette display.Palette // Colours of the pixels
+	Keymap  tty.Keymap      // Keys for the keypad, by the character of the key typed
+	Name    string          // Name of the desktop
+}
+
+// Server is a frontend that plays in VNC viewers. The first viewer to
+// connect presses the keys of the Keyboard, the others watch until it
+// leaves. It is the Screen and the Loop.
+type Server struct {
+	addr    string
+	keys    cpu.Keyboard
+	o       Options
+	desktop image.Rectangle
+
+	lock    sync.Mutex
+	frame   []byte // Last frame drawn, never changed once set
+	sound   bool
+	viewers []*viewer // In the order they connected, the first controls
+}
+
+// viewer is a VNC viewer connected to the server.
+type viewer struct {
+	conn   net.Conn
+	notify chan struct{} // Signalled when there may be something to send
+	held   int           // Key the viewer holds down, -1 for none
+
+	lock        sync.Mutex
+	colours     *colours
+	rre         bool
+	request     *image.Rectangle // Part of the desktop asked for, nil for nothing
+	incremental bool             // Whether to send the request only once something changes
+	bell        bool
+	sent        []byte // Frame last sent
+}
+
+// New returns a frontend that serves viewers on addr and presses the keys
+// the controlling viewer types on k.
+func New(addr string, k cpu.Keyboard, o Options) *Server {
+	if o.Scale < 1 {
+		o.Scale = DefaultScale
+	}
+	if o.Name == "" {
+		o.Name = "CHIP-8"
+	}
+	return &Server{
+		addr:    addr,
+		keys:    k,
+		o:       o,
+		desktop: image.Rect(0, 0, 64*o.Scale, 32*o.Scale),
+		frame:   make([]byte, 64*32),
+	}
+}
+
+func (s *Server) Draw(frameBuffer []byte) {
+	fb := make([]byte, len(frameBuffer))
+	copy(fb, frameBuffer)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.frame = fb
+	for _, v := range s.viewers {
+		v.signal()
+	}
+}
+
+// Sound rings the bell of the viewers when the sound turns on.
+func (s *Server) Sound(on bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ring := on && !s.sound
+	s.sound = on
+	if !ring {
+		return
+	}
+	for _, v := range s.viewers {
+		v.lock.Lock()
+		v.bell = true
+		v.lock.Unlock()
+		v.signal()
+	}
+}
+
+func (v *viewer) signal() {
+	select {
+	case v.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run serves viewers on the address of the server until ctx is done, when
+// they are disconnected.
+func (s *Server) Run(ctx context.Context) error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	var lock sync.Mutex
+	conns := make(map[net.Conn]struct{})
+	go func() {
+		<-ctx.Done()
+		if err := l.Close(); err != nil {
+			log.WithError(err).Error("Could not stop VNC server")
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+	log.Warnf("Serving VNC on %s", l.Addr())
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		lock.Lock()
+		if ctx.Err() != nil {
+			lock.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		conns[conn] = struct{}{}
+		lock.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.serve(conn); err != nil {
+				log.WithError(err).WithField("viewer", conn.RemoteAddr()).Info("Viewer disconnected")
+			}
+			lock.Lock()
+			delete(conns, conn)
+			lock.Unlock()
+		}()
+	}
+}
+
+// serve lets a viewer in and then serves it until it goes away.
+func (s *Server) serve(conn net.Conn) error {
+	defer func() {
+		_ = conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	if err := s.handshake(r, conn); err != nil {
+		return err
+	}
+	v := &viewer{
+		conn:    conn,
+		notify:  make(chan struct{}, 1),
+		held:    -1,
+		colours: newColours(s.o.Palette, defaultFormat),
+	}
+	s.lock.Lock()
+	s.viewers = append(s.viewers, v)
+	log.WithField("viewer", conn.RemoteAddr()).WithField("controls", len(s.viewers) == 1).Info("Viewer connected")
+	s.lock.Unlock()
+	defer s.leave(v)
+	// Only once it is in the queue for control is a viewer told it is in
+	if err := s.init(conn); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	written := make(chan error, 1)
+	go func() {
+		written <- s.write(v, done)
+	}()
+	err := s.read(r, v)
+	close(done)
+	_ = conn.Close()
+	if werr := <-written; err == io.EOF || err == nil {
+		err = werr
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// leave removes a viewer, releasing the key it held if it was in control.
+func (s *Server) leave(v *viewer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, o := range s.viewers {
+		if o == v {
+			s.viewers = append(s.viewers[:i], s.viewers[i+1:]...)
+			break
+		}
+	}
+	if v.held >= 0 && s.keys.IsKeyPressed(byte(v.held)) {
+		s.keys.Clear()
+	}
+}
+
+// controls returns whether the viewer presses the keys.
+func (s *Server) controls(v *viewer) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.viewers) > 0 && s.viewers[0] == v
+}
+
+// handshake agrees the version and security, which is none, with a viewer.
+func (s *Server) handshake(r io.Reader, w io.Writer) error {
+	if _, err := io.WriteString(w, protocolVersion); err != nil {
+		return err
+	}
+	version := make([]byte, len(protocolVersion))
+	if _, err := io.ReadFull(r, version); err != nil {
+		return err
+	}
+	if string(version) != protocolVersion {
+		err := fmt.Errorf("version %q is not supported, only %q", version, protocolVersion)
+		return refuse(w, []byte{0}, err)
+	}
+	if _, err := w.Write([]byte{1, securityNone}); err != nil {
+		return err
+	}
+	security := make([]byte, 1)
+	if _, err := io.ReadFull(r, security); err != nil {
+		return err
+	}
+	if security[0] != securityNone {
+		err := fmt.Errorf("security type %d is not supported", security[0])
+		return refuse(w, []byte{0, 0, 0, 1}, err)
+	}
+	// SecurityResult OK
+	if _, err := w.Write([]byte{0, 0, 0, 0}); err != nil {
+		return err
+	}
+	// Every viewer shares the desktop, so whether it asked to is ignored
+	_, err := io.ReadFull(r, make([]byte, 1))
+	return err
+}
+
+// init tells a viewer about the desktop.
+func (s *Server) init(w io.Writer) error {
+	init := serverInit{
+		Width:      uint16(s.desktop.Dx()),
+		Height:     uint16(s.desktop.Dy()),
+		Format:     defaultFormat,
+		NameLength: uint32(len(s.o.Name)),
+	}
+	if err := binary.Write(w, binary.BigEndian, init); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s.o.Name)
+	return err
+}
+
+// refuse sends a viewer the reason it can't connect after the message
+// saying it failed.
+func refuse(w io.Writer, failed []byte, reason error) error {
+	msg := append(failed, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(msg[len(failed):], uint32(len(reason.Error())))
+	msg = append(msg, reason.Error()...)
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return reason
+}
+
+// read handles the messages of a viewer until it goes away.
+func (s *Server) read(r io.Reader, v *viewer) error {
+	t := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, t); err != nil {
+			return err
+		}
+		var err error
+		switch t[0] {
+		case msgSetPixelFormat:
+			err = s.setPixelFormat(r, v)
+		case msgSetEncodings:
+			err = setEncodings(r, v)
+		case msgFramebufferUpdateRequest:
+			err = updateRequest(r, v, s.desktop)
+		case msgKeyEvent:
+			err = s.keyEvent(r, v)
+		case msgPointerEvent:
+			_, err = io.ReadFull(r, make([]byte, 5))
+		case msgClientCutText:
+			err = cutText(r)
+		default:
+			err = fmt.Errorf("unknown message type %d", t[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) setPixelFormat(r io.Reader, v *viewer) error {
+	var msg struct {
+		_      [3]byte
+		Format pixelFormat
+	}
+	if err := binary.Read(r, binary.BigEndian, &msg); err != nil {
+		return err
+	}
+	if err := msg.Format.check(); err != nil {
+		return err
+	}
+	c := newColours(s.o.Palette, msg.Format)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.colours = c
+	return nil
+}
+
+// setEncodings uses RRE when a viewer prefers it to raw.
+func setEncodings(r io.Reader, v *viewer) error {
+	var msg struct {
+		_     byte
+		Count uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &msg); err != nil {
+		return err
+	}
+	encodings := make([]int32, msg.Count)
+	if err := binary.Read(r, binary.BigEndian, encodings); err != nil {
+		return err
+	}
+	rre := false
+	for _, e := range encodings {
+		if e == encodingRaw || e == encodingRRE {
+			rre = e == encodingRRE
+			break
+		}
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.rre = rre
+	return nil
+}
+
+func updateRequest(r io.Reader, v *viewer, desktop image.Rectangle) error {
+	var msg struct {
+		Incremental         uint8
+		X, Y, Width, Height uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &msg); err != nil {
+		return err
+	}
+	x, y := int(msg.X), int(msg.Y)
+	rect := image.Rect(x, y, x+int(msg.Width), y+int(msg.Height)).Intersect(desktop)
+	v.lock.Lock()
+	v.request, v.incremental = &rect, msg.Incremental != 0
+	v.lock.Unlock()
+	v.signal()
+	return nil
+}
+
+// keyEvent presses and releases the keys typed by the viewer in control.
+func (s *Server) keyEvent(r io.Reader, v *viewer) error {
+	var msg struct {
+		Down uint8
+		_    [2]byte
+		Key  uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &msg); err != nil {
+		return err
+	}
+	if msg.Key > 0xFF || !s.controls(v) {
+		return nil
+	}
+	key, ok := s.o.Keymap[byte(msg.Key)]
+	if !ok {
+		return nil
+	}
+	if msg.Down != 0 {
+		s.keys.KeyPressed(key)
+		v.held = int(key)
+		return nil
+	}
+	if s.keys.IsKeyPressed(key) {
+		s.keys.Clear()
+	}
+	if v.held == int(key) {
+		v.held = -1
+	}
+	return nil
+}
+
+func cutText(r io.Reader) error {
+	var msg struct {
+		_      [3]byte
+		Length uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &msg); err != nil {
+		return err
+	}
+	_, err := io.CopyN(ioutil.Discard, r, int64(msg.Length))
+	return err
+}
+
+// write sends a viewer the bell when it rings and the part of the desktop
+// it asked for, once it changed if it asked for it incrementally, until
+// done.
+func (s *Server) write(v *viewer, done <-chan struct{}) error {
+	w := bufio.NewWriter(v.conn)
+	for {
+		select {
+		case <-v.notify:
+		case <-done:
+			return nil
+		}
+		s.lock.Lock()
+		sc := newScreen(s.frame, s.desktop)
+		s.lock.Unlock()
+
+		v.lock.Lock()
+		bell := v.bell
+		v.bell = false
+		var rect image.Rectangle
+		send := false
+		if v.request != nil {
+			// What changed is sent too, whatever was asked for, or it
+			// would be taken as sent
+			if v.sent != nil {
+				rect = sc.changed(v.sent)
+			}
+			if !v.incremental {
+				rect = rect.Union(*v.request)
+			} else if v.sent == nil {
+				rect = sc.desktop
+			}
+			send = !rect.Empty()
+		}
+		if send {
+			v.request = nil
+			// Until it has been sent all of the desktop there is nothing
+			// to tell what changed from
+			if v.sent != nil || rect == sc.desktop {
+				v.sent = sc.fb
+			}
+		}
+		c, rre := v.colours, v.rre
+		v.lock.Unlock()
+
+		if bell {
+			if err := w.WriteByte(msgBell); err != nil {
+				return err
+			}
+		}
+		if send {
+			if err := writeUpdate(w, sc, rect, c, rre); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
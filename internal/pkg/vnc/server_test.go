@@ -0,0 +1,340 @@
+package vnc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"github.com/carlosroman/go-chip-8/internal/pkg/tty"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+var _ cpu.Screen = &Server{}
+
+// testViewer is a minimal RFB client.
+type testViewer struct {
+	t      *testing.T
+	conn   net.Conn
+	r      *bufio.Reader
+	init   serverInit
+	name   string
+	bpp    int
+	served chan error
+}
+
+// dialPipe connects a viewer to s over a pipe, without the handshake.
+func dialPipe(t *testing.T, s *Server) *testViewer {
+	server, client := net.Pipe()
+	assert.NoError(t, client.SetDeadline(time.Now().Add(5*time.Second)))
+	v := &testViewer{t: t, conn: client, r: bufio.NewReader(client), bpp: 4, served: make(chan error, 1)}
+	go func() {
+		v.served <- s.serve(server)
+	}()
+	return v
+}
+
+// connect connects a viewer to s.
+func connect(t *testing.T, s *Server) *testViewer {
+	v := dialPipe(t, s)
+	assert.Equal(t, protocolVersion, string(v.read(12)))
+	v.write([]byte(protocolVersion))
+	assert.Equal(t, []byte{1, securityNone}, v.read(2))
+	v.write([]byte{securityNone})
+	assert.Equal(t, []byte{0, 0, 0, 0}, v.read(4))
+	v.write([]byte{1})
+	assert.NoError(t, binary.Read(v.r, binary.BigEndian, &v.init))
+	v.name = string(v.read(int(v.init.NameLength)))
+	return v
+}
+
+func (v *testViewer) read(n int) []byte {
+	b := make([]byte, n)
+	_, err := io.ReadFull(v.r, b)
+	if !assert.NoError(v.t, err) {
+		v.t.FailNow()
+	}
+	return b
+}
+
+func (v *testViewer) write(msg ...interface{}) {
+	for _, m := range msg {
+		if !assert.NoError(v.t, binary.Write(v.conn, binary.BigEndian, m)) {
+			v.t.FailNow()
+		}
+	}
+}
+
+func (v *testViewer) request(incremental bool, x, y, w, h uint16) {
+	i := uint8(0)
+	if incremental {
+		i = 1
+	}
+	v.write(uint8(msgFramebufferUpdateRequest), i, x, y, w, h)
+}
+
+// update reads a FramebufferUpdate of one rectangle.
+func (v *testViewer) update() (r rectangle, body []byte) {
+	assert.Equal(v.t, []byte{msgFramebufferUpdate, 0, 0, 1}, v.read(4))
+	assert.NoError(v.t, binary.Read(v.r, binary.BigEndian, &r))
+	switch r.Encoding {
+	case encodingRaw:
+		body = v.read(int(r.Width) * int(r.Height) * v.bpp)
+	case encodingRRE:
+		head := v.read(4 + v.bpp)
+		n := int(binary.BigEndian.Uint32(head))
+		body = append(head, v.read(n*(v.bpp+8))...)
+	default:
+		v.t.Fatalf("unexpected encoding %d", r.Encoding)
+	}
+	return r, body
+}
+
+// sync waits for the messages sent so far to be handled.
+func (v *testViewer) sync() {
+	v.request(false, 0, 0, 1, 1)
+	v.update()
+}
+
+func (v *testViewer) close() error {
+	assert.NoError(v.t, v.conn.Close())
+	select {
+	case err := <-v.served:
+		return err
+	case <-time.After(5 * time.Second):
+		v.t.Fatal("viewer was not disconnected")
+	}
+	return nil
+}
+
+// pixel returns a pixel of the default format from a raw rectangle.
+func pixel(r rectangle, body []byte, x, y int) uint32 {
+	i := (y*int(r.Width) + x) * 4
+	return binary.LittleEndian.Uint32(body[i:])
+}
+
+func TestServer_handshake(t *testing.T) {
+	t.Parallel()
+	v := connect(t, New("", cpu.NewKeyboard(), Options{}))
+	assert.Equal(t, uint16(512), v.init.Width)
+	assert.Equal(t, uint16(256), v.init.Height)
+	assert.Equal(t, defaultFormat, v.init.Format)
+	assert.Equal(t, "CHIP-8", v.name)
+	assert.NoError(t, v.close())
+
+	v = connect(t, New("", cpu.NewKeyboard(), Options{Scale: 2, Name: "pong"}))
+	assert.Equal(t, uint16(128), v.init.Width)
+	assert.Equal(t, uint16(64), v.init.Height)
+	assert.Equal(t, "pong", v.name)
+	assert.NoError(t, v.close())
+}
+
+func TestServer_handshake_refused(t *testing.T) {
+	t.Parallel()
+	v := dialPipe(t, New("", cpu.NewKeyboard(), Options{}))
+	v.read(12)
+	v.write([]byte("RFB 003.003\n"))
+	reason := `version "RFB 003.003\n" is not supported, only "RFB 003.008\n"`
+	assert.Equal(t, []byte{0, 0, 0, 0, byte(len(reason))}, v.read(5), "no security types")
+	assert.Equal(t, reason, string(v.read(len(reason))))
+	assert.EqualError(t, <-v.served, reason)
+
+	v = dialPipe(t, New("", cpu.NewKeyboard(), Options{}))
+	v.read(12)
+	v.write([]byte(protocolVersion))
+	v.read(2)
+	v.write([]byte{2})
+	reason = "security type 2 is not supported"
+	assert.Equal(t, []byte{0, 0, 0, 1, 0, 0, 0, byte(len(reason))}, v.read(8), "failed")
+	assert.Equal(t, reason, string(v.read(len(reason))))
+	assert.EqualError(t, <-v.served, reason)
+}
+
+func TestServer_raw(t *testing.T) {
+	t.Parallel()
+	s := New("", cpu.NewKeyboard(), Options{Scale: 2, Palette: display.DefaultPalette})
+	fb := make([]byte, 64*32)
+	fb[1] = 1
+	s.Draw(fb)
+	v := connect(t, s)
+	defer v.close()
+
+	v.request(false, 0, 0, 128, 64)
+	r, body := v.update()
+	assert.Equal(t, rectangle{Width: 128, Height: 64, Encoding: encodingRaw}, r)
+	assert.Equal(t, uint32(0), pixel(r, body, 1, 1))
+	assert.Equal(t, uint32(0xFFFFFF), pixel(r, body, 2, 0))
+	assert.Equal(t, uint32(0xFFFFFF), pixel(r, body, 3, 1))
+	assert.Equal(t, uint32(0), pixel(r, body, 4, 0))
+
+	v.request(true, 0, 0, 128, 64)
+	s.Draw(fb)
+	s.Sound(false)
+	s.Sound(true)
+	s.Sound(true)
+	assert.Equal(t, []byte{msgBell}, v.read(1), "nothing changed, only the bell")
+
+	fb[64+3] = 1
+	s.Draw(fb)
+	r, body = v.update()
+	assert.Equal(t, rectangle{X: 6, Y: 2, Width: 2, Height: 2, Encoding: encodingRaw}, r, "only what changed")
+	assert.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0, 0xFF, 0xFF, 0xFF, 0, 0xFF, 0xFF, 0xFF, 0, 0xFF, 0xFF, 0xFF, 0}, body)
+
+	fb[64*31+63] = 1
+	s.Draw(fb)
+	v.request(false, 0, 0, 4, 4)
+	r, _ = v.update()
+	assert.Equal(t, rectangle{Width: 128, Height: 64, Encoding: encodingRaw}, r, "what was asked for and what changed")
+}
+
+func TestServer_hires(t *testing.T) {
+	t.Parallel()
+	s := New("", cpu.NewKeyboard(), Options{Scale: 2, Palette: display.DefaultPalette})
+	fb := make([]byte, 128*64)
+	fb[len(fb)-1] = 1
+	s.Draw(fb)
+	v := connect(t, s)
+	defer v.close()
+	v.request(false, 126, 62, 2, 2)
+	r, body := v.update()
+	assert.Equal(t, rectangle{X: 126, Y: 62, Width: 2, Height: 2, Encoding: encodingRaw}, r)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0}, body, "drawn at half the scale")
+}
+
+func TestServer_rre(t *testing.T) {
+	t.Parallel()
+	s := New("", cpu.NewKeyboard(), Options{Scale: 2, Palette: display.DefaultPalette})
+	fb := make([]byte, 64*32)
+	fb[0], fb[1] = 1, 1
+	s.Draw(fb)
+	v := connect(t, s)
+	defer v.close()
+	v.write(uint8(msgSetEncodings), uint8(0), uint16(3), []int32{-223, encodingRRE, encodingRaw})
+	v.request(false, 0, 0, 128, 64)
+	r, body := v.update()
+	assert.Equal(t, rectangle{Width: 128, Height: 64, Encoding: encodingRRE}, r)
+	assert.Equal(t, []byte{0, 0, 0, 1, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 4, 0, 2}, body)
+
+	v.write(uint8(msgSetEncodings), uint8(0), uint16(2), []int32{encodingRaw, encodingRRE})
+	v.request(false, 0, 0, 1, 1)
+	r, _ = v.update()
+	assert.Equal(t, int32(encodingRaw), r.Encoding, "raw is preferred")
+}
+
+func TestServer_setPixelFormat(t *testing.T) {
+	t.Parallel()
+	p := display.Palette{On: color.RGBA{R: 0xFF, A: 0xFF}, Off: color.RGBA{A: 0xFF}}
+	s := New("", cpu.NewKeyboard(), Options{Scale: 1, Palette: p})
+	fb := make([]byte, 64*32)
+	fb[0] = 1
+	s.Draw(fb)
+	v := connect(t, s)
+	defer v.conn.Close()
+	rgb565 := pixelFormat{BitsPerPixel: 16, Depth: 16, BigEndian: 1, TrueColour: 1, RedMax: 31, GreenMax: 63, BlueMax: 31, RedShift: 11, GreenShift: 5}
+	v.write(uint8(msgSetPixelFormat), [3]byte{}, rgb565)
+	v.bpp = 2
+	v.request(false, 0, 0, 2, 1)
+	_, body := v.update()
+	assert.Equal(t, []byte{0xF8, 0x00, 0x00, 0x00}, body)
+
+	rgb565.TrueColour = 0
+	v.write(uint8(msgSetPixelFormat), [3]byte{}, rgb565)
+	assert.EqualError(t, <-v.served, "colour maps are not supported")
+}
+
+func TestServer_messages(t *testing.T) {
+	t.Parallel()
+	v := connect(t, New("", cpu.NewKeyboard(), Options{}))
+	defer v.conn.Close()
+	v.write(uint8(msgPointerEvent), uint8(1), uint16(10), uint16(20))
+	v.write(uint8(msgClientCutText), [3]byte{}, uint32(5), []byte("hello"))
+	v.sync()
+	v.write(uint8(9))
+	assert.EqualError(t, <-v.served, "unknown message type 9")
+}
+
+func TestServer_keys(t *testing.T) {
+	t.Parallel()
+	m, err := tty.ParseKeymap(tty.DefaultKeymap)
+	assert.NoError(t, err)
+	k := cpu.NewKeyboard()
+	s := New("", k, Options{Keymap: m})
+	key := func(v *testViewer, down bool, sym uint32) {
+		d := uint8(0)
+		if down {
+			d = 1
+		}
+		v.write(uint8(msgKeyEvent), d, [2]byte{}, sym)
+		v.sync()
+	}
+	controller := connect(t, s)
+	spectator := connect(t, s)
+	defer spectator.close()
+
+	key(controller, true, 'q')
+	assert.True(t, k.IsKeyPressed(0x4))
+	pressed, ok := k.PollKeyPressed()
+	assert.True(t, ok)
+	assert.Equal(t, byte(0x4), pressed)
+	key(spectator, true, 'w')
+	assert.True(t, k.IsKeyPressed(0x4), "spectators can't press keys")
+	key(controller, true, 0xFFE1)
+	key(controller, true, 'p')
+	assert.True(t, k.IsKeyPressed(0x4), "keys not in the keymap")
+	key(controller, false, 'Q')
+	assert.False(t, k.IsKeyPressed(0x4))
+
+	key(controller, true, 'v')
+	assert.True(t, k.IsKeyPressed(0xF))
+	assert.NoError(t, controller.close())
+	assert.False(t, k.IsKeyPressed(0xF), "released when the controller leaves")
+
+	key(spectator, true, 'w')
+	assert.True(t, k.IsKeyPressed(0x5), "the next viewer takes control")
+}
+
+func TestServer_Run(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Error(t, New(l.Addr().String(), cpu.NewKeyboard(), Options{}).Run(context.Background()), "address in use")
+
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+	s := New(addr, cpu.NewKeyboard(), Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- s.Run(ctx)
+	}()
+	var conn net.Conn
+	for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+	}
+	if !assert.NoError(t, err, "serving") {
+		cancel()
+		return
+	}
+	defer conn.Close()
+	assert.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	version := make([]byte, 12)
+	_, err = io.ReadFull(conn, version)
+	assert.NoError(t, err)
+	assert.Equal(t, protocolVersion, string(version))
+
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+}
@@ -0,0 +1,163 @@
+package web
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// hex returns a colour the way CSS writes it.
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// page draws the frames it is sent on a canvas, beeps when told to and sends
+// the keys pressed on its keypad, or on the left of a QWERTY keyboard, back.
+// See protocol.go for the messages.
+const page = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>CHIP-8</title>
+<style>
+body { margin: 0; padding: 1em; background: #222; color: #ddd; font-family: sans-serif; display: flex; flex-direction: column; align-items: center; gap: 1em; }
+canvas { width: min(95vw, 768px); image-rendering: pixelated; image-rendering: crisp-edges; border: 2px solid #555; }
+#keypad { display: grid; grid-template-columns: repeat(4, 4em); gap: 0.4em; user-select: none; touch-action: none; }
+#keypad button { height: 4em; font-size: 1.2em; font-family: monospace; background: #444; color: #eee; border: 1px solid #666; border-radius: 0.3em; }
+#keypad button.down { background: #888; }
+#status { font-size: 0.8em; color: #999; }
+</style>
+</head>
+<body>
+<canvas id="screen" width="64" height="32" data-lit="{{.On}}" data-unlit="{{.Off}}"></canvas>
+<div id="keypad"></div>
+<div id="status">Connecting...</div>
+<script>
+(function () {
+  "use strict";
+  var canvas = document.getElementById("screen");
+  var ctx = canvas.getContext("2d");
+  var status = document.getElementById("status");
+  var on = colour(canvas.dataset.lit), off = colour(canvas.dataset.unlit);
+  var width = 64, height = 32, pixels = new Uint8Array(width * height);
+
+  function colour(hex) {
+    var v = parseInt(hex.slice(1), 16);
+    return [(v >> 16) & 0xff, (v >> 8) & 0xff, v & 0xff];
+  }
+
+  function draw() {
+    if (canvas.width !== width || canvas.height !== height) {
+      canvas.width = width;
+      canvas.height = height;
+    }
+    var img = ctx.createImageData(width, height);
+    for (var i = 0; i < width * height; i++) {
+      // Pixels fading out or blended are a mix of the two colours
+      var level = pixels[i];
+      for (var j = 0; j < 3; j++) {
+        img.data[i * 4 + j] = Math.round(off[j] + (on[j] - off[j]) * level / 255);
+      }
+      img.data[i * 4 + 3] = 255;
+    }
+    ctx.putImageData(img, 0, 0);
+  }
+
+  var audio = null, gain = null;
+  function beep(b) {
+    if (audio === null) {
+      if (!b) {
+        return;
+      }
+      var AudioContext = window.AudioContext || window.webkitAudioContext;
+      if (!AudioContext) {
+        return;
+      }
+      audio = new AudioContext();
+      var osc = audio.createOscillator();
+      osc.type = "square";
+      osc.frequency.value = 440;
+      gain = audio.createGain();
+      gain.gain.value = 0;
+      osc.connect(gain);
+      gain.connect(audio.destination);
+      osc.start();
+    }
+    gain.gain.setValueAtTime(b ? 0.1 : 0, audio.currentTime);
+  }
+
+  var ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+  ws.binaryType = "arraybuffer";
+  ws.onopen = function () { status.textContent = "Connected"; };
+  ws.onclose = function () { status.textContent = "Disconnected"; beep(false); };
+  ws.onmessage = function (e) {
+    var m = new Uint8Array(e.data);
+    switch (m[0]) {
+    case 1:
+      width = m[1];
+      height = m[2];
+      pixels = m.slice(3);
+      draw();
+      break;
+    case 2:
+      for (var i = 1; i + 2 < m.length; i += 3) {
+        pixels[(m[i] << 8) | m[i + 1]] = m[i + 2];
+      }
+      draw();
+      break;
+    case 3:
+      beep(m[1] === 1);
+      break;
+    }
+  };
+
+  function send(down, key) {
+    if (audio !== null && audio.state === "suspended") {
+      audio.resume();
+    }
+    if (ws.readyState === WebSocket.OPEN) {
+      ws.send(new Uint8Array([down ? 1 : 0, key]));
+    }
+  }
+
+  // The COSMAC VIP keypad, row by row, and the keys typed for it
+  var keys = [0x1, 0x2, 0x3, 0xC, 0x4, 0x5, 0x6, 0xD, 0x7, 0x8, 0x9, 0xE, 0xA, 0x0, 0xB, 0xF];
+  var typed = "1234qwerasdfzxcv";
+  var buttons = {};
+  var keypad = document.getElementById("keypad");
+  keys.forEach(function (key) {
+    var b = document.createElement("button");
+    b.textContent = key.toString(16).toUpperCase();
+    var press = function (down) {
+      return function (e) {
+        e.preventDefault();
+        if (b.classList.contains("down") === down) {
+          return;
+        }
+        b.classList.toggle("down", down);
+        send(down, key);
+      };
+    };
+    b.addEventListener("pointerdown", press(true));
+    b.addEventListener("pointerup", press(false));
+    b.addEventListener("pointerleave", press(false));
+    b.addEventListener("pointercancel", press(false));
+    buttons[key] = b;
+    keypad.appendChild(b);
+  });
+  function typedKey(e, down) {
+    var i = typed.indexOf(e.key.toLowerCase());
+    if (i < 0 || e.repeat) {
+      return;
+    }
+    buttons[keys[i]].classList.toggle("down", down);
+    send(down, keys[i]);
+  }
+  document.addEventListener("keydown", function (e) { typedKey(e, true); });
+  document.addEventListener("keyup", function (e) { typedKey(e, false); });
+  draw();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/display"
+)
+
+// Messages the server sends over the WebSocket, each a binary message
+// starting with its type.
+const (
+	// msgFrame is a whole frame: width, height and then the pixels a byte
+	// each, row by row, from 0 for off to 255 for on. Those in between
+	// fade out or are blended, for the page to mix the palette's colours.
+	msgFrame = 0x01
+	// msgDiff changes pixels of the last frame sent: a big endian index of
+	// the pixel and its level now, three bytes a change.
+	msgDiff = 0x02
+	// msgSound turns the beep on, 1, or off, 0.
+	msgSound = 0x03
+)
+
+// Messages the page sends: whether a key went down, 1, or up, 0, and the
+// key.
+const (
+	keyUp   = 0x00
+	keyDown = 0x01
+)
+
+// levels returns how bright each pixel of a frame is, see display.Level.
+func levels(frameBuffer []byte) []byte {
+	l := make([]byte, len(frameBuffer))
+	for i, px := range frameBuffer {
+		l[i] = display.Level(px)
+	}
+	return l
+}
+
+// frame returns the message of a whole frame of levels.
+func frame(w, h int, p []byte) []byte {
+	return append([]byte{msgFrame, byte(w), byte(h)}, p...)
+}
+
+// diff returns the message that turns the frame of levels from into to, or
+// a whole frame when that is no bigger.
+func diff(w, h int, from, to []byte) []byte {
+	if len(from) != len(to) {
+		return frame(w, h, to)
+	}
+	msg := []byte{msgDiff}
+	for i := range to {
+		if from[i] == to[i] {
+			continue
+		}
+		msg = append(msg, byte(i>>8), byte(i), to[i])
+		if len(msg) >= len(to)+3 {
+			return frame(w, h, to)
+		}
+	}
+	return msg
+}
+
+// sound returns the message that turns the beep on or off.
+func sound(on bool) []byte {
+	if on {
+		return []byte{msgSound, 1}
+	}
+	return []byte{msgSound, 0}
+}
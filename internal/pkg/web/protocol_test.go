@@ -0,0 +1,44 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	t.Parallel()
+	fb := make([]byte, 64*32)
+	fb[0], fb[9], fb[63], fb[64] = 1, 255, 0x7F, 0x80
+	l := levels(fb)
+	assert.Len(t, l, 64*32)
+	assert.Equal(t, byte(0xFF), l[0], "1 is on")
+	assert.Equal(t, byte(0xFF), l[9])
+	assert.Equal(t, byte(0x7F), l[63], "fading out")
+	assert.Equal(t, byte(0x80), l[64])
+	assert.Equal(t, byte(0x00), l[1])
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	from := make([]byte, 256)
+	to := make([]byte, 256)
+	to[1], to[255] = 0xF0, 0x01
+	assert.Equal(t, []byte{msgDiff, 0x00, 0x01, 0xF0, 0x00, 0xFF, 0x01}, diff(64, 32, from, to))
+	assert.Equal(t, []byte{msgDiff}, diff(64, 32, to, to), "nothing changed")
+
+	for i := range to {
+		to[i] = 0xFF
+	}
+	msg := diff(64, 32, from, to)
+	assert.Equal(t, []byte{msgFrame, 64, 32}, msg[:3], "a whole frame is smaller")
+	assert.Equal(t, to, msg[3:])
+
+	msg = diff(128, 64, from, make([]byte, 1024))
+	assert.Equal(t, []byte{msgFrame, 128, 64}, msg[:3], "another size")
+}
+
+func TestSound(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []byte{msgSound, 1}, sound(true))
+	assert.Equal(t, []byte{msgSound, 0}, sound(false))
+}
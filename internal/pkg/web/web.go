@@ -0,0 +1,270 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"html/template"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// writeWait is how long a client has to take a message before it is
+	// dropped.
+	writeWait = 5 * time.Second
+	// shutdownWait is how long requests have to finish once the server is
+	// stopped.
+	shutdownWait = 2 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  64,
+	WriteBufferSize: 1024,
+}
+
+// Server is a frontend that plays in a browser. It serves a page that draws
+// the screen and has a keypad, streams frames to it over a WebSocket and
+// presses the keys of the Keyboard the page sends back. It is the Screen
+// and the Loop.
+type Server struct {
+	addr    string
+	keys    cpu.Keyboard
+	palette display.Palette
+
+	lock          sync.Mutex
+	width, height int
+	frame         []byte // Levels of the last frame drawn, never changed once set
+	sound         bool
+	clients       map[*client]struct{}
+}
+
+// client is a page connected to the WebSocket.
+type client struct {
+	conn   *websocket.Conn
+	notify chan struct{} // Signalled when there is something new to send
+}
+
+// New returns a frontend that serves on addr, presses the keys it is sent
+// on k and draws pixels in the colours of p.
+func New(addr string, k cpu.Keyboard, p display.Palette) *Server {
+	return &Server{
+		addr:    addr,
+		keys:    k,
+		palette: p,
+		clients: make(map[*client]struct{}),
+	}
+}
+
+func (s *Server) Draw(frameBuffer []byte) {
+	w, h := dimensions(len(frameBuffer))
+	p := levels(frameBuffer)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if bytes.Equal(p, s.frame) {
+		return
+	}
+	s.width, s.height, s.frame = w, h, p
+	s.signal()
+}
+
+// Sound turns the beep of the pages on or off.
+func (s *Server) Sound(on bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if on == s.sound {
+		return
+	}
+	s.sound = on
+	s.signal()
+}
+
+// signal wakes the clients up to send what changed, s.lock must be held.
+func (s *Server) signal() {
+	for c := range s.clients {
+		select {
+		case c.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Handler returns the handler of the page, at /, and of the WebSocket, at
+// /ws.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc("/ws", s.serveWebSocket)
+	return mux
+}
+
+// Run serves on the address of the server until ctx is done, when the
+// pages connected are disconnected.
+func (s *Server) Run(ctx context.Context) error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: s.Handler()}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		s.disconnect()
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownWait)
+		defer cancel()
+		if err := srv.Shutdown(sctx); err != nil {
+			log.WithError(err).Error("Could not stop web server")
+		}
+	}()
+	log.Warnf("Serving on http://%s/", l.Addr())
+	if err = srv.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// disconnect closes the WebSockets, which the server does not stop itself.
+func (s *Server) disconnect() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for c := range s.clients {
+		if err := c.conn.Close(); err != nil {
+			log.WithError(err).Debug("Could not close WebSocket")
+		}
+	}
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(page))
+
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := pageTemplate.Execute(w, struct{ On, Off string }{
+		On:  hex(s.palette.On),
+		Off: hex(s.palette.Off),
+	})
+	if err != nil {
+		log.WithError(err).Error("Could not serve page")
+	}
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with the error
+		log.WithError(err).Debug("Could not upgrade to a WebSocket")
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	c := &client{conn: conn, notify: make(chan struct{}, 1)}
+	s.lock.Lock()
+	s.clients[c] = struct{}{}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.clients, c)
+		s.lock.Unlock()
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.readKeys(conn)
+	}()
+	if err := s.writeFrames(c, done); err != nil {
+		log.WithError(err).Debug("Could not write to WebSocket")
+	}
+}
+
+// readKeys presses and releases the keys a page sends until it goes away,
+// when the key it held is released.
+func (s *Server) readKeys(conn *websocket.Conn) {
+	held := -1
+	defer func() {
+		if held >= 0 && s.keys.IsKeyPressed(byte(held)) {
+			s.keys.Clear()
+		}
+	}()
+	for {
+		t, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if t != websocket.BinaryMessage || len(msg) != 2 || msg[1] > 0xF {
+			log.WithField("message", msg).Debug("Ignoring message")
+			continue
+		}
+		key := msg[1]
+		switch msg[0] {
+		case keyDown:
+			s.keys.KeyPressed(key)
+			held = int(key)
+		case keyUp:
+			if s.keys.IsKeyPressed(key) {
+				s.keys.Clear()
+			}
+			if held == int(key) {
+				held = -1
+			}
+		}
+	}
+}
+
+// writeFrames sends a client the frame, then what changes in it and the
+// sound, until done.
+func (s *Server) writeFrames(c *client, done <-chan struct{}) error {
+	var sent []byte
+	on := false
+	for {
+		s.lock.Lock()
+		w, h, f, snd := s.width, s.height, s.frame, s.sound
+		s.lock.Unlock()
+		if f != nil && !bytes.Equal(sent, f) {
+			msg := frame(w, h, f)
+			if sent != nil {
+				msg = diff(w, h, sent, f)
+			}
+			if err := write(c.conn, msg); err != nil {
+				return err
+			}
+			sent = f
+		}
+		if snd != on {
+			if err := write(c.conn, sound(snd)); err != nil {
+				return err
+			}
+			on = snd
+		}
+		select {
+		case <-c.notify:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+func write(conn *websocket.Conn, msg []byte) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.BinaryMessage, msg)
+}
+
+// dimensions returns the size of a frame of n pixels.
+func dimensions(n int) (width, height int) {
+	if n == 128*64 {
+		return 128, 64
+	}
+	return 64, n / 64
+}
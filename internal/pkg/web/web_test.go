@@ -0,0 +1,173 @@
+package web
+
+import (
+	"context"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var _ cpu.Screen = &Server{}
+
+func dial(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return conn
+}
+
+func read(t *testing.T, conn *websocket.Conn) []byte {
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	mt, msg, err := conn.ReadMessage()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, websocket.BinaryMessage, mt)
+	return msg
+}
+
+// eventually fails unless ok is true within a few seconds.
+func eventually(t *testing.T, ok func() bool, msgAndArgs ...interface{}) {
+	for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(time.Millisecond) {
+		if ok() {
+			return
+		}
+	}
+	assert.Fail(t, "condition never met", msgAndArgs...)
+}
+
+func TestServer_page(t *testing.T) {
+	t.Parallel()
+	p, err := display.ParsePalette("green")
+	assert.NoError(t, err)
+	ts := httptest.NewServer(New("", cpu.NewKeyboard(), p).Handler())
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+	b, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `<canvas id="screen" width="64" height="32" data-lit="`+hex(p.On)+`" data-unlit="`+hex(p.Off)+`">`)
+	assert.Contains(t, string(b), `new WebSocket(`)
+
+	res, err = http.Get(ts.URL + "/nothing")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestServer_frames(t *testing.T) {
+	t.Parallel()
+	s := New("", cpu.NewKeyboard(), display.DefaultPalette)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	fb := make([]byte, 64*32)
+	fb[0] = 1
+	s.Draw(fb)
+	conn := dial(t, ts)
+	defer conn.Close()
+	msg := read(t, conn)
+	assert.Equal(t, []byte{msgFrame, 64, 32, 0xFF}, msg[:4], "the whole frame first")
+	assert.Len(t, msg, 3+64*32)
+
+	fb[64*31+63] = 1
+	fb[0] = 0
+	s.Draw(fb)
+	assert.Equal(t, []byte{msgDiff, 0x00, 0x00, 0x00, 0x07, 0xFF, 0xFF}, read(t, conn), "then what changed")
+
+	s.Draw(fb)
+	s.Sound(true)
+	assert.Equal(t, []byte{msgSound, 1}, read(t, conn), "nothing to send for the same frame")
+	s.Sound(false)
+	assert.Equal(t, []byte{msgSound, 0}, read(t, conn))
+
+	other := dial(t, ts)
+	defer other.Close()
+	msg = read(t, other)
+	assert.Equal(t, []byte{msgFrame, 64, 32}, msg[:3], "each page is sent the whole frame")
+	assert.Equal(t, byte(0xFF), msg[len(msg)-1])
+
+	fb[64*31+63] = 0x40
+	s.Draw(fb)
+	assert.Equal(t, []byte{msgDiff, 0x07, 0xFF, 0x40}, read(t, conn), "pixels fading out are sent as they are")
+}
+
+func TestServer_keys(t *testing.T) {
+	t.Parallel()
+	k := cpu.NewKeyboard()
+	ts := httptest.NewServer(New("", k, display.DefaultPalette).Handler())
+	defer ts.Close()
+	conn := dial(t, ts)
+
+	pressed := func(key byte) func() bool {
+		return func() bool { return k.IsKeyPressed(key) }
+	}
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{keyDown, 0xA}))
+	eventually(t, pressed(0xA))
+	key, ok := k.PollKeyPressed()
+	assert.True(t, ok)
+	assert.Equal(t, byte(0xA), key)
+
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("hi")))
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{keyDown, 0x10}))
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{keyUp, 0x3}))
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{keyDown, 0x3}))
+	eventually(t, pressed(0x3), "messages that aren't keys are ignored")
+
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{keyUp, 0x3}))
+	eventually(t, func() bool { return !k.IsKeyPressed(0x3) })
+
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{keyDown, 0x7}))
+	eventually(t, pressed(0x7))
+	assert.NoError(t, conn.Close())
+	eventually(t, func() bool { return !k.IsKeyPressed(0x7) }, "released when the page goes")
+}
+
+func TestServer_Run(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.Error(t, New(l.Addr().String(), cpu.NewKeyboard(), display.DefaultPalette).Run(context.Background()), "address in use")
+
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+	s := New(addr, cpu.NewKeyboard(), display.DefaultPalette)
+	s.Draw(make([]byte, 64*32))
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- s.Run(ctx)
+	}()
+	var conn *websocket.Conn
+	eventually(t, func() bool {
+		conn, _, err = websocket.DefaultDialer.Dial("ws://"+addr+"/ws", nil)
+		return err == nil
+	}, "serving")
+	defer conn.Close()
+	assert.Equal(t, byte(msgFrame), read(t, conn)[0])
+
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err = conn.ReadMessage()
+	assert.Error(t, err, "disconnected")
+}
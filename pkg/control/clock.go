@@ -0,0 +1,47 @@
+package control
+
+import (
+	"time"
+)
+
+// DefaultCatchUp is the most frames run at once to catch up with, unless
+// the options say otherwise.
+const DefaultCatchUp = 4
+
+// clock paces frames, 60 a second times a multiplier, telling how many are
+// due each time the controller wakes up. When the host falls behind, the
+// frames it missed are due together so the emulator catches up, up to a
+// bound past which they are skipped instead.
+type clock struct {
+	frame   time.Duration // How long a frame lasts, 0 when unthrottled
+	catchUp int           // Most frames due at once
+	next    time.Time     // When the next frame is due
+}
+
+// set sets the multiplier, with the next frame due at now.
+func (k *clock) set(multiplier float64, now time.Time) {
+	k.frame = 0
+	if multiplier != Unthrottled {
+		k.frame = time.Duration(float64(time.Second) / (60 * multiplier))
+	}
+	k.next = now
+}
+
+// due returns how many frames are due at now, and when none are how long
+// until the next one is.
+func (k *clock) due(now time.Time) (frames int, wait time.Duration) {
+	if k.frame == 0 {
+		return 1, 0
+	}
+	if now.Before(k.next) {
+		return 0, k.next.Sub(now)
+	}
+	frames = 1 + int(now.Sub(k.next)/k.frame)
+	if frames > k.catchUp {
+		// Too far behind to catch up, the rest are skipped
+		k.next = now.Add(k.frame)
+		return k.catchUp, 0
+	}
+	k.next = k.next.Add(time.Duration(frames) * k.frame)
+	return frames, 0
+}
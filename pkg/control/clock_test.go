@@ -0,0 +1,48 @@
+package control
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestClock_due(t *testing.T) {
+	t.Parallel()
+	start := time.Unix(0, 0)
+	at := func(frames float64) time.Time {
+		return start.Add(time.Duration(frames * float64(time.Second) / 60))
+	}
+	k := clock{catchUp: 4}
+	k.set(1, start)
+
+	frames, wait := k.due(start)
+	assert.Equal(t, 1, frames, "the first is due at once")
+	assert.Equal(t, time.Duration(0), wait)
+	frames, wait = k.due(at(0.5))
+	assert.Equal(t, 0, frames)
+	assert.Equal(t, k.frame/2, wait)
+
+	frames, _ = k.due(at(3.5))
+	assert.Equal(t, 3, frames, "caught up")
+	frames, _ = k.due(at(4))
+	assert.Equal(t, 1, frames)
+
+	frames, _ = k.due(at(100))
+	assert.Equal(t, 4, frames, "caught up as far as the bound")
+	frames, _ = k.due(at(100.5))
+	assert.Equal(t, 0, frames, "the rest were skipped")
+	frames, _ = k.due(at(101))
+	assert.Equal(t, 1, frames)
+
+	k.set(2, at(200))
+	k.due(at(200))
+	frames, _ = k.due(at(201))
+	assert.Equal(t, 2, frames, "twice as many at twice the speed")
+
+	k.set(Unthrottled, at(300))
+	for i := 0; i < 3; i++ {
+		frames, wait = k.due(at(300))
+		assert.Equal(t, 1, frames, "always one unthrottled")
+		assert.Equal(t, time.Duration(0), wait)
+	}
+}
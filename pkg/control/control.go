@@ -0,0 +1,597 @@
+// Package control runs a CPU so that it can be paused, stepped, reset,
+// inspected and changed while it runs, from another goroutine than the one
+// running it.
+package control
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Machine is the CPU a Controller runs.
+type Machine interface {
+	Tick() error
+	PC() uint16
+	Memory() state.Memory
+	FrameBuffer() []byte
+	Registers() cpu.Step
+	Reset()
+	Load(rom []byte) error
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
+	IdleLoop() int
+	SkipIdle(n int) int
+	Waiting() bool
+}
+
+// Types of Event.
+const (
+	Breakpoint = "breakpoint" // The CPU paused at a breakpoint
+	Sound      = "sound"      // The sound turned on or off
+	Halted     = "halted"     // The program jumped to itself, or the CPU failed
+	Waiting    = "waiting"    // The program waits for a key to be pressed
+)
+
+// Event is something that happened while the CPU ran.
+type Event struct {
+	Type  string `json:"type"`
+	PC    uint16 `json:"pc"`
+	Cycle uint64 `json:"cycle"`
+	On    bool   `json:"on,omitempty"`    // Whether the sound is on, for Sound
+	Error string `json:"error,omitempty"` // Why the CPU failed, for Halted
+}
+
+// Unthrottled is the multiplier that runs the emulator as fast as it can.
+const Unthrottled = 0
+
+// Multipliers are the multipliers Faster and Slower step through.
+var Multipliers = []float64{0.25, 0.5, 1, 2, 4, 8, Unthrottled}
+
+// Status is whether and how fast the CPU is running.
+type Status struct {
+	Paused     bool    `json:"paused"`
+	PC         uint16  `json:"pc"`
+	Cycle      uint64  `json:"cycle"`
+	Speed      int     `json:"speed"`      // Instructions a second
+	Multiplier float64 `json:"multiplier"` // Of the speed and of the frame rate, 0 for unthrottled
+}
+
+// Options configure a Controller.
+type Options struct {
+	Speed   int          // Instructions a second
+	CatchUp int          // Most frames to run at once when the host falls behind, see DefaultCatchUp
+	ROM     []byte       // What a hard reset loads
+	Present func() error // Presents what was drawn, once a frame
+	Timers  func() error // Counts the timers down, once a frame
+
+	// SkipIdle skips the instructions of loops that only wait for the
+	// delay timer or a key, which are the same until the frame ends, so
+	// that fast forwarding isn't slowed down by them and the host sleeps
+	// instead of executing them.
+	SkipIdle bool
+}
+
+// Controller runs a Machine a frame at a time, 60 times a second times its
+// multiplier, until it is paused. Each frame executes the instructions of a
+// 60th of a second and then presents what was drawn and counts the timers
+// down, so the timers keep time with the instructions at any speed.
+// Everything it does is done one thing at a time, so the machine can be
+// looked at and changed between two instructions.
+type Controller struct {
+	m    Machine
+	keys cpu.Keyboard
+	o    Options
+	wake chan struct{} // Signalled when resumed or the speed changes
+
+	lock        sync.Mutex
+	paused      bool
+	speed       int
+	multiplier  float64
+	clock       clock
+	owed        float64 // Instructions owed to the next frame, from speeds that aren't a multiple of 60
+	rom         []byte
+	breakpoints map[uint16]struct{}
+	breakCycle  uint64 // Cycle to pause at, 0 for none
+	halted      bool   // Whether Halted was sent for the loop the program is in
+	waiting     bool   // Whether Waiting was sent for the key the program waits for
+	sound       bool
+	subscribers map[chan Event]struct{}
+}
+
+// New returns a controller that runs m, pressing keys on k.
+func New(m Machine, k cpu.Keyboard, o Options) *Controller {
+	if o.Speed < 1 {
+		o.Speed = 100
+	}
+	if o.Present == nil {
+		o.Present = func() error { return nil }
+	}
+	if o.Timers == nil {
+		o.Timers = func() error { return nil }
+	}
+	if o.CatchUp < 1 {
+		o.CatchUp = DefaultCatchUp
+	}
+	return &Controller{
+		m:           m,
+		keys:        k,
+		o:           o,
+		wake:        make(chan struct{}, 1),
+		speed:       o.Speed,
+		multiplier:  1,
+		clock:       clock{catchUp: o.CatchUp},
+		rom:         o.ROM,
+		breakpoints: make(map[uint16]struct{}),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Run runs the machine until ctx is done.
+func (c *Controller) Run(ctx context.Context) {
+	log.Info("Starting controller")
+	c.lock.Lock()
+	c.clock.set(c.multiplier, time.Now())
+	c.lock.Unlock()
+	for {
+		if c.Paused() {
+			select {
+			case <-c.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		c.lock.Lock()
+		frames, wait := c.clock.due(time.Now())
+		var err error
+		for i := 0; i < frames && err == nil && !c.paused; i++ {
+			err = c.frame(false)
+		}
+		c.lock.Unlock()
+		if err != nil {
+			log.WithError(err).Warn("Got an error running frame, exiting")
+			return
+		}
+		if wait == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				continue
+			}
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-c.wake:
+			// Sped up, which set the clock going again
+			t.Stop()
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+// tick executes an instruction, pausing at breakpoints and when the CPU
+// fails. c.lock must be held.
+func (c *Controller) tick() bool {
+	if err := c.m.Tick(); err != nil {
+		c.paused = true
+		c.publish(Event{Type: Halted, Error: err.Error()})
+		return false
+	}
+	pc := c.m.PC()
+	_, ok := c.breakpoints[pc]
+	if c.breakCycle > 0 && c.m.Registers().Cycle >= c.breakCycle {
+		c.breakCycle, ok = 0, true
+	}
+	if ok {
+		c.paused = true
+		c.publish(Event{Type: Breakpoint})
+		return false
+	}
+	m := c.m.Memory()
+	loop := int(pc)+1 < len(m) && binary.BigEndian.Uint16(m[pc:]) == 0x1000|pc
+	if loop && !c.halted {
+		c.publish(Event{Type: Halted})
+	}
+	c.halted = loop
+	return true
+}
+
+// frame executes the instructions of a frame, then presents it and counts
+// the timers down, unless paused before or by a breakpoint. Paused frames
+// are executed when advance is set. c.lock must be held.
+func (c *Controller) frame(advance bool) error {
+	if c.paused && !advance {
+		return nil
+	}
+	for c.owed += float64(c.speed) / 60; c.owed >= 1; c.owed-- {
+		if c.o.SkipIdle {
+			if c.owed -= float64(c.skipIdle(int(c.owed))); c.owed < 1 {
+				break
+			}
+		}
+		if !c.tick() {
+			c.owed = 0
+			c.present()
+			return nil
+		}
+	}
+	c.wait()
+	if err := c.o.Present(); err != nil {
+		return err
+	}
+	if err := c.o.Timers(); err != nil {
+		return err
+	}
+	if on := c.m.Registers().ST > 0; on != c.sound {
+		c.sound = on
+		c.publish(Event{Type: Sound, On: on})
+	}
+	return nil
+}
+
+// wait publishes Waiting when the program has started waiting for a key.
+// FX0A is executed again until one is pressed, so the lock is never held
+// while waiting. c.lock must be held.
+func (c *Controller) wait() {
+	waiting := c.m.Waiting()
+	if waiting && !c.waiting {
+		c.publish(Event{Type: Waiting})
+	}
+	c.waiting = waiting
+}
+
+// skipIdle skips up to n instructions of a loop that waits for the delay
+// timer or a key, unless it has a breakpoint, returning how many it
+// skipped. c.lock must be held.
+func (c *Controller) skipIdle(n int) int {
+	l := c.m.IdleLoop()
+	if l == 0 {
+		return 0
+	}
+	for pc := c.m.PC(); pc < c.m.PC()+2*uint16(l); pc += 2 {
+		if _, ok := c.breakpoints[pc]; ok {
+			return 0
+		}
+	}
+	if c.breakCycle > 0 {
+		// Up to the instruction that pauses at the cycle, which is
+		// executed to pause there
+		cycle := c.m.Registers().Cycle
+		if cycle >= c.breakCycle {
+			return 0
+		}
+		if left := c.breakCycle - cycle - 1; left < uint64(n) {
+			n = int(left)
+		}
+	}
+	return c.m.SkipIdle(n)
+}
+
+// present presents what was drawn while paused. c.lock must be held.
+func (c *Controller) present() {
+	if err := c.o.Present(); err != nil {
+		log.WithError(err).Error("Could not present frame")
+	}
+}
+
+// publish sends an event to the subscribers, dropping it for those that
+// are behind. c.lock must be held.
+func (c *Controller) publish(e Event) {
+	r := c.m.Registers()
+	e.PC, e.Cycle = r.PC, r.Cycle
+	for s := range c.subscribers {
+		select {
+		case s <- e:
+		default:
+			log.WithField("event", e.Type).Warn("Subscriber is behind, dropped event")
+		}
+	}
+}
+
+// Subscribe returns the events from now on, until unsubscribe is called.
+func (c *Controller) Subscribe() (events <-chan Event, unsubscribe func()) {
+	s := make(chan Event, 64)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.subscribers[s] = struct{}{}
+	return s, func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		delete(c.subscribers, s)
+	}
+}
+
+// Status returns whether and how fast the CPU is running.
+func (c *Controller) Status() Status {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	r := c.m.Registers()
+	return Status{Paused: c.paused, PC: r.PC, Cycle: r.Cycle, Speed: c.speed, Multiplier: c.multiplier}
+}
+
+func (c *Controller) Paused() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.paused
+}
+
+// Pause stops instructions from executing, frames from being presented and
+// the timers from counting down.
+func (c *Controller) Pause() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.paused = true
+}
+
+func (c *Controller) Resume() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.paused = false
+	c.clock.set(c.multiplier, time.Now())
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Reset starts the program again, with the memory as it is.
+func (c *Controller) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.m.Reset()
+	c.halted, c.waiting = false, false
+	c.present()
+}
+
+// HardReset starts the program again as it was loaded, in blank memory and
+// with a blank screen.
+func (c *Controller) HardReset() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.load(c.rom)
+}
+
+// LoadROM starts another program, which hard resets then start again.
+func (c *Controller) LoadROM(rom []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.load(rom); err != nil {
+		return err
+	}
+	c.rom = rom
+	return nil
+}
+
+// load starts rom. c.lock must be held.
+func (c *Controller) load(rom []byte) error {
+	if err := c.m.Load(rom); err != nil {
+		return err
+	}
+	c.halted, c.waiting, c.owed = false, false, 0
+	c.present()
+	return nil
+}
+
+// FrameAdvance pauses and then runs a frame, returning the registers after.
+func (c *Controller) FrameAdvance() (cpu.Step, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.paused = true
+	err := c.frame(true)
+	return c.m.Registers(), err
+}
+
+// Step pauses and then executes n instructions, stopping early at
+// breakpoints, and returns the registers after.
+func (c *Controller) Step(n int) cpu.Step {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.paused = true
+	for i := 0; i < n && c.tick(); i++ {
+	}
+	c.wait()
+	c.present()
+	return c.m.Registers()
+}
+
+// PressKey presses a key of the keypad, from 0x0 to 0xF.
+func (c *Controller) PressKey(key byte) error {
+	if key > 0xF {
+		return fmt.Errorf("there is no key %#x, keys are 0x0 to 0xF", key)
+	}
+	c.keys.KeyPressed(key)
+	return nil
+}
+
+// ReleaseKey releases a key if it is pressed.
+func (c *Controller) ReleaseKey(key byte) error {
+	if key > 0xF {
+		return fmt.Errorf("there is no key %#x, keys are 0x0 to 0xF", key)
+	}
+	if c.keys.IsKeyPressed(key) {
+		c.keys.Clear()
+	}
+	return nil
+}
+
+// Registers returns the state of the CPU about to execute the next
+// instruction.
+func (c *Controller) Registers() cpu.Step {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.m.Registers()
+}
+
+// ReadMemory returns a copy of n bytes of memory from addr.
+func (c *Controller) ReadMemory(addr uint16, n int) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m := c.m.Memory()
+	if n < 0 || int(addr)+n > len(m) {
+		return nil, fmt.Errorf("%d bytes at %#03x are outside of memory", n, addr)
+	}
+	return append([]byte(nil), m[addr:int(addr)+n]...), nil
+}
+
+// WriteMemory writes data to memory from addr.
+func (c *Controller) WriteMemory(addr uint16, data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m := c.m.Memory()
+	if int(addr)+len(data) > len(m) {
+		return fmt.Errorf("%d bytes at %#03x are outside of memory", len(data), addr)
+	}
+	copy(m[addr:], data)
+	c.halted = false
+	return nil
+}
+
+// FrameBuffer returns a copy of what the CPU has drawn, a byte a pixel.
+func (c *Controller) FrameBuffer() []byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.m.FrameBuffer()
+}
+
+// SaveState writes the state of the machine between two instructions.
+func (c *Controller) SaveState(w io.Writer) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.m.SaveState(w)
+}
+
+// LoadState carries on from a state written by SaveState.
+func (c *Controller) LoadState(r io.Reader) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.m.LoadState(r); err != nil {
+		return err
+	}
+	c.halted, c.waiting = false, false
+	c.present()
+	return nil
+}
+
+// SetSpeed sets how many instructions are executed a second.
+func (c *Controller) SetSpeed(speed int) error {
+	if speed < 1 {
+		return fmt.Errorf("speed %d must be at least 1 instruction a second", speed)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.speed = speed
+	return nil
+}
+
+// SetMultiplier sets how many times faster than its speed the emulator
+// runs, the instructions and the frames alike, Unthrottled to run it as fast
+// as it can.
+func (c *Controller) SetMultiplier(multiplier float64) error {
+	if multiplier != Unthrottled && !(multiplier >= 0.25) {
+		return fmt.Errorf("speed multiplier %g must be at least 0.25, or 0 to run unthrottled", multiplier)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.setMultiplier(multiplier)
+	return nil
+}
+
+func (c *Controller) Multiplier() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.multiplier
+}
+
+// Faster sets the next of the Multipliers, returning it.
+func (c *Controller) Faster() float64 {
+	return c.stepMultiplier(true)
+}
+
+// Slower sets the previous of the Multipliers, returning it.
+func (c *Controller) Slower() float64 {
+	return c.stepMultiplier(false)
+}
+
+func (c *Controller) stepMultiplier(faster bool) float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// Unthrottled is the fastest
+	fast := func(m float64) float64 {
+		if m == Unthrottled {
+			return math.Inf(1)
+		}
+		return m
+	}
+	next := c.multiplier
+	for i := range Multipliers {
+		if faster {
+			if m := Multipliers[i]; fast(m) > fast(c.multiplier) {
+				next = m
+				break
+			}
+		} else if m := Multipliers[len(Multipliers)-1-i]; fast(m) < fast(c.multiplier) {
+			next = m
+			break
+		}
+	}
+	c.setMultiplier(next)
+	return next
+}
+
+// setMultiplier sets the multiplier, waking the controller up in case it
+// is waiting for the next frame at the speed before. c.lock must be held.
+func (c *Controller) setMultiplier(multiplier float64) {
+	c.multiplier = multiplier
+	c.clock.set(multiplier, time.Now())
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// AddBreakpoint pauses the CPU when it is about to execute the instruction
+// at addr.
+func (c *Controller) AddBreakpoint(addr uint16) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.breakpoints[addr] = struct{}{}
+}
+
+func (c *Controller) RemoveBreakpoint(addr uint16) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.breakpoints, addr)
+}
+
+// BreakAtCycle pauses the CPU once, when it has executed cycle
+// instructions, as a breakpoint does, or never when cycle is 0.
+func (c *Controller) BreakAtCycle(cycle uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.breakCycle = cycle
+}
+
+// Breakpoints returns the addresses of the breakpoints, lowest first.
+func (c *Controller) Breakpoints() []uint16 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	bs := make([]uint16, 0, len(c.breakpoints))
+	for b := range c.breakpoints {
+		bs = append(bs, b)
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i] < bs[j] })
+	return bs
+}
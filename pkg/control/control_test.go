@@ -0,0 +1,459 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+type screenMock struct{}
+
+func (s *screenMock) Draw(frameBuffer []byte) {}
+
+// newController returns a controller of a CPU that runs program, with the
+// sound timer draining into a channel nobody has to read.
+func newController(program []byte, speed int) (*Controller, cpu.Keyboard) {
+	m := state.InitMemory()
+	copy(m[0x200:], program)
+	k := cpu.NewKeyboard()
+	ti := cpu.NewTimer(make(chan byte, 1<<16))
+	c := cpu.NewCPU(m, rand.New(rand.NewSource(42)), k, ti, &screenMock{})
+	return New(c, k, Options{Speed: speed, ROM: program, Present: c.VBlank, Timers: ti.Tick}), k
+}
+
+// next returns the next event, failing the test if none comes.
+func next(t *testing.T, events <-chan Event) Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+		return Event{}
+	}
+}
+
+func TestController_Step(t *testing.T) {
+	t.Parallel()
+	// V0 = 5, V0 += 1, jump to itself
+	c, _ := newController([]byte{0x60, 0x05, 0x70, 0x01, 0x12, 0x04}, 100)
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+
+	r := c.Step(1)
+	assert.Equal(t, uint16(0x202), r.PC)
+	assert.Equal(t, byte(5), r.V[0])
+	assert.True(t, c.Paused())
+
+	r = c.Step(1)
+	assert.Equal(t, uint16(0x204), r.PC)
+	assert.Equal(t, byte(6), r.V[0])
+	assert.Equal(t, Event{Type: Halted, PC: 0x204, Cycle: 2}, next(t, events))
+
+	c.Step(3)
+	assert.Empty(t, events, "halted once for the loop")
+
+	c.Reset()
+	assert.Equal(t, Status{Paused: true, PC: 0x200, Cycle: 5, Speed: 100, Multiplier: 1}, c.Status())
+	c.Step(2)
+	assert.Equal(t, Event{Type: Halted, PC: 0x204, Cycle: 7}, next(t, events), "halted again after a reset")
+}
+
+func TestController_breakpoint(t *testing.T) {
+	t.Parallel()
+	// V0 = 5, V0 += 1, V0 += 1, jump to itself
+	c, _ := newController([]byte{0x60, 0x05, 0x70, 0x01, 0x70, 0x01, 0x12, 0x06}, 1000)
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+	c.AddBreakpoint(0x206)
+	c.AddBreakpoint(0x204)
+	assert.Equal(t, []uint16{0x204, 0x206}, c.Breakpoints())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	assert.Equal(t, Event{Type: Breakpoint, PC: 0x204, Cycle: 2}, next(t, events))
+	assert.True(t, c.Paused())
+	assert.Equal(t, byte(6), c.Registers().V[0])
+
+	c.RemoveBreakpoint(0x206)
+	c.Resume()
+	assert.Equal(t, Event{Type: Halted, PC: 0x206, Cycle: 3}, next(t, events), "not paused at a removed breakpoint")
+	assert.Equal(t, byte(7), c.Registers().V[0])
+}
+
+// within fails the test unless f returns in time, which it would not were
+// it blocked.
+func within(t *testing.T, f func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked")
+	}
+}
+
+func TestController_waitingForKey(t *testing.T) {
+	t.Parallel()
+	// Wait for a key into V0, jump to itself
+	program := []byte{0xF0, 0x0A, 0x12, 0x02}
+	c, _ := newController(program, 600)
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx)
+	}()
+
+	assert.Equal(t, Waiting, next(t, events).Type)
+	within(t, c.Pause)
+	r := c.Registers()
+	assert.Equal(t, uint16(0x200), r.PC, "still waiting")
+	within(t, c.Resume)
+	within(t, func() {
+		cancel()
+		<-done
+	})
+
+	c, _ = newController(program, 600)
+	events, unsubscribe = c.Subscribe()
+	defer unsubscribe()
+	assert.Equal(t, uint16(0x200), c.Step(3).PC)
+	assert.Equal(t, Event{Type: Waiting, PC: 0x200, Cycle: 3}, next(t, events))
+	assert.NoError(t, c.PressKey(0x7))
+	r = c.Step(1)
+	assert.Equal(t, uint16(0x202), r.PC)
+	assert.Equal(t, byte(0x7), r.V[0])
+	assert.Equal(t, Event{Type: Halted, PC: 0x202, Cycle: 4}, next(t, events))
+	assert.Empty(t, events, "waited once")
+}
+
+func TestController_sound(t *testing.T) {
+	t.Parallel()
+	// V0 = 3, ST = V0, jump to itself
+	c, _ := newController([]byte{0x60, 0x03, 0xF0, 0x18, 0x12, 0x04}, 1000)
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var sound []bool
+	for len(sound) < 2 {
+		if e := next(t, events); e.Type == Sound {
+			sound = append(sound, e.On)
+		}
+	}
+	assert.Equal(t, []bool{true, false}, sound)
+}
+
+// failing is a machine that fails to execute instructions.
+type failing struct {
+	Machine
+}
+
+func (f failing) Tick() error {
+	return errors.New("broken")
+}
+
+func TestController_errors(t *testing.T) {
+	t.Parallel()
+	m, k := newController(nil, 100)
+	c := New(failing{m.m}, k, Options{})
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+	c.Step(5)
+	assert.Equal(t, Event{Type: Halted, PC: 0x200, Error: "broken"}, next(t, events))
+	assert.Empty(t, events, "stopped at the error")
+}
+
+func TestController_memory(t *testing.T) {
+	t.Parallel()
+	c, _ := newController([]byte{0x60, 0x05}, 100)
+	b, err := c.ReadMemory(0x200, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x60, 0x05}, b)
+
+	assert.NoError(t, c.WriteMemory(0x201, []byte{0x2A}))
+	assert.Equal(t, byte(0x2A), c.Step(1).V[0])
+
+	_, err = c.ReadMemory(0xFFF, 2)
+	assert.EqualError(t, err, "2 bytes at 0xfff are outside of memory")
+	assert.EqualError(t, c.WriteMemory(0xFFE, []byte{1, 2, 3}), "3 bytes at 0xffe are outside of memory")
+}
+
+func TestController_keys(t *testing.T) {
+	t.Parallel()
+	c, k := newController(nil, 100)
+	assert.NoError(t, c.PressKey(0xA))
+	assert.True(t, k.IsKeyPressed(0xA))
+	assert.NoError(t, c.ReleaseKey(0xB))
+	assert.True(t, k.IsKeyPressed(0xA), "only the key pressed is released")
+	assert.NoError(t, c.ReleaseKey(0xA))
+	assert.False(t, k.IsKeyPressed(0xA))
+	assert.EqualError(t, c.PressKey(0x10), "there is no key 0x10, keys are 0x0 to 0xF")
+	assert.EqualError(t, c.ReleaseKey(0x10), "there is no key 0x10, keys are 0x0 to 0xF")
+}
+
+func TestController_SaveState(t *testing.T) {
+	t.Parallel()
+	c, _ := newController([]byte{0x60, 0x05, 0x70, 0x01, 0x12, 0x04}, 100)
+	c.Step(2)
+	var b bytes.Buffer
+	assert.NoError(t, c.SaveState(&b))
+	c.Step(1)
+	c.Reset()
+	assert.NoError(t, c.LoadState(&b))
+	assert.Equal(t, uint16(0x204), c.Registers().PC)
+	assert.Equal(t, byte(6), c.Registers().V[0])
+	assert.Error(t, c.LoadState(&b), "nothing left to load")
+}
+
+func TestController_SetSpeed(t *testing.T) {
+	t.Parallel()
+	c, _ := newController(nil, 0)
+	assert.Equal(t, 100, c.Status().Speed)
+	assert.NoError(t, c.SetSpeed(500))
+	assert.Equal(t, 500, c.Status().Speed)
+	assert.EqualError(t, c.SetSpeed(0), "speed 0 must be at least 1 instruction a second")
+}
+
+func TestController_HardReset(t *testing.T) {
+	t.Parallel()
+	// V0 = 5, I = 0x20A, draw, jump to itself
+	c, _ := newController([]byte{0x60, 0x05, 0xA2, 0x0A, 0xD0, 0x01, 0x12, 0x06, 0x00, 0x00, 0xFF}, 100)
+	c.Step(4)
+	assert.NoError(t, c.WriteMemory(0x300, []byte{0x2A}))
+	assert.NotEqual(t, make([]byte, 64*32), c.FrameBuffer())
+
+	c.Reset()
+	assert.Equal(t, uint16(0x200), c.Registers().PC)
+	assert.NotEqual(t, make([]byte, 64*32), c.FrameBuffer(), "a soft reset keeps the screen")
+	b, _ := c.ReadMemory(0x300, 1)
+	assert.Equal(t, []byte{0x2A}, b, "and the memory")
+
+	assert.NoError(t, c.HardReset())
+	assert.Equal(t, uint16(0x200), c.Registers().PC)
+	assert.Equal(t, make([]byte, 64*32), c.FrameBuffer())
+	b, _ = c.ReadMemory(0x300, 1)
+	assert.Equal(t, []byte{0}, b)
+}
+
+func TestController_LoadROM(t *testing.T) {
+	t.Parallel()
+	c, _ := newController([]byte{0x60, 0x05}, 100)
+	assert.NoError(t, c.LoadROM([]byte{0x61, 0x07}))
+	assert.Equal(t, byte(7), c.Step(1).V[1])
+	assert.NoError(t, c.HardReset())
+	assert.Equal(t, uint16(0x6107), c.Registers().Opcode, "a hard reset loads the new rom")
+
+	assert.EqualError(t, c.LoadROM(make([]byte, 4096)), "rom of 4096 bytes does not fit in the 3584 bytes of memory from 0x200")
+	assert.Equal(t, uint16(0x6107), c.Registers().Opcode, "nothing changed")
+}
+
+func TestController_FrameAdvance(t *testing.T) {
+	t.Parallel()
+	// V0 = 3, ST = V0, V0 += 1 over and over
+	c, _ := newController([]byte{0x60, 0x03, 0xF0, 0x18, 0x70, 0x01, 0x12, 0x04}, 120)
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+
+	r, err := c.FrameAdvance()
+	assert.NoError(t, err)
+	assert.True(t, c.Paused())
+	assert.Equal(t, uint64(2), r.Cycle, "120 instructions a second is 2 a frame")
+	assert.Equal(t, byte(2), r.ST, "the timers counted down once")
+	assert.Equal(t, Event{Type: Sound, PC: 0x204, Cycle: 2, On: true}, next(t, events))
+
+	r, _ = c.FrameAdvance()
+	assert.Equal(t, uint64(4), r.Cycle)
+	assert.Equal(t, byte(1), r.ST)
+}
+
+func TestController_speeds(t *testing.T) {
+	t.Parallel()
+	// 90 instructions a second is 1.5 a frame
+	c, _ := newController([]byte{0x70, 0x01, 0x12, 0x00}, 90)
+	cycles := []uint64{}
+	for i := 0; i < 4; i++ {
+		r, _ := c.FrameAdvance()
+		cycles = append(cycles, r.Cycle)
+	}
+	assert.Equal(t, []uint64{1, 3, 4, 6}, cycles)
+
+	assert.Equal(t, 1.0, c.Multiplier())
+	assert.Equal(t, 2.0, c.Faster())
+	assert.Equal(t, 4.0, c.Faster())
+	assert.Equal(t, 8.0, c.Faster())
+	assert.Equal(t, float64(Unthrottled), c.Faster())
+	assert.Equal(t, float64(Unthrottled), c.Faster(), "nothing is faster")
+	assert.Equal(t, 8.0, c.Slower())
+	assert.NoError(t, c.SetMultiplier(3))
+	assert.Equal(t, 4.0, c.Faster())
+	assert.NoError(t, c.SetMultiplier(3))
+	assert.Equal(t, 2.0, c.Slower())
+	assert.NoError(t, c.SetMultiplier(0.25))
+	assert.Equal(t, 0.25, c.Slower(), "nothing is slower")
+	assert.Equal(t, 0.25, c.Status().Multiplier)
+	assert.EqualError(t, c.SetMultiplier(0.1), "speed multiplier 0.1 must be at least 0.25, or 0 to run unthrottled")
+	assert.EqualError(t, c.SetMultiplier(-1), "speed multiplier -1 must be at least 0.25, or 0 to run unthrottled")
+}
+
+func TestController_unthrottled(t *testing.T) {
+	t.Parallel()
+	// V0 = 0xFF, ST = V0, loop
+	c, _ := newController([]byte{0x60, 0xFF, 0xF0, 0x18, 0x12, 0x04}, 60)
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+	assert.NoError(t, c.SetMultiplier(Unthrottled))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// 255 frames of sound, which take over 4 seconds at 60 frames a second
+	start := time.Now()
+	var sound []bool
+	for len(sound) < 2 {
+		if e := next(t, events); e.Type == Sound {
+			sound = append(sound, e.On)
+		}
+	}
+	assert.Equal(t, []bool{true, false}, sound)
+	assert.True(t, time.Since(start) < 2*time.Second, "ran unthrottled")
+}
+
+// counting is a machine that counts the instructions it executes.
+type counting struct {
+	Machine
+	ticks int
+}
+
+func (c *counting) Tick() error {
+	c.ticks++
+	return c.Machine.Tick()
+}
+
+func TestController_SkipIdle(t *testing.T) {
+	t.Parallel()
+	program := []byte{
+		0xF5, 0x0A, // 200: Wait for a key into V5
+		0x6A, 0x00, // 202: VA = 0
+		0x6B, 0x04, // 204: VB = 4
+		0xA2, 0x24, // 206: I = sprite
+		0xC2, 0x0F, // 208: V2 = random
+		0xDA, 0xB1, // 20A: Draw at VA, VB
+		0x60, 0x03, // 20C: V0 = 3
+		0xF0, 0x15, // 20E: DT = V0
+		0xF1, 0x07, // 210: V1 = DT
+		0x31, 0x00, // 212: Skip if V1 == 0
+		0x12, 0x10, // 214: Jump to 210
+		0xDA, 0xB1, // 216: Erase at VA, VB
+		0x7A, 0x01, // 218: VA += 1
+		0x3A, 0x08, // 21A: Skip if VA == 8
+		0x12, 0x08, // 21C: Jump to 208
+		0xE5, 0x9E, // 21E: Wait for key V5
+		0x12, 0x1E, // 220: Jump to 21E
+		0x12, 0x00, // 222: Jump to 200
+		0xF0, //       224: Sprite
+	}
+	run := func(skip bool) (frames [][]byte, registers []cpu.Step, ticks int) {
+		m, k := newController(program, 700)
+		counter := &counting{Machine: m.m}
+		c := New(counter, k, Options{Speed: 700, Present: m.o.Present, Timers: m.o.Timers, SkipIdle: skip})
+		for i := 0; i < 120; i++ {
+			switch i {
+			case 10, 70:
+				assert.NoError(t, c.PressKey(3))
+			case 15, 75:
+				assert.NoError(t, c.ReleaseKey(3))
+			}
+			r, err := c.FrameAdvance()
+			assert.NoError(t, err)
+			frames = append(frames, c.FrameBuffer())
+			registers = append(registers, r)
+		}
+		return frames, registers, counter.ticks
+	}
+	frames, registers, ticks := run(false)
+	skippedFrames, skippedRegisters, skippedTicks := run(true)
+	for i := range frames {
+		assert.Equal(t, sha1.Sum(frames[i]), sha1.Sum(skippedFrames[i]), "frame %d", i)
+		assert.Equal(t, registers[i], skippedRegisters[i], "frame %d", i)
+	}
+	assert.Equal(t, uint16(0x200), skippedRegisters[9].PC, "waiting for a key")
+	assert.Equal(t, byte(3), skippedRegisters[10].V[5], "the key pressed")
+	assert.Contains(t, []uint16{0x21E, 0x220}, skippedRegisters[69].PC, "waiting for key V5")
+	assert.NotContains(t, []uint16{0x21E, 0x220}, skippedRegisters[70].PC, "the key pressed again")
+	assert.InDelta(t, 120*700/60, registers[len(registers)-1].Cycle, 1)
+	assert.True(t, skippedTicks < ticks/2, "executed %d of %d instructions", skippedTicks, ticks)
+}
+
+func TestController_SkipIdle_breakpoint(t *testing.T) {
+	t.Parallel()
+	// V0 = 3, DT = V0, wait for the delay timer
+	m, k := newController([]byte{0x60, 0x03, 0xF0, 0x15, 0xF1, 0x07, 0x31, 0x00, 0x12, 0x04}, 600)
+	c := New(m.m, k, Options{Speed: 600, Timers: m.o.Timers, SkipIdle: true})
+	c.AddBreakpoint(0x206)
+	r, err := c.FrameAdvance()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x206), r.PC, "stopped at the breakpoint in the loop")
+	assert.Equal(t, uint64(3), r.Cycle)
+}
+
+func TestController_BreakAtCycle(t *testing.T) {
+	t.Parallel()
+	// V0 += 1, jump to itself
+	c, _ := newController([]byte{0x70, 0x01, 0x12, 0x00}, 600)
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+	c.BreakAtCycle(25)
+
+	r, err := c.FrameAdvance()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), r.Cycle)
+	r, err = c.FrameAdvance()
+	assert.NoError(t, err)
+	r, err = c.FrameAdvance()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(25), r.Cycle)
+	assert.Equal(t, byte(13), r.V[0])
+	assert.Equal(t, Event{Type: Breakpoint, PC: 0x202, Cycle: 25}, next(t, events))
+
+	r, err = c.FrameAdvance()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(35), r.Cycle, "paused once")
+}
@@ -0,0 +1,89 @@
+package coverage
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+)
+
+const memorySize = 4096
+
+// Profile is the coverage of a ROM over a session, how often each address
+// was executed, read and written. Only addresses that were are kept.
+type Profile struct {
+	ROM    []byte            `json:"rom"`
+	Origin uint16            `json:"origin"`
+	Exec   map[uint16]uint64 `json:"exec"`
+	Read   map[uint16]uint64 `json:"read"`
+	Write  map[uint16]uint64 `json:"write"`
+}
+
+// Load reads a profile written by Save.
+func Load(r io.Reader) (p *Profile, err error) {
+	p = &Profile{}
+	if err = json.NewDecoder(r).Decode(p); err != nil {
+		return nil, err
+	}
+	return p, err
+}
+
+// Save writes the profile as JSON.
+func (p *Profile) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(p)
+}
+
+// Recorder counts executed instructions and memory accesses, it is both a
+// cpu.Tracer and a cpu.MemoryWatcher.
+type Recorder struct {
+	rom    []byte
+	origin uint16
+	exec   [memorySize]uint64
+	read   [memorySize]uint64
+	write  [memorySize]uint64
+}
+
+// NewRecorder records the coverage of rom loaded at origin.
+func NewRecorder(rom []byte, origin uint16) *Recorder {
+	return &Recorder{
+		rom:    rom,
+		origin: origin,
+	}
+}
+
+func (r *Recorder) Trace(s cpu.Step) {
+	r.exec[s.PC%memorySize]++
+}
+
+func (r *Recorder) Read(addr uint16, n uint16) {
+	for i := uint16(0); i < n; i++ {
+		r.read[(addr+i)%memorySize]++
+	}
+}
+
+func (r *Recorder) Write(addr uint16, n uint16) {
+	for i := uint16(0); i < n; i++ {
+		r.write[(addr+i)%memorySize]++
+	}
+}
+
+// Profile returns what has been recorded so far.
+func (r *Recorder) Profile() *Profile {
+	return &Profile{
+		ROM:    r.rom,
+		Origin: r.origin,
+		Exec:   counts(r.exec[:]),
+		Read:   counts(r.read[:]),
+		Write:  counts(r.write[:]),
+	}
+}
+
+func counts(c []uint64) map[uint16]uint64 {
+	m := make(map[uint16]uint64)
+	for a, n := range c {
+		if n > 0 {
+			m[uint16(a)] = n
+		}
+	}
+	return m
+}
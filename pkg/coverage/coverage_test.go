@@ -0,0 +1,48 @@
+package coverage
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRecorder_Profile(t *testing.T) {
+	t.Parallel()
+	r := NewRecorder([]byte{0x00, 0xE0}, 0x200)
+	r.Trace(cpu.Step{PC: 0x200})
+	r.Trace(cpu.Step{PC: 0x200})
+	r.Trace(cpu.Step{PC: 0x202})
+	r.Read(0x300, 3)
+	r.Read(0x301, 1)
+	r.Write(0xFFF, 2) // wraps around
+	p := r.Profile()
+	assert.Equal(t, []byte{0x00, 0xE0}, p.ROM)
+	assert.Equal(t, uint16(0x200), p.Origin)
+	assert.Equal(t, map[uint16]uint64{0x200: 2, 0x202: 1}, p.Exec)
+	assert.Equal(t, map[uint16]uint64{0x300: 1, 0x301: 2, 0x302: 1}, p.Read)
+	assert.Equal(t, map[uint16]uint64{0xFFF: 1, 0x000: 1}, p.Write)
+}
+
+func TestProfile_SaveLoad(t *testing.T) {
+	t.Parallel()
+	p := &Profile{
+		ROM:    []byte{0x00, 0xE0},
+		Origin: 0x200,
+		Exec:   map[uint16]uint64{0x200: 2},
+		Read:   map[uint16]uint64{0x300: 1},
+		Write:  map[uint16]uint64{},
+	}
+	var b bytes.Buffer
+	assert.NoError(t, p.Save(&b))
+	assert.Equal(t, `{"rom":"AOA=","origin":512,"exec":{"512":2},"read":{"768":1},"write":{}}`+"\n", b.String())
+	l, err := Load(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, p, l)
+}
+
+func TestLoad_invalid(t *testing.T) {
+	t.Parallel()
+	_, err := Load(bytes.NewBufferString("{"))
+	assert.Error(t, err)
+}
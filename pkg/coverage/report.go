@@ -0,0 +1,240 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/carlosroman/go-chip-8/pkg/disasm"
+)
+
+// Line is a line of a report, an instruction or up to eight bytes of data.
+type Line struct {
+	Addr   uint16
+	Bytes  []byte
+	Text   string
+	Code   bool   // Executed, or reachable, instruction rather than data
+	Hits   uint64 // Times the instruction was executed
+	Reads  uint64 // Reads of the bytes of the line
+	Writes uint64 // Writes to the bytes of the line
+	Never  string // Set on the first line of a region never executed
+}
+
+// Lines lays the ROM out as a disassembly. Executed addresses, and the code
+// reachable from them, are instructions. Data that was read or written is
+// shown a byte per line so every address has its own counts, the rest
+// eight bytes per line.
+func (p *Profile) Lines() (lines []Line) {
+	flow := disasm.Trace(p.ROM, p.Origin)
+	end := int(p.Origin) + len(p.ROM)
+	code := func(a int) bool {
+		return a+1 < end && (p.Exec[uint16(a)] > 0 || flow.Code[uint16(a)])
+	}
+	touched := func(a int) bool {
+		return p.Read[uint16(a)] > 0 || p.Write[uint16(a)] > 0
+	}
+	for a := int(p.Origin); a < end; {
+		l := Line{Addr: uint16(a)}
+		switch {
+		case code(a):
+			l.Code = true
+			l.Bytes = p.ROM[a-int(p.Origin) : a+2-int(p.Origin)]
+			l.Text = disasm.DecodeAt(l.Bytes, 0).String()
+		case touched(a):
+			l.Bytes = p.ROM[a-int(p.Origin) : a+1-int(p.Origin)]
+			l.Text = strings.NewReplacer("0", ".", "1", "#").Replace(fmt.Sprintf("%08b", l.Bytes[0]))
+		default:
+			n := 1
+			for n < 8 && a+n < end && !code(a+n) && !touched(a+n) {
+				n++
+			}
+			l.Bytes = p.ROM[a-int(p.Origin) : a+n-int(p.Origin)]
+		}
+		for i := range l.Bytes {
+			l.Reads += p.Read[uint16(a+i)]
+			l.Writes += p.Write[uint16(a+i)]
+		}
+		l.Hits = p.Exec[uint16(a)]
+		lines = append(lines, l)
+		a += len(l.Bytes)
+	}
+	// Mark where each run of lines that never executed starts
+	for i := 0; i < len(lines); {
+		if lines[i].Hits > 0 {
+			i++
+			continue
+		}
+		j := i
+		for j+1 < len(lines) && lines[j+1].Hits == 0 {
+			j++
+		}
+		last := lines[j]
+		lines[i].Never = fmt.Sprintf("never executed: 0x%03X-0x%03X (%d bytes)",
+			lines[i].Addr, int(last.Addr)+len(last.Bytes)-1, int(last.Addr)+len(last.Bytes)-int(lines[i].Addr))
+		i = j + 1
+	}
+	return lines
+}
+
+// Summary is the number of instructions, of those that were reachable or
+// executed, that were executed.
+func (p *Profile) Summary() (executed, total int) {
+	for _, l := range p.Lines() {
+		if l.Code {
+			total++
+			if l.Hits > 0 {
+				executed++
+			}
+		}
+	}
+	return executed, total
+}
+
+// Outside returns the addresses outside of the ROM that were read or
+// written, such as the font, in order.
+func (p *Profile) Outside() (addrs []uint16) {
+	end := int(p.Origin) + len(p.ROM)
+	for a := 0; a < memorySize; a++ {
+		if a >= int(p.Origin) && a < end {
+			continue
+		}
+		if p.Read[uint16(a)] > 0 || p.Write[uint16(a)] > 0 {
+			addrs = append(addrs, uint16(a))
+		}
+	}
+	return addrs
+}
+
+// WriteText writes the report as an annotated disassembly.
+func (p *Profile) WriteText(w io.Writer) error {
+	executed, total := p.Summary()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d instructions executed (%.1f%%)\n\n", executed, total, percent(executed, total))
+	fmt.Fprintf(&b, "%8s %8s %8s  %-5s  %-16s  %s\n", "hits", "reads", "writes", "addr", "bytes", "")
+	for _, l := range p.Lines() {
+		if l.Never != "" {
+			fmt.Fprintf(&b, "%37s--- %s ---\n", "", l.Never)
+		}
+		fmt.Fprintf(&b, "%8s %8s %8s  0x%03X  %-16s  %s\n",
+			count(l.Hits), count(l.Reads), count(l.Writes), l.Addr, hex(l.Bytes), l.Text)
+	}
+	if out := p.Outside(); len(out) > 0 {
+		fmt.Fprintf(&b, "\nOutside of the ROM\n")
+		for _, a := range out {
+			fmt.Fprintf(&b, "%8s %8s %8s  0x%03X\n", "", count(p.Read[a]), count(p.Write[a]), a)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes the report as a page with the annotated disassembly and
+// a heat map of all of memory.
+func (p *Profile) WriteHTML(w io.Writer) error {
+	executed, total := p.Summary()
+	type cell struct {
+		Addr                 uint16
+		Exec, Read, Write    uint64
+		ExecA, ReadA, WriteA float64
+	}
+	var maxExec, maxRW uint64
+	for _, n := range p.Exec {
+		if n > maxExec {
+			maxExec = n
+		}
+	}
+	for _, m := range []map[uint16]uint64{p.Read, p.Write} {
+		for _, n := range m {
+			if n > maxRW {
+				maxRW = n
+			}
+		}
+	}
+	cells := make([]cell, memorySize)
+	for a := range cells {
+		c := cell{Addr: uint16(a), Exec: p.Exec[uint16(a)], Read: p.Read[uint16(a)], Write: p.Write[uint16(a)]}
+		c.ExecA, c.ReadA, c.WriteA = heat(c.Exec, maxExec), heat(c.Read, maxRW), heat(c.Write, maxRW)
+		cells[a] = c
+	}
+	return reportTemplate.Execute(w, map[string]interface{}{
+		"Executed": executed,
+		"Total":    total,
+		"Percent":  fmt.Sprintf("%.1f", percent(executed, total)),
+		"Lines":    p.Lines(),
+		"Cells":    cells,
+		"MaxHits":  maxExec,
+	})
+}
+
+// heat scales n logarithmically to between 0 and 1.
+func heat(n, max uint64) float64 {
+	if n == 0 || max == 0 {
+		return 0
+	}
+	return 0.2 + 0.8*math.Log1p(float64(n))/math.Log1p(float64(max))
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+func count(n uint64) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+func hex(bs []byte) string {
+	return fmt.Sprintf("% X", bs)
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"count": count,
+	"hex":   hex,
+	"heat": func(n, max uint64) string {
+		return fmt.Sprintf("%.2f", heat(n, max))
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CHIP-8 coverage</title>
+<style>
+body { font-family: monospace; }
+table.listing td { padding: 0 0.5em; white-space: pre; }
+table.listing td.n { text-align: right; }
+tr.never td { color: #999; }
+tr.region td { color: #c00; padding-top: 0.5em; }
+.map { display: grid; grid-template-columns: repeat(64, 10px); gap: 1px; }
+.map div { width: 10px; height: 10px; background: #eee; }
+</style>
+</head>
+<body>
+<h1>CHIP-8 coverage</h1>
+<p>{{.Executed}} of {{.Total}} instructions executed ({{.Percent}}%)</p>
+<h2>Memory</h2>
+<p>Each square is an address, 64 per row. Green was executed, blue read and red written.</p>
+<div class="map">
+{{- range .Cells}}
+<div title="0x{{printf "%03X" .Addr}} exec {{.Exec}} read {{.Read}} write {{.Write}}" style="background: rgba({{if .Write}}200,0,0,{{printf "%.2f" .WriteA}}{{else if .Exec}}0,160,0,{{printf "%.2f" .ExecA}}{{else if .Read}}0,0,200,{{printf "%.2f" .ReadA}}{{else}}0,0,0,0.05{{end}})"></div>
+{{- end}}
+</div>
+<h2>Disassembly</h2>
+<table class="listing">
+<tr><th>hits</th><th>reads</th><th>writes</th><th>addr</th><th>bytes</th><th></th></tr>
+{{- range .Lines}}
+{{- if .Never}}
+<tr class="region"><td colspan="6">{{.Never}}</td></tr>
+{{- end}}
+<tr{{if not .Hits}} class="never"{{end}}{{if .Hits}} style="background: rgba(0,160,0,{{heat .Hits $.MaxHits}})"{{end}}><td class="n">{{count .Hits}}</td><td class="n">{{count .Reads}}</td><td class="n">{{count .Writes}}</td><td>0x{{printf "%03X" .Addr}}</td><td>{{hex .Bytes}}</td><td>{{.Text}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,117 @@
+package coverage
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const (
+	bcChip8TestPath = "../../test/roms/BC_test.ch8"
+)
+
+func init() {
+	log.SetLevel(log.WarnLevel)
+}
+
+func testProfile() *Profile {
+	return &Profile{
+		ROM: []byte{
+			0xA2, 0x08, // 0x200: i := 0x208
+			0xD0, 0x12, // 0x202: sprite v0 v1 2
+			0x12, 0x04, // 0x204: jump 0x204
+			0x00, 0xEE, // 0x206: return, never executed or reachable
+			0x3C, 0xFF, // 0x208: sprite
+			0x00, 0x00, 0x00, // 0x20A: padding
+		},
+		Origin: 0x200,
+		Exec:   map[uint16]uint64{0x200: 1, 0x202: 1, 0x204: 10},
+		Read:   map[uint16]uint64{0x208: 1, 0x209: 1, 0x020: 5},
+		Write:  map[uint16]uint64{},
+	}
+}
+
+func TestProfile_Lines(t *testing.T) {
+	t.Parallel()
+	lines := testProfile().Lines()
+	assert.Equal(t, []Line{
+		{Addr: 0x200, Bytes: []byte{0xA2, 0x08}, Text: "i := 0x208", Code: true, Hits: 1},
+		{Addr: 0x202, Bytes: []byte{0xD0, 0x12}, Text: "sprite v0 v1 2", Code: true, Hits: 1},
+		{Addr: 0x204, Bytes: []byte{0x12, 0x04}, Text: "jump 0x204", Code: true, Hits: 10},
+		{Addr: 0x206, Bytes: []byte{0x00, 0xEE}, Never: "never executed: 0x206-0x20C (7 bytes)"},
+		{Addr: 0x208, Bytes: []byte{0x3C}, Text: "..####..", Reads: 1},
+		{Addr: 0x209, Bytes: []byte{0xFF}, Text: "########", Reads: 1},
+		{Addr: 0x20A, Bytes: []byte{0x00, 0x00, 0x00}},
+	}, lines)
+}
+
+func TestProfile_WriteText(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	assert.NoError(t, testProfile().WriteText(&b))
+	assert.Equal(t, `3 of 3 instructions executed (100.0%)
+
+    hits    reads   writes  addr   bytes             
+       1        -        -  0x200  A2 08             i := 0x208
+       1        -        -  0x202  D0 12             sprite v0 v1 2
+      10        -        -  0x204  12 04             jump 0x204
+                                     --- never executed: 0x206-0x20C (7 bytes) ---
+       -        -        -  0x206  00 EE             
+       -        1        -  0x208  3C                ..####..
+       -        1        -  0x209  FF                ########
+       -        -        -  0x20A  00 00 00          
+
+Outside of the ROM
+                5        -  0x020
+`, b.String())
+}
+
+func TestProfile_WriteHTML(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	assert.NoError(t, testProfile().WriteHTML(&b))
+	h := b.String()
+	assert.Contains(t, h, "<p>3 of 3 instructions executed (100.0%)</p>")
+	assert.Contains(t, h, "never executed: 0x206-0x20C (7 bytes)")
+	assert.Contains(t, h, `<td>0x204</td><td>12 04</td><td>jump 0x204</td>`)
+	assert.Contains(t, h, `title="0x204 exec 10 read 0 write 0" style="background: rgba(0,160,0,1.00)"`)
+	assert.Equal(t, 4096, strings.Count(h, `<div title="0x`))
+}
+
+func TestRecorder_BC_test(t *testing.T) {
+	t.Parallel()
+	rom, err := ioutil.ReadFile(bcChip8TestPath)
+	assert.NoError(t, err)
+	m := state.InitMemory()
+	assert.NoError(t, m.LoadMemory(bytes.NewReader(rom)))
+	sc := make(chan byte, 1)
+	c := cpu.NewCPU(m, rand.New(rand.NewSource(1)), cpu.NewKeyboard(), cpu.NewTimer(sc), &noopScreen{})
+	r := NewRecorder(rom, 0x200)
+	c.AddTracer(r)
+	c.AddMemoryWatcher(r)
+	for i := 0; i < 250; i++ {
+		assert.NoError(t, c.Tick())
+	}
+	p := r.Profile()
+	executed, total := p.Summary()
+	assert.True(t, executed > 100, "executed %d", executed)
+	assert.True(t, executed < total, "the error path is never executed")
+	assert.Equal(t, uint64(2), p.Write[0x3D0], "FX33 and FX55 both write to 0x3D0")
+	assert.True(t, p.Read[0x358] > 0, "sprites are read")
+	var b bytes.Buffer
+	assert.NoError(t, p.WriteText(&b))
+	assert.Contains(t, b.String(), "--- never executed: 0x310-0x331 (34 bytes) ---")
+}
+
+type noopScreen struct {
+}
+
+func (s *noopScreen) Draw(frameBuffer []byte) {
+
+}
@@ -46,6 +46,40 @@ func Benchmark_BC_Chip8Test(b *testing.B) {
 	}
 }
 
+// drawLoop draws the 0 of the font over and over, moving it each time so
+// most rows straddle two words of a packed frame buffer.
+var drawLoop = []uint16{
+	0x6000, // V0 = 0
+	0x6100, // V1 = 0
+	0x620F, // V2 = 0x0F
+	0x633F, // V3 = 0x3F
+	0xA000, // I = 0
+	0xD015, // draw(V0, V1, 5)
+	0x7005, // V0 += 5
+	0x8032, // V0 &= V3
+	0x7103, // V1 += 3
+	0x8122, // V1 &= V2
+	0x120A, // goto draw
+}
+
+func Benchmark_Draw(b *testing.B) {
+	log.SetLevel(log.WarnLevel)
+	m := state.InitMemory()
+	for i, o := range drawLoop {
+		addToMemory(m, o, 0x200+2*i)
+	}
+	c := getCPU(b, m)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for tc := 0; tc < 600; tc++ { // 100 sprites
+			if err := c.Tick(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
 func getMemory(b *testing.B) (state.Memory, error) {
 	b.StopTimer()
 	defer b.StartTimer()
@@ -84,3 +118,38 @@ type noopScreen struct {
 func (s *noopScreen) Draw(frameBuffer []byte) {
 
 }
+
+// drawBytes draws sprite the way a frame buffer of a byte per pixel does,
+// a bit at a time, to compare with the packed frame buffer.
+func drawBytes(fb []byte, x, y int, sprite []byte) (collision bool) {
+	for yl, row := range sprite {
+		for xl := 0; xl < 8; xl++ {
+			if row&(0x80>>uint(xl)) != 0 {
+				i := x + xl + (y+yl)*64
+				if fb[i] == 0x1 {
+					collision = true
+				}
+				fb[i] ^= 0x1
+			}
+		}
+	}
+	return collision
+}
+
+var benchmarkSprite = []byte{0xF0, 0x90, 0x90, 0x90, 0xF0, 0xFF, 0x81, 0xFF}
+
+func Benchmark_drawBytes(b *testing.B) {
+	fb := make([]byte, 64*32)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		drawBytes(fb, i%61, i%24, benchmarkSprite)
+	}
+}
+
+func Benchmark_drawPacked(b *testing.B) {
+	fb := newFrameBuffer(64, 32)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fb.draw(i%61, i%24, benchmarkSprite, false)
+	}
+}
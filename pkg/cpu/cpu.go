@@ -2,46 +2,73 @@ package cpu
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/carlosroman/go-chip-8/pkg/state"
 	log "github.com/sirupsen/logrus"
 	"math/rand"
 )
 
+// ErrExit is returned by Tick when the program exits with 00FD, which
+// leaves the program counter at the 00FD to exit again if ticked again.
+var ErrExit = errors.New("the program exited")
+
 type cpu struct {
-	m     state.Memory // CPU Memory
-	pc    int16        // Program counter
-	ir    uint16       // Index register - 16bit register (For memory address) (Similar to void pointer)
-	sp    int16        // Stack pointer
-	stack *state.Stack // Stack
-	v     []byte       // CPU registers
-	r     *rand.Rand   // Random number generator
-	k     Keyboard     // Keyboard wrapper
-	t     *timer       // Count down timer
-	fb    []byte       // Frame buffer
-	s     Screen       // Screen
+	m     state.Memory    // CPU Memory
+	pc    int16           // Program counter
+	ir    uint16          // Index register - 16bit register (For memory address) (Similar to void pointer)
+	sp    int16           // Stack pointer
+	stack *state.Stack    // Stack
+	v     []byte          // CPU registers
+	r     *rand.Rand      // Random number generator
+	k     Keyboard        // Keyboard wrapper
+	t     *timer          // Count down timer
+	fb    *frameBuffer    // Frame buffer
+	s     Screen          // Screen
+	cycle uint64          // Number of instructions executed
+	trs   []Tracer        // Tracers told about every instruction
+	mws   []MemoryWatcher // Watchers told about memory accesses
+
+	shown    []byte // Frame last presented
+	orFrames bool   // Whether to present every pixel on since the last vblank
+	wrap     bool   // Whether sprites wrap around the edges of the screen
+	key      byte   // Pressed for FX0A to store, when pressed is set
+	pressed  bool
 }
 
 func (c *cpu) Tick() (err error) {
+	if c.pc < 0 || int(c.pc)+1 >= len(c.m) {
+		return fmt.Errorf("the program counter %#03x is outside of memory", c.pc)
+	}
 	opcode := binary.BigEndian.Uint16([]byte{c.m[c.pc], c.m[c.pc+1]})
-	//fmt.Printf("%#04x:%X:[%#02x %#02x]:%v\n", opcode, opcode, c.m[c.pc], c.m[c.pc+1], opcode)
-	//opCodeA := (uint16(c.m[c.pc]) << 8) | uint16(c.m[c.pc+1])
-	//fmt.Printf("%#04x:%X:[%#02x %#02x]:%v\n", opCodeA, opCodeA, c.m[c.pc], c.m[c.pc+1], opCodeA)
+	if len(c.trs) > 0 {
+		c.trace(opcode)
+	}
+	c.cycle++
+	return c.Exec(opcode)
+}
 
+// Exec executes opcode as if it had been fetched from the program counter.
+func (c *cpu) Exec(opcode uint16) (err error) {
 	switch val := opcode & 0xF000; val {
 	case 0x0000: // 0x00
 		switch sub := opcode & 0x00FF; sub {
 		case 0x00E0:
 			log.Info("Opcode: 00E0")
 			// 0x00E0, Display, disp_clear(), Clears the screen.
-			for i := range c.fb {
-				c.fb[i] = byte(0x0)
-			}
-			c.s.Draw(c.fb)
+			c.fb.clear()
 		case 0x00EE:
 			// 0x00EE, Flow, return;, Returns from a subroutine.
 			log.Info("Opcode: 00EE")
-			c.pc = c.stack.Pop()
+			pc, err := c.stack.Pop()
+			if err != nil {
+				return c.fault(opcode, err)
+			}
+			c.pc = pc
+		case 0x00FD:
+			// 0x00FD, Flow, exit(), Exits the interpreter. (SUPER-CHIP)
+			log.Info("Opcode: 00FD")
+			return ErrExit
 		default:
 			log.Warnf("Unknown opcode [0x0000]: %#04x:%#04x\n", val, sub)
 		}
@@ -79,25 +106,14 @@ func (c *cpu) Tick() (err error) {
 				WithField("n", n).
 				Debug("About to draw sprite")
 		}
+		if err = c.inMemory(c.ir, n); err != nil {
+			return c.fault(opcode, err)
+		}
 		c.v[0xF] = 0x0
-		for yl := uint16(0); yl < n; yl++ {
-			px := c.m[c.ir+yl]
-			for xl := uint16(0); xl < 8; xl++ {
-				if px&(0x80>>xl) != 0 {
-					if log.IsLevelEnabled(log.DebugLevel) {
-						log.
-							WithField("xl", xl).
-							WithField("yl", yl).
-							Debugf("T:%v", vx+xl+((vy+yl)*64))
-					}
-					if c.fb[(vx+xl+((vy+yl)*64))] == 0x1 {
-						c.v[0xF] = 0x1
-					}
-					c.fb[vx+xl+((vy+yl)*64)] ^= 0x1
-				}
-			}
+		c.read(c.ir, n)
+		if c.fb.draw(int(vx), int(vy), c.m[c.ir:c.ir+n], c.wrap) {
+			c.v[0xF] = 0x1
 		}
-		c.s.Draw(c.fb)
 		c.pc += 2
 	case 0x1000:
 		// 0x1NNN, Flow, goto NNN;, Jumps to address NNN.
@@ -110,7 +126,9 @@ func (c *cpu) Tick() (err error) {
 		log.Info("Opcode: 2NNN")
 		nnn := opcode & 0x0FFF
 		log.Debugf("nnn:%v", nnn)
-		c.stack.Push(c.pc)
+		if err = c.stack.Push(c.pc); err != nil {
+			return c.fault(opcode, err)
+		}
 		c.pc = int16(nnn)
 	case 0x3000:
 		// 0x3XNN, Cond, if(Vx==NN), Skips the next instruction if VX equals NN. (Usually the next instruction is a jump to skip a code block)
@@ -182,47 +200,53 @@ func (c *cpu) Tick() (err error) {
 			// 0x8XY4, Math, Vx += Vy , Adds VY to VX. VF is set to 1 when there's a carry, and to 0 when there isn't.
 			log.Info("Opcode: 8XY4")
 			x, y := getXY(opcode, c)
-			if c.v[y] > (0xFF - c.v[x]) {
+			vx, vy := c.v[x], c.v[y]
+			c.v[x] = vx + vy
+			// The flag is set last, so it is what VF is left holding when it is VX
+			if vy > (0xFF - vx) {
 				log.Debug("carrying the one")
 				c.v[0xF] = 1 // carry
 			} else {
 				c.v[0xF] = 0
 			}
-			c.v[x] += c.v[y]
 		case 0x0005:
 			// 0x8XY5, Math, Vx -= Vy, VY is subtracted from VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
 			log.Info("Opcode: 8XY5")
 			x, y := getXY(opcode, c)
-			if c.v[y] > c.v[x] {
+			vx, vy := c.v[x], c.v[y]
+			c.v[x] = vx - vy
+			if vy > vx {
 				log.Debug("borrowing")
 				c.v[0xF] = 0 // borrow
 			} else {
 				c.v[0xF] = 1
 			}
-			c.v[x] -= c.v[y]
 		case 0x0006:
 			// 0x8XY6, BitOp, Vx>>=1, Stores the least significant bit of VX in VF and then shifts VX to the right by 1.
 			log.Info("Opcode: 8XY6")
 			x, _ := getXY(opcode, c)
-			c.v[0xF] = c.v[x] & 0x1
-			c.v[x] >>= 1
+			vx := c.v[x]
+			c.v[x] = vx >> 1
+			c.v[0xF] = vx & 0x1
 		case 0x0007:
 			// 0x8XY7, Math, Vx=Vy-Vx, Sets VX to VY minus VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
 			log.Info("Opcode: 8XY7")
 			x, y := getXY(opcode, c)
-			if c.v[x] > c.v[y] {
+			vx, vy := c.v[x], c.v[y]
+			c.v[x] = vy - vx
+			if vx > vy {
 				log.Debug("borrowing")
 				c.v[0xF] = 0 // borrow
 			} else {
 				c.v[0xF] = 1
 			}
-			c.v[x] = c.v[y] - c.v[x]
 		case 0x000E:
 			// 0x8XYE, BitOp, Vx<<=1, Stores the most significant bit of VX in VF and then shifts VX to the left by 1.
 			log.Info("Opcode: 8XYE")
 			x, _ := getXY(opcode, c)
-			c.v[0xF] = c.v[x] >> 7
-			c.v[x] <<= 1
+			vx := c.v[x]
+			c.v[x] = vx << 1
+			c.v[0xF] = vx >> 7
 		}
 		c.pc += 2
 	case 0x9000:
@@ -261,11 +285,13 @@ func (c *cpu) Tick() (err error) {
 			x := getX(opcode)
 			c.v[x] = c.t.GetDelay()
 		case 0x000a:
-			// 0xFX0A, KeyOp, Vx = get_key(), A key press is awaited, and then stored in VX. (Blocking Operation. All instruction halted until next key event)
+			// 0xFX0A, KeyOp, Vx = get_key(), A key press is awaited, and then stored in VX. Until one is, the program counter stays on FX0A to execute it again, so waiting never blocks whoever ticks the CPU.
 			log.Info("Opcode: FX0A")
-			key := c.k.WaitForKeyPressed()
+			if !c.pollKey() {
+				return nil
+			}
 			x := getX(opcode)
-			c.v[x] = key
+			c.v[x], c.pressed = c.key, false
 		case 0x0015:
 			// 0xFX15, Timer, delay_timer(Vx), Sets the delay timer to VX.
 			log.Info("Opcode: FX15")
@@ -293,25 +319,38 @@ func (c *cpu) Tick() (err error) {
 			// 0xFX29, MEM, I=sprite_addr[Vx], Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
 			log.Info("Opcode: FX29")
 			x := getX(opcode)
-			c.ir = uint16(c.v[x] * 0x5)
+			// Only the low nibble names a character, VX*5 overflowing a byte otherwise
+			c.ir = uint16(c.v[x]&0xF) * 0x5
 		case 0x0033:
 			// 0xFX33, BCD, set_BCD(Vx);, Stores the binary-coded decimal representation of VX, with the most significant of three digits at the address in I, the middle digit at I plus 1, and the least significant digit at I plus 2. (In other words, take the decimal representation of VX, place the hundreds digit in memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.)
 			log.Info("Opcode: FX33")
 			x := getX(opcode)
+			if err = c.inMemory(c.ir, 3); err != nil {
+				return c.fault(opcode, err)
+			}
 			c.m[c.ir] = c.v[x] / 100
 			c.m[c.ir+1] = (c.v[x] / 10) % 10
 			c.m[c.ir+2] = (c.v[x] % 100) % 10
+			c.written(c.ir, 3)
 		case 0x55:
 			// 0xFX55, MEM, reg_dump(Vx,&I), Stores V0 to VX (including VX) in memory starting at address I. The offset from I is increased by 1 for each value written, but I itself is left unmodified.
 			log.Info("Opcode: FX55")
 			x := getX(opcode)
+			if err = c.inMemory(c.ir, x+1); err != nil {
+				return c.fault(opcode, err)
+			}
 			for i := uint16(0); i <= x; i++ {
 				c.m[c.ir+i] = c.v[i]
 			}
+			c.written(c.ir, x+1)
 		case 0x65:
 			// 0xFills V0 to VX (including VX) with values from memory starting at address I. The offset from I is increased by 1 for each value written, but I itself is left unmodified.
 			log.Info("Opcode: FX65")
 			x := getX(opcode)
+			if err = c.inMemory(c.ir, x+1); err != nil {
+				return c.fault(opcode, err)
+			}
+			c.read(c.ir, x+1)
 			for i := uint16(0); i <= x; i++ {
 				c.v[i] = c.m[c.ir+i]
 			}
@@ -325,6 +364,12 @@ func (c *cpu) Tick() (err error) {
 	return err
 }
 
+// fault returns err as the reason opcode at the program counter could not
+// be executed. The program counter is left where it is.
+func (c *cpu) fault(opcode uint16, err error) error {
+	return fmt.Errorf("%04X at %#03x: %v", opcode, c.pc, err)
+}
+
 func getX(opcode uint16) (x uint16) {
 	x = (opcode & 0x0F00) >> 8
 	if log.IsLevelEnabled(log.DebugLevel) {
@@ -362,7 +407,13 @@ func NewCPU(memory state.Memory, rgen *rand.Rand, k Keyboard, t *timer, s Screen
 		r:     rgen,
 		k:     k,
 		t:     t,
-		fb:    make([]byte, 64*32),
+		fb:    newFrameBuffer(64, 32),
 		s:     s,
 	}
 }
+
+// SetWrap sets whether sprites drawn past the edges of the screen wrap
+// around to the other side, rather than being clipped as most games expect.
+func (c *cpu) SetWrap(wrap bool) {
+	c.wrap = wrap
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/stretchr/testify/mock"
 	"math/rand"
 	"testing"
-	"time"
 )
 
 func init() {
@@ -48,9 +47,60 @@ func TestCpu_Tick_0x00E0(t *testing.T) {
 	err = c.Tick()
 	assert.NoError(t, err)
 	assert.Equal(t, int16(514), c.pc)
+	sm.AssertNotCalled(t, "Draw", fb)
+	assert.NoError(t, c.VBlank())
 	sm.AssertCalled(t, "Draw", fb)
 }
 
+func TestCpu_Tick_0x00FD(t *testing.T) {
+	t.Parallel()
+	m := state.InitMemory()
+	err := m.LoadMemory(bytes.NewBuffer(opCodeToBytes(0x00FD)))
+	assert.NoError(t, err)
+	c := getNewCPU(m, NewKeyboard(), getTimer(), &screenMock{})
+
+	assert.Equal(t, ErrExit, c.Tick())
+	assert.Equal(t, int16(512), c.pc)
+	assert.Equal(t, ErrExit, c.Tick(), "exits again")
+}
+
+func TestCpu_Tick_faults(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		opcode uint16
+		pc     int16
+		ir     uint16
+		calls  int
+		err    string
+	}{
+		{"0x00EE with nothing to return to", 0x00EE, 0x200, 0, 0, "00EE at 0x200: stack underflow"},
+		{"0x2NNN with the stack full", 0x2300, 0x200, 0, 16, "2300 at 0x200: stack overflow"},
+		{"0xDXYN past the end of memory", 0xD015, 0x200, 0xFFD, 0, "D015 at 0x200: 5 bytes at 0xffd are past the end of memory"},
+		{"0xFX33 past the end of memory", 0xF033, 0x200, 0xFFE, 0, "F033 at 0x200: 3 bytes at 0xffe are past the end of memory"},
+		{"0xFX55 past the end of memory", 0xF155, 0x200, 0xFFF, 0, "F155 at 0x200: 2 bytes at 0xfff are past the end of memory"},
+		{"0xFX65 past I wrapping", 0xF265, 0x200, 0x10FE, 0, "F265 at 0x200: 3 bytes at 0x10fe are past the end of memory"},
+		{"program counter at the last byte", 0x0000, 0xFFF, 0, 0, "the program counter 0xfff is outside of memory"},
+		{"program counter past memory", 0x0000, 0x10FE, 0, 0, "the program counter 0x10fe is outside of memory"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			m := state.InitMemory()
+			assert.NoError(t, m.LoadMemory(bytes.NewBuffer(opCodeToBytes(tc.opcode))))
+			c := getNewCPU(m, NewKeyboard(), getTimer(), &screenMock{})
+			c.pc = tc.pc
+			c.ir = tc.ir
+			for i := 0; i < tc.calls; i++ {
+				assert.NoError(t, c.stack.Push(0x200))
+			}
+			assert.EqualError(t, c.Tick(), tc.err)
+			assert.Equal(t, tc.pc, c.pc, "left at the instruction")
+		})
+	}
+}
+
 func TestCpu_Tick_0xDXYN_no_collision(t *testing.T) {
 	t.Parallel()
 	bs := opCodeToBytes(0xD013)
@@ -73,6 +123,8 @@ func TestCpu_Tick_0xDXYN_no_collision(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int16(514), c.pc)
 	assert.Equal(t, byte(0x0), c.v[0xF])
+	sm.AssertNotCalled(t, "Draw", mock.Anything)
+	assert.NoError(t, c.VBlank())
 	sm.AssertCalled(t, "Draw", fb)
 }
 
@@ -97,7 +149,7 @@ func TestCpu_Tick_0xDXYN_has_collision(t *testing.T) {
 	m[c.ir+1] = 0x0C3
 	m[c.ir+2] = 0x0FF
 
-	c.fb[(64*(2+0))+1+2] = 0x1
+	c.fb.set(1+2, 2+0)
 	fb := getExpectedFrameBuffer()
 	fb[(64*(2+0))+1+2] = 0x0
 	sm.On("Draw", mock.Anything)
@@ -105,9 +157,59 @@ func TestCpu_Tick_0xDXYN_has_collision(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int16(514), c.pc)
 	assert.Equal(t, byte(0x1), c.v[0xF])
+	sm.AssertNotCalled(t, "Draw", mock.Anything)
+	assert.NoError(t, c.VBlank())
 	sm.AssertCalled(t, "Draw", fb)
 }
 
+func TestCpu_Tick_0xDXYN_edges(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		vx, vy byte
+		wrap   bool
+		set    [][2]int // Pixels on before drawing
+		on     [][2]int // Pixels on after
+		vf     byte
+	}{
+		{name: "clipped right", vx: 62, vy: 0, on: [][2]int{{62, 0}, {63, 0}, {62, 1}, {62, 2}, {63, 2}}},
+		{name: "wrapped right", vx: 62, vy: 0, wrap: true, on: [][2]int{{62, 0}, {63, 0}, {0, 0}, {62, 1}, {1, 1}, {62, 2}, {63, 2}, {0, 2}, {1, 2}}},
+		{name: "clipped bottom", vx: 0, vy: 31, on: [][2]int{{0, 31}, {1, 31}, {2, 31}}},
+		{name: "wrapped bottom", vx: 0, vy: 31, wrap: true, on: [][2]int{{0, 31}, {1, 31}, {2, 31}, {0, 0}, {3, 0}, {0, 1}, {1, 1}, {2, 1}, {3, 1}}},
+		{name: "start wraps", vx: 64 + 4, vy: 32 + 8, on: [][2]int{{4, 8}, {5, 8}, {6, 8}, {4, 9}, {7, 9}, {4, 10}, {5, 10}, {6, 10}, {7, 10}}},
+		{name: "start wraps from 255", vx: 255, vy: 255, on: [][2]int{{63, 31}}},
+		{name: "clipped pixels don't collide", vx: 62, vy: 0, set: [][2]int{{0, 1}}, on: [][2]int{{62, 0}, {63, 0}, {62, 1}, {62, 2}, {63, 2}, {0, 1}}},
+		{name: "wrapped pixels collide", vx: 62, vy: 0, wrap: true, set: [][2]int{{1, 1}}, on: [][2]int{{62, 0}, {63, 0}, {0, 0}, {62, 1}, {62, 2}, {63, 2}, {0, 2}, {1, 2}}, vf: 1},
+		{name: "collide at the bottom", vx: 0, vy: 31, set: [][2]int{{2, 31}}, on: [][2]int{{0, 31}, {1, 31}}, vf: 1},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			m := state.InitMemory()
+			assert.NoError(t, m.LoadMemory(bytes.NewBuffer(opCodeToBytes(0xD013))))
+			c := getNewCPU(m, NewKeyboard(), getTimer(), &noopScreen{})
+			c.SetWrap(tc.wrap)
+			c.ir = uint16(55)
+			c.v[0] = tc.vx
+			c.v[1] = tc.vy
+			m[c.ir] = 0xE0   // ***
+			m[c.ir+1] = 0x90 // *  *
+			m[c.ir+2] = 0xF0 // ****
+			for _, p := range tc.set {
+				c.fb.set(p[0], p[1])
+			}
+			assert.NoError(t, c.Tick())
+			exp := make([]byte, 64*32)
+			for _, p := range tc.on {
+				exp[p[1]*64+p[0]] = 1
+			}
+			assert.Equal(t, exp, c.FrameBuffer())
+			assert.Equal(t, tc.vf, c.v[0xF])
+		})
+	}
+}
+
 func getExpectedFrameBuffer() []byte {
 	// given vx,vy is 1,2
 	vx := 1
@@ -217,7 +319,7 @@ func TestCpu_Tick_0x2NNN(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int16(1263), c.pc)
 	assert.Equal(t, int8(1), c.stack.Len())
-	assert.Equal(t, int16(512), c.stack.Pop())
+	assert.Equal(t, []int16{512}, c.stack.Values())
 }
 
 func TestCpu_Tick_0x3XNN(t *testing.T) {
@@ -555,6 +657,26 @@ func TestCpu_Tick_0x8(t *testing.T) {
 			exp:    246,
 			cry:    0x1,
 		},
+		{
+			name:   "0x8XY4 carry with VF as VY",
+			opcode: 0x80f4,
+			x:      0,
+			vx:     1,
+			y:      15,
+			vy:     255,
+			exp:    0, // VY read before the carry is set
+			cry:    0x1,
+		},
+		{
+			name:   "0x8XY7 with VF as VY",
+			opcode: 0x80f7,
+			x:      0,
+			vx:     0,
+			y:      15,
+			vy:     0,
+			exp:    0,
+			cry:    0x1,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -665,13 +787,20 @@ func TestCpu_Tick_0xFX0A(t *testing.T) {
 	err := m.LoadMemory(bf)
 	assert.NoError(t, err)
 	k := &keyboardMock{}
-	k.On("WaitForKeyPressed").WaitUntil(time.After(time.Second)).Return(byte(0xb))
+	k.On("PollKeyPressed").Return(byte(0), false).Twice()
+	k.On("PollKeyPressed").Return(byte(0xb), true).Once()
 	c := getNewCPU(m, k, getTimer(), &screenMock{})
+	for i := 0; i < 2; i++ {
+		err = c.Tick()
+		assert.NoError(t, err)
+		assert.Equal(t, int16(512), c.pc, "executed again until a key is pressed")
+	}
 	err = c.Tick()
 	assert.NoError(t, err)
 	assert.Equal(t, int16(514), c.pc)
-	k.AssertCalled(t, "WaitForKeyPressed")
 	assert.Equal(t, byte(0xb), c.v[9])
+	assert.Equal(t, uint64(3), c.cycle)
+	k.AssertExpectations(t)
 }
 
 func TestCpu_Tick_0xFX15(t *testing.T) {
@@ -821,6 +950,15 @@ func TestCpu_Tick_0xFX_MEM(t *testing.T) {
 			expIr:  12 * 5, // 0x0c * 0X5 (font starts hex x 5)
 			cry:    0x0,
 		},
+		{
+			name:   "FX29 past the font",
+			opcode: 0xfb29,
+			x:      11,
+			vx:     0x3e,
+			ir:     121,
+			expIr:  0xe * 5, // Only the low nibble is a character
+			cry:    0x0,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -858,9 +996,9 @@ type keyboardMock struct {
 	mock.Mock
 }
 
-func (k *keyboardMock) WaitForKeyPressed() (key byte) {
+func (k *keyboardMock) PollKeyPressed() (key byte, ok bool) {
 	args := k.Called()
-	return args.Get(0).(byte)
+	return args.Get(0).(byte), args.Bool(1)
 }
 
 func (k *keyboardMock) KeyPressed(key byte) {
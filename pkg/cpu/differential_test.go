@@ -0,0 +1,378 @@
+package cpu
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/disasm"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// program is a random program and the state the machine starts it in,
+// everything needed to run it the same way again.
+type program struct {
+	code   []uint16 // Loaded at 0x200
+	v      [16]byte
+	i      uint16
+	dt, st byte
+	key    byte     // Held down, none when it is not 0x0 to 0xF
+	stack  []uint16 // Addresses of calls already made
+	lit    []int    // Pixels on, as y*64+x
+	wrap   bool
+	seed   int64 // Of the random numbers of CXNN
+	steps  int
+}
+
+// template is an instruction to generate, the bits of mask being random.
+type template struct {
+	opcode, mask uint16
+	jump         bool // Whether NNN is an address in the program
+}
+
+// templates are every instruction the cpu executes but FX0A, which waits
+// for a key. 8XY8 is one that does nothing.
+var templates = []template{
+	{0x00E0, 0x0000, false}, {0x00EE, 0x0000, false}, {0x00FD, 0x0000, false},
+	{0x1000, 0x0FFF, true}, {0x2000, 0x0FFF, true}, {0x3000, 0x0FFF, false},
+	{0x4000, 0x0FFF, false}, {0x5000, 0x0FF0, false}, {0x6000, 0x0FFF, false},
+	{0x7000, 0x0FFF, false}, {0x8000, 0x0FF0, false}, {0x8001, 0x0FF0, false},
+	{0x8002, 0x0FF0, false}, {0x8003, 0x0FF0, false}, {0x8004, 0x0FF0, false},
+	{0x8005, 0x0FF0, false}, {0x8006, 0x0FF0, false}, {0x8007, 0x0FF0, false},
+	{0x8008, 0x0FF0, false}, {0x800E, 0x0FF0, false}, {0x9000, 0x0FF0, false},
+	{0xA000, 0x0FFF, false}, {0xB000, 0x0FFF, true}, {0xC000, 0x0FFF, false},
+	{0xD000, 0x0FFF, false}, {0xE09E, 0x0F00, false}, {0xE0A1, 0x0F00, false},
+	{0xF007, 0x0F00, false}, {0xF015, 0x0F00, false}, {0xF018, 0x0F00, false},
+	{0xF01E, 0x0F00, false}, {0xF029, 0x0F00, false}, {0xF033, 0x0F00, false},
+	{0xF055, 0x0F00, false}, {0xF065, 0x0F00, false},
+}
+
+// randomProgram returns a program of up to 32 instructions, jumping only
+// to its own instructions, and a random state to start it in.
+func randomProgram(r *rand.Rand) program {
+	p := program{
+		code:  make([]uint16, 1+r.Intn(32)),
+		i:     uint16(r.Intn(0x1000)),
+		dt:    byte(r.Intn(256)),
+		st:    byte(r.Intn(256)),
+		key:   byte(r.Intn(0x12)),
+		wrap:  r.Intn(2) == 0,
+		seed:  r.Int63(),
+		steps: 100,
+	}
+	if r.Intn(2) == 0 {
+		// The font and the program are drawn more often than the rest
+		p.i = uint16(r.Intn(0x250))
+	}
+	for i := range p.code {
+		t := templates[r.Intn(len(templates))]
+		p.code[i] = t.opcode | uint16(r.Intn(0x10000))&t.mask
+		if t.jump {
+			p.code[i] = t.opcode | uint16(0x200+2*r.Intn(len(p.code)))
+		}
+	}
+	r.Read(p.v[:])
+	for i := r.Intn(4); i > 0; i-- {
+		p.stack = append(p.stack, uint16(0x200+2*r.Intn(len(p.code))))
+	}
+	for i := r.Intn(64); i > 0; i-- {
+		p.lit = append(p.lit, r.Intn(64*32))
+	}
+	return p
+}
+
+// machine is everything that is compared after every step.
+type machine struct {
+	Registers Step
+	Memory    []byte
+	Screen    []byte
+}
+
+// differ returns what is different between two machines.
+func (m machine) differ(o machine) []string {
+	var diffs []string
+	if !reflect.DeepEqual(m.Registers, o.Registers) {
+		diffs = append(diffs, fmt.Sprintf("registers %+v, want %+v", o.Registers, m.Registers))
+	}
+	for a := range m.Memory {
+		if m.Memory[a] != o.Memory[a] {
+			diffs = append(diffs, fmt.Sprintf("memory at %#03x is %#02x, want %#02x", a, o.Memory[a], m.Memory[a]))
+		}
+	}
+	for p := range m.Screen {
+		if m.Screen[p] != o.Screen[p] {
+			diffs = append(diffs, fmt.Sprintf("pixel %d,%d is %d, want %d", p%64, p/64, o.Screen[p], m.Screen[p]))
+		}
+	}
+	return diffs
+}
+
+// load sets up the cpu and the reference to run p.
+func (p program) load() (*cpu, *reference) {
+	m := state.InitMemory()
+	for i, op := range p.code {
+		addToMemory(m, op, 0x200+2*i)
+	}
+	// Enough room for every tick of the sound timer, which nobody listens to
+	ti := NewTimer(make(chan byte, p.steps/10+1))
+	ti.SetDelay(p.dt)
+	ti.SetSound(p.st)
+	k := NewKeyboard()
+	k.KeyPressed(p.key)
+	c := NewCPU(m, rand.New(rand.NewSource(p.seed)), k, ti, &noopScreen{})
+	c.SetWrap(p.wrap)
+	copy(c.v, p.v[:])
+	c.ir = p.i
+	for _, a := range p.stack {
+		c.stack.Push(int16(a))
+	}
+	for _, l := range p.lit {
+		c.fb.set(l%64, l/64)
+	}
+
+	r := &reference{
+		v:     p.v,
+		i:     p.i,
+		pc:    0x200,
+		stack: append([]uint16(nil), p.stack...),
+		dt:    p.dt,
+		st:    p.st,
+		key:   p.key,
+		wrap:  p.wrap,
+		r:     rand.New(rand.NewSource(p.seed)),
+	}
+	copy(r.mem[:], m)
+	for _, l := range p.lit {
+		r.screen[l/64][l%64] = true
+	}
+	return c, r
+}
+
+func (c *cpu) machine() machine {
+	return machine{Registers: c.Registers(), Memory: append([]byte(nil), c.m...), Screen: c.FrameBuffer()}
+}
+
+func (r *reference) machine() machine {
+	s := Step{
+		Cycle: r.cycle,
+		PC:    r.pc,
+		V:     r.v,
+		I:     r.i,
+		SP:    int8(len(r.stack)),
+		Stack: append([]uint16(nil), r.stack...),
+		DT:    r.dt,
+		ST:    r.st,
+	}
+	if int(r.pc)+1 < len(r.mem) {
+		s.Opcode = r.opcode()
+	}
+	if len(s.Stack) == 0 {
+		s.Stack = nil
+	}
+	m := machine{Registers: s, Memory: append([]byte(nil), r.mem[:]...)}
+	for _, row := range r.screen {
+		for _, p := range row {
+			m.Screen = append(m.Screen, flag(p))
+		}
+	}
+	return m
+}
+
+// run runs p on the cpu and the reference side by side, with the timers
+// counted down every 10 steps, returning how they first differed and at
+// which step, or nothing when they never did. Where the reference cannot
+// go on the cpu has to return an error.
+func (p program) run() (step int, diffs []string) {
+	c, r := p.load()
+	if diffs = r.machine().differ(c.machine()); len(diffs) > 0 {
+		return 0, diffs
+	}
+	for step = 1; step <= p.steps && r.valid(); step++ {
+		if step%10 == 0 {
+			r.tick()
+			_ = c.t.Tick()
+		}
+		exited := r.step()
+		err := tick(c)
+		switch {
+		case exited && err != ErrExit:
+			return step, []string{fmt.Sprintf("returned %v, want %v", err, ErrExit)}
+		case !exited && err != nil:
+			return step, []string{fmt.Sprintf("returned %v", err)}
+		}
+		if diffs = r.machine().differ(c.machine()); len(diffs) > 0 {
+			return step, diffs
+		}
+		if exited {
+			return 0, nil
+		}
+	}
+	if step <= p.steps && !r.waiting() {
+		// The reference cannot go on, so the cpu should say why it cannot
+		if err := tick(c); err == nil || strings.HasPrefix(err.Error(), "panicked") {
+			return step, []string{fmt.Sprintf("returned %v, want an error", err)}
+		}
+	}
+	return 0, nil
+}
+
+// tick ticks c, returning an error should it panic.
+func tick(c *cpu) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panicked: %v", p)
+		}
+	}()
+	return c.Tick()
+}
+
+// fails reports whether the cpu and the reference differ running p.
+func (p program) fails() bool {
+	_, diffs := p.run()
+	return len(diffs) > 0
+}
+
+// shrink returns the smallest program it can find that fails is true of,
+// by removing instructions, calls and pixels and zeroing operands and
+// registers for as long as any of them keeps it failing.
+func (p program) shrink(fails func(program) bool) program {
+	for {
+		smaller, ok := p.smaller(fails)
+		if !ok {
+			return p
+		}
+		p = smaller
+	}
+}
+
+// smaller returns the first simpler version of p that fails is true of.
+func (p program) smaller(fails func(program) bool) (program, bool) {
+	var candidates []program
+	for i := range p.code {
+		q := p
+		q.code = append(append([]uint16(nil), p.code[:i]...), p.code[i+1:]...)
+		candidates = append(candidates, q)
+	}
+	for i, op := range p.code {
+		for _, mask := range []uint16{0xF0FF, 0xFF0F, 0xFFF0} {
+			if op&mask != op {
+				q := p
+				q.code = append([]uint16(nil), p.code...)
+				q.code[i] = op & mask
+				candidates = append(candidates, q)
+			}
+		}
+	}
+	for i := range p.stack {
+		q := p
+		q.stack = append(append([]uint16(nil), p.stack[:i]...), p.stack[i+1:]...)
+		candidates = append(candidates, q)
+	}
+	for i := range p.lit {
+		q := p
+		q.lit = append(append([]int(nil), p.lit[:i]...), p.lit[i+1:]...)
+		candidates = append(candidates, q)
+	}
+	for i, v := range p.v {
+		if v != 0 {
+			q := p
+			q.v[i] = 0
+			candidates = append(candidates, q)
+		}
+	}
+	if p.i != 0 {
+		q := p
+		q.i = 0
+		candidates = append(candidates, q)
+	}
+	if p.dt != 0 || p.st != 0 {
+		q := p
+		q.dt, q.st = 0, 0
+		candidates = append(candidates, q)
+	}
+	if p.wrap {
+		q := p
+		q.wrap = false
+		candidates = append(candidates, q)
+	}
+	for _, q := range candidates {
+		if len(q.code) > 0 && fails(q) {
+			return q, true
+		}
+	}
+	return p, false
+}
+
+// String returns p as a listing and the state it starts in.
+func (p program) String() string {
+	var b strings.Builder
+	for i, op := range p.code {
+		fmt.Fprintf(&b, "%#03x  %04X  %s\n", 0x200+2*i, op, disasm.Decode(op))
+	}
+	fmt.Fprintf(&b, "V=% X I=%#03x DT=%d ST=%d key=%#x stack=%#03x lit=%v wrap=%v seed=%d steps=%d",
+		p.v[:], p.i, p.dt, p.st, p.key, p.stack, p.lit, p.wrap, p.seed, p.steps)
+	return b.String()
+}
+
+// TestCpu_Tick_reference runs random programs from random states on the
+// cpu and the reference, comparing every register, byte of memory and
+// pixel after every step, and shrinking any program they differ on to
+// the smallest that still shows how.
+func TestCpu_Tick_reference(t *testing.T) {
+	// Shrinking runs into memory that was never written, 0000 warning
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(log.ErrorLevel)
+	programs := 2000
+	if testing.Short() {
+		programs = 200
+	}
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < programs; n++ {
+		p := randomProgram(r)
+		if !p.fails() {
+			continue
+		}
+		p = p.shrink(program.fails)
+		step, diffs := p.run()
+		p.steps = step
+		t.Fatalf("the cpu differs from the reference at step %d of program %d:\n%s\n\n%s",
+			step, n, strings.Join(diffs, "\n"), p)
+	}
+}
+
+func TestProgram_shrink(t *testing.T) {
+	t.Parallel()
+	// Failing whenever V3 is added to V2 with a carry
+	fails := func(p program) bool {
+		_, r := p.load()
+		for step := 0; step < p.steps && r.valid(); step++ {
+			if r.opcode() == 0x8234 && int(r.v[2])+int(r.v[3]) > 0xFF {
+				return true
+			}
+			if r.step() {
+				break
+			}
+		}
+		return false
+	}
+	p := program{
+		code:  []uint16{0x6080, 0x71FF, 0xA234, 0x6290, 0x220C, 0xD015, 0x8234, 0x00FD},
+		v:     [16]byte{0x1, 0x2, 0x3, 0x90, 0x5},
+		i:     0x123,
+		stack: []uint16{0x202},
+		lit:   []int{5, 70},
+		wrap:  true,
+		steps: 100,
+	}
+	assert.True(t, fails(p))
+	p = p.shrink(fails)
+	assert.Equal(t, []uint16{0x6290, 0x8234}, p.code)
+	assert.Equal(t, [16]byte{3: 0x90}, p.v)
+	assert.Equal(t, uint16(0), p.i)
+	assert.Empty(t, p.stack)
+	assert.Empty(t, p.lit)
+	assert.False(t, p.wrap)
+}
@@ -0,0 +1,156 @@
+package cpu
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// frameBuffer is what the CPU draws to. Pixels are packed a bit each, most
+// significant first, into 64 bit words, a row of a low resolution frame
+// being one word and of a high resolution one two. It is locked as it is
+// presented from another goroutine than the one drawing to it.
+type frameBuffer struct {
+	lock          sync.Mutex
+	width, height int
+	rows          []uint64
+	lit           []uint64 // Pixels that were on at any time since the last present
+	dirty         bool     // Whether it was drawn to since the last present
+	unlit         bool     // Whether the last present showed pixels since turned off
+}
+
+func newFrameBuffer(width, height int) *frameBuffer {
+	return &frameBuffer{
+		width:  width,
+		height: height,
+		rows:   make([]uint64, width*height/64),
+		lit:    make([]uint64, width*height/64),
+	}
+}
+
+// clear turns every pixel off.
+func (f *frameBuffer) clear() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for i := range f.rows {
+		f.rows[i] = 0
+	}
+	f.dirty = true
+}
+
+// draw XORs sprite, a row of 8 pixels a byte, onto the frame at x, y,
+// returning whether it turned any pixel off. x and y wrap around the
+// screen, and pixels past its edges are clipped, or wrap around to the
+// other side when wrap is set. Rows are drawn whole, a row of the sprite
+// being shifted into place and XOR'ed with the one or two words it lands
+// on.
+func (f *frameBuffer) draw(x, y int, sprite []byte, wrap bool) (collision bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	words := f.width / 64
+	x, y = x%f.width, y%f.height
+	word, shift := x/64, uint(x%64)
+	for yl, row := range sprite {
+		yy := y + yl
+		if yy >= f.height {
+			if !wrap {
+				break
+			}
+			yy %= f.height
+		}
+		first := yy*words + word
+		if shift <= 56 {
+			collision = f.xor(first, uint64(row)<<(56-shift)) || collision
+			continue
+		}
+		collision = f.xor(first, uint64(row)>>(shift-56)) || collision
+		// The rest is in the next word of the row, or past the right edge
+		switch {
+		case word+1 < words:
+			collision = f.xor(first+1, uint64(row)<<(120-shift)) || collision
+		case wrap:
+			collision = f.xor(yy*words, uint64(row)<<(120-shift)) || collision
+		}
+	}
+	f.dirty = true
+	return collision
+}
+
+// xor flips the pixels of mask in a word, returning whether any were on.
+func (f *frameBuffer) xor(word int, mask uint64) bool {
+	collision := f.rows[word]&mask != 0
+	f.rows[word] ^= mask
+	f.lit[word] |= f.rows[word]
+	return collision
+}
+
+// pixel returns whether the pixel at x, y is on.
+func (f *frameBuffer) pixel(x, y int) bool {
+	p := y*f.width + x
+	return f.rows[p/64]&(1<<uint(63-p%64)) != 0
+}
+
+// set turns the pixel at x, y on.
+func (f *frameBuffer) set(x, y int) {
+	p := y*f.width + x
+	f.rows[p/64] |= 1 << uint(63-p%64)
+}
+
+// pixels returns a copy of the frame, one byte per pixel, as screens are
+// given it.
+func (f *frameBuffer) pixels() []byte {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return unpack(f.rows)
+}
+
+// words returns a copy of the frame as it is packed.
+func (f *frameBuffer) words() []uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]uint64(nil), f.rows...)
+}
+
+// load replaces the frame with words, packed as it is.
+func (f *frameBuffer) load(words []uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	copy(f.rows, words)
+	f.dirty = true
+}
+
+// unpack returns the pixels of words, one byte per pixel.
+func unpack(words []uint64) []byte {
+	pix := make([]byte, len(words)*64)
+	for i, w := range words {
+		for w != 0 {
+			b := bits.LeadingZeros64(w)
+			pix[i*64+b] = 0x1
+			w &^= 1 << uint(63-b)
+		}
+	}
+	return pix
+}
+
+// present returns a copy of what to show, or false when it is the same as
+// the last time. When or is set it is every pixel that was on at all since
+// the last time rather than those on now.
+func (f *frameBuffer) present(or bool) ([]byte, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.dirty && !f.unlit {
+		return nil, false
+	}
+	frame := unpack(f.rows)
+	if or {
+		frame = unpack(f.lit)
+		f.unlit = false
+		for i := range f.lit {
+			if f.lit[i] != f.rows[i] {
+				f.unlit = true
+			}
+		}
+	}
+	copy(f.lit, f.rows)
+	f.dirty = false
+	return frame, true
+}
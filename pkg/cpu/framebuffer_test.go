@@ -0,0 +1,129 @@
+package cpu
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestFrameBuffer_draw(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		width, height int
+		x, y          int
+		sprite        []byte
+		on            [][2]int
+	}{
+		{"in a word", 64, 32, 0, 0, []byte{0x81}, [][2]int{{0, 0}, {7, 0}}},
+		{"at the end of a word", 64, 32, 56, 1, []byte{0x01}, [][2]int{{63, 1}}},
+		{"across two words", 128, 64, 60, 2, []byte{0x99}, [][2]int{{60, 2}, {63, 2}, {64, 2}, {67, 2}}},
+		{"rows", 64, 32, 3, 30, []byte{0x80, 0x40}, [][2]int{{3, 30}, {4, 31}}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := newFrameBuffer(tc.width, tc.height)
+			assert.False(t, f.draw(tc.x, tc.y, tc.sprite, false))
+			exp := make([]byte, tc.width*tc.height)
+			for _, p := range tc.on {
+				exp[p[1]*tc.width+p[0]] = 1
+				assert.True(t, f.pixel(p[0], p[1]))
+			}
+			assert.Equal(t, exp, f.pixels())
+			assert.True(t, f.draw(tc.x, tc.y, tc.sprite, false), "collides with itself")
+			assert.Equal(t, make([]byte, tc.width*tc.height), f.pixels(), "and erases itself")
+		})
+	}
+}
+
+func TestFrameBuffer_draw_edges(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		width, height int
+		x, y          int
+		sprite        []byte
+		wrap          bool
+		on            [][2]int
+	}{
+		{"clipped right", 64, 32, 62, 0, []byte{0xF0}, false, [][2]int{{62, 0}, {63, 0}}},
+		{"wrapped right", 64, 32, 62, 0, []byte{0xF0}, true, [][2]int{{62, 0}, {63, 0}, {0, 0}, {1, 0}}},
+		{"clipped bottom", 64, 32, 0, 31, []byte{0x80, 0x80}, false, [][2]int{{0, 31}}},
+		{"wrapped bottom", 64, 32, 0, 31, []byte{0x80, 0x80}, true, [][2]int{{0, 31}, {0, 0}}},
+		{"start wraps", 64, 32, 64 + 3, 32 + 2, []byte{0x80}, false, [][2]int{{3, 2}}},
+		{"hires clipped right", 128, 64, 125, 63, []byte{0xFF}, false, [][2]int{{125, 63}, {126, 63}, {127, 63}}},
+		{"hires wrapped right", 128, 64, 126, 0, []byte{0xC1}, true, [][2]int{{126, 0}, {127, 0}, {5, 0}}},
+		{"hires across words", 128, 64, 63, 0, []byte{0xC0}, false, [][2]int{{63, 0}, {64, 0}}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := newFrameBuffer(tc.width, tc.height)
+			f.draw(tc.x, tc.y, tc.sprite, tc.wrap)
+			exp := make([]byte, tc.width*tc.height)
+			for _, p := range tc.on {
+				exp[p[1]*tc.width+p[0]] = 1
+			}
+			assert.Equal(t, exp, f.pixels())
+		})
+	}
+}
+
+func TestFrameBuffer_draw_collision(t *testing.T) {
+	t.Parallel()
+	f := newFrameBuffer(64, 32)
+	f.set(10, 5)
+	assert.False(t, f.draw(2, 5, []byte{0xFF}, false), "next to it")
+	assert.True(t, f.draw(4, 4, []byte{0x00, 0x02}, false), "only the pixel on")
+	assert.False(t, f.pixel(10, 5))
+}
+
+func TestFrameBuffer_draw_sameAsBytes(t *testing.T) {
+	t.Parallel()
+	r := rand.New(rand.NewSource(7))
+	f := newFrameBuffer(64, 32)
+	fb := make([]byte, 64*32)
+	for i := 0; i < 1000; i++ {
+		sprite := make([]byte, r.Intn(16))
+		r.Read(sprite)
+		x, y := r.Intn(64-8), r.Intn(32-len(sprite))
+		assert.Equal(t, drawBytes(fb, x, y, sprite), f.draw(x, y, sprite, false))
+	}
+	assert.Equal(t, fb, f.pixels())
+}
+
+func TestFrameBuffer_clear(t *testing.T) {
+	t.Parallel()
+	f := newFrameBuffer(128, 64)
+	f.draw(100, 60, []byte{0xFF}, false)
+	f.clear()
+	assert.Equal(t, make([]byte, 128*64), f.pixels())
+}
+
+func TestFrameBuffer_present(t *testing.T) {
+	t.Parallel()
+	f := newFrameBuffer(64, 32)
+	_, ok := f.present(false)
+	assert.False(t, ok, "not drawn to")
+	f.draw(0, 0, []byte{0x80}, false)
+	frame, ok := f.present(false)
+	assert.True(t, ok)
+	assert.Equal(t, byte(1), frame[0])
+	f.draw(0, 0, []byte{0x80}, false)
+	frame[1] = 1
+	assert.Equal(t, byte(0), f.pixels()[1], "a copy")
+
+	f.draw(0, 0, []byte{0x80}, false)
+	f.draw(0, 0, []byte{0x80}, false)
+	frame, ok = f.present(true)
+	assert.True(t, ok)
+	assert.Equal(t, byte(1), frame[0], "on at some point")
+	frame, ok = f.present(true)
+	assert.True(t, ok, "off since")
+	assert.Equal(t, byte(0), frame[0])
+	_, ok = f.present(true)
+	assert.False(t, ok)
+}
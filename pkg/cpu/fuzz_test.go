@@ -0,0 +1,120 @@
+//go:build go1.18
+// +build go1.18
+
+package cpu
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// fuzzTicks is how many instructions a fuzzed machine is run for.
+const fuzzTicks = 1000
+
+// heldKeyboard has a key held down that is never let go, so a program
+// waiting for a key always gets it.
+type heldKeyboard struct {
+	key byte
+}
+
+func (k heldKeyboard) PollKeyPressed() (byte, bool) {
+	return k.key, true
+}
+
+func (k heldKeyboard) IsKeyPressed(key byte) bool {
+	return key == k.key
+}
+
+func (k heldKeyboard) KeyPressed(key byte) {}
+
+func (k heldKeyboard) Clear() {}
+
+// newFuzzCPU returns a CPU whose timers can be ticked without anybody
+// listening to the sound timer.
+func newFuzzCPU(m state.Memory) *cpu {
+	return NewCPU(m, rand.New(rand.NewSource(1)), heldKeyboard{key: 0x5}, NewTimer(make(chan byte, fuzzTicks)), &noopScreen{})
+}
+
+// run ticks c until it returns an error, ticking its timers every 10
+// instructions.
+func run(c *cpu) {
+	for i := 1; i <= fuzzTicks; i++ {
+		if i%10 == 0 {
+			_ = c.t.Tick()
+		}
+		if c.Tick() != nil {
+			return
+		}
+	}
+}
+
+// addROMs adds the test roms loaded into memory as seeds, or when states
+// is set the states they are in after running for a while.
+func addROMs(f *testing.F, states bool) {
+	paths, err := filepath.Glob("../../test/roms/*.ch8")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		rom, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		m := state.InitMemory()
+		if err = m.LoadMemory(bytes.NewReader(rom)); err != nil {
+			f.Fatal(err)
+		}
+		if !states {
+			f.Add([]byte(m))
+			continue
+		}
+		c := newFuzzCPU(m)
+		run(c)
+		var b bytes.Buffer
+		if err = c.SaveState(&b); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b.Bytes())
+	}
+}
+
+// FuzzTick runs whatever is in memory, which should only ever end in an
+// error and never a panic.
+func FuzzTick(f *testing.F) {
+	log.SetLevel(log.ErrorLevel)
+	addROMs(f, false)
+	f.Fuzz(func(t *testing.T, image []byte) {
+		m := state.InitMemory()
+		copy(m, image)
+		c := newFuzzCPU(m)
+		c.SetWrap(len(image)%2 == 1)
+		run(c)
+		c.Registers()
+		c.IdleLoop()
+		c.SkipIdle(fuzzTicks)
+		_ = c.VBlank()
+	})
+}
+
+// FuzzLoadState loads whatever it is given as a save state, which should
+// either be refused or leave a machine that can run.
+func FuzzLoadState(f *testing.F) {
+	log.SetLevel(log.ErrorLevel)
+	addROMs(f, true)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := newFuzzCPU(state.InitMemory())
+		if err := c.LoadState(bytes.NewReader(data)); err != nil {
+			return
+		}
+		run(c)
+		var b bytes.Buffer
+		if err := c.SaveState(&b); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package cpu
+
+// IdleLoop returns how many instructions long the loop the program counter
+// is at the start of is, when it is a loop that does nothing but wait for
+// the delay timer or a key, or 0 when it isn't. The loops recognised are
+//
+//	FX07; 3XNN; 1NNN  Wait for the delay timer to reach NN
+//	EX9E; 1NNN        Wait for key VX to be pressed
+//	EXA1; 1NNN        Wait for key VX to be released
+//	FX0A              Wait for a key to be pressed into VX
+//	1NNN              Wait forever
+//
+// where 1NNN jumps back to the first instruction, and FX0A is executed
+// again until a key is pressed. Until a frame counts the timers down or a
+// key changes, every time around such a loop does the same, so it can be
+// skipped without changing what the program does.
+func (c *cpu) IdleLoop() int {
+	op := func(i int) uint16 {
+		at := int(c.pc) + 2*i
+		if at < 0 || at+1 >= len(c.m) {
+			return 0
+		}
+		return uint16(c.m[at])<<8 | uint16(c.m[at+1])
+	}
+	back := 0x1000 | uint16(c.pc)
+	first := op(0)
+	x := first & 0x0F00
+	switch {
+	case first == back:
+		return 1
+	case first&0xF0FF == 0xF007 && op(1)&0xFF00 == 0x3000|x && op(2) == back:
+		if c.t.GetDelay() != byte(op(1)) {
+			return 3
+		}
+	case first&0xF0FF == 0xE09E && op(1) == back:
+		if !c.k.IsKeyPressed(c.v[x>>8]) {
+			return 2
+		}
+	case first&0xF0FF == 0xE0A1 && op(1) == back:
+		if c.k.IsKeyPressed(c.v[x>>8]) {
+			return 2
+		}
+	case first&0xF0FF == 0xF00A:
+		if !c.pollKey() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// SkipIdle skips as many of the next n instructions as go around the idle
+// loop the program counter is at, see IdleLoop, a whole number of times,
+// leaving the CPU as executing them would have. It returns how many it
+// skipped, which is none while there are tracers or memory watchers, as
+// they would miss what was skipped.
+func (c *cpu) SkipIdle(n int) int {
+	if len(c.trs) > 0 || len(c.mws) > 0 {
+		return 0
+	}
+	l := c.IdleLoop()
+	if l == 0 {
+		return 0
+	}
+	n -= n % l
+	if n == 0 {
+		return 0
+	}
+	if l == 3 {
+		// FX07 is the only instruction of the loops to change anything
+		c.v[c.m[c.pc]&0x0F] = c.t.GetDelay()
+	}
+	c.cycle += uint64(n)
+	return n
+}
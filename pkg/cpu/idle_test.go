@@ -0,0 +1,114 @@
+package cpu
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCpu_IdleLoop(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		program []byte
+		delay   byte
+		key     byte // Pressed, when not 0xFF
+		length  int
+	}{
+		{"jump to itself", []byte{0x12, 0x00}, 0, 0xFF, 1},
+		{"delay timer running", []byte{0xF3, 0x07, 0x33, 0x00, 0x12, 0x00}, 5, 0xFF, 3},
+		{"delay timer done", []byte{0xF3, 0x07, 0x33, 0x00, 0x12, 0x00}, 0, 0xFF, 0},
+		{"delay timer not yet at NN", []byte{0xF3, 0x07, 0x33, 0x02, 0x12, 0x00}, 5, 0xFF, 3},
+		{"delay timer in another register", []byte{0xF3, 0x07, 0x34, 0x00, 0x12, 0x00}, 5, 0xFF, 0},
+		{"delay timer jumping elsewhere", []byte{0xF3, 0x07, 0x33, 0x00, 0x12, 0x02}, 5, 0xFF, 0},
+		{"key not pressed", []byte{0xE1, 0x9E, 0x12, 0x00}, 0, 0xFF, 2},
+		{"key pressed", []byte{0xE1, 0x9E, 0x12, 0x00}, 0, 0x1, 0},
+		{"other key pressed", []byte{0xE1, 0x9E, 0x12, 0x00}, 0, 0x2, 2},
+		{"key not released", []byte{0xE1, 0xA1, 0x12, 0x00}, 0, 0x1, 2},
+		{"key released", []byte{0xE1, 0xA1, 0x12, 0x00}, 0, 0xFF, 0},
+		{"waiting for a key", []byte{0xF1, 0x0A, 0x12, 0x00}, 0, 0xFF, 1},
+		{"key pressed for FX0A", []byte{0xF1, 0x0A, 0x12, 0x00}, 0, 0x2, 0},
+		{"not a loop", []byte{0x60, 0x01, 0x12, 0x00}, 0, 0xFF, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := state.InitMemory()
+			copy(m[0x200:], tt.program)
+			k := NewKeyboard()
+			if tt.key != 0xFF {
+				k.KeyPressed(tt.key)
+			}
+			ti := getTimer()
+			ti.SetDelay(tt.delay)
+			c := getNewCPU(m, k, ti, &screenMock{})
+			c.v[1] = 0x1
+			assert.Equal(t, tt.length, c.IdleLoop())
+		})
+	}
+}
+
+func TestCpu_IdleLoop_end_of_memory(t *testing.T) {
+	t.Parallel()
+	m := state.InitMemory()
+	m[0xFFE], m[0xFFF] = 0xF3, 0x07
+	c := getNewCPU(m, NewKeyboard(), getTimer(), &screenMock{})
+	c.pc = 0xFFE
+	assert.Equal(t, 0, c.IdleLoop())
+}
+
+func TestCpu_SkipIdle(t *testing.T) {
+	t.Parallel()
+	// V3 = 9, wait for the delay timer, which was set to 5
+	program := []byte{0x63, 0x09, 0xF3, 0x07, 0x33, 0x00, 0x12, 0x02}
+	newCPU := func() *cpu {
+		m := state.InitMemory()
+		copy(m[0x200:], program)
+		ti := getTimer()
+		ti.SetDelay(5)
+		return getNewCPU(m, NewKeyboard(), ti, &screenMock{})
+	}
+	for _, n := range []int{0, 1, 2, 3, 4, 10, 11} {
+		ticked, skipped := newCPU(), newCPU()
+		assert.NoError(t, ticked.Tick())
+		assert.NoError(t, skipped.Tick())
+		for i := 0; i < n; i++ {
+			assert.NoError(t, ticked.Tick())
+		}
+		s := skipped.SkipIdle(n)
+		assert.Equal(t, n-n%3, s, "whole loops skipped of %d", n)
+		for i := s; i < n; i++ {
+			assert.NoError(t, skipped.Tick())
+		}
+		assert.Equal(t, ticked.Registers(), skipped.Registers(), "after %d", n)
+	}
+}
+
+func TestCpu_SkipIdle_waitingForKey(t *testing.T) {
+	t.Parallel()
+	// Wait for a key into V1, jump to itself
+	m := state.InitMemory()
+	copy(m[0x200:], []byte{0xF1, 0x0A, 0x12, 0x02})
+	k := NewKeyboard()
+	c := getNewCPU(m, k, getTimer(), &screenMock{})
+	assert.Equal(t, 10, c.SkipIdle(10), "the rest of the frame")
+	assert.Equal(t, uint16(0x200), c.PC())
+	k.KeyPressed(0x5)
+	assert.Equal(t, 0, c.SkipIdle(10), "a key was pressed")
+	assert.NoError(t, c.Tick())
+	assert.Equal(t, uint16(0x202), c.PC())
+	assert.Equal(t, byte(0x5), c.v[1], "the key pressed while skipping")
+	assert.Equal(t, uint64(11), c.Registers().Cycle)
+}
+
+func TestCpu_SkipIdle_traced(t *testing.T) {
+	t.Parallel()
+	m := state.InitMemory()
+	copy(m[0x200:], []byte{0x12, 0x00})
+	c := getNewCPU(m, NewKeyboard(), getTimer(), &screenMock{})
+	assert.Equal(t, 4, c.SkipIdle(4))
+	c.AddTracer(&recordingTracer{})
+	assert.Equal(t, 0, c.SkipIdle(4), "tracers see every instruction")
+	assert.Equal(t, uint64(4), c.Registers().Cycle)
+}
@@ -6,7 +6,9 @@ import (
 )
 
 type Keyboard interface {
-	WaitForKeyPressed() (key byte)
+	// PollKeyPressed returns the key pressed since it was last called, and
+	// false when none was, without waiting for one.
+	PollKeyPressed() (key byte, ok bool)
 	IsKeyPressed(key byte) bool
 	KeyPressed(key byte)
 	Clear()
@@ -36,24 +38,29 @@ func (k *keyboard) IsKeyPressed(key byte) bool {
 	return k.kp == key
 }
 
-func (k *keyboard) WaitForKeyPressed() (key byte) {
-	log.Info("Waiting...")
-	key = <-k.wait
+func (k *keyboard) PollKeyPressed() (key byte, ok bool) {
+	select {
+	case key = <-k.wait:
+	default:
+		return 0, false
+	}
 	if log.IsLevelEnabled(log.DebugLevel) {
 		log.
 			WithField("key", key).
 			WithField("kp", k.kp).
-			Debug("WaitForKeyPressed")
+			Debug("PollKeyPressed")
 	}
-	return key
+	return key, true
 }
 
 func (k *keyboard) KeyPressed(key byte) {
 	k.loc.Lock()
 	defer k.loc.Unlock()
 	k.kp = key
-	if len(k.wait) > 0 {
-		<-k.wait
+	// Polling may take the key at any time, so never wait to drain it
+	select {
+	case <-k.wait:
+	default:
 	}
 	k.wait <- key
 }
@@ -61,8 +68,27 @@ func (k *keyboard) KeyPressed(key byte) {
 func (k *keyboard) Clear() {
 	k.loc.Lock()
 	defer k.loc.Unlock()
-	if len(k.wait) > 0 {
-		<-k.wait
+	// Polling may take the key at any time, so never wait to drain it
+	select {
+	case <-k.wait:
+	default:
 	}
 	k.kp = 0x11
 }
+
+// pollKey takes the key pressed since the keyboard was last polled, if
+// there was one, for FX0A to store. It returns whether a key is waiting to
+// be stored.
+func (c *cpu) pollKey() bool {
+	if !c.pressed {
+		c.key, c.pressed = c.k.PollKeyPressed()
+	}
+	return c.pressed
+}
+
+// Waiting reports whether the program waits for a key, the instruction at
+// the program counter being FX0A with no key pressed for it yet.
+func (c *cpu) Waiting() bool {
+	at := int(c.pc)
+	return at >= 0 && at+1 < len(c.m) && c.m[at]&0xF0 == 0xF0 && c.m[at+1] == 0x0A && !c.pollKey()
+}
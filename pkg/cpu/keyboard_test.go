@@ -3,6 +3,7 @@ package cpu
 import (
 	"github.com/stretchr/testify/assert"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"testing"
@@ -20,23 +21,58 @@ func TestKeyboard_isKeyPressed(t *testing.T) {
 	k.KeyPressed(0xb) // Should not block
 }
 
-func TestKeyboard_waitForKeyPressed(t *testing.T) {
+func TestKeyboard_pollKeyPressed(t *testing.T) {
 	t.Parallel()
 	k := NewKeyboard()
+	_, ok := k.PollKeyPressed()
+	assert.False(t, ok, "nothing pressed")
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
-		wg.Wait()
-		assert.False(t, k.IsKeyPressed(0xa))
+		defer wg.Done()
 		log.Info("pressing key")
 		k.KeyPressed(0xb)
 	}()
-	wg.Done()
-	log.Info("waiting for key")
-	key := k.WaitForKeyPressed()
-	log.Info("checking key")
+	wg.Wait()
+	key, ok := k.PollKeyPressed()
+	assert.True(t, ok)
 	assert.True(t, k.IsKeyPressed(0xb))
 	assert.Equal(t, byte(0xb), key)
+	_, ok = k.PollKeyPressed()
+	assert.False(t, ok, "taken by the last poll")
+}
+
+func TestKeyboard_pollWhilePressing(t *testing.T) {
+	t.Parallel()
+	k := NewKeyboard()
+	stop := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				k.PollKeyPressed()
+			}
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			k.KeyPressed(byte(i % 16))
+			k.Clear()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pressing keys blocked while they were polled")
+	}
+	close(stop)
+	<-polled
 }
 
 func TestKeyboard_Clear(t *testing.T) {
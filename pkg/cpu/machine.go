@@ -0,0 +1,47 @@
+package cpu
+
+import "github.com/carlosroman/go-chip-8/pkg/state"
+
+// Machine exposes the CPU state to code that runs a program without going
+// through Tick for every instruction, such as a recompiled ROM.
+type Machine interface {
+	Tick() error
+	Exec(opcode uint16) error
+	PC() uint16
+	SetPC(pc uint16)
+	I() uint16
+	SetI(i uint16)
+	V() []byte
+	Memory() state.Memory
+	FrameBuffer() []byte
+}
+
+func (c *cpu) PC() uint16 {
+	return uint16(c.pc)
+}
+
+func (c *cpu) SetPC(pc uint16) {
+	c.pc = int16(pc)
+}
+
+func (c *cpu) I() uint16 {
+	return c.ir
+}
+
+func (c *cpu) SetI(i uint16) {
+	c.ir = i
+}
+
+// V returns the registers, changes to it change the CPU.
+func (c *cpu) V() []byte {
+	return c.v
+}
+
+func (c *cpu) Memory() state.Memory {
+	return c.m
+}
+
+// FrameBuffer returns a copy of the frame buffer, one byte per pixel.
+func (c *cpu) FrameBuffer() []byte {
+	return c.fb.pixels()
+}
@@ -0,0 +1,25 @@
+package cpu
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCpu_Machine(t *testing.T) {
+	t.Parallel()
+	m := state.InitMemory()
+	var c Machine = getNewCPU(m, NewKeyboard(), getTimer(), &screenMock{})
+	assert.Equal(t, uint16(0x200), c.PC())
+	c.SetPC(0x2A4)
+	assert.Equal(t, uint16(0x2A4), c.PC())
+	c.SetI(0x300)
+	assert.Equal(t, uint16(0x300), c.I())
+	c.V()[0xA] = 0x5
+	err := c.Exec(0x7A01)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x6), c.V()[0xA])
+	assert.Equal(t, uint16(0x2A6), c.PC())
+	assert.Len(t, c.FrameBuffer(), 64*32)
+	assert.Equal(t, m, c.Memory())
+}
@@ -0,0 +1,38 @@
+package cpu
+
+import (
+	"fmt"
+)
+
+// MemoryWatcher is told about every read of and write to memory made by an
+// instruction, other than fetching the instruction itself.
+type MemoryWatcher interface {
+	Read(addr uint16, n uint16)
+	Write(addr uint16, n uint16)
+}
+
+// AddMemoryWatcher adds a watcher that is told about memory accesses from
+// now on.
+func (c *cpu) AddMemoryWatcher(w MemoryWatcher) {
+	c.mws = append(c.mws, w)
+}
+
+func (c *cpu) read(addr uint16, n uint16) {
+	for _, w := range c.mws {
+		w.Read(addr, n)
+	}
+}
+
+func (c *cpu) written(addr uint16, n uint16) {
+	for _, w := range c.mws {
+		w.Write(addr, n)
+	}
+}
+
+// inMemory returns an error when the n bytes at addr are not all in memory.
+func (c *cpu) inMemory(addr uint16, n uint16) error {
+	if int(addr)+int(n) > len(c.m) {
+		return fmt.Errorf("%d bytes at %#03x are past the end of memory", n, addr)
+	}
+	return nil
+}
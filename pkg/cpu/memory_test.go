@@ -0,0 +1,56 @@
+package cpu
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func TestCpu_AddMemoryWatcher(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		opcode uint16
+		read   []uint16
+		write  []uint16
+	}{
+		{name: "DXYN", opcode: 0xD015, read: []uint16{0x300, 5}},
+		{name: "FX33", opcode: 0xF133, write: []uint16{0x300, 3}},
+		{name: "FX55", opcode: 0xF355, write: []uint16{0x300, 4}},
+		{name: "FX65", opcode: 0xF265, read: []uint16{0x300, 3}},
+		{name: "6XNN", opcode: 0x6A05},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			m := state.InitMemory()
+			err := m.LoadMemory(bytes.NewBuffer(opCodeToBytes(tc.opcode)))
+			assert.NoError(t, err)
+			sm := &screenMock{}
+			sm.On("Draw", mock.Anything)
+			c := getNewCPU(m, NewKeyboard(), getTimer(), sm)
+			c.ir = 0x300
+			w := &recordingWatcher{}
+			c.AddMemoryWatcher(w)
+			assert.NoError(t, c.Tick())
+			assert.Equal(t, tc.read, w.read)
+			assert.Equal(t, tc.write, w.write)
+		})
+	}
+}
+
+type recordingWatcher struct {
+	read  []uint16
+	write []uint16
+}
+
+func (r *recordingWatcher) Read(addr uint16, n uint16) {
+	r.read = append(r.read, addr, n)
+}
+
+func (r *recordingWatcher) Write(addr uint16, n uint16) {
+	r.write = append(r.write, addr, n)
+}
@@ -0,0 +1,59 @@
+package cpu
+
+import "image"
+
+// DirtyScreen is a Screen that is also told which part of a frame changed
+// since the frame before, so it can redraw only that.
+type DirtyScreen interface {
+	Screen
+	DrawDirty(frameBuffer []byte, dirty image.Rectangle)
+}
+
+// VBlank presents what was drawn since the last vblank to the screen, and
+// is to be called 60 times a second. Instructions only draw to the frame
+// buffer, so a sprite erased and drawn again between two vblanks is never
+// seen half drawn. The frame presented is a copy that is never changed, so
+// the screen can keep it, and it is only presented when it changed.
+func (c *cpu) VBlank() error {
+	frame, ok := c.fb.present(c.orFrames)
+	if !ok {
+		return nil
+	}
+	dirty := diff(c.shown, frame)
+	if c.shown != nil && dirty.Empty() {
+		return nil
+	}
+	c.shown = frame
+	if ds, ok := c.s.(DirtyScreen); ok {
+		ds.DrawDirty(frame, dirty)
+	} else {
+		c.s.Draw(frame)
+	}
+	return nil
+}
+
+// SetOrFrames sets whether VBlank presents every pixel that was on at all
+// since the last vblank, rather than only those on at the time. Sprites
+// that are erased and drawn again then don't flicker.
+func (c *cpu) SetOrFrames(or bool) {
+	c.orFrames = or
+}
+
+// diff returns the bounds of the pixels of b that differ from a, all of
+// them when a is nil.
+func diff(a, b []byte) (dirty image.Rectangle) {
+	width := 64
+	if len(b) == 128*64 {
+		width = 128
+	}
+	if len(a) != len(b) {
+		return image.Rect(0, 0, width, len(b)/width)
+	}
+	for i := range b {
+		if a[i] != b[i] {
+			x, y := i%width, i/width
+			dirty = dirty.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	return dirty
+}
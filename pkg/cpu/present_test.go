@@ -0,0 +1,127 @@
+package cpu
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"testing"
+)
+
+type dirtyScreen struct {
+	frames [][]byte
+	dirty  []image.Rectangle
+}
+
+func (s *dirtyScreen) Draw(frameBuffer []byte) {
+	panic("DrawDirty is used instead")
+}
+
+func (s *dirtyScreen) DrawDirty(frameBuffer []byte, dirty image.Rectangle) {
+	s.frames = append(s.frames, frameBuffer)
+	s.dirty = append(s.dirty, dirty)
+}
+
+// newDrawingCPU returns a CPU with a program of opcodes and I pointing at
+// a sprite of a single pixel.
+func newDrawingCPU(s Screen, opcodes ...uint16) *cpu {
+	var rom []byte
+	for _, o := range opcodes {
+		rom = append(rom, opCodeToBytes(o)...)
+	}
+	m := state.InitMemory()
+	_ = m.LoadMemory(bytes.NewReader(rom))
+	c := getNewCPU(m, NewKeyboard(), getTimer(), s)
+	c.ir = 0x300
+	m[0x300] = 0x80
+	return c
+}
+
+func TestCpu_VBlank(t *testing.T) {
+	t.Parallel()
+	s := &dirtyScreen{}
+	c := newDrawingCPU(s, 0xD011, 0xD011, 0x00E0)
+	c.v[0] = 3
+
+	assert.NoError(t, c.VBlank())
+	assert.Empty(t, s.frames, "nothing drawn yet")
+
+	assert.NoError(t, c.Tick())
+	assert.NoError(t, c.VBlank())
+	assert.Len(t, s.frames, 1)
+	assert.Equal(t, byte(1), s.frames[0][3])
+	assert.Equal(t, image.Rect(0, 0, 64, 32), s.dirty[0], "all of the first frame")
+
+	assert.NoError(t, c.VBlank())
+	assert.Len(t, s.frames, 1, "only presented when drawn to")
+
+	assert.NoError(t, c.Tick())
+	assert.Equal(t, byte(1), s.frames[0][3], "the frame presented doesn't change")
+	c.v[0] = 10
+	c.v[1] = 5
+	m := c.Memory()
+	copy(m[0x204:], opCodeToBytes(0xD011))
+	assert.NoError(t, c.Tick())
+	assert.NoError(t, c.VBlank())
+	assert.Len(t, s.frames, 2)
+	assert.Equal(t, image.Rect(3, 0, 11, 6), s.dirty[1], "what was erased and drawn")
+}
+
+func TestCpu_VBlank_unchanged(t *testing.T) {
+	t.Parallel()
+	s := &dirtyScreen{}
+	c := newDrawingCPU(s, 0xD011, 0xD011, 0xD011)
+	assert.NoError(t, c.Tick())
+	assert.NoError(t, c.VBlank())
+	assert.NoError(t, c.Tick())
+	assert.NoError(t, c.Tick())
+	assert.NoError(t, c.VBlank())
+	assert.Len(t, s.frames, 1, "erased and drawn again between vblanks")
+}
+
+func TestCpu_VBlank_orFrames(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		or     bool
+		frames []byte // First pixel of each frame presented
+	}{
+		{"last", false, []byte{0}},
+		{"or", true, []byte{1, 0}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			s := &dirtyScreen{}
+			c := newDrawingCPU(s, 0xD011, 0xD011)
+			c.SetOrFrames(tc.or)
+			assert.NoError(t, c.Tick()) // drawn
+			assert.NoError(t, c.Tick()) // and erased before the vblank
+			assert.NoError(t, c.VBlank())
+			assert.NoError(t, c.VBlank())
+			var got []byte
+			for _, f := range s.frames {
+				got = append(got, f[0])
+			}
+			assert.Equal(t, tc.frames, got)
+		})
+	}
+}
+
+func TestCpu_VBlank_screen(t *testing.T) {
+	t.Parallel()
+	s := &lastScreen{}
+	c := newDrawingCPU(s, 0xD011)
+	assert.NoError(t, c.Tick())
+	assert.NoError(t, c.VBlank())
+	assert.Equal(t, byte(1), s.fb[0], "a plain Screen is drawn to")
+}
+
+type lastScreen struct {
+	fb []byte
+}
+
+func (s *lastScreen) Draw(frameBuffer []byte) {
+	s.fb = frameBuffer
+}
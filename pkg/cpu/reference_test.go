@@ -0,0 +1,260 @@
+package cpu
+
+import (
+	"math/rand"
+)
+
+// reference is a CHIP-8 interpreter written to be obviously right rather
+// than fast, for the cpu to be checked against. Every part of the machine
+// is a plain field, every pixel a bool, and an instruction is split into
+// its nibbles before a switch picks what to do with them.
+//
+// It has the quirks the cpu has chosen: 8XY6 and 8XYE shift VX and ignore
+// VY, FX55 and FX65 leave I as it was, FX1E sets VF when I goes past 0xFFF,
+// and sprites are clipped at the edges of the screen unless wrap is set.
+// The stack holds the addresses of the calls, as Step reports them, and a
+// return carries on after the call.
+type reference struct {
+	mem    [4096]byte
+	v      [16]byte
+	i      uint16
+	pc     uint16
+	stack  []uint16
+	dt, st byte
+	screen [32][64]bool
+	cycle  uint64
+	key    byte // The key held down, none when it is not 0x0 to 0xF
+	wrap   bool
+	r      *rand.Rand
+}
+
+// opcode returns the instruction at the program counter.
+func (r *reference) opcode() uint16 {
+	return uint16(r.mem[r.pc])<<8 | uint16(r.mem[r.pc+1])
+}
+
+// valid reports whether the instruction at the program counter can be
+// executed without reading or writing past the end of memory, over or
+// underflowing the stack, or waiting for a key.
+func (r *reference) valid() bool {
+	if int(r.pc)+1 >= len(r.mem) {
+		return false
+	}
+	op := r.opcode()
+	x, n := int(op>>8&0xF), int(op&0xF)
+	i := int(r.i)
+	switch {
+	case op == 0x00EE:
+		return len(r.stack) > 0
+	case op>>12 == 0x2:
+		return len(r.stack) < 16
+	case op>>12 == 0xD:
+		return i+n <= len(r.mem)
+	case op&0xF0FF == 0xF00A:
+		return false
+	case op&0xF0FF == 0xF033:
+		return i+3 <= len(r.mem)
+	case op&0xF0FF == 0xF055, op&0xF0FF == 0xF065:
+		return i+x+1 <= len(r.mem)
+	}
+	return true
+}
+
+// waiting reports whether the instruction at the program counter waits
+// for a key.
+func (r *reference) waiting() bool {
+	return int(r.pc)+1 < len(r.mem) && r.opcode()&0xF0FF == 0xF00A
+}
+
+// step executes the instruction at the program counter, returning whether
+// it was 00FD, which leaves the program counter where it is.
+func (r *reference) step() (exited bool) {
+	op := r.opcode()
+	kind := op >> 12
+	x := op >> 8 & 0xF
+	y := op >> 4 & 0xF
+	n := op & 0xF
+	nn := byte(op)
+	nnn := op & 0xFFF
+	r.cycle++
+
+	next := r.pc + 2
+	skip := r.pc + 4
+	switch {
+	case op == 0x00E0:
+		r.screen = [32][64]bool{}
+		r.pc = next
+	case op == 0x00FD:
+		return true
+	case op == 0x00EE:
+		call := r.stack[len(r.stack)-1]
+		r.stack = r.stack[:len(r.stack)-1]
+		r.pc = call + 2
+	case kind == 0x1:
+		r.pc = nnn
+	case kind == 0x2:
+		r.stack = append(r.stack, r.pc)
+		r.pc = nnn
+	case kind == 0x3:
+		r.pc = next
+		if r.v[x] == nn {
+			r.pc = skip
+		}
+	case kind == 0x4:
+		r.pc = next
+		if r.v[x] != nn {
+			r.pc = skip
+		}
+	case kind == 0x5:
+		r.pc = next
+		if r.v[x] == r.v[y] {
+			r.pc = skip
+		}
+	case kind == 0x6:
+		r.v[x] = nn
+		r.pc = next
+	case kind == 0x7:
+		r.v[x] += nn
+		r.pc = next
+	case kind == 0x8:
+		r.arithmetic(x, y, n)
+		r.pc = next
+	case kind == 0x9:
+		r.pc = next
+		if r.v[x] != r.v[y] {
+			r.pc = skip
+		}
+	case kind == 0xA:
+		r.i = nnn
+		r.pc = next
+	case kind == 0xB:
+		r.pc = uint16(r.v[0]) + nnn
+	case kind == 0xC:
+		r.v[x] = byte(r.r.Intn(256)) & nn
+		r.pc = next
+	case kind == 0xD:
+		r.draw(int(r.v[x]), int(r.v[y]), int(n))
+		r.pc = next
+	case kind == 0xE && nn == 0x9E:
+		r.pc = next
+		if r.key == r.v[x] {
+			r.pc = skip
+		}
+	case kind == 0xE && nn == 0xA1:
+		r.pc = next
+		if r.key != r.v[x] {
+			r.pc = skip
+		}
+	case kind == 0xF:
+		r.misc(x, nn)
+		r.pc = next
+	default:
+		// Anything else does nothing
+		r.pc = next
+	}
+	return false
+}
+
+// arithmetic executes 8XYN. Flags are set after the result, so VF holds
+// the flag when it is also VX.
+func (r *reference) arithmetic(x, y, n uint16) {
+	vx, vy := int(r.v[x]), int(r.v[y])
+	switch n {
+	case 0x0:
+		r.v[x] = byte(vy)
+	case 0x1:
+		r.v[x] = byte(vx | vy)
+	case 0x2:
+		r.v[x] = byte(vx & vy)
+	case 0x3:
+		r.v[x] = byte(vx ^ vy)
+	case 0x4:
+		r.v[x] = byte(vx + vy)
+		r.v[0xF] = flag(vx+vy > 255)
+	case 0x5:
+		r.v[x] = byte(vx - vy)
+		r.v[0xF] = flag(vx >= vy)
+	case 0x6:
+		r.v[x] = byte(vx / 2)
+		r.v[0xF] = byte(vx % 2)
+	case 0x7:
+		r.v[x] = byte(vy - vx)
+		r.v[0xF] = flag(vy >= vx)
+	case 0xE:
+		r.v[x] = byte(vx * 2)
+		r.v[0xF] = flag(vx >= 128)
+	}
+}
+
+// misc executes FXNN.
+func (r *reference) misc(x uint16, nn byte) {
+	switch nn {
+	case 0x07:
+		r.v[x] = r.dt
+	case 0x15:
+		r.dt = r.v[x]
+	case 0x18:
+		r.st = r.v[x]
+	case 0x1E:
+		i := int(r.i) + int(r.v[x])
+		r.i = uint16(i)
+		r.v[0xF] = flag(i > 0xFFF)
+	case 0x29:
+		// Only the low nibble names a character of the font
+		r.i = uint16(r.v[x]%16) * 5
+	case 0x33:
+		r.mem[r.i] = r.v[x] / 100
+		r.mem[r.i+1] = r.v[x] / 10 % 10
+		r.mem[r.i+2] = r.v[x] % 10
+	case 0x55:
+		for j := uint16(0); j <= x; j++ {
+			r.mem[r.i+j] = r.v[j]
+		}
+	case 0x65:
+		for j := uint16(0); j <= x; j++ {
+			r.v[j] = r.mem[r.i+j]
+		}
+	}
+}
+
+// draw XORs the n rows of the sprite at I onto the screen a pixel at a
+// time, starting at x, y wrapped onto the screen.
+func (r *reference) draw(x, y, n int) {
+	r.v[0xF] = 0
+	for row := 0; row < n; row++ {
+		sprite := r.mem[int(r.i)+row]
+		for col := 0; col < 8; col++ {
+			if sprite&(0x80>>uint(col)) == 0 {
+				continue
+			}
+			px, py := x%64+col, y%32+row
+			if px >= 64 || py >= 32 {
+				if !r.wrap {
+					continue
+				}
+				px, py = px%64, py%32
+			}
+			if r.screen[py][px] {
+				r.v[0xF] = 1
+			}
+			r.screen[py][px] = !r.screen[py][px]
+		}
+	}
+}
+
+// tick counts the timers down once.
+func (r *reference) tick() {
+	if r.dt > 0 {
+		r.dt--
+	}
+	if r.st > 0 {
+		r.st--
+	}
+}
+
+func flag(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
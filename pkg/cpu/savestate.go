@@ -0,0 +1,165 @@
+package cpu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"io"
+)
+
+const (
+	// stateMagic starts a save state, followed by its version.
+	stateMagic   = "CHIP8ST"
+	stateVersion = 1
+)
+
+// savedState is the fixed size part of a save state. It is followed by the
+// frame buffer, packed as the CPU keeps it, and then the memory.
+type savedState struct {
+	PC, I         uint16
+	V             [16]byte
+	SP            uint8
+	Stack         [16]uint16
+	DT, ST        byte
+	Cycle         uint64
+	Width, Height uint16
+	MemorySize    uint16
+}
+
+// Registers returns the state of the CPU about to execute the instruction
+// at the program counter.
+func (c *cpu) Registers() Step {
+	var opcode uint16
+	if pc := int(c.pc); pc >= 0 && pc+1 < len(c.m) {
+		opcode = binary.BigEndian.Uint16(c.m[pc:])
+	}
+	return c.step(opcode)
+}
+
+// Reset puts the registers, stack, timers and program counter back the way
+// they start, leaving the memory and the screen as they are. A key taken
+// for FX0A before is dropped.
+func (c *cpu) Reset() {
+	for i := range c.v {
+		c.v[i] = 0
+	}
+	c.ir = 0
+	c.pc = 0x200
+	c.stack = state.InitStack()
+	c.t.SetDelay(0)
+	c.t.SetSound(0)
+	c.key, c.pressed = 0, false
+}
+
+// Load puts the CPU back the way it starts, with rom loaded into memory
+// that is otherwise blank and a blank screen. Nothing changes if rom does
+// not fit.
+func (c *cpu) Load(rom []byte) error {
+	if n := len(c.m) - 0x200; len(rom) > n {
+		return fmt.Errorf("rom of %d bytes does not fit in the %d bytes of memory from 0x200", len(rom), n)
+	}
+	m := make(state.Memory, len(c.m))
+	if err := m.LoadMemory(bytes.NewReader(rom)); err != nil {
+		return err
+	}
+	copy(c.m, m)
+	c.Reset()
+	c.fb.clear()
+	c.shown = nil
+	return nil
+}
+
+// SaveState writes everything LoadState needs to carry on from where the
+// CPU is now: the registers, stack, timers, screen and memory.
+func (c *cpu) SaveState(w io.Writer) error {
+	s := savedState{
+		PC:         uint16(c.pc),
+		I:          c.ir,
+		DT:         c.t.GetDelay(),
+		ST:         c.t.GetSound(),
+		Cycle:      c.cycle,
+		Width:      uint16(c.fb.width),
+		Height:     uint16(c.fb.height),
+		MemorySize: uint16(len(c.m)),
+	}
+	copy(s.V[:], c.v)
+	for i, a := range c.stack.Values() {
+		s.Stack[i] = uint16(a)
+		s.SP++
+	}
+	if _, err := io.WriteString(w, stateMagic); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{stateVersion}); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, s); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, c.fb.words()); err != nil {
+		return err
+	}
+	_, err := w.Write(c.m)
+	return err
+}
+
+// LoadState carries on from a state written by SaveState. Nothing changes
+// unless all of it can be read and fits this CPU.
+func (c *cpu) LoadState(r io.Reader) error {
+	head := make([]byte, len(stateMagic)+1)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return fmt.Errorf("not a save state: %v", err)
+	}
+	if string(head[:len(stateMagic)]) != stateMagic {
+		return fmt.Errorf("not a save state")
+	}
+	if v := head[len(stateMagic)]; v != stateVersion {
+		return fmt.Errorf("save state version %d is not supported", v)
+	}
+	var s savedState
+	if err := binary.Read(r, binary.BigEndian, &s); err != nil {
+		return fmt.Errorf("could not read save state: %v", err)
+	}
+	if int(s.Width) != c.fb.width || int(s.Height) != c.fb.height {
+		return fmt.Errorf("save state of a %dx%d screen, the screen is %dx%d", s.Width, s.Height, c.fb.width, c.fb.height)
+	}
+	if int(s.MemorySize) != len(c.m) {
+		return fmt.Errorf("save state of %d bytes of memory, the memory is %d bytes", s.MemorySize, len(c.m))
+	}
+	if s.SP > uint8(len(s.Stack)) {
+		return fmt.Errorf("save state has %d return addresses, the stack holds %d", s.SP, len(s.Stack))
+	}
+	for _, a := range append(s.Stack[:s.SP:s.SP], s.PC) {
+		if int(a) >= len(c.m) {
+			return fmt.Errorf("save state has address %#03x outside of memory", a)
+		}
+	}
+	words := make([]uint64, len(c.fb.rows))
+	if err := binary.Read(r, binary.BigEndian, words); err != nil {
+		return fmt.Errorf("could not read screen of save state: %v", err)
+	}
+	m := make([]byte, len(c.m))
+	if _, err := io.ReadFull(r, m); err != nil {
+		return fmt.Errorf("could not read memory of save state: %v", err)
+	}
+	stack := state.InitStack()
+	for _, a := range s.Stack[:s.SP] {
+		if err := stack.Push(int16(a)); err != nil {
+			return fmt.Errorf("could not restore stack of save state: %v", err)
+		}
+	}
+
+	copy(c.m, m)
+	copy(c.v, s.V[:])
+	c.pc = int16(s.PC)
+	c.ir = s.I
+	c.stack = stack
+	c.key, c.pressed = 0, false
+	c.t.SetDelay(s.DT)
+	c.t.SetSound(s.ST)
+	c.cycle = s.Cycle
+	c.fb.load(words)
+	c.shown = nil
+	return nil
+}
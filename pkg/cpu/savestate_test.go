@@ -0,0 +1,161 @@
+package cpu
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// savedCPU returns a CPU that has run a little of a program.
+func savedCPU(t *testing.T) *cpu {
+	m := state.InitMemory()
+	// Call 0x20A, which sets V3, I and the delay timer and draws a sprite
+	copy(m[0x200:], []byte{0x22, 0x0A})
+	copy(m[0x20A:], []byte{0x63, 0x2A, 0xA2, 0x20, 0xF3, 0x15, 0xD3, 0x31})
+	m[0x220] = 0xF0
+	c := getNewCPU(m, NewKeyboard(), getTimer(), &screenMock{})
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, c.Tick())
+	}
+	return c
+}
+
+func TestCpu_Registers(t *testing.T) {
+	t.Parallel()
+	c := savedCPU(t)
+	assert.Equal(t, Step{
+		Cycle:  5,
+		PC:     0x212,
+		Opcode: 0x0000,
+		V:      [16]byte{0x3: 0x2A},
+		I:      0x220,
+		SP:     1,
+		Stack:  []uint16{0x200},
+		DT:     0x2A,
+	}, c.Registers())
+}
+
+func TestCpu_Reset(t *testing.T) {
+	t.Parallel()
+	c := savedCPU(t)
+	fb := c.FrameBuffer()
+	c.Reset()
+	r := c.Registers()
+	assert.Equal(t, uint16(0x200), r.PC)
+	assert.Equal(t, uint16(0x220A), r.Opcode, "memory is kept")
+	assert.Equal(t, [16]byte{}, r.V)
+	assert.Equal(t, uint16(0), r.I)
+	assert.Equal(t, int8(0), r.SP)
+	assert.Equal(t, byte(0), r.DT)
+	assert.Equal(t, fb, c.FrameBuffer(), "the screen is kept")
+}
+
+func TestCpu_Reset_dropsKey(t *testing.T) {
+	t.Parallel()
+	m := state.InitMemory()
+	copy(m[0x200:], []byte{0xF1, 0x0A}) // Wait for a key into V1
+	k := NewKeyboard()
+	c := getNewCPU(m, k, getTimer(), &screenMock{})
+	k.KeyPressed(0x5)
+	assert.False(t, c.Waiting(), "the key is taken for FX0A")
+	c.Reset()
+	assert.True(t, c.Waiting(), "the key is dropped")
+	assert.NoError(t, c.Tick())
+	assert.Equal(t, uint16(0x200), c.Registers().PC, "still waiting")
+	assert.Equal(t, byte(0), c.Registers().V[1])
+}
+
+func TestCpu_SaveState(t *testing.T) {
+	t.Parallel()
+	c := savedCPU(t)
+	var b bytes.Buffer
+	assert.NoError(t, c.SaveState(&b))
+	assert.Equal(t, "CHIP8ST\x01", b.String()[:8])
+
+	o := getNewCPU(state.InitMemory(), NewKeyboard(), getTimer(), &screenMock{})
+	o.shown = make([]byte, 64*32)
+	assert.NoError(t, o.LoadState(bytes.NewReader(b.Bytes())))
+	assert.Equal(t, c.Registers(), o.Registers())
+	assert.Equal(t, c.m, o.m)
+	assert.Equal(t, c.FrameBuffer(), o.FrameBuffer())
+	assert.Nil(t, o.shown, "the screen is presented again")
+
+	assert.NoError(t, o.Tick())
+	assert.NoError(t, c.Tick())
+	assert.Equal(t, c.Registers(), o.Registers(), "carries on the same")
+}
+
+func TestCpu_LoadState_fullStack(t *testing.T) {
+	t.Parallel()
+	c := getNewCPU(state.InitMemory(), NewKeyboard(), getTimer(), &screenMock{})
+	for i := 0; i < 16; i++ {
+		assert.NoError(t, c.stack.Push(int16(0x200+2*i)))
+	}
+	var b bytes.Buffer
+	assert.NoError(t, c.SaveState(&b))
+
+	o := getNewCPU(state.InitMemory(), NewKeyboard(), getTimer(), &screenMock{})
+	assert.NoError(t, o.LoadState(bytes.NewReader(b.Bytes())))
+	assert.Equal(t, c.Registers(), o.Registers())
+	assert.Equal(t, int8(16), o.Registers().SP)
+}
+
+func TestCpu_LoadState_errors(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	assert.NoError(t, savedCPU(t).SaveState(&b))
+	saved := b.Bytes()
+	change := func(i int, v ...byte) []byte {
+		s := append([]byte(nil), saved...)
+		copy(s[i:], v)
+		return s
+	}
+	// Offsets of the fields after the magic and version
+	const sp, stack, width, size = 8 + 20, 8 + 21, 8 + 63, 8 + 67
+	testCases := []struct {
+		name  string
+		state []byte
+		err   string
+	}{
+		{"empty", nil, "not a save state: EOF"},
+		{"not a save state", []byte("CHIP8XX\x01"), "not a save state"},
+		{"version", change(7, 2), "save state version 2 is not supported"},
+		{"short", saved[:20], "could not read save state: unexpected EOF"},
+		{"screen", change(width, 0, 128), "save state of a 128x32 screen, the screen is 64x32"},
+		{"memory", change(size, 0x20, 0x00), "save state of 8192 bytes of memory, the memory is 4096 bytes"},
+		{"stack", change(sp, 17), "save state has 17 return addresses, the stack holds 16"},
+		{"stack address", change(stack, 0x10, 0x00), "save state has address 0x1000 outside of memory"},
+		{"program counter", change(8, 0xFF, 0xFF), "save state has address 0xffff outside of memory"},
+		{"no screen", saved[:8+69+8], "could not read screen of save state: unexpected EOF"},
+		{"no memory", saved[:len(saved)-1], "could not read memory of save state: unexpected EOF"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := getNewCPU(state.InitMemory(), NewKeyboard(), getTimer(), &screenMock{})
+			before := c.Registers()
+			assert.EqualError(t, c.LoadState(bytes.NewReader(tc.state)), tc.err)
+			assert.Equal(t, before, c.Registers(), "nothing changed")
+		})
+	}
+}
+
+func TestCpu_Load(t *testing.T) {
+	t.Parallel()
+	c := savedCPU(t)
+	c.shown = make([]byte, 64*32)
+	assert.NoError(t, c.Load([]byte{0x60, 0x07}))
+	r := c.Registers()
+	assert.Equal(t, uint16(0x200), r.PC)
+	assert.Equal(t, uint16(0x6007), r.Opcode)
+	assert.Equal(t, byte(0), r.DT)
+	assert.Equal(t, state.Memory{0xF0, 0x90}, c.m[:2], "the fonts are loaded")
+	assert.Equal(t, byte(0), c.m[0x20A], "the rest of memory is blank")
+	assert.Equal(t, make([]byte, 64*32), c.FrameBuffer())
+	assert.Nil(t, c.shown, "the screen is presented again")
+
+	assert.EqualError(t, c.Load(make([]byte, 3585)), "rom of 3585 bytes does not fit in the 3584 bytes of memory from 0x200")
+	assert.Equal(t, uint16(0x6007), c.Registers().Opcode, "nothing changed")
+}
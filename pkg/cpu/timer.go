@@ -47,7 +47,8 @@ func (t *timer) GetSound() (val byte) {
 	return t.sound
 }
 
-func (t *timer) tick() (err error) {
+// Tick counts the timers down once, as happens 60 times a second.
+func (t *timer) Tick() (err error) {
 	log.Debug("tick")
 	t.lock.Lock()
 	defer t.lock.Unlock()
@@ -62,7 +63,7 @@ func (t *timer) tick() (err error) {
 }
 
 func (t *timer) Start(ctx context.Context, duration time.Duration) {
-	Start("timer", ctx, duration, t.tick)
+	Start("timer", ctx, duration, t.Tick)
 }
 
 func Start(name string, ctx context.Context, d time.Duration, tick func() error) {
@@ -31,7 +31,9 @@ func TestTimer_SetSound(t *testing.T) {
 
 func TestTimer_Start(t *testing.T) {
 	t.Parallel()
-	ti, sc := setupTimer()
+	// Room for the tick that can race the reader stopping, so it can't block
+	sc := make(chan byte, 1)
+	ti := NewTimer(sc)
 	ti.SetSound(0x0d) // 13
 	ti.SetDelay(0x33) // 51
 	ctx, cancel := context.WithCancel(context.Background())
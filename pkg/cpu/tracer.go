@@ -0,0 +1,49 @@
+package cpu
+
+// Step is the state of the CPU just before it executes an instruction.
+type Step struct {
+	Cycle  uint64   `json:"cycle"`  // Number of instructions executed before this one
+	PC     uint16   `json:"pc"`     // Program counter
+	Opcode uint16   `json:"opcode"` // Instruction about to be executed
+	V      [16]byte `json:"v"`      // Registers
+	I      uint16   `json:"i"`      // Index register
+	SP     int8     `json:"sp"`     // Number of return addresses on the stack
+	Stack  []uint16 `json:"stack"`  // Addresses of the calls on the stack, the outermost first
+	DT     byte     `json:"dt"`     // Delay timer
+	ST     byte     `json:"st"`     // Sound timer
+}
+
+// Tracer is told about every instruction executed by Tick.
+type Tracer interface {
+	Trace(s Step)
+}
+
+// AddTracer adds a tracer that is told about every instruction from now on.
+func (c *cpu) AddTracer(t Tracer) {
+	c.trs = append(c.trs, t)
+}
+
+func (c *cpu) trace(opcode uint16) {
+	s := c.step(opcode)
+	for _, t := range c.trs {
+		t.Trace(s)
+	}
+}
+
+// step returns the state of the CPU about to execute opcode.
+func (c *cpu) step(opcode uint16) Step {
+	s := Step{
+		Cycle:  c.cycle,
+		PC:     uint16(c.pc),
+		Opcode: opcode,
+		I:      c.ir,
+		SP:     c.stack.Len(),
+		DT:     c.t.GetDelay(),
+		ST:     c.t.GetSound(),
+	}
+	copy(s.V[:], c.v)
+	for _, a := range c.stack.Values() {
+		s.Stack = append(s.Stack, uint16(a))
+	}
+	return s
+}
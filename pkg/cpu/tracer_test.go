@@ -0,0 +1,39 @@
+package cpu
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCpu_AddTracer(t *testing.T) {
+	t.Parallel()
+	bs := append(opCodeToBytes(0x6A05), opCodeToBytes(0x2300)...)
+	m := state.InitMemory()
+	err := m.LoadMemory(bytes.NewBuffer(bs))
+	assert.NoError(t, err)
+	addToMemory(m, 0xA123, 0x300)
+	ti := getTimer()
+	ti.SetDelay(0x3)
+	ti.SetSound(0x4)
+	c := getNewCPU(m, NewKeyboard(), ti, &screenMock{})
+	tr := &recordingTracer{}
+	c.AddTracer(tr)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, c.Tick())
+	}
+	assert.Len(t, tr.steps, 3)
+	assert.Equal(t, Step{Cycle: 0, PC: 0x200, Opcode: 0x6A05, DT: 0x3, ST: 0x4}, tr.steps[0])
+	exp := Step{Cycle: 2, PC: 0x300, Opcode: 0xA123, SP: 1, Stack: []uint16{0x202}, DT: 0x3, ST: 0x4}
+	exp.V[0xA] = 0x05
+	assert.Equal(t, exp, tr.steps[2])
+}
+
+type recordingTracer struct {
+	steps []Step
+}
+
+func (r *recordingTracer) Trace(s Step) {
+	r.steps = append(r.steps, s)
+}
@@ -0,0 +1,378 @@
+package disasm
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Kind identifies a CHIP-8 instruction.
+type Kind int
+
+const (
+	Invalid   Kind = iota // Not a CHIP-8 instruction, most likely data
+	Clear                 // 00E0
+	Return                // 00EE
+	Jump                  // 1NNN
+	Call                  // 2NNN
+	SkipEqNN              // 3XNN
+	SkipNeNN              // 4XNN
+	SkipEqY               // 5XY0
+	LoadNN                // 6XNN
+	AddNN                 // 7XNN
+	Move                  // 8XY0
+	Or                    // 8XY1
+	And                   // 8XY2
+	Xor                   // 8XY3
+	Add                   // 8XY4
+	Sub                   // 8XY5
+	Shr                   // 8XY6
+	SubN                  // 8XY7
+	Shl                   // 8XYE
+	SkipNeY               // 9XY0
+	LoadI                 // ANNN
+	Jump0                 // BNNN
+	Random                // CXNN
+	Draw                  // DXYN
+	SkipKey               // EX9E
+	SkipNoKey             // EXA1
+	GetDelay              // FX07
+	WaitKey               // FX0A
+	SetDelay              // FX15
+	SetSound              // FX18
+	AddI                  // FX1E
+	Font                  // FX29
+	BCD                   // FX33
+	Save                  // FX55
+	Load                  // FX65
+)
+
+// Instruction is a decoded opcode.
+type Instruction struct {
+	Opcode uint16
+	Kind   Kind
+	X      byte   // Register X, the second nibble
+	Y      byte   // Register Y, the third nibble
+	N      byte   // The lowest nibble
+	NN     byte   // The lowest byte
+	NNN    uint16 // The lowest 12 bits, usually an address
+}
+
+// Decode decodes a single opcode. Opcodes that do not match an instruction
+// exactly, such as 0NNN machine code calls or 5XY1, decode as Invalid.
+func Decode(opcode uint16) Instruction {
+	i := Instruction{
+		Opcode: opcode,
+		X:      byte((opcode & 0x0F00) >> 8),
+		Y:      byte((opcode & 0x00F0) >> 4),
+		N:      byte(opcode & 0x000F),
+		NN:     byte(opcode & 0x00FF),
+		NNN:    opcode & 0x0FFF,
+	}
+	switch opcode & 0xF000 {
+	case 0x0000:
+		switch opcode {
+		case 0x00E0:
+			i.Kind = Clear
+		case 0x00EE:
+			i.Kind = Return
+		}
+	case 0x1000:
+		i.Kind = Jump
+	case 0x2000:
+		i.Kind = Call
+	case 0x3000:
+		i.Kind = SkipEqNN
+	case 0x4000:
+		i.Kind = SkipNeNN
+	case 0x5000:
+		if i.N == 0x0 {
+			i.Kind = SkipEqY
+		}
+	case 0x6000:
+		i.Kind = LoadNN
+	case 0x7000:
+		i.Kind = AddNN
+	case 0x8000:
+		switch i.N {
+		case 0x0:
+			i.Kind = Move
+		case 0x1:
+			i.Kind = Or
+		case 0x2:
+			i.Kind = And
+		case 0x3:
+			i.Kind = Xor
+		case 0x4:
+			i.Kind = Add
+		case 0x5:
+			i.Kind = Sub
+		case 0x6:
+			i.Kind = Shr
+		case 0x7:
+			i.Kind = SubN
+		case 0xE:
+			i.Kind = Shl
+		}
+	case 0x9000:
+		if i.N == 0x0 {
+			i.Kind = SkipNeY
+		}
+	case 0xA000:
+		i.Kind = LoadI
+	case 0xB000:
+		i.Kind = Jump0
+	case 0xC000:
+		i.Kind = Random
+	case 0xD000:
+		i.Kind = Draw
+	case 0xE000:
+		switch i.NN {
+		case 0x9E:
+			i.Kind = SkipKey
+		case 0xA1:
+			i.Kind = SkipNoKey
+		}
+	case 0xF000:
+		switch i.NN {
+		case 0x07:
+			i.Kind = GetDelay
+		case 0x0A:
+			i.Kind = WaitKey
+		case 0x15:
+			i.Kind = SetDelay
+		case 0x18:
+			i.Kind = SetSound
+		case 0x1E:
+			i.Kind = AddI
+		case 0x29:
+			i.Kind = Font
+		case 0x33:
+			i.Kind = BCD
+		case 0x55:
+			i.Kind = Save
+		case 0x65:
+			i.Kind = Load
+		}
+	}
+	return i
+}
+
+// DecodeAt decodes the opcode stored big endian at m[addr].
+func DecodeAt(m []byte, addr int) Instruction {
+	return Decode(binary.BigEndian.Uint16(m[addr : addr+2]))
+}
+
+// IsSkip reports whether the instruction conditionally skips the next one.
+func (i Instruction) IsSkip() bool {
+	switch i.Kind {
+	case SkipEqNN, SkipNeNN, SkipEqY, SkipNeY, SkipKey, SkipNoKey:
+		return true
+	}
+	return false
+}
+
+// HasAddress reports whether NNN is an address rather than an operand.
+func (i Instruction) HasAddress() bool {
+	switch i.Kind {
+	case Jump, Call, LoadI, Jump0:
+		return true
+	}
+	return false
+}
+
+// String returns the instruction in Octo syntax with numeric addresses.
+func (i Instruction) String() string {
+	return i.Format(nil)
+}
+
+// Format returns the instruction in Octo syntax. When name is not nil it is
+// asked for a label for the address of jumps, calls and `i :=`; the numeric
+// address is used when it returns false.
+func (i Instruction) Format(name func(addr uint16) (string, bool)) string {
+	addr := fmt.Sprintf("0x%03X", i.NNN)
+	named := false
+	if name != nil && i.HasAddress() {
+		if n, ok := name(i.NNN); ok {
+			addr, named = n, true
+		}
+	}
+	vx := fmt.Sprintf("v%x", i.X)
+	vy := fmt.Sprintf("v%x", i.Y)
+	nn := fmt.Sprintf("0x%02X", i.NN)
+	switch i.Kind {
+	case Clear:
+		return "clear"
+	case Return:
+		return "return"
+	case Jump:
+		return "jump " + addr
+	case Call:
+		if named {
+			return addr
+		}
+		return ":call " + addr
+	case SkipEqNN:
+		return "if " + vx + " != " + nn + " then"
+	case SkipNeNN:
+		return "if " + vx + " == " + nn + " then"
+	case SkipEqY:
+		return "if " + vx + " != " + vy + " then"
+	case LoadNN:
+		return vx + " := " + nn
+	case AddNN:
+		return vx + " += " + nn
+	case Move:
+		return vx + " := " + vy
+	case Or:
+		return vx + " |= " + vy
+	case And:
+		return vx + " &= " + vy
+	case Xor:
+		return vx + " ^= " + vy
+	case Add:
+		return vx + " += " + vy
+	case Sub:
+		return vx + " -= " + vy
+	case Shr:
+		return vx + " >>= " + vy
+	case SubN:
+		return vx + " =- " + vy
+	case Shl:
+		return vx + " <<= " + vy
+	case SkipNeY:
+		return "if " + vx + " == " + vy + " then"
+	case LoadI:
+		return "i := " + addr
+	case Jump0:
+		return "jump0 " + addr
+	case Random:
+		return vx + " := random " + nn
+	case Draw:
+		return fmt.Sprintf("sprite %s %s %d", vx, vy, i.N)
+	case SkipKey:
+		return "if " + vx + " -key then"
+	case SkipNoKey:
+		return "if " + vx + " key then"
+	case GetDelay:
+		return vx + " := delay"
+	case WaitKey:
+		return vx + " := key"
+	case SetDelay:
+		return "delay := " + vx
+	case SetSound:
+		return "buzzer := " + vx
+	case AddI:
+		return "i += " + vx
+	case Font:
+		return "i := hex " + vx
+	case BCD:
+		return "bcd " + vx
+	case Save:
+		return "save " + vx
+	case Load:
+		return "load " + vx
+	}
+	return fmt.Sprintf("0x%02X 0x%02X", byte(i.Opcode>>8), byte(i.Opcode))
+}
+
+// Line is a single line of a linear disassembly listing.
+type Line struct {
+	Addr  uint16
+	Bytes []byte
+	Inst  Instruction
+}
+
+// Disassemble decodes rom linearly, two bytes at a time, as if loaded at
+// origin. A trailing odd byte is returned as an Invalid line.
+func Disassemble(rom []byte, origin uint16) []Line {
+	lines := make([]Line, 0, (len(rom)+1)/2)
+	for a := 0; a < len(rom); a += 2 {
+		l := Line{Addr: origin + uint16(a)}
+		if a+1 < len(rom) {
+			l.Bytes = rom[a : a+2]
+			l.Inst = DecodeAt(rom, a)
+		} else {
+			l.Bytes = rom[a : a+1]
+			l.Inst = Instruction{Opcode: uint16(rom[a]) << 8}
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// String formats the line as `0x200: 00E0  clear`.
+func (l Line) String() string {
+	return l.Format(nil)
+}
+
+// Format formats the line like String, using name for addresses as
+// Instruction.Format does. A line whose own address has a name ends with it
+// as a comment: `0x2A4: 00E0  clear  # draw_player`.
+func (l Line) Format(name func(addr uint16) (string, bool)) string {
+	var s string
+	if len(l.Bytes) == 1 {
+		s = fmt.Sprintf("0x%03X: %02X    0x%02X", l.Addr, l.Bytes[0], l.Bytes[0])
+	} else {
+		s = fmt.Sprintf("0x%03X: %04X  %s", l.Addr, l.Inst.Opcode, l.Inst.Format(name))
+	}
+	if name != nil {
+		if n, ok := name(l.Addr); ok {
+			s += "  # " + n
+		}
+	}
+	return s
+}
+
+// Flow is what following the control flow of a program found.
+type Flow struct {
+	Code  map[uint16]bool // Reachable instructions
+	Calls map[uint16]bool // Call targets
+	Jumps map[uint16]bool // Jump targets
+	Data  map[uint16]bool // Targets of `i :=` and `jump0`
+}
+
+// Trace follows every path through rom, loaded at origin, starting from
+// origin. Invalid opcodes end a path since they are almost always data, as
+// does `jump0` since its target is only known at run time.
+func Trace(rom []byte, origin uint16) *Flow {
+	f := &Flow{
+		Code:  make(map[uint16]bool),
+		Calls: map[uint16]bool{origin: true},
+		Jumps: make(map[uint16]bool),
+		Data:  make(map[uint16]bool),
+	}
+	end := int(origin) + len(rom)
+	work := []uint16{origin}
+	for len(work) > 0 {
+		a := work[len(work)-1]
+		work = work[:len(work)-1]
+		if f.Code[a] || a < origin || int(a)+1 >= end {
+			continue
+		}
+		i := DecodeAt(rom, int(a-origin))
+		if i.Kind == Invalid {
+			continue
+		}
+		f.Code[a] = true
+		next := []uint16{a + 2}
+		switch {
+		case i.Kind == Return:
+			next = nil
+		case i.Kind == Jump:
+			f.Jumps[i.NNN] = true
+			next = []uint16{i.NNN}
+		case i.Kind == Jump0:
+			f.Data[i.NNN] = true
+			next = nil
+		case i.Kind == Call:
+			f.Calls[i.NNN] = true
+			next = append(next, i.NNN)
+		case i.Kind == LoadI:
+			f.Data[i.NNN] = true
+		case i.IsSkip():
+			next = append(next, a+4)
+		}
+		work = append(work, next...)
+	}
+	return f
+}
@@ -0,0 +1,112 @@
+package disasm
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		opcode uint16
+		kind   Kind
+		exp    string
+	}{
+		{opcode: 0x00E0, kind: Clear, exp: "clear"},
+		{opcode: 0x00EE, kind: Return, exp: "return"},
+		{opcode: 0x01E0, kind: Invalid, exp: "0x01 0xE0"},
+		{opcode: 0x12A4, kind: Jump, exp: "jump 0x2A4"},
+		{opcode: 0x22A4, kind: Call, exp: ":call 0x2A4"},
+		{opcode: 0x3A05, kind: SkipEqNN, exp: "if va != 0x05 then"},
+		{opcode: 0x4A05, kind: SkipNeNN, exp: "if va == 0x05 then"},
+		{opcode: 0x5AB0, kind: SkipEqY, exp: "if va != vb then"},
+		{opcode: 0x5AB1, kind: Invalid, exp: "0x5A 0xB1"},
+		{opcode: 0x6AFF, kind: LoadNN, exp: "va := 0xFF"},
+		{opcode: 0x7A01, kind: AddNN, exp: "va += 0x01"},
+		{opcode: 0x8AB0, kind: Move, exp: "va := vb"},
+		{opcode: 0x8AB1, kind: Or, exp: "va |= vb"},
+		{opcode: 0x8AB2, kind: And, exp: "va &= vb"},
+		{opcode: 0x8AB3, kind: Xor, exp: "va ^= vb"},
+		{opcode: 0x8AB4, kind: Add, exp: "va += vb"},
+		{opcode: 0x8AB5, kind: Sub, exp: "va -= vb"},
+		{opcode: 0x8AB6, kind: Shr, exp: "va >>= vb"},
+		{opcode: 0x8AB7, kind: SubN, exp: "va =- vb"},
+		{opcode: 0x8ABE, kind: Shl, exp: "va <<= vb"},
+		{opcode: 0x8AB8, kind: Invalid, exp: "0x8A 0xB8"},
+		{opcode: 0x9AB0, kind: SkipNeY, exp: "if va == vb then"},
+		{opcode: 0xA2F0, kind: LoadI, exp: "i := 0x2F0"},
+		{opcode: 0xB2F0, kind: Jump0, exp: "jump0 0x2F0"},
+		{opcode: 0xCAF0, kind: Random, exp: "va := random 0xF0"},
+		{opcode: 0xD01F, kind: Draw, exp: "sprite v0 v1 15"},
+		{opcode: 0xE19E, kind: SkipKey, exp: "if v1 -key then"},
+		{opcode: 0xE1A1, kind: SkipNoKey, exp: "if v1 key then"},
+		{opcode: 0xF107, kind: GetDelay, exp: "v1 := delay"},
+		{opcode: 0xF10A, kind: WaitKey, exp: "v1 := key"},
+		{opcode: 0xF115, kind: SetDelay, exp: "delay := v1"},
+		{opcode: 0xF118, kind: SetSound, exp: "buzzer := v1"},
+		{opcode: 0xF11E, kind: AddI, exp: "i += v1"},
+		{opcode: 0xF129, kind: Font, exp: "i := hex v1"},
+		{opcode: 0xF133, kind: BCD, exp: "bcd v1"},
+		{opcode: 0xF155, kind: Save, exp: "save v1"},
+		{opcode: 0xF165, kind: Load, exp: "load v1"},
+		{opcode: 0xF1FF, kind: Invalid, exp: "0xF1 0xFF"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%04X", tc.opcode), func(t *testing.T) {
+			i := Decode(tc.opcode)
+			assert.Equal(t, tc.kind, i.Kind)
+			assert.Equal(t, tc.exp, i.String())
+		})
+	}
+}
+
+func TestInstruction_Format(t *testing.T) {
+	t.Parallel()
+	name := func(addr uint16) (string, bool) {
+		if addr == 0x2A4 {
+			return "draw_player", true
+		}
+		return "", false
+	}
+	assert.Equal(t, "draw_player", Decode(0x22A4).Format(name))
+	assert.Equal(t, ":call 0x2A6", Decode(0x22A6).Format(name))
+	assert.Equal(t, "jump draw_player", Decode(0x12A4).Format(name))
+	assert.Equal(t, "i := draw_player", Decode(0xA2A4).Format(name))
+	assert.Equal(t, "v2 := 0xA4", Decode(0x62A4).Format(name))
+}
+
+func TestDisassemble(t *testing.T) {
+	t.Parallel()
+	lines := Disassemble([]byte{0x00, 0xE0, 0x12, 0x00, 0xFF}, 0x200)
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "0x200: 00E0  clear", lines[0].String())
+	assert.Equal(t, "0x202: 1200  jump 0x200", lines[1].String())
+	assert.Equal(t, "0x204: FF    0xFF", lines[2].String())
+
+	name := func(addr uint16) (string, bool) {
+		return map[uint16]string{0x200: "main", 0x204: "data"}[addr], addr == 0x200 || addr == 0x204
+	}
+	assert.Equal(t, "0x200: 00E0  clear  # main", lines[0].Format(name))
+	assert.Equal(t, "0x202: 1200  jump main", lines[1].Format(name))
+	assert.Equal(t, "0x204: FF    0xFF  # data", lines[2].Format(name))
+}
+
+func TestTrace(t *testing.T) {
+	t.Parallel()
+	rom := []byte{
+		0x22, 0x08, // 0x200: call 0x208
+		0x12, 0x02, // 0x202: jump 0x202
+		0xFF, 0xFF, // 0x204: data
+		0xB2, 0x04, // 0x206: jump0 0x204, never reached
+		0xA2, 0x04, // 0x208: i := 0x204
+		0x30, 0x01, // 0x20A: if v0 != 0x01 then
+		0x00, 0xEE, // 0x20C: return
+		0x00, 0xEE, // 0x20E: return
+	}
+	f := Trace(rom, 0x200)
+	assert.Equal(t, map[uint16]bool{0x200: true, 0x202: true, 0x208: true, 0x20A: true, 0x20C: true, 0x20E: true}, f.Code)
+	assert.Equal(t, map[uint16]bool{0x200: true, 0x208: true}, f.Calls)
+	assert.Equal(t, map[uint16]bool{0x202: true}, f.Jumps)
+	assert.Equal(t, map[uint16]bool{0x204: true}, f.Data)
+}
@@ -0,0 +1,32 @@
+//go:build go1.18
+// +build go1.18
+
+package disasm
+
+import (
+	"testing"
+)
+
+// FuzzDisassemble disassembles and traces whatever it is given, loaded
+// anywhere, which should never panic.
+func FuzzDisassemble(f *testing.F) {
+	f.Add([]byte{0x00, 0xE0, 0xA2, 0x2A, 0x60, 0x0C, 0xD0, 0x1F, 0x12, 0x00}, uint16(0x200))
+	f.Add([]byte{0x22, 0x04, 0x00, 0xEE, 0x00}, uint16(0x200))
+	f.Fuzz(func(t *testing.T, rom []byte, origin uint16) {
+		lines := Disassemble(rom, origin)
+		if len(lines) != (len(rom)+1)/2 {
+			t.Fatalf("%d lines for %d bytes", len(lines), len(rom))
+		}
+		for _, l := range lines {
+			_ = l.Format(func(addr uint16) (string, bool) {
+				return "label", addr%2 == 0
+			})
+		}
+		flow := Trace(rom, origin)
+		for a := range flow.Code {
+			if int(a) < int(origin) || int(a)+1 >= int(origin)+len(rom) {
+				t.Fatalf("traced code at %#03x outside of the rom", a)
+			}
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package display
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Palette is the colour of pixels that are off and on, those in between
+// being a blend of the two.
+type Palette struct {
+	Off, On color.RGBA
+}
+
+// DefaultPalette is white on black.
+var DefaultPalette = Palette{
+	Off: color.RGBA{A: 0xFF},
+	On:  color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+}
+
+// Presets are palettes that can be chosen by name. Those named after a
+// colour vision deficiency keep the two colours apart in both hue and
+// brightness for those who have it: yellow on navy for protanopia, as reds
+// look dark without red cones, orange on indigo for deuteranopia, which
+// keeps reds bright, and pink on teal for tritanopia, which confuses blue
+// with green and yellow with violet.
+var Presets = map[string]Palette{
+	"white":        DefaultPalette,
+	"green":        {Off: rgb(0x0A1A0A), On: rgb(0x33FF66)},
+	"amber":        {Off: rgb(0x1A0F00), On: rgb(0xFFB000)},
+	"lcd":          {Off: rgb(0x9BBC0F), On: rgb(0x0F380F)},
+	"inverse":      {Off: rgb(0xFFFFFF), On: rgb(0x000000)},
+	"protanopia":   {Off: rgb(0x002B5C), On: rgb(0xF0E442)},
+	"deuteranopia": {Off: rgb(0x1A1033), On: rgb(0xE69F00)},
+	"tritanopia":   {Off: rgb(0x0B2E2E), On: rgb(0xFF8C94)},
+}
+
+func rgb(v uint32) color.RGBA {
+	return color.RGBA{R: byte(v >> 16), G: byte(v >> 8), B: byte(v), A: 0xFF}
+}
+
+// ParsePalette reads the name of one of the Presets, or a palette of the on
+// and the off colour in hex, such as `ffffff,000000`, with or without a
+// leading #.
+func ParsePalette(s string) (p Palette, err error) {
+	if p, ok := Presets[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return p, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return p, fmt.Errorf("palette '%s' must be two colours, on and off, or one of %s", s, strings.Join(PresetNames(), ", "))
+	}
+	cs := make([]color.RGBA, 2)
+	for i, part := range parts {
+		h := strings.TrimPrefix(strings.TrimSpace(part), "#")
+		v, err := strconv.ParseUint(h, 16, 32)
+		if len(h) != 6 || err != nil {
+			return p, fmt.Errorf("invalid colour '%s' in palette '%s'", part, s)
+		}
+		cs[i] = rgb(uint32(v))
+	}
+	return Palette{On: cs[0], Off: cs[1]}, nil
+}
+
+// PresetNames returns the names of the Presets in order.
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for n := range Presets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Color returns the colour of a pixel level bright, see Level.
+func (p Palette) Color(level byte) color.RGBA {
+	mix := func(off, on uint8) uint8 {
+		return uint8((int(off)*(255-int(level)) + int(on)*int(level) + 127) / 255)
+	}
+	return color.RGBA{R: mix(p.Off.R, p.On.R), G: mix(p.Off.G, p.On.G), B: mix(p.Off.B, p.On.B), A: 0xFF}
+}
+
+// Shades returns n colours from off to on, for images with a palette.
+func (p Palette) Shades(n int) color.Palette {
+	shades := make(color.Palette, n)
+	for i := range shades {
+		shades[i] = p.Color(byte(i * 255 / (n - 1)))
+	}
+	return shades
+}
+
+// Shade returns which of n Shades is closest to a pixel level bright.
+func Shade(level byte, n int) int {
+	return (int(level)*(n-1) + 127) / 255
+}
+
+// Level returns how bright a pixel of a frame is, from 0 for off to 255 for
+// on. The CPU draws pixels that are on as 1, a Pipeline blends them into
+// levels in between but never 1, so that is on too.
+func Level(pixel byte) byte {
+	if pixel == 1 {
+		return 255
+	}
+	return pixel
+}
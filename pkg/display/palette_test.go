@@ -0,0 +1,95 @@
+package display
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"testing"
+)
+
+var testPalette = Palette{
+	Off: color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xFF},
+	On:  color.RGBA{R: 0xFF, G: 0xB0, B: 0x00, A: 0xFF},
+}
+
+func TestParsePalette(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		s   string
+		exp Palette
+		err string
+	}{
+		{"ffffff,000000", DefaultPalette, ""},
+		{"#FFB000, #102030", testPalette, ""},
+		{"amber", Presets["amber"], ""},
+		{" Deuteranopia ", Presets["deuteranopia"], ""},
+		{"ffffff", Palette{}, "palette 'ffffff' must be two colours, on and off, or one of amber, deuteranopia, green, inverse, lcd, protanopia, tritanopia, white"},
+		{"fff,000", Palette{}, "invalid colour 'fff' in palette 'fff,000'"},
+		{"ffffff,00000g", Palette{}, "invalid colour '00000g' in palette 'ffffff,00000g'"},
+	}
+	for _, tc := range testCases {
+		p, err := ParsePalette(tc.s)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.exp, p)
+	}
+}
+
+// luma is how bright a colour looks, from 0 to 255.
+func luma(c color.RGBA) int {
+	return (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+}
+
+func TestPresets(t *testing.T) {
+	t.Parallel()
+	names := make(map[Palette]string)
+	for name, p := range Presets {
+		if other, ok := names[p]; ok {
+			t.Errorf("%s is the same palette as %s", name, other)
+		}
+		names[p] = name
+		d := luma(p.On) - luma(p.Off)
+		if d < 0 {
+			d = -d
+		}
+		assert.True(t, d >= 100, "%s has on and off far enough apart in brightness, %d", name, d)
+		assert.Equal(t, uint8(0xFF), p.On.A, name)
+		assert.Equal(t, uint8(0xFF), p.Off.A, name)
+	}
+}
+
+func TestPalette_Color(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, testPalette.Off, testPalette.Color(0))
+	assert.Equal(t, testPalette.On, testPalette.Color(255))
+	assert.Equal(t, color.RGBA{R: 0x88, G: 0x68, B: 0x18, A: 0xFF}, testPalette.Color(128))
+}
+
+func TestPalette_Shades(t *testing.T) {
+	t.Parallel()
+	shades := testPalette.Shades(4)
+	assert.Len(t, shades, 4)
+	assert.Equal(t, testPalette.Off, shades[0])
+	assert.Equal(t, testPalette.Color(85), shades[1])
+	assert.Equal(t, testPalette.On, shades[3])
+}
+
+func TestShade(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 0, Shade(0, 16))
+	assert.Equal(t, 0, Shade(8, 16))
+	assert.Equal(t, 1, Shade(9, 16))
+	assert.Equal(t, 8, Shade(128, 16))
+	assert.Equal(t, 15, Shade(255, 16))
+	assert.Equal(t, 1, Shade(255, 2))
+}
+
+func TestLevel(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, byte(0), Level(0))
+	assert.Equal(t, byte(255), Level(1), "as the CPU draws it")
+	assert.Equal(t, byte(128), Level(128))
+	assert.Equal(t, byte(255), Level(255))
+}
@@ -0,0 +1,130 @@
+package display
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"image"
+	"sync"
+)
+
+// minLevel is the dimmest a pixel is shown, those dimmer are off.
+const minLevel = 8
+
+// Options configure how a Pipeline processes frames.
+type Options struct {
+	Decay float64 // Share of its brightness a pixel keeps each frame once off, from 0 to less than 1
+	Blend int     // Number of frames to average, 0 or 1 to show only the last
+}
+
+// Enabled reports whether the options do anything.
+func (o Options) Enabled() bool {
+	return o.Decay > 0 || o.Blend > 1
+}
+
+// Pipeline is a Screen that sits between the CPU and another screen. Games
+// flicker as sprites are moved by erasing and drawing them again; the
+// pipeline passes a frame on 60 times a second, when Tick is called, with
+// the frames before blended in or fading out like the phosphor of a CRT.
+// The frames passed on are of levels, see Level.
+type Pipeline struct {
+	lock    sync.Mutex
+	next    cpu.Screen
+	o       Options
+	fb      []byte    // Last frame drawn
+	history [][]byte  // Last frames, for blending
+	n       int       // Number of frames in history
+	levels  []float64 // Brightness shown
+	out     []byte
+	passed  bool // Whether a frame of this size was passed on
+}
+
+func NewPipeline(next cpu.Screen, o Options) *Pipeline {
+	if o.Blend < 1 {
+		o.Blend = 1
+	}
+	if o.Decay < 0 || o.Decay >= 1 {
+		o.Decay = 0
+	}
+	return &Pipeline{next: next, o: o}
+}
+
+func (p *Pipeline) Draw(frameBuffer []byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.fb) != len(frameBuffer) {
+		p.reset(len(frameBuffer))
+	}
+	copy(p.fb, frameBuffer)
+}
+
+// DrawDirty draws a frame. Pixels keep changing as they fade out, so what
+// changed is worked out again when frames are passed on.
+func (p *Pipeline) DrawDirty(frameBuffer []byte, dirty image.Rectangle) {
+	p.Draw(frameBuffer)
+}
+
+// reset starts again with frames of n pixels, as after the resolution
+// changes.
+func (p *Pipeline) reset(n int) {
+	p.fb, p.levels, p.out = make([]byte, n), make([]float64, n), make([]byte, n)
+	p.history = make([][]byte, p.o.Blend)
+	for i := range p.history {
+		p.history[i] = make([]byte, n)
+	}
+	p.n = 0
+	p.passed = false
+}
+
+// Tick passes the next frame on, nothing until a frame has been drawn. A
+// screen that can redraw only what changed is told what did, and nothing
+// when no pixel did.
+func (p *Pipeline) Tick() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.fb == nil {
+		return nil
+	}
+	copy(p.history[p.n%len(p.history)], p.fb)
+	p.n++
+	frames := p.n
+	if frames > len(p.history) {
+		frames = len(p.history)
+	}
+	width := 64
+	if len(p.out) == 128*64 {
+		width = 128
+	}
+	var dirty image.Rectangle
+	for i := range p.out {
+		on := 0
+		for _, h := range p.history[:frames] {
+			if h[i] != 0 {
+				on++
+			}
+		}
+		l := float64(255*on) / float64(frames)
+		if d := p.levels[i] * p.o.Decay; d > l {
+			l = d
+		}
+		p.levels[i] = l
+		out := byte(l + 0.5)
+		if out < minLevel {
+			out = 0
+		}
+		if out != p.out[i] {
+			x, y := i%width, i/width
+			dirty = dirty.Union(image.Rect(x, y, x+1, y+1))
+		}
+		p.out[i] = out
+	}
+	ds, ok := p.next.(cpu.DirtyScreen)
+	switch {
+	case !ok:
+		p.next.Draw(p.out)
+	case !p.passed:
+		ds.DrawDirty(p.out, image.Rect(0, 0, width, len(p.out)/width))
+	case !dirty.Empty():
+		ds.DrawDirty(p.out, dirty)
+	}
+	p.passed = true
+	return nil
+}
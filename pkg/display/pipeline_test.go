@@ -0,0 +1,123 @@
+package display
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"testing"
+)
+
+type frames struct {
+	got [][]byte
+}
+
+func (s *frames) Draw(frameBuffer []byte) {
+	s.got = append(s.got, append([]byte(nil), frameBuffer...))
+}
+
+// pixel returns a frame with only its first pixel set to px.
+func pixel(px byte) []byte {
+	fb := make([]byte, 64*32)
+	fb[0] = px
+	return fb
+}
+
+// firstPixels returns the first pixel of each frame drawn.
+func (s *frames) firstPixels() []byte {
+	var px []byte
+	for _, f := range s.got {
+		px = append(px, f[0])
+	}
+	return px
+}
+
+func TestOptions_Enabled(t *testing.T) {
+	t.Parallel()
+	assert.False(t, Options{}.Enabled())
+	assert.False(t, Options{Blend: 1}.Enabled())
+	assert.True(t, Options{Blend: 2}.Enabled())
+	assert.True(t, Options{Decay: 0.5}.Enabled())
+}
+
+func TestPipeline(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name  string
+		o     Options
+		draws [][]byte // Drawn before each tick
+		exp   []byte
+	}{
+		{"only ticks", Options{}, [][]byte{{1, 0, 1}, {}, {0}}, []byte{255, 255, 0}},
+		{"last frame", Options{}, [][]byte{{1, 0}, {0, 1}}, []byte{0, 255}},
+		{"blend", Options{Blend: 2}, [][]byte{{1}, {0}, {0}, {1}, {1}}, []byte{255, 128, 0, 128, 255}},
+		{"decay", Options{Decay: 0.5}, [][]byte{{1}, {0}, {}, {}, {}, {}, {}, {1}}, []byte{255, 128, 64, 32, 16, 8, 0, 255}},
+		{"invalid decay", Options{Decay: 1}, [][]byte{{1}, {0}}, []byte{255, 0}},
+		{"blend and decay", Options{Blend: 2, Decay: 0.75}, [][]byte{{1}, {0}, {}, {}}, []byte{255, 191, 143, 108}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			s := &frames{}
+			p := NewPipeline(s, tc.o)
+			assert.NoError(t, p.Tick())
+			assert.Empty(t, s.got, "nothing until a frame is drawn")
+			for _, draws := range tc.draws {
+				for _, px := range draws {
+					p.Draw(pixel(px))
+				}
+				assert.NoError(t, p.Tick())
+			}
+			assert.Equal(t, tc.exp, s.firstPixels())
+		})
+	}
+}
+
+func TestPipeline_resolution(t *testing.T) {
+	t.Parallel()
+	s := &frames{}
+	p := NewPipeline(s, Options{Decay: 0.5})
+	p.Draw(pixel(1))
+	assert.NoError(t, p.Tick())
+	hires := make([]byte, 128*64)
+	p.Draw(hires)
+	assert.NoError(t, p.Tick())
+	assert.Len(t, s.got[1], 128*64)
+	assert.Equal(t, byte(0), s.got[1][0], "starts again")
+}
+
+// dirtyFrames is a screen that is told what changed.
+type dirtyFrames struct {
+	dirty []image.Rectangle
+}
+
+func (s *dirtyFrames) Draw(frameBuffer []byte) {
+	panic("DrawDirty is used instead")
+}
+
+func (s *dirtyFrames) DrawDirty(frameBuffer []byte, dirty image.Rectangle) {
+	s.dirty = append(s.dirty, dirty)
+}
+
+func TestPipeline_DrawDirty(t *testing.T) {
+	t.Parallel()
+	s := &dirtyFrames{}
+	p := NewPipeline(s, Options{Decay: 0.5})
+	p.DrawDirty(pixel(0), image.Rect(0, 0, 64, 32))
+	assert.NoError(t, p.Tick())
+	p.DrawDirty(pixel(1), image.Rect(0, 0, 1, 1))
+	assert.NoError(t, p.Tick())
+	p.Draw(pixel(0))
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, p.Tick())
+	}
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(0, 0, 64, 32), // The whole first frame
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 1, 1), // Fading out to 128, 64, 32, 16 and 8
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 1, 1), // Off, then nothing changes
+	}, s.dirty)
+}
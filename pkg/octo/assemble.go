@@ -0,0 +1,444 @@
+package octo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Origin is the address programs are assembled for.
+const Origin = 0x200
+
+// Program is the result of assembling Octo source.
+type Program struct {
+	ROM    []byte
+	Labels map[string]uint16
+}
+
+// Assemble assembles the subset of Octo emitted by Decompile: labels, calls,
+// `loop ... again`, `if ... then`, every CHIP-8 instruction and raw bytes.
+func Assemble(src string) (p *Program, err error) {
+	a := &assembler{
+		tokens: tokenize(src),
+		labels: make(map[string]uint16),
+	}
+	if err = a.assemble(); err != nil {
+		return nil, err
+	}
+	return &Program{ROM: a.rom, Labels: a.labels}, nil
+}
+
+type token struct {
+	text string
+	line int
+}
+
+func tokenize(src string) (tokens []token) {
+	for n, l := range strings.Split(src, "\n") {
+		if i := strings.Index(l, "#"); i >= 0 {
+			l = l[:i]
+		}
+		for _, f := range strings.Fields(l) {
+			tokens = append(tokens, token{text: f, line: n + 1})
+		}
+	}
+	return tokens
+}
+
+type fixup struct {
+	at   int
+	name token
+}
+
+type assembler struct {
+	tokens []token
+	pos    int
+	rom    []byte
+	labels map[string]uint16
+	fixups []fixup
+	loops  []uint16
+}
+
+func (a *assembler) pc() uint16 {
+	return uint16(Origin + len(a.rom))
+}
+
+func (a *assembler) next() (t token, err error) {
+	if a.pos >= len(a.tokens) {
+		line := 0
+		if len(a.tokens) > 0 {
+			line = a.tokens[len(a.tokens)-1].line
+		}
+		return t, fmt.Errorf("line %d: unexpected end of source", line)
+	}
+	t = a.tokens[a.pos]
+	a.pos++
+	return t, err
+}
+
+func (a *assembler) expect(text string) error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+	if t.text != text {
+		return fmt.Errorf("line %d: expected '%s', got '%s'", t.line, text, t.text)
+	}
+	return nil
+}
+
+func (a *assembler) peek() string {
+	if a.pos >= len(a.tokens) {
+		return ""
+	}
+	return a.tokens[a.pos].text
+}
+
+func (a *assembler) emit(opcode uint16) {
+	a.rom = append(a.rom, byte(opcode>>8), byte(opcode))
+}
+
+func (a *assembler) assemble() (err error) {
+	for a.pos < len(a.tokens) {
+		if err = a.statement(); err != nil {
+			return err
+		}
+	}
+	if len(a.loops) > 0 {
+		return fmt.Errorf("'loop' at %#03x without matching 'again'", a.loops[len(a.loops)-1])
+	}
+	for _, f := range a.fixups {
+		addr, ok := a.labels[f.name.text]
+		if !ok {
+			return fmt.Errorf("line %d: undefined label '%s'", f.name.line, f.name.text)
+		}
+		a.rom[f.at] |= byte(addr>>8) & 0x0F
+		a.rom[f.at+1] = byte(addr)
+	}
+	return err
+}
+
+func (a *assembler) statement() (err error) {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+	switch t.text {
+	case ":":
+		n, err := a.next()
+		if err != nil {
+			return err
+		}
+		if _, ok := a.labels[n.text]; ok {
+			return fmt.Errorf("line %d: label '%s' already defined", n.line, n.text)
+		}
+		a.labels[n.text] = a.pc()
+	case ":call":
+		return a.address(0x2000)
+	case "loop":
+		a.loops = append(a.loops, a.pc())
+	case "again":
+		if len(a.loops) == 0 {
+			return fmt.Errorf("line %d: 'again' without 'loop'", t.line)
+		}
+		l := a.loops[len(a.loops)-1]
+		a.loops = a.loops[:len(a.loops)-1]
+		a.emit(0x1000 | l)
+	case "clear":
+		a.emit(0x00E0)
+	case "return":
+		a.emit(0x00EE)
+	case "jump":
+		return a.address(0x1000)
+	case "jump0":
+		return a.address(0xB000)
+	case "if":
+		return a.condition()
+	case "sprite":
+		x, err := a.register()
+		if err != nil {
+			return err
+		}
+		y, err := a.register()
+		if err != nil {
+			return err
+		}
+		n, err := a.number(0, 0xF)
+		if err != nil {
+			return err
+		}
+		a.emit(0xD000 | x<<8 | y<<4 | n)
+	case "i":
+		return a.index()
+	case "delay", "buzzer":
+		if err = a.expect(":="); err != nil {
+			return err
+		}
+		x, err := a.register()
+		if err != nil {
+			return err
+		}
+		op := uint16(0xF015)
+		if t.text == "buzzer" {
+			op = 0xF018
+		}
+		a.emit(op | x<<8)
+	case "bcd", "save", "load":
+		x, err := a.register()
+		if err != nil {
+			return err
+		}
+		op := map[string]uint16{"bcd": 0xF033, "save": 0xF055, "load": 0xF065}[t.text]
+		a.emit(op | x<<8)
+	default:
+		if x, ok := parseRegister(t.text); ok {
+			return a.assign(x)
+		}
+		if n, ok := parseNumber(t.text); ok {
+			if n < -128 || n > 0xFF {
+				return fmt.Errorf("line %d: byte '%s' out of range", t.line, t.text)
+			}
+			a.rom = append(a.rom, byte(n))
+			return nil
+		}
+		// Anything else is a call to a label, possibly defined later.
+		a.pos--
+		return a.address(0x2000)
+	}
+	return err
+}
+
+func (a *assembler) condition() error {
+	x, err := a.register()
+	if err != nil {
+		return err
+	}
+	op, err := a.next()
+	if err != nil {
+		return err
+	}
+	switch op.text {
+	case "key", "-key":
+		if err = a.expect("then"); err != nil {
+			return err
+		}
+		if op.text == "key" {
+			a.emit(0xE0A1 | x<<8)
+		} else {
+			a.emit(0xE09E | x<<8)
+		}
+		return nil
+	case "==", "!=":
+	default:
+		return fmt.Errorf("line %d: unknown condition '%s'", op.line, op.text)
+	}
+	rhs, err := a.next()
+	if err != nil {
+		return err
+	}
+	if err = a.expect("then"); err != nil {
+		return err
+	}
+	// The skip is the inverse of the condition so the next statement only
+	// runs when the condition holds.
+	if y, ok := parseRegister(rhs.text); ok {
+		if op.text == "==" {
+			a.emit(0x9000 | x<<8 | y<<4)
+		} else {
+			a.emit(0x5000 | x<<8 | y<<4)
+		}
+		return nil
+	}
+	nn, err := a.byteValue(rhs)
+	if err != nil {
+		return err
+	}
+	if op.text == "==" {
+		a.emit(0x4000 | x<<8 | nn)
+	} else {
+		a.emit(0x3000 | x<<8 | nn)
+	}
+	return nil
+}
+
+func (a *assembler) index() error {
+	op, err := a.next()
+	if err != nil {
+		return err
+	}
+	switch op.text {
+	case "+=":
+		x, err := a.register()
+		if err != nil {
+			return err
+		}
+		a.emit(0xF01E | x<<8)
+	case ":=":
+		if a.peek() == "hex" {
+			a.pos++
+			x, err := a.register()
+			if err != nil {
+				return err
+			}
+			a.emit(0xF029 | x<<8)
+			return nil
+		}
+		return a.address(0xA000)
+	default:
+		return fmt.Errorf("line %d: unknown operator 'i %s'", op.line, op.text)
+	}
+	return nil
+}
+
+func (a *assembler) assign(x uint16) error {
+	op, err := a.next()
+	if err != nil {
+		return err
+	}
+	rhs, err := a.next()
+	if err != nil {
+		return err
+	}
+	y, isReg := parseRegister(rhs.text)
+	switch op.text {
+	case ":=":
+		switch {
+		case isReg:
+			a.emit(0x8000 | x<<8 | y<<4)
+		case rhs.text == "delay":
+			a.emit(0xF007 | x<<8)
+		case rhs.text == "key":
+			a.emit(0xF00A | x<<8)
+		case rhs.text == "random":
+			nn, err := a.number(0, 0xFF)
+			if err != nil {
+				return err
+			}
+			a.emit(0xC000 | x<<8 | nn)
+		default:
+			nn, err := a.byteValue(rhs)
+			if err != nil {
+				return err
+			}
+			a.emit(0x6000 | x<<8 | nn)
+		}
+		return nil
+	case "+=":
+		if isReg {
+			a.emit(0x8004 | x<<8 | y<<4)
+			return nil
+		}
+		nn, err := a.byteValue(rhs)
+		if err != nil {
+			return err
+		}
+		a.emit(0x7000 | x<<8 | nn)
+		return nil
+	}
+	sub, ok := map[string]uint16{"|=": 0x1, "&=": 0x2, "^=": 0x3, "-=": 0x5, ">>=": 0x6, "=-": 0x7, "<<=": 0xE}[op.text]
+	if !ok {
+		return fmt.Errorf("line %d: unknown operator '%s'", op.line, op.text)
+	}
+	if !isReg {
+		return fmt.Errorf("line %d: expected a register, got '%s'", rhs.line, rhs.text)
+	}
+	a.emit(0x8000 | x<<8 | y<<4 | sub)
+	return nil
+}
+
+// address emits op with a 12 bit address that is either a number or a label.
+func (a *assembler) address(op uint16) error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+	if n, ok := parseNumber(t.text); ok {
+		if n < 0 || n > 0xFFF {
+			return fmt.Errorf("line %d: address '%s' out of range", t.line, t.text)
+		}
+		a.emit(op | uint16(n))
+		return nil
+	}
+	if _, ok := parseRegister(t.text); ok || !isIdentifier(t.text) {
+		return fmt.Errorf("line %d: expected an address, got '%s'", t.line, t.text)
+	}
+	a.fixups = append(a.fixups, fixup{at: len(a.rom), name: t})
+	a.emit(op)
+	return nil
+}
+
+func (a *assembler) register() (uint16, error) {
+	t, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	x, ok := parseRegister(t.text)
+	if !ok {
+		return 0, fmt.Errorf("line %d: expected a register, got '%s'", t.line, t.text)
+	}
+	return x, nil
+}
+
+func (a *assembler) number(min, max int) (uint16, error) {
+	t, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	n, ok := parseNumber(t.text)
+	if !ok || n < min || n > max {
+		return 0, fmt.Errorf("line %d: expected a number between %d and %d, got '%s'", t.line, min, max, t.text)
+	}
+	return uint16(n), nil
+}
+
+func (a *assembler) byteValue(t token) (uint16, error) {
+	n, ok := parseNumber(t.text)
+	if !ok || n < -128 || n > 0xFF {
+		return 0, fmt.Errorf("line %d: expected a byte, got '%s'", t.line, t.text)
+	}
+	return uint16(byte(n)), nil
+}
+
+func parseRegister(s string) (uint16, bool) {
+	if len(s) != 2 || (s[0] != 'v' && s[0] != 'V') {
+		return 0, false
+	}
+	x, err := strconv.ParseUint(s[1:], 16, 8)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(x), true
+}
+
+func parseNumber(s string) (int, bool) {
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		base, s = 16, s[2:]
+	case strings.HasPrefix(s, "0b"), strings.HasPrefix(s, "0B"):
+		base, s = 2, s[2:]
+	}
+	n, err := strconv.ParseInt(s, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	if neg {
+		n = -n
+	}
+	return int(n), true
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || strings.ContainsAny(s[:1], "0123456789-") {
+		return false
+	}
+	switch s {
+	case ":=", "+=", "-=", "=-", "|=", "&=", "^=", ">>=", "<<=", "==", "!=", "then", "key", "-key":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package octo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		src string
+		exp []byte
+	}{
+		{src: "clear return", exp: []byte{0x00, 0xE0, 0x00, 0xEE}},
+		{src: "jump 0x2A4 jump0 0x300 :call 0x2A4", exp: []byte{0x12, 0xA4, 0xB3, 0x00, 0x22, 0xA4}},
+		{src: "if va != 0x05 then if va == 5 then", exp: []byte{0x3A, 0x05, 0x4A, 0x05}},
+		{src: "if va != vb then if va == vb then", exp: []byte{0x5A, 0xB0, 0x9A, 0xB0}},
+		{src: "if v1 -key then if v1 key then", exp: []byte{0xE1, 0x9E, 0xE1, 0xA1}},
+		{src: "va := 0xFF va += 1 va := vb va := random 0xF0", exp: []byte{0x6A, 0xFF, 0x7A, 0x01, 0x8A, 0xB0, 0xCA, 0xF0}},
+		{src: "va |= vb va &= vb va ^= vb va += vb", exp: []byte{0x8A, 0xB1, 0x8A, 0xB2, 0x8A, 0xB3, 0x8A, 0xB4}},
+		{src: "va -= vb va >>= vb va =- vb va <<= vb", exp: []byte{0x8A, 0xB5, 0x8A, 0xB6, 0x8A, 0xB7, 0x8A, 0xBE}},
+		{src: "i := 0x2F0 sprite v0 v1 15 i += v1 i := hex v1", exp: []byte{0xA2, 0xF0, 0xD0, 0x1F, 0xF1, 0x1E, 0xF1, 0x29}},
+		{src: "v1 := delay v1 := key delay := v1 buzzer := v1", exp: []byte{0xF1, 0x07, 0xF1, 0x0A, 0xF1, 0x15, 0xF1, 0x18}},
+		{src: "bcd v1 save v1 load v1", exp: []byte{0xF1, 0x33, 0xF1, 0x55, 0xF1, 0x65}},
+		{src: "0xFF 0b1010 7 -1 # a comment\n", exp: []byte{0xFF, 0x0A, 0x07, 0xFF}},
+		{src: ": main loop v0 += 1 again", exp: []byte{0x70, 0x01, 0x12, 0x00}},
+		{src: ": main sub jump main : sub return", exp: []byte{0x22, 0x04, 0x12, 0x00, 0x00, 0xEE}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.src, func(t *testing.T) {
+			p, err := Assemble(tc.src)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.exp, p.ROM)
+		})
+	}
+}
+
+func TestAssemble_labels(t *testing.T) {
+	t.Parallel()
+	p, err := Assemble(": main clear : draw_player i := sprite 0xFF : sprite 0x3C")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint16{"main": 0x200, "draw_player": 0x202, "sprite": 0x205}, p.Labels)
+	assert.Equal(t, []byte{0x00, 0xE0, 0xA2, 0x05, 0xFF, 0x3C}, p.ROM)
+}
+
+func TestAssemble_errors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		src string
+		exp string
+	}{
+		{src: "jump", exp: "line 1: unexpected end of source"},
+		{src: "jump nowhere", exp: "line 1: undefined label 'nowhere'"},
+		{src: ": a : a", exp: "line 1: label 'a' already defined"},
+		{src: "again", exp: "line 1: 'again' without 'loop'"},
+		{src: "loop", exp: "'loop' at 0x200 without matching 'again'"},
+		{src: "\nv0 := 256", exp: "line 2: expected a byte, got '256'"},
+		{src: "v0 |= 1", exp: "line 1: expected a register, got '1'"},
+		{src: "v0 ** v1", exp: "line 1: unknown operator '**'"},
+		{src: "sprite v0 v1 16", exp: "line 1: expected a number between 0 and 15, got '16'"},
+		{src: "if v0 < v1 then", exp: "line 1: unknown condition '<'"},
+		{src: "jump 0x1000", exp: "line 1: address '0x1000' out of range"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.src, func(t *testing.T) {
+			_, err := Assemble(tc.src)
+			assert.EqualError(t, err, tc.exp)
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package octo
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/carlosroman/go-chip-8/pkg/disasm"
+)
+
+// Decompile recovers the structure of a ROM loaded at Origin and returns it
+// as Octo source. Reachable code is found by following the control flow
+// from Origin: call targets become subroutines, skips become `if ... then`,
+// backward jumps that nest become `loop ... again` and the targets of
+// `i :=` become labelled data, drawn as sprites when a `sprite` uses them.
+// Everything that is not reachable is emitted as raw bytes, so assembling
+// the result gives back the exact same ROM.
+//
+// Labels are called what names returns for their address, which may be
+// nil, as long as that is a valid Octo identifier no other label uses.
+func Decompile(rom []byte, names func(addr uint16) (string, bool)) string {
+	d := &decompiler{
+		rom:     rom,
+		end:     Origin + len(rom),
+		sprites: make(map[int]int),
+		loops:   make(map[int]int),
+		agains:  make(map[int]bool),
+		names:   make(map[int]string),
+	}
+	d.trace()
+	d.layout()
+	d.findLoops()
+	d.useNames(names)
+	return d.print()
+}
+
+type item struct {
+	addr int
+	size int
+	inst disasm.Instruction
+	code bool
+}
+
+type decompiler struct {
+	rom     []byte
+	end     int
+	code    map[int]bool // reachable instruction addresses
+	subs    map[int]bool // call targets
+	jumps   map[int]bool // jump targets
+	data    map[int]bool // `i :=` targets
+	sprites map[int]int  // `i :=` targets drawn by a sprite, and its height
+	items   []item
+	bounds  map[int]bool // addresses an item starts at, where labels can go
+	loops   map[int]int  // number of `loop`s starting at an address
+	agains  map[int]bool // jumps emitted as `again`
+	names   map[int]string
+}
+
+func (d *decompiler) inROM(addr int) bool {
+	return addr >= Origin && addr+1 < d.end
+}
+
+func (d *decompiler) decode(addr int) disasm.Instruction {
+	return disasm.DecodeAt(d.rom, addr-Origin)
+}
+
+// trace marks everything reachable from Origin, and the height of the
+// sprites drawn from the targets of `i :=`.
+func (d *decompiler) trace() {
+	f := disasm.Trace(d.rom, Origin)
+	d.code = addresses(f.Code)
+	d.subs = addresses(f.Calls)
+	d.jumps = addresses(f.Jumps)
+	d.data = addresses(f.Data)
+	for a := range d.code {
+		if i := d.decode(a); i.Kind == disasm.LoadI {
+			d.findSprite(a+2, int(i.NNN))
+		}
+	}
+}
+
+func addresses(m map[uint16]bool) map[int]bool {
+	r := make(map[int]bool, len(m))
+	for a := range m {
+		r[int(a)] = true
+	}
+	return r
+}
+
+// findSprite looks for a sprite drawn with I pointing at target before I or
+// the straight line flow starting at addr changes.
+func (d *decompiler) findSprite(addr, target int) {
+	for a := addr; d.inROM(a); a += 2 {
+		i := d.decode(a)
+		switch i.Kind {
+		case disasm.Draw:
+			if int(i.N) > d.sprites[target] {
+				d.sprites[target] = int(i.N)
+			}
+			return
+		case disasm.Invalid, disasm.Return, disasm.Jump, disasm.Jump0, disasm.Call,
+			disasm.LoadI, disasm.AddI, disasm.Font, disasm.Save, disasm.Load:
+			return
+		}
+	}
+}
+
+// layout splits the ROM into instructions and data bytes. An instruction
+// that overlaps the start of another reachable one is emitted as data so
+// both keep an address a label can be put on.
+func (d *decompiler) layout() {
+	d.bounds = make(map[int]bool)
+	for a := Origin; a < d.end; {
+		d.bounds[a] = true
+		if d.code[a] && !d.code[a+1] {
+			d.items = append(d.items, item{addr: a, size: 2, inst: d.decode(a), code: true})
+			a += 2
+			continue
+		}
+		d.items = append(d.items, item{addr: a, size: 1})
+		a++
+	}
+}
+
+// findLoops turns backward jumps into `loop ... again`. The shortest jump
+// back to an address wins, and a loop is only kept when it nests properly
+// with the others and nothing outside it jumps or calls into its body.
+func (d *decompiler) findLoops() {
+	type span struct{ from, to int }
+	var cands []span
+	for _, it := range d.items {
+		if it.code && it.inst.Kind == disasm.Jump {
+			t := int(it.inst.NNN)
+			if t <= it.addr && d.bounds[t] && d.code[t] {
+				cands = append(cands, span{from: t, to: it.addr})
+			}
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		return cands[i].to-cands[i].from < cands[j].to-cands[j].from
+	})
+	var accepted []span
+next:
+	for _, c := range cands {
+		if d.loops[c.from] > 0 {
+			continue
+		}
+		for _, it := range d.items {
+			outside := it.addr < c.from || it.addr > c.to
+			if outside && it.code && (it.inst.Kind == disasm.Jump || it.inst.Kind == disasm.Call) {
+				if t := int(it.inst.NNN); t > c.from && t <= c.to {
+					continue next
+				}
+			}
+		}
+		for _, o := range accepted {
+			disjoint := c.to < o.from || o.to < c.from
+			nested := c.from <= o.from && o.to < c.to
+			if !disjoint && !nested {
+				continue next
+			}
+		}
+		accepted = append(accepted, c)
+		d.loops[c.from]++
+		d.agains[c.to] = true
+	}
+	// A jump target still needs a label if something other than an
+	// `again` jumps to it.
+	for t := range d.jumps {
+		if d.loops[t] > 0 && !d.needsLabel(t) {
+			delete(d.jumps, t)
+		}
+	}
+}
+
+func (d *decompiler) needsLabel(t int) bool {
+	for _, it := range d.items {
+		if it.code && !d.agains[it.addr] && it.inst.HasAddress() && int(it.inst.NNN) == t {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	keywords   = map[string]bool{
+		"again": true, "bcd": true, "buzzer": true, "clear": true, "delay": true, "hex": true,
+		"i": true, "if": true, "jump": true, "jump0": true, "key": true, "load": true, "loop": true,
+		"random": true, "return": true, "save": true, "sprite": true, "then": true,
+	}
+)
+
+// useNames takes the names of labels from names, skipping those that would
+// not assemble or that clash with another label.
+func (d *decompiler) useNames(names func(addr uint16) (string, bool)) {
+	if names == nil {
+		return
+	}
+	var addrs []int
+	used := make(map[string]bool)
+	for a := range d.bounds {
+		addrs = append(addrs, a)
+		if n, ok := d.label(uint16(a)); ok {
+			used[n] = true
+		}
+	}
+	sort.Ints(addrs)
+	for _, a := range addrs {
+		n, ok := names(uint16(a))
+		if _, reg := parseRegister(n); !ok || reg || used[n] || keywords[n] || !identifier.MatchString(n) {
+			continue
+		}
+		d.names[a] = n
+		used[n] = true
+	}
+}
+
+func (d *decompiler) label(addr uint16) (string, bool) {
+	a := int(addr)
+	if !d.bounds[a] {
+		return "", false
+	}
+	if n, ok := d.names[a]; ok {
+		return n, true
+	}
+	switch {
+	case a == Origin:
+		return "main", true
+	case d.subs[a] && d.code[a]:
+		return fmt.Sprintf("sub_%03X", a), true
+	case d.jumps[a] && d.code[a]:
+		return fmt.Sprintf("label_%03X", a), true
+	case d.data[a] && !d.code[a]:
+		return fmt.Sprintf("data_%03X", a), true
+	case d.data[a] || d.subs[a] || d.jumps[a]:
+		return fmt.Sprintf("addr_%03X", a), true
+	}
+	return "", false
+}
+
+func (d *decompiler) print() string {
+	var b strings.Builder
+	depth := 0
+	indent := func() string { return strings.Repeat("  ", depth+1) }
+	inThen := false
+	for n := 0; n < len(d.items); n++ {
+		it := d.items[n]
+		name, labelled := d.label(uint16(it.addr))
+		if labelled {
+			if inThen {
+				b.WriteString("\n")
+				inThen = false
+			}
+			if d.subs[it.addr] && d.code[it.addr] && it.addr != Origin {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, ": %s\n", name)
+		}
+		for l := 0; l < d.loops[it.addr]; l++ {
+			if inThen {
+				b.WriteString("\n")
+				inThen = false
+			}
+			b.WriteString(indent() + "loop\n")
+			depth++
+		}
+		if !it.code {
+			if inThen {
+				b.WriteString("\n")
+			}
+			n = d.printData(&b, n, indent())
+			inThen = false
+			continue
+		}
+		text := it.inst.Format(d.label)
+		if d.agains[it.addr] {
+			depth--
+			text = "again"
+		}
+		if inThen {
+			b.WriteString(" " + text)
+		} else {
+			b.WriteString(indent() + text)
+		}
+		inThen = it.inst.IsSkip() && !inThen
+		if !inThen {
+			b.WriteString("\n")
+		}
+	}
+	if inThen {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// printData prints the run of data bytes starting at items[n] and returns
+// the index of its last item. Sprites are printed a row per line with the
+// pixels in a comment, anything else eight bytes per line.
+func (d *decompiler) printData(b *strings.Builder, n int, indent string) int {
+	start := d.items[n].addr
+	last := n
+	for last+1 < len(d.items) {
+		nx := d.items[last+1]
+		if nx.code || d.loops[nx.addr] > 0 {
+			break
+		}
+		if _, ok := d.label(uint16(nx.addr)); ok {
+			break
+		}
+		last++
+	}
+	bs := d.rom[start-Origin : d.items[last].addr+1-Origin]
+	if h := d.sprites[start]; h > 0 {
+		if h > len(bs) {
+			h = len(bs)
+		}
+		for _, r := range bs[:h] {
+			px := strings.NewReplacer("0", ".", "1", "#").Replace(fmt.Sprintf("%08b", r))
+			fmt.Fprintf(b, "%s0x%02X # %s\n", indent, r, px)
+		}
+		bs = bs[h:]
+	}
+	for i := 0; i < len(bs); i += 8 {
+		row := bs[i:]
+		if len(row) > 8 {
+			row = row[:8]
+		}
+		hex := make([]string, len(row))
+		for j, r := range row {
+			hex[j] = fmt.Sprintf("0x%02X", r)
+		}
+		b.WriteString(indent + strings.Join(hex, " ") + "\n")
+	}
+	return last
+}
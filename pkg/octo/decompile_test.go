@@ -0,0 +1,129 @@
+package octo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	romsPath = "../../test/roms"
+)
+
+func TestDecompile_roundTrip(t *testing.T) {
+	t.Parallel()
+	roms, err := filepath.Glob(filepath.Join(romsPath, "*.ch8"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, roms)
+	for _, r := range roms {
+		r := r
+		t.Run(filepath.Base(r), func(t *testing.T) {
+			t.Parallel()
+			rom, err := ioutil.ReadFile(r)
+			assert.NoError(t, err)
+			src := Decompile(rom, nil)
+			p, err := Assemble(src)
+			if assert.NoError(t, err, src) {
+				assert.Equal(t, rom, p.ROM, src)
+			}
+		})
+	}
+}
+
+func TestDecompile_structure(t *testing.T) {
+	t.Parallel()
+	rom := []byte{
+		0x22, 0x08, // 0x200: call sub
+		0x12, 0x02, // 0x202: jump to itself
+		0x00, 0x00, // 0x204: padding, never reached
+		0x3C, 0x3C, // 0x206: sprite
+		0xA2, 0x06, // 0x208: i := sprite
+		0x60, 0x00, // 0x20A: v0 := 0
+		0xD0, 0x02, // 0x20C: sprite v0 v0 2
+		0x70, 0x01, // 0x20E: v0 += 1
+		0x30, 0x08, // 0x210: if v0 != 8
+		0x12, 0x0C, // 0x212: jump back to the sprite
+		0x00, 0xEE, // 0x214: return
+		0xAB, // 0x216: odd trailing byte
+	}
+	exp := `: main
+  sub_208
+  loop
+  again
+  0x00 0x00
+: data_206
+  0x3C # ..####..
+  0x3C # ..####..
+
+: sub_208
+  i := data_206
+  v0 := 0x00
+  loop
+    sprite v0 v0 2
+    v0 += 0x01
+    if v0 != 0x08 then again
+  return
+  0xAB
+`
+	src := Decompile(rom, nil)
+	assert.Equal(t, exp, src)
+	p, err := Assemble(src)
+	assert.NoError(t, err)
+	assert.Equal(t, rom, p.ROM)
+}
+
+func TestDecompile_names(t *testing.T) {
+	t.Parallel()
+	rom := []byte{
+		0x22, 0x08, // 0x200: call sub
+		0x12, 0x02, // 0x202: jump to itself
+		0x22, 0x0A, // 0x204: call sub, never reached
+		0x3C, 0x3C, // 0x206: sprite
+		0xA2, 0x06, // 0x208: i := sprite
+		0xD0, 0x02, // 0x20A: sprite v0 v0 2
+		0x00, 0xEE, // 0x20C: return
+	}
+	names := map[uint16]string{
+		0x200: "start",
+		0x202: "sub_208", // clashes with the generated name of 0x208
+		0x206: "player",
+		0x208: "draw_player",
+		0x20A: "v1", // a register
+		0x20C: "2bad",
+	}
+	src := Decompile(rom, func(addr uint16) (string, bool) {
+		n, ok := names[addr]
+		return n, ok
+	})
+	assert.Equal(t, `: start
+  draw_player
+  loop
+  again
+  0x22 0x0A
+: player
+  0x3C # ..####..
+  0x3C # ..####..
+
+: draw_player
+  i := player
+  sprite v0 v0 2
+  return
+`, src)
+	p, err := Assemble(src)
+	assert.NoError(t, err)
+	assert.Equal(t, rom, p.ROM)
+}
+
+func TestDecompile_overlapping(t *testing.T) {
+	t.Parallel()
+	rom := []byte{
+		0x12, 0x03, // 0x200: jump into the middle of the next instruction
+		0x60, 0x12, // 0x202: v0 := 0x12, which at 0x203 reads as 0x1203
+		0x03,
+	}
+	src := Decompile(rom, nil)
+	p, err := Assemble(src)
+	assert.NoError(t, err)
+	assert.Equal(t, rom, p.ROM, src)
+}
@@ -0,0 +1,244 @@
+package profile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const origin = 0x200
+
+// Profile message fields, from profile.proto.
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileMapping           = 3
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profilePeriodType        = 11
+	profilePeriod            = 12
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	mappingID             = 1
+	mappingMemoryStart    = 2
+	mappingMemoryLimit    = 3
+	mappingFilename       = 5
+	mappingHasFunctions   = 7
+	mappingHasLineNumbers = 9
+
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID        = 1
+	functionName      = 2
+	functionFilename  = 4
+	functionStartLine = 5
+)
+
+// frame is where a subroutine, known by the address it starts at, is.
+type frame struct {
+	fn   uint16
+	addr uint16
+}
+
+// Profiler is a cpu.Tracer that samples where a program is, the program
+// counter and the subroutines on the stack that led to it, every so many
+// instructions. Written out it can be read by go tool pprof.
+type Profiler struct {
+	lock    sync.Mutex
+	period  uint64
+	name    func(addr uint16) (string, bool)
+	targets map[uint16]uint16 // Subroutine called from each call
+	counts  map[string]int64
+	stacks  map[string][]frame
+}
+
+// NewProfiler samples every period instructions, every instruction when
+// period is 1. Subroutines are called what name, which may be nil, returns
+// for the address they start at.
+func NewProfiler(period uint64, name func(addr uint16) (string, bool)) *Profiler {
+	if period == 0 {
+		period = 1
+	}
+	return &Profiler{
+		period:  period,
+		name:    name,
+		targets: make(map[uint16]uint16),
+		counts:  make(map[string]int64),
+		stacks:  make(map[string][]frame),
+	}
+}
+
+func (p *Profiler) Trace(s cpu.Step) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if s.Opcode&0xF000 == 0x2000 {
+		p.targets[s.PC] = s.Opcode & 0x0FFF
+	}
+	if s.Cycle%p.period != 0 {
+		return
+	}
+	// The stack holds the address of each call, the subroutine a frame is
+	// in is the one called by the frame before it.
+	fn := func(i int) uint16 {
+		if i == 0 {
+			return origin
+		}
+		return p.targets[s.Stack[i-1]]
+	}
+	st := []frame{{fn: fn(len(s.Stack)), addr: s.PC}}
+	for i := len(s.Stack) - 1; i >= 0; i-- {
+		st = append(st, frame{fn: fn(i), addr: s.Stack[i]})
+	}
+	var k strings.Builder
+	for _, f := range st {
+		fmt.Fprintf(&k, "%03X:%03X;", f.fn, f.addr)
+	}
+	key := k.String()
+	if _, ok := p.stacks[key]; !ok {
+		p.stacks[key] = st
+	}
+	p.counts[key]++
+}
+
+// Name returns what the subroutine starting at addr is called.
+func (p *Profiler) Name(addr uint16) string {
+	if p.name != nil {
+		if n, ok := p.name(addr); ok {
+			return n
+		}
+	}
+	if addr == origin {
+		return "main"
+	}
+	return fmt.Sprintf("sub_%03X", addr)
+}
+
+// Write writes the samples taken so far as a gzipped profile.proto. Each
+// subroutine is a function in file, and each address a line of it.
+func (p *Profiler) Write(w io.Writer, file string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	strs := []string{""}
+	index := map[string]int64{"": 0}
+	str := func(s string) int64 {
+		if i, ok := index[s]; ok {
+			return i
+		}
+		index[s] = int64(len(strs))
+		strs = append(strs, s)
+		return index[s]
+	}
+	var b buffer
+	for _, vt := range [][2]string{{"samples", "count"}, {"instructions", "count"}} {
+		vt := vt
+		b.message(profileSampleType, func(b *buffer) {
+			b.int64(valueTypeType, str(vt[0]))
+			b.int64(valueTypeUnit, str(vt[1]))
+		})
+	}
+
+	keys := make([]string, 0, len(p.stacks))
+	for k := range p.stacks {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	locs := make(map[frame]uint64)
+	var order []frame
+	for _, k := range keys {
+		var ids []uint64
+		for _, f := range p.stacks[k] {
+			id, ok := locs[f]
+			if !ok {
+				id = uint64(len(order) + 1)
+				locs[f] = id
+				order = append(order, f)
+			}
+			ids = append(ids, id)
+		}
+		n := p.counts[k]
+		b.message(profileSample, func(b *buffer) {
+			b.packed(sampleLocationID, ids)
+			b.packed(sampleValue, []uint64{uint64(n), uint64(n) * p.period})
+		})
+	}
+
+	var lowest, highest uint16 = 0xFFF, 0
+	for _, f := range order {
+		if f.addr < lowest {
+			lowest = f.addr
+		}
+		if f.addr > highest {
+			highest = f.addr
+		}
+	}
+	b.message(profileMapping, func(b *buffer) {
+		b.uint64(mappingID, 1)
+		b.uint64(mappingMemoryStart, uint64(lowest))
+		b.uint64(mappingMemoryLimit, uint64(highest)+2)
+		b.int64(mappingFilename, str(file))
+		b.bool(mappingHasFunctions, true)
+		b.bool(mappingHasLineNumbers, true)
+	})
+
+	fns := make(map[uint16]uint64)
+	var fnOrder []uint16
+	for _, f := range order {
+		if _, ok := fns[f.fn]; !ok {
+			fns[f.fn] = uint64(len(fnOrder) + 1)
+			fnOrder = append(fnOrder, f.fn)
+		}
+		f := f
+		b.message(profileLocation, func(b *buffer) {
+			b.uint64(locationID, locs[f])
+			b.uint64(locationMappingID, 1)
+			b.uint64(locationAddress, uint64(f.addr))
+			b.message(locationLine, func(b *buffer) {
+				b.uint64(lineFunctionID, fns[f.fn])
+				b.int64(lineLine, int64(f.addr))
+			})
+		})
+	}
+	for _, fn := range fnOrder {
+		fn := fn
+		b.message(profileFunction, func(b *buffer) {
+			b.uint64(functionID, fns[fn])
+			b.int64(functionName, str(p.Name(fn)))
+			b.int64(functionFilename, str(file))
+			b.int64(functionStartLine, int64(fn))
+		})
+	}
+
+	b.message(profilePeriodType, func(b *buffer) {
+		b.int64(valueTypeType, str("instructions"))
+		b.int64(valueTypeUnit, str("count"))
+	})
+	b.int64(profilePeriod, int64(p.period))
+	b.int64(profileDefaultSampleType, str("instructions"))
+	for _, s := range strs {
+		b.string(profileStringTable, s)
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.b); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,131 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// steps runs main at 0x200, which calls draw at 0x300, which calls a
+// subroutine without a name at 0x400.
+func steps() []cpu.Step {
+	return []cpu.Step{
+		{Cycle: 0, PC: 0x200, Opcode: 0x2300},
+		{Cycle: 1, PC: 0x300, Opcode: 0x6000, Stack: []uint16{0x200}},
+		{Cycle: 2, PC: 0x302, Opcode: 0x2400, Stack: []uint16{0x200}},
+		{Cycle: 3, PC: 0x400, Opcode: 0x00EE, Stack: []uint16{0x200, 0x302}},
+		{Cycle: 4, PC: 0x304, Opcode: 0x00EE, Stack: []uint16{0x200}},
+		{Cycle: 5, PC: 0x202, Opcode: 0x1202},
+		{Cycle: 6, PC: 0x202, Opcode: 0x1202},
+	}
+}
+
+func draw(addr uint16) (string, bool) {
+	return "draw", addr == 0x300
+}
+
+func TestProfiler_Trace(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		period uint64
+		exp    map[string]int64
+	}{
+		{"every instruction", 1, map[string]int64{
+			"200:200;":                 1,
+			"300:300;200:200;":         1,
+			"300:302;200:200;":         1,
+			"400:400;300:302;200:200;": 1,
+			"300:304;200:200;":         1,
+			"200:202;":                 2,
+		}},
+		{"every other instruction", 2, map[string]int64{
+			"200:200;":         1,
+			"300:302;200:200;": 1,
+			"300:304;200:200;": 1,
+			"200:202;":         1,
+		}},
+		{"zero is every instruction", 0, map[string]int64{
+			"200:200;":                 1,
+			"300:300;200:200;":         1,
+			"300:302;200:200;":         1,
+			"400:400;300:302;200:200;": 1,
+			"300:304;200:200;":         1,
+			"200:202;":                 2,
+		}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p := NewProfiler(tt.period, nil)
+			for _, s := range steps() {
+				p.Trace(s)
+			}
+			assert.Equal(t, tt.exp, p.counts)
+		})
+	}
+}
+
+func TestProfiler_Name(t *testing.T) {
+	t.Parallel()
+	p := NewProfiler(1, draw)
+	assert.Equal(t, "main", p.Name(0x200))
+	assert.Equal(t, "draw", p.Name(0x300))
+	assert.Equal(t, "sub_400", p.Name(0x400))
+}
+
+func TestProfiler_Write(t *testing.T) {
+	t.Parallel()
+	p := NewProfiler(1, draw)
+	for _, s := range steps() {
+		p.Trace(s)
+	}
+	var b bytes.Buffer
+	assert.NoError(t, p.Write(&b, "game.ch8"))
+	gz, err := gzip.NewReader(&b)
+	assert.NoError(t, err)
+	raw, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	for _, s := range []string{"samples", "instructions", "count", "game.ch8", "main", "draw", "sub_400"} {
+		assert.Contains(t, string(raw), s)
+	}
+}
+
+func TestProfiler_Write_pprof(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go tool pprof")
+	}
+	t.Parallel()
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+	dir, err := ioutil.TempDir("", "profile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "profile.pb.gz")
+
+	p := NewProfiler(1, draw)
+	for _, s := range steps() {
+		p.Trace(s)
+	}
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Write(f, "game.ch8"))
+	assert.NoError(t, f.Close())
+
+	out, err := exec.Command(goTool, "tool", "pprof", "-top", "-lines", path).CombinedOutput()
+	assert.NoError(t, err, string(out))
+	assert.Contains(t, string(out), "File: game.ch8\nType: instructions\n")
+	assert.Contains(t, string(out), "Showing nodes accounting for 7, 100% of 7 total")
+	assert.Regexp(t, `2 28.57% +28.57% +2 28.57% +main game.ch8:514\n`, string(out))
+	assert.Regexp(t, `1 14.29% .* +2 28.57% +draw game.ch8:770\n`, string(out))
+	assert.Regexp(t, `1 14.29% .* +1 14.29% +sub_400 game.ch8:1024\n`, string(out))
+}
@@ -0,0 +1,67 @@
+package profile
+
+// A minimal protocol buffer encoder, enough to write the messages of
+// profile.proto from github.com/google/pprof.
+
+type buffer struct {
+	b []byte
+}
+
+func (b *buffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.b = append(b.b, byte(x)|0x80)
+		x >>= 7
+	}
+	b.b = append(b.b, byte(x))
+}
+
+func (b *buffer) key(field int, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint64 writes a varint field, zero values are left out as proto3 does.
+func (b *buffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(x)
+}
+
+func (b *buffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *buffer) bool(field int, x bool) {
+	if x {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *buffer) bytes(field int, x []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(x)))
+	b.b = append(b.b, x...)
+}
+
+func (b *buffer) string(field int, x string) {
+	b.bytes(field, []byte(x))
+}
+
+// packed writes a repeated varint field in its packed encoding.
+func (b *buffer) packed(field int, xs []uint64) {
+	if len(xs) == 0 {
+		return
+	}
+	var p buffer
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.bytes(field, p.b)
+}
+
+func (b *buffer) message(field int, m func(b *buffer)) {
+	var mb buffer
+	m(&mb)
+	b.bytes(field, mb.b)
+}
@@ -0,0 +1,35 @@
+package profile
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		write func(b *buffer)
+		exp   []byte
+	}{
+		{"varint", func(b *buffer) { b.uint64(1, 150) }, []byte{0x08, 0x96, 0x01}},
+		{"zero is left out", func(b *buffer) { b.uint64(1, 0) }, nil},
+		{"true", func(b *buffer) { b.bool(7, true) }, []byte{0x38, 0x01}},
+		{"false is left out", func(b *buffer) { b.bool(7, false) }, nil},
+		{"string", func(b *buffer) { b.string(6, "ab") }, []byte{0x32, 0x02, 'a', 'b'}},
+		{"empty string", func(b *buffer) { b.string(6, "") }, []byte{0x32, 0x00}},
+		{"packed", func(b *buffer) { b.packed(2, []uint64{1, 300}) }, []byte{0x12, 0x03, 0x01, 0xAC, 0x02}},
+		{"message", func(b *buffer) {
+			b.message(1, func(b *buffer) { b.int64(2, 3) })
+		}, []byte{0x0A, 0x02, 0x10, 0x03}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var b buffer
+			tt.write(&b)
+			assert.Equal(t, tt.exp, b.b)
+		})
+	}
+}
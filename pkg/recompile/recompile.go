@@ -0,0 +1,177 @@
+package recompile
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/carlosroman/go-chip-8/pkg/disasm"
+)
+
+const origin = 0x200
+
+// Recompile translates every reachable basic block of rom into Go and
+// returns the source of a main package that runs it with Main. name is only
+// used in the header of the generated file. The program is not standalone:
+// it imports the cpu and recompile packages of this module, which a go.mod
+// next to it has to require.
+//
+// Register and index arithmetic, jumps and skips are translated to Go,
+// everything else, such as drawing, the timers and the keyboard, is handed
+// to cpu.Machine.Exec so it behaves exactly like the interpreter.
+func Recompile(rom []byte, name string) ([]byte, error) {
+	blocks := findBlocks(rom)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by chip8 recompile from %s. DO NOT EDIT.\n\n", name)
+	b.WriteString("package main\n\n")
+	b.WriteString("import (\n\t\"github.com/carlosroman/go-chip-8/pkg/cpu\"\n\t\"github.com/carlosroman/go-chip-8/pkg/recompile\"\n)\n\n")
+	b.WriteString("var rom = []byte{")
+	for i, r := range rom {
+		if i%16 == 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "0x%02X, ", r)
+	}
+	b.WriteString("\n}\n\n")
+	b.WriteString("var blocks = []recompile.Block{\n")
+	for _, bl := range blocks {
+		start := int(bl[0].addr) - origin
+		fmt.Fprintf(&b, "{Addr: 0x%03X, Code: rom[0x%03X:0x%03X], Count: %d, Run: block%03X},\n",
+			bl[0].addr, start, start+2*len(bl), len(bl), bl[0].addr)
+	}
+	b.WriteString("}\n\n")
+	b.WriteString("func main() {\n\trecompile.Main(rom, blocks)\n}\n")
+	for _, bl := range blocks {
+		writeBlock(&b, bl)
+	}
+	return format.Source(b.Bytes())
+}
+
+type instruction struct {
+	addr uint16
+	inst disasm.Instruction
+}
+
+// ends reports whether i ends a block. Besides changing the control flow a
+// write to memory ends a block so the next one is checked for having been
+// modified before it runs, and waiting for a key does as it leaves the
+// program counter where it is until one is pressed.
+func ends(i disasm.Instruction) bool {
+	switch i.Kind {
+	case disasm.Jump, disasm.Jump0, disasm.Call, disasm.Return, disasm.BCD, disasm.Save, disasm.WaitKey:
+		return true
+	}
+	return i.IsSkip()
+}
+
+// findBlocks splits the reachable code into basic blocks. A block starts at
+// the entry point, a jump or call target, a return address, either side of
+// a skip or after a key wait, and ends at the next control flow change.
+func findBlocks(rom []byte) (blocks [][]instruction) {
+	f := disasm.Trace(rom, origin)
+	leaders := map[uint16]bool{origin: true}
+	for a := range f.Code {
+		i := disasm.DecodeAt(rom, int(a)-origin)
+		switch {
+		case i.Kind == disasm.Jump:
+			leaders[i.NNN] = true
+		case i.Kind == disasm.Call:
+			leaders[i.NNN] = true
+			leaders[a+2] = true
+		case i.Kind == disasm.WaitKey:
+			leaders[a+2] = true
+		case i.IsSkip():
+			leaders[a+2] = true
+			leaders[a+4] = true
+		}
+	}
+	var starts []int
+	for a := range leaders {
+		if f.Code[a] {
+			starts = append(starts, int(a))
+		}
+	}
+	sort.Ints(starts)
+	for _, s := range starts {
+		var bl []instruction
+		for a := uint16(s); f.Code[a] && (a == uint16(s) || !leaders[a]); a += 2 {
+			i := disasm.DecodeAt(rom, int(a)-origin)
+			bl = append(bl, instruction{addr: a, inst: i})
+			if ends(i) {
+				break
+			}
+		}
+		blocks = append(blocks, bl)
+	}
+	return blocks
+}
+
+func writeBlock(b *bytes.Buffer, bl []instruction) {
+	var body strings.Builder
+	last := bl[len(bl)-1]
+	for _, in := range bl {
+		fmt.Fprintf(&body, "// 0x%03X: %s\n", in.addr, in.inst)
+		body.WriteString(translate(in.addr, in.inst))
+	}
+	if !ends(last.inst) {
+		fmt.Fprintf(&body, "c.SetPC(0x%03X)\n", last.addr+2)
+	}
+	fmt.Fprintf(b, "\nfunc block%03X(c cpu.Machine) error {\n", bl[0].addr)
+	if strings.Contains(body.String(), "v[") {
+		b.WriteString("v := c.V()\n")
+	}
+	b.WriteString(body.String())
+	b.WriteString("return nil\n}\n")
+}
+
+// translate returns the Go for a single instruction. The statements follow
+// the order of those in cpu.Exec so the flag register ends up the same when
+// VF is also an operand.
+func translate(addr uint16, i disasm.Instruction) string {
+	vx := fmt.Sprintf("v[0x%X]", i.X)
+	vy := fmt.Sprintf("v[0x%X]", i.Y)
+	skip := func(cond string) string {
+		return fmt.Sprintf("if %s {\nc.SetPC(0x%03X)\n} else {\nc.SetPC(0x%03X)\n}\n", cond, addr+4, addr+2)
+	}
+	switch i.Kind {
+	case disasm.Jump:
+		return fmt.Sprintf("c.SetPC(0x%03X)\n", i.NNN)
+	case disasm.SkipEqNN:
+		return skip(fmt.Sprintf("%s == 0x%02X", vx, i.NN))
+	case disasm.SkipNeNN:
+		return skip(fmt.Sprintf("%s != 0x%02X", vx, i.NN))
+	case disasm.SkipEqY:
+		return skip(vx + " == " + vy)
+	case disasm.SkipNeY:
+		return skip(vx + " != " + vy)
+	case disasm.LoadNN:
+		return fmt.Sprintf("%s = 0x%02X\n", vx, i.NN)
+	case disasm.AddNN:
+		return fmt.Sprintf("%s += 0x%02X\n", vx, i.NN)
+	case disasm.Move:
+		return vx + " = " + vy + "\n"
+	case disasm.Or:
+		return vx + " |= " + vy + "\n"
+	case disasm.And:
+		return vx + " &= " + vy + "\n"
+	case disasm.Xor:
+		return vx + " ^= " + vy + "\n"
+	case disasm.Add:
+		return fmt.Sprintf("{\nx, y := %s, %s\n%s = x + y\nif y > (0xFF - x) {\nv[0xF] = 1\n} else {\nv[0xF] = 0\n}\n}\n", vx, vy, vx)
+	case disasm.Sub:
+		return fmt.Sprintf("{\nx, y := %s, %s\n%s = x - y\nif y > x {\nv[0xF] = 0\n} else {\nv[0xF] = 1\n}\n}\n", vx, vy, vx)
+	case disasm.Shr:
+		return fmt.Sprintf("{\nx := %s\n%s = x >> 1\nv[0xF] = x & 0x1\n}\n", vx, vx)
+	case disasm.SubN:
+		return fmt.Sprintf("{\nx, y := %s, %s\n%s = y - x\nif x > y {\nv[0xF] = 0\n} else {\nv[0xF] = 1\n}\n}\n", vx, vy, vx)
+	case disasm.Shl:
+		return fmt.Sprintf("{\nx := %s\n%s = x << 1\nv[0xF] = x >> 7\n}\n", vx, vx)
+	case disasm.LoadI:
+		return fmt.Sprintf("c.SetI(0x%03X)\n", i.NNN)
+	case disasm.AddI:
+		return fmt.Sprintf("{\nux := uint16(%s)\nif c.I()+ux > 0xFFF {\nv[0xF] = 1\n} else {\nv[0xF] = 0\n}\nc.SetI(c.I() + ux)\n}\n", vx)
+	}
+	return fmt.Sprintf("c.SetPC(0x%03X)\nif err := c.Exec(0x%04X); err != nil {\nreturn err\n}\n", addr, i.Opcode)
+}
@@ -0,0 +1,117 @@
+package recompile
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	romsPath = "../../test/roms"
+	frames   = 120
+	ipf      = 10
+)
+
+func TestRecompile(t *testing.T) {
+	t.Parallel()
+	rom := []byte{
+		0x22, 0x06, // 0x200: :call 0x206
+		0x12, 0x02, // 0x202: jump 0x202
+		0xFF, 0xFF, // 0x204: data
+		0x8A, 0xF4, // 0x206: va += vf
+		0xF0, 0x0A, // 0x208: v0 := key
+		0x00, 0xEE, // 0x20A: return
+	}
+	src, err := Recompile(rom, "test.ch8")
+	assert.NoError(t, err)
+	s := string(src)
+	assert.True(t, strings.HasPrefix(s, "// Code generated by chip8 recompile from test.ch8. DO NOT EDIT.\n"))
+	assert.Contains(t, s, "{Addr: 0x200, Code: rom[0x000:0x002], Count: 1, Run: block200},")
+	assert.Contains(t, s, "{Addr: 0x202, Code: rom[0x002:0x004], Count: 1, Run: block202},")
+	assert.Contains(t, s, "{Addr: 0x206, Code: rom[0x006:0x00A], Count: 2, Run: block206},")
+	assert.Contains(t, s, "{Addr: 0x20A, Code: rom[0x00A:0x00C], Count: 1, Run: block20A},")
+	assert.NotContains(t, s, "block204")
+	assert.Contains(t, s, `func block206(c cpu.Machine) error {
+	v := c.V()
+	// 0x206: va += vf
+	{
+		x, y := v[0xA], v[0xF]
+		v[0xA] = x + y
+		if y > (0xFF - x) {
+			v[0xF] = 1
+		} else {
+			v[0xF] = 0
+		}
+	}
+	// 0x208: v0 := key
+	c.SetPC(0x208)
+	if err := c.Exec(0xF00A); err != nil {
+		return err
+	}
+	return nil
+}`)
+}
+
+// TestRecompile_matchesInterpreter builds the recompiled test ROMs and checks
+// their frame buffer after a number of frames is the same as the
+// interpreter's.
+func TestRecompile_matchesInterpreter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+	roms, err := filepath.Glob(filepath.Join(romsPath, "*.ch8"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, roms)
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	assert.NoError(t, err)
+	sum, err := ioutil.ReadFile(filepath.Join(root, "go.sum"))
+	assert.NoError(t, err)
+	for _, r := range roms {
+		t.Run(filepath.Base(r), func(t *testing.T) {
+			rom, err := ioutil.ReadFile(r)
+			assert.NoError(t, err)
+
+			c, tick, err := Boot(rom, 1)
+			assert.NoError(t, err)
+			runner := NewRunner(c, tick, ipf, nil)
+			for f := 0; f < frames; f++ {
+				assert.NoError(t, runner.Frame())
+			}
+			exp := Hash(c.FrameBuffer())
+			assert.NotEqual(t, Hash(make([]byte, 64*32)), exp, "screen should not be blank")
+
+			src, err := Recompile(rom, filepath.Base(r))
+			assert.NoError(t, err)
+			// The program is built in a module of its own, as it would be
+			// anywhere else, that uses this one where it is
+			dir, err := ioutil.TempDir("", "recompiled")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			mod := "module recompiled\n\nrequire github.com/carlosroman/go-chip-8 v0.0.0\n\nreplace github.com/carlosroman/go-chip-8 => " + root + "\n\ngo 1.12\n"
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod), 0644))
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644))
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), src, 0644))
+
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(goBin, "run", ".", "-frames", strconv.Itoa(frames), "-ipf", strconv.Itoa(ipf), "-seed", "1")
+			cmd.Dir = dir
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			err = cmd.Run()
+			if assert.NoError(t, err, stderr.String()) {
+				assert.Equal(t, exp, strings.TrimSpace(stdout.String()))
+				assert.NotContains(t, stderr.String(), "compiled: 0,")
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package recompile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	log "github.com/sirupsen/logrus"
+)
+
+// Block is a basic block of a ROM translated to Go.
+type Block struct {
+	Addr  uint16 // Address of the first instruction
+	Code  []byte // The bytes the block was translated from
+	Count int    // Number of instructions in the block
+	Run   func(c cpu.Machine) error
+}
+
+// Runner runs a program a frame at a time, using the recompiled blocks when
+// it can and the interpreter when it can't: for addresses that are not the
+// start of a block, such as the target of a computed jump, and for blocks
+// whose bytes in memory no longer match the code they were compiled from.
+type Runner struct {
+	c           cpu.Machine
+	tick        func() error
+	ipf         int
+	blocks      map[uint16]Block
+	Compiled    int // Instructions run by recompiled blocks
+	Interpreted int // Instructions run by the interpreter
+}
+
+func NewRunner(c cpu.Machine, tick func() error, ipf int, blocks []Block) *Runner {
+	r := &Runner{
+		c:      c,
+		tick:   tick,
+		ipf:    ipf,
+		blocks: make(map[uint16]Block, len(blocks)),
+	}
+	for _, b := range blocks {
+		r.blocks[b.Addr] = b
+	}
+	return r
+}
+
+// Frame runs exactly ipf instructions and then ticks the timers once, so a
+// recompiled program and the interpreter see the timers change at the same
+// point. A block that would overrun the frame is interpreted instead.
+func (r *Runner) Frame() (err error) {
+	m := r.c.Memory()
+	for n := 0; n < r.ipf; {
+		b, ok := r.blocks[r.c.PC()]
+		if ok && n+b.Count <= r.ipf && bytes.Equal(m[b.Addr:int(b.Addr)+len(b.Code)], b.Code) {
+			if err = b.Run(r.c); err != nil {
+				return err
+			}
+			n += b.Count
+			r.Compiled += b.Count
+			continue
+		}
+		if err = r.c.Tick(); err != nil {
+			return err
+		}
+		n++
+		r.Interpreted++
+	}
+	return r.tick()
+}
+
+// Boot loads rom into a new machine that has no screen or keyboard attached
+// and whose random numbers come from seed. The returned function ticks its
+// timers.
+func Boot(rom []byte, seed int64) (c cpu.Machine, tick func() error, err error) {
+	m := state.InitMemory()
+	if err = m.LoadMemory(bytes.NewReader(rom)); err != nil {
+		return c, tick, err
+	}
+	sc := make(chan byte, 1)
+	go func() {
+		for range sc {
+			// noop
+		}
+	}()
+	ti := cpu.NewTimer(sc)
+	c = cpu.NewCPU(m, rand.New(rand.NewSource(seed)), cpu.NewKeyboard(), ti, &noScreen{})
+	return c, ti.Tick, err
+}
+
+// Hash returns the SHA-256 of a frame buffer as hex.
+func Hash(frameBuffer []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(frameBuffer))
+}
+
+// Screen returns a frame buffer as text, one line per row.
+func Screen(frameBuffer []byte) string {
+	var b strings.Builder
+	for y := 0; y < len(frameBuffer)/64; y++ {
+		for _, px := range frameBuffer[y*64 : (y+1)*64] {
+			if px != 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Main is the entry point of a recompiled program. It runs the program for
+// a number of frames and prints the hash of the frame buffer.
+func Main(rom []byte, blocks []Block) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	frames := fs.Int("frames", 600, "Number of frames to run")
+	ipf := fs.Int("ipf", 10, "Instructions per frame")
+	seed := fs.Int64("seed", 1, "Seed for the random number generator")
+	screen := fs.Bool("screen", false, "Print the screen after the last frame")
+	_ = fs.Parse(os.Args[1:])
+
+	log.SetLevel(log.WarnLevel)
+	c, tick, err := Boot(rom, *seed)
+	if err != nil {
+		log.WithError(err).Fatal("Could not load rom")
+	}
+	r := NewRunner(c, tick, *ipf, blocks)
+	for f := 0; f < *frames; f++ {
+		if err = r.Frame(); err != nil {
+			log.WithError(err).Fatal("Program crashed")
+		}
+	}
+	fmt.Println(Hash(c.FrameBuffer()))
+	if *screen {
+		fmt.Print(Screen(c.FrameBuffer()))
+	}
+	fmt.Fprintf(os.Stderr, "compiled: %d, interpreted: %d\n", r.Compiled, r.Interpreted)
+}
+
+type noScreen struct {
+}
+
+func (s *noScreen) Draw(frameBuffer []byte) {
+
+}
@@ -0,0 +1,100 @@
+package recompile
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func init() {
+	log.SetLevel(log.WarnLevel)
+}
+
+func TestRunner_Frame(t *testing.T) {
+	t.Parallel()
+	rom := []byte{
+		0x60, 0x01, // 0x200: v0 := 0x01
+		0x61, 0x02, // 0x202: v1 := 0x02
+		0x12, 0x04, // 0x204: jump 0x204
+	}
+	c, tick, err := Boot(rom, 1)
+	assert.NoError(t, err)
+	ran := 0
+	b := Block{Addr: 0x200, Code: rom[0:4], Count: 2, Run: func(c cpu.Machine) error {
+		ran++
+		c.V()[0] = 0x01
+		c.V()[1] = 0x02
+		c.SetPC(0x204)
+		return nil
+	}}
+	r := NewRunner(c, tick, 5, []Block{b})
+	err = r.Frame()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ran)
+	assert.Equal(t, 2, r.Compiled)
+	assert.Equal(t, 3, r.Interpreted)
+	assert.Equal(t, []byte{0x01, 0x02}, c.V()[:2])
+	assert.Equal(t, uint16(0x204), c.PC())
+}
+
+func TestRunner_Frame_modifiedCode(t *testing.T) {
+	t.Parallel()
+	rom := []byte{
+		0x60, 0x01, // 0x200: v0 := 0x01
+		0x12, 0x00, // 0x202: jump 0x200
+	}
+	c, tick, err := Boot(rom, 1)
+	assert.NoError(t, err)
+	c.Memory()[0x201] = 0x07 // v0 := 0x07
+	b := Block{Addr: 0x200, Code: rom[0:2], Count: 1, Run: func(c cpu.Machine) error {
+		t.Fatal("should not run a block that has been modified")
+		return nil
+	}}
+	r := NewRunner(c, tick, 2, []Block{b})
+	err = r.Frame()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, r.Interpreted)
+	assert.Equal(t, byte(0x07), c.V()[0])
+}
+
+func TestRunner_Frame_blockOverrunsFrame(t *testing.T) {
+	t.Parallel()
+	rom := []byte{
+		0x60, 0x01, // 0x200: v0 := 0x01
+		0x61, 0x02, // 0x202: v1 := 0x02
+	}
+	c, tick, err := Boot(rom, 1)
+	assert.NoError(t, err)
+	b := Block{Addr: 0x200, Code: rom, Count: 2, Run: func(c cpu.Machine) error {
+		t.Fatal("should not run a block that does not fit in the frame")
+		return nil
+	}}
+	r := NewRunner(c, tick, 1, []Block{b})
+	err = r.Frame()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, r.Interpreted)
+	assert.Equal(t, uint16(0x202), c.PC())
+}
+
+func TestScreen(t *testing.T) {
+	t.Parallel()
+	fb := make([]byte, 64*2)
+	fb[1] = 0x1
+	fb[64+63] = 0x1
+	exp := ".#" + repeat('.', 62) + "\n" + repeat('.', 63) + "#\n"
+	assert.Equal(t, exp, Screen(fb))
+}
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", Hash(nil))
+}
+
+func repeat(b byte, n int) string {
+	bs := make([]byte, n)
+	for i := range bs {
+		bs[i] = b
+	}
+	return string(bs)
+}
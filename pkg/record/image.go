@@ -0,0 +1,53 @@
+package record
+
+import (
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"image"
+)
+
+// shades is the number of levels of brightness images have.
+const shades = 16
+
+// dimensions returns the width and height of a frame buffer of n pixels,
+// 128x64 for a high resolution one and 64 pixels wide otherwise.
+func dimensions(n int) (width, height int) {
+	if n == 128*64 {
+		return 128, 64
+	}
+	return 64, n / 64
+}
+
+// Image returns a frame buffer as an image with each pixel scale by scale
+// pixels, coloured from p by how bright it is, see display.Level.
+func Image(frameBuffer []byte, scale int, p display.Palette) *image.Paletted {
+	if scale < 1 {
+		scale = 1
+	}
+	fw, fh := dimensions(len(frameBuffer))
+	img := image.NewPaletted(image.Rect(0, 0, fw*scale, fh*scale), p.Shades(shades))
+	for y := 0; y < fh*scale; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+fw*scale]
+		for x := range row {
+			row[x] = uint8(display.Shade(display.Level(frameBuffer[(y/scale)*fw+x/scale]), shades))
+		}
+	}
+	return img
+}
+
+// Text returns a frame buffer as text, a line a row with a # for each
+// pixel that is on and a . for each that is off.
+func Text(frameBuffer []byte) []string {
+	fw, fh := dimensions(len(frameBuffer))
+	rows := make([]string, fh)
+	row := make([]byte, fw)
+	for y := range rows {
+		for x, px := range frameBuffer[y*fw : (y+1)*fw] {
+			row[x] = '.'
+			if px != 0 {
+				row[x] = '#'
+			}
+		}
+		rows[y] = string(row)
+	}
+	return rows
+}
@@ -0,0 +1,32 @@
+package record
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		width  int
+		height int
+	}{
+		{"low resolution", 64, 32},
+		{"high resolution", 128, 64},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			fb := make([]byte, tc.width*tc.height)
+			fb[1], fb[tc.width*tc.height-1] = 1, 1
+			rows := Text(fb)
+			assert.Len(t, rows, tc.height)
+			assert.Equal(t, ".#"+strings.Repeat(".", tc.width-2), rows[0])
+			assert.Equal(t, strings.Repeat(".", tc.width), rows[1])
+			assert.Equal(t, strings.Repeat(".", tc.width-1)+"#", rows[tc.height-1])
+		})
+	}
+}
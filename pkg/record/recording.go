@@ -0,0 +1,168 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+// FPS is the rate a recording is made at.
+const FPS = 60
+
+type frame struct {
+	fb []byte
+	n  int // Number of 60ths of a second it is shown for
+}
+
+// Recording is a session recorded a frame every 60th of a second. A frame
+// that is the same as the one before only makes that one last longer.
+type Recording struct {
+	scale  int
+	p      display.Palette
+	frames []frame
+}
+
+func NewRecording(scale int, p display.Palette) *Recording {
+	return &Recording{scale: scale, p: p}
+}
+
+// Add adds the frame shown for the next 60th of a second.
+func (r *Recording) Add(frameBuffer []byte) {
+	if n := len(r.frames); n > 0 && bytes.Equal(r.frames[n-1].fb, frameBuffer) {
+		r.frames[n-1].n++
+		return
+	}
+	r.frames = append(r.frames, frame{fb: append([]byte(nil), frameBuffer...), n: 1})
+}
+
+// Len returns the number of distinct frames and how many 60ths of a second
+// they last.
+func (r *Recording) Len() (frames, ticks int) {
+	for _, f := range r.frames {
+		ticks += f.n
+	}
+	return len(r.frames), ticks
+}
+
+// WriteGIF writes the recording as an animated GIF that loops. GIF delays
+// are in 100ths of a second, so each is rounded such that the frames start
+// at the right time overall.
+func (r *Recording) WriteGIF(w io.Writer) error {
+	if len(r.frames) == 0 {
+		return fmt.Errorf("nothing was recorded")
+	}
+	g := &gif.GIF{}
+	start := 0
+	for _, f := range r.frames {
+		end := start + f.n
+		g.Image = append(g.Image, Image(f.fb, r.scale, r.p))
+		g.Delay = append(g.Delay, centis(end)-centis(start))
+		start = end
+	}
+	return gif.EncodeAll(w, g)
+}
+
+// centis returns ticks 60ths of a second in 100ths, rounded.
+func centis(ticks int) int {
+	return (ticks*100 + FPS/2) / FPS
+}
+
+// WriteAPNG writes the recording as an animated PNG that loops.
+func (r *Recording) WriteAPNG(w io.Writer) error {
+	if len(r.frames) == 0 {
+		return fmt.Errorf("nothing was recorded")
+	}
+	var out bytes.Buffer
+	out.WriteString(pngSignature)
+	seq := uint32(0)
+	for i, f := range r.frames {
+		img := Image(f.fb, r.scale, r.p)
+		chunks, err := encodePNG(img)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			for _, c := range chunks {
+				if c.typ == "IHDR" {
+					writeChunk(&out, c.typ, c.data)
+				}
+			}
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl[0:], uint32(len(r.frames)))
+			writeChunk(&out, "acTL", actl) // and plays forever
+		}
+		writeChunk(&out, "fcTL", fcTL(seq, img.Bounds(), f.n))
+		seq++
+		for _, c := range chunks {
+			switch {
+			case c.typ == "IDAT" && i == 0:
+				writeChunk(&out, "IDAT", c.data)
+			case c.typ == "IDAT":
+				d := make([]byte, 4, 4+len(c.data))
+				binary.BigEndian.PutUint32(d, seq)
+				seq++
+				writeChunk(&out, "fdAT", append(d, c.data...))
+			case i == 0 && c.typ != "IHDR" && c.typ != "IEND":
+				writeChunk(&out, c.typ, c.data) // such as PLTE
+			}
+		}
+	}
+	writeChunk(&out, "IEND", nil)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+type chunk struct {
+	typ  string
+	data []byte
+}
+
+// encodePNG encodes img as a PNG and returns its chunks.
+func encodePNG(img image.Image) (chunks []chunk, err error) {
+	var b bytes.Buffer
+	if err = png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	p := b.Bytes()[len(pngSignature):]
+	for len(p) >= 12 {
+		n := int(binary.BigEndian.Uint32(p))
+		chunks = append(chunks, chunk{typ: string(p[4:8]), data: p[8 : 8+n]})
+		p = p[12+n:]
+	}
+	return chunks, err
+}
+
+func writeChunk(w *bytes.Buffer, typ string, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	w.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	w.WriteString(typ)
+	w.Write(data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	w.Write(n[:])
+}
+
+// fcTL returns the frame control of a frame covering bounds shown for
+// ticks 60ths of a second.
+func fcTL(seq uint32, bounds image.Rectangle, ticks int) []byte {
+	d := make([]byte, 26)
+	binary.BigEndian.PutUint32(d[0:], seq)
+	binary.BigEndian.PutUint32(d[4:], uint32(bounds.Dx()))
+	binary.BigEndian.PutUint32(d[8:], uint32(bounds.Dy()))
+	// x and y offsets of 0
+	binary.BigEndian.PutUint16(d[20:], uint16(ticks))
+	binary.BigEndian.PutUint16(d[22:], FPS)
+	// no disposal, source blending
+	return d
+}
@@ -0,0 +1,144 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+var testPalette = display.Palette{
+	Off: color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xFF},
+	On:  color.RGBA{R: 0xF0, G: 0xE0, B: 0xD0, A: 0xFF},
+}
+
+func testFrame(width, height int, on ...int) []byte {
+	fb := make([]byte, width*height)
+	for _, i := range on {
+		fb[i] = 1
+	}
+	return fb
+}
+
+func TestImage(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		fb            []byte
+		scale         int
+		width, height int
+	}{
+		{"low resolution", testFrame(64, 32, 65), 2, 128, 64},
+		{"high resolution", testFrame(128, 64, 129), 3, 384, 192},
+		{"scale of at least one", testFrame(64, 32, 65), 0, 64, 32},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			img := Image(tc.fb, tc.scale, testPalette)
+			assert.Equal(t, tc.width, img.Bounds().Dx())
+			assert.Equal(t, tc.height, img.Bounds().Dy())
+			s := tc.scale
+			if s < 1 {
+				s = 1
+			}
+			assert.Equal(t, testPalette.On, img.At(s, s), "pixel 1,1 is on")
+			assert.Equal(t, testPalette.On, img.At(2*s-1, 2*s-1))
+			assert.Equal(t, testPalette.Off, img.At(2*s, s))
+			assert.Equal(t, testPalette.Off, img.At(0, 0))
+		})
+	}
+}
+
+func TestImage_levels(t *testing.T) {
+	t.Parallel()
+	fb := testFrame(64, 32)
+	fb[0], fb[1] = 128, 255
+	img := Image(fb, 1, testPalette)
+	assert.Len(t, img.Palette, 16)
+	assert.Equal(t, testPalette.Color(136), img.At(0, 0), "the closest shade")
+	assert.Equal(t, testPalette.On, img.At(1, 0))
+}
+
+func TestRecording_Add(t *testing.T) {
+	t.Parallel()
+	r := NewRecording(1, testPalette)
+	fb := testFrame(64, 32, 0)
+	r.Add(fb)
+	fb[0] = 0 // the recording keeps a copy
+	r.Add(testFrame(64, 32, 0))
+	r.Add(testFrame(64, 32, 1))
+	r.Add(testFrame(64, 32, 1))
+	r.Add(testFrame(64, 32, 1))
+	r.Add(testFrame(64, 32, 0))
+	frames, ticks := r.Len()
+	assert.Equal(t, 3, frames, "the same frame twice in a row is recorded once")
+	assert.Equal(t, 6, ticks)
+}
+
+func TestRecording_WriteGIF(t *testing.T) {
+	t.Parallel()
+	r := NewRecording(2, testPalette)
+	for i := 0; i < 60; i++ {
+		r.Add(testFrame(64, 32, i/20)) // three frames of a third of a second
+	}
+	var b bytes.Buffer
+	assert.NoError(t, r.WriteGIF(&b))
+	g, err := gif.DecodeAll(&b)
+	assert.NoError(t, err)
+	assert.Len(t, g.Image, 3)
+	assert.Equal(t, []int{33, 34, 33}, g.Delay, "add up to a second")
+	assert.Equal(t, 0, g.LoopCount, "loops forever")
+	assert.Equal(t, 128, g.Config.Width)
+	assert.Equal(t, testPalette.On, g.Image[1].At(2, 0))
+	assert.Equal(t, testPalette.Off, g.Image[1].At(0, 0))
+
+	assert.EqualError(t, NewRecording(1, testPalette).WriteGIF(&b), "nothing was recorded")
+}
+
+func TestRecording_WriteAPNG(t *testing.T) {
+	t.Parallel()
+	r := NewRecording(2, testPalette)
+	for i := 0; i < 5; i++ {
+		r.Add(testFrame(64, 32, 0))
+	}
+	r.Add(testFrame(64, 32, 1))
+	var b bytes.Buffer
+	assert.NoError(t, r.WriteAPNG(&b))
+
+	img, err := png.Decode(bytes.NewReader(b.Bytes()))
+	assert.NoError(t, err, "a PNG decoder shows the first frame")
+	assert.Equal(t, 128, img.Bounds().Dx())
+	assert.Equal(t, testPalette.On, img.At(1, 1))
+
+	var types []string
+	var delays [][2]uint16
+	var seqs []uint32
+	p := b.Bytes()[len(pngSignature):]
+	for len(p) >= 12 {
+		n := int(binary.BigEndian.Uint32(p))
+		typ, data := string(p[4:8]), p[8:8+n]
+		types = append(types, typ)
+		switch typ {
+		case "acTL":
+			assert.Equal(t, uint32(2), binary.BigEndian.Uint32(data), "number of frames")
+			assert.Equal(t, uint32(0), binary.BigEndian.Uint32(data[4:]), "plays forever")
+		case "fcTL":
+			seqs = append(seqs, binary.BigEndian.Uint32(data))
+			delays = append(delays, [2]uint16{binary.BigEndian.Uint16(data[20:]), binary.BigEndian.Uint16(data[22:])})
+		case "fdAT":
+			seqs = append(seqs, binary.BigEndian.Uint32(data))
+		}
+		p = p[12+n:]
+	}
+	assert.Equal(t, []string{"IHDR", "acTL", "fcTL", "PLTE", "IDAT", "fcTL", "fdAT", "IEND"}, types)
+	assert.Equal(t, [][2]uint16{{5, 60}, {1, 60}}, delays)
+	assert.Equal(t, []uint32{0, 1, 2}, seqs)
+
+	assert.EqualError(t, NewRecording(1, testPalette).WriteAPNG(&b), "nothing was recorded")
+}
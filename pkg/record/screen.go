@@ -0,0 +1,105 @@
+package record
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"image"
+	"image/png"
+	"io"
+	"sync"
+)
+
+// Screen is a cpu.Screen that passes frames on to another screen, keeping
+// the last one to take screenshots of and record.
+type Screen struct {
+	lock sync.Mutex
+	next cpu.Screen
+	fb   []byte
+	rec  *Recording
+}
+
+func NewScreen(next cpu.Screen) *Screen {
+	return &Screen{next: next}
+}
+
+func (s *Screen) Draw(frameBuffer []byte) {
+	s.keep(frameBuffer)
+	s.next.Draw(frameBuffer)
+}
+
+// DrawDirty passes on which part of the frame changed to the next screen
+// when it can redraw only that.
+func (s *Screen) DrawDirty(frameBuffer []byte, dirty image.Rectangle) {
+	s.keep(frameBuffer)
+	if ds, ok := s.next.(cpu.DirtyScreen); ok {
+		ds.DrawDirty(frameBuffer, dirty)
+	} else {
+		s.next.Draw(frameBuffer)
+	}
+}
+
+// keep keeps a copy of the frame being drawn.
+func (s *Screen) keep(frameBuffer []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.fb) != len(frameBuffer) {
+		s.fb = make([]byte, len(frameBuffer))
+	}
+	copy(s.fb, frameBuffer)
+}
+
+// Frame returns a copy of the last frame drawn, blank before the first.
+func (s *Screen) Frame() []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fb == nil {
+		return make([]byte, 64*32)
+	}
+	return append([]byte(nil), s.fb...)
+}
+
+// Screenshot writes the last frame drawn as a PNG.
+func (s *Screen) Screenshot(w io.Writer, scale int, p display.Palette) error {
+	return png.Encode(w, Image(s.Frame(), scale, p))
+}
+
+// Record starts recording a frame each time Tick is called.
+func (s *Screen) Record(scale int, p display.Palette) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rec = NewRecording(scale, p)
+}
+
+// Stop stops recording and returns what was recorded, nil when nothing was
+// being recorded.
+func (s *Screen) Stop() *Recording {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.rec
+	s.rec = nil
+	return r
+}
+
+// Tick adds the frame being shown to the recording, if there is one. It is
+// to be called 60 times a second.
+func (s *Screen) Tick() error {
+	fb := s.Frame()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.rec != nil {
+		s.rec.Add(fb)
+	}
+	return nil
+}
+
+// Write writes a recording in format, gif or apng.
+func Write(w io.Writer, r *Recording, format string) error {
+	switch format {
+	case "gif":
+		return r.WriteGIF(w)
+	case "apng":
+		return r.WriteAPNG(w)
+	}
+	return fmt.Errorf("unknown recording format '%s', expected gif or apng", format)
+}
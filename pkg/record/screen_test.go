@@ -0,0 +1,98 @@
+package record
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
+	"testing"
+)
+
+type lastScreen struct {
+	fb []byte
+}
+
+func (s *lastScreen) Draw(frameBuffer []byte) {
+	s.fb = frameBuffer
+}
+
+func TestScreen_Draw(t *testing.T) {
+	t.Parallel()
+	next := &lastScreen{}
+	s := NewScreen(next)
+	assert.Equal(t, testFrame(64, 32), s.Frame(), "blank before the first frame")
+	fb := testFrame(64, 32, 3)
+	s.Draw(fb)
+	assert.Equal(t, fb, next.fb, "passed on")
+	fb[3] = 0
+	assert.Equal(t, testFrame(64, 32, 3), s.Frame(), "keeps a copy")
+}
+
+type dirtyScreen struct {
+	lastScreen
+	dirty image.Rectangle
+}
+
+func (s *dirtyScreen) DrawDirty(frameBuffer []byte, dirty image.Rectangle) {
+	s.fb, s.dirty = frameBuffer, dirty
+}
+
+func TestScreen_DrawDirty(t *testing.T) {
+	t.Parallel()
+	next := &dirtyScreen{}
+	s := NewScreen(next)
+	fb := testFrame(64, 32, 3)
+	s.DrawDirty(fb, image.Rect(3, 0, 4, 1))
+	assert.Equal(t, fb, next.fb, "passed on")
+	assert.Equal(t, image.Rect(3, 0, 4, 1), next.dirty, "with what changed")
+	assert.Equal(t, fb, s.Frame(), "kept")
+
+	last := &lastScreen{}
+	s = NewScreen(last)
+	s.DrawDirty(fb, image.Rect(3, 0, 4, 1))
+	assert.Equal(t, fb, last.fb, "drawn whole by screens that can't redraw part")
+}
+
+func TestScreen_Screenshot(t *testing.T) {
+	t.Parallel()
+	s := NewScreen(&lastScreen{})
+	s.Draw(testFrame(128, 64, 1))
+	var b bytes.Buffer
+	assert.NoError(t, s.Screenshot(&b, 2, testPalette))
+	img, err := png.Decode(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, 256, img.Bounds().Dx())
+	assert.Equal(t, 128, img.Bounds().Dy())
+	assert.Equal(t, testPalette.On, img.At(3, 1))
+	assert.Equal(t, testPalette.Off, img.At(1, 1))
+}
+
+func TestScreen_Record(t *testing.T) {
+	t.Parallel()
+	s := NewScreen(&lastScreen{})
+	assert.NoError(t, s.Tick(), "nothing is recorded until asked")
+	assert.Nil(t, s.Stop())
+
+	s.Record(1, testPalette)
+	assert.NoError(t, s.Tick())
+	s.Draw(testFrame(64, 32, 1))
+	assert.NoError(t, s.Tick())
+	assert.NoError(t, s.Tick())
+	r := s.Stop()
+	frames, ticks := r.Len()
+	assert.Equal(t, 2, frames)
+	assert.Equal(t, 3, ticks)
+	assert.Nil(t, s.Stop(), "stopped")
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+	r := NewRecording(1, testPalette)
+	r.Add(testFrame(64, 32))
+	for _, format := range []string{"gif", "apng"} {
+		var b bytes.Buffer
+		assert.NoError(t, Write(&b, r, format))
+		assert.NotZero(t, b.Len())
+	}
+	assert.EqualError(t, Write(&bytes.Buffer{}, r, "mp4"), "unknown recording format 'mp4', expected gif or apng")
+}
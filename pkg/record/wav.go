@@ -0,0 +1,64 @@
+package record
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// WAV writes 16 bit mono PCM to a WAV file. The sizes in its header are
+// only known once Close is called, so it needs to be able to seek back.
+type WAV struct {
+	w    io.WriteSeeker
+	size uint32
+}
+
+const wavHeaderSize = 44
+
+// NewWAV writes the header of a WAV file of sampleRate samples a second to
+// w and returns what writes the samples after it.
+func NewWAV(w io.WriteSeeker, sampleRate int) (*WAV, error) {
+	h := make([]byte, wavHeaderSize)
+	copy(h[0:], "RIFF")
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16) // size of fmt
+	binary.LittleEndian.PutUint16(h[20:], 1)  // PCM
+	binary.LittleEndian.PutUint16(h[22:], 1)  // mono
+	binary.LittleEndian.PutUint32(h[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(sampleRate*2)) // bytes a second
+	binary.LittleEndian.PutUint16(h[32:], 2)                    // bytes a sample
+	binary.LittleEndian.PutUint16(h[34:], 16)                   // bits a sample
+	copy(h[36:], "data")
+	if _, err := w.Write(h); err != nil {
+		return nil, err
+	}
+	return &WAV{w: w}, nil
+}
+
+// Write writes samples, little endian 16 bit ones.
+func (w *WAV) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	w.size += uint32(n)
+	return n, err
+}
+
+// Close fills in the sizes of the header. It doesn't close what is written
+// to.
+func (w *WAV) Close() error {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], wavHeaderSize-8+w.size)
+	if _, err := w.w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(b[:]); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b[:], w.size)
+	if _, err := w.w.Seek(40, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(b[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,40 @@
+package record
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWAV(t *testing.T) {
+	t.Parallel()
+	f, err := ioutil.TempFile("", "wav")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := NewWAV(f, 44100)
+	assert.NoError(t, err)
+	n, err := w.Write([]byte{1, 0, 2, 0})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	_, err = w.Write([]byte{3, 0})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	_, err = w.Write([]byte{4, 0})
+	assert.NoError(t, err, "carries on at the end")
+
+	raw, err := ioutil.ReadFile(f.Name())
+	assert.NoError(t, err)
+	assert.Len(t, raw, 44+8)
+	assert.Equal(t, "RIFF", string(raw[0:4]))
+	assert.Equal(t, uint32(36+6), binary.LittleEndian.Uint32(raw[4:]))
+	assert.Equal(t, "WAVEfmt ", string(raw[8:16]))
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(raw[22:]), "mono")
+	assert.Equal(t, uint32(44100), binary.LittleEndian.Uint32(raw[24:]))
+	assert.Equal(t, "data", string(raw[36:40]))
+	assert.Equal(t, uint32(6), binary.LittleEndian.Uint32(raw[40:]))
+	assert.Equal(t, []byte{1, 0, 2, 0, 3, 0, 4, 0}, raw[44:])
+}
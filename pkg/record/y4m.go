@@ -0,0 +1,74 @@
+package record
+
+import (
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"image/color"
+	"io"
+)
+
+// Y4M writes frames as a YUV4MPEG2 stream of 60 frames a second, which
+// encoders such as ffmpeg can read from a pipe. The stream is the size of
+// its first frame scaled, later frames of another resolution are stretched
+// to fit.
+type Y4M struct {
+	w             io.Writer
+	scale         int
+	ycc           [256][3]byte // Y, Cb and Cr of each level
+	width, height int
+	buf           []byte
+}
+
+// NewY4M returns a stream that writes frames to w with each pixel scale by
+// scale pixels, coloured from p by how bright it is, see display.Level.
+func NewY4M(w io.Writer, scale int, p display.Palette) *Y4M {
+	if scale < 1 {
+		scale = 1
+	}
+	y := &Y4M{w: w, scale: scale}
+	for i := range y.ycc {
+		c := p.Color(byte(i))
+		y.ycc[i][0], y.ycc[i][1], y.ycc[i][2] = color.RGBToYCbCr(c.R, c.G, c.B)
+	}
+	return y
+}
+
+// WriteFrame writes the next frame, the header too when it is the first.
+func (y *Y4M) WriteFrame(frameBuffer []byte) error {
+	fw, fh := dimensions(len(frameBuffer))
+	if y.buf == nil {
+		y.width, y.height = fw*y.scale, fh*y.scale
+		// 4:2:0 chroma is averaged over 2x2 pixels, both are even
+		y.buf = make([]byte, len("FRAME\n")+y.width*y.height*3/2)
+		header := fmt.Sprintf("YUV4MPEG2 W%d H%d F60:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n", y.width, y.height)
+		if _, err := io.WriteString(y.w, header); err != nil {
+			return err
+		}
+	}
+	copy(y.buf, "FRAME\n")
+	luma := y.buf[len("FRAME\n"):]
+	cb := luma[y.width*y.height:]
+	cr := cb[y.width*y.height/4:]
+	on := func(x, yy int) byte {
+		return display.Level(frameBuffer[(yy*fh/y.height)*fw+x*fw/y.width])
+	}
+	for yy := 0; yy < y.height; yy++ {
+		for x := 0; x < y.width; x++ {
+			luma[yy*y.width+x] = y.ycc[on(x, yy)][0]
+		}
+	}
+	for yy := 0; yy < y.height/2; yy++ {
+		for x := 0; x < y.width/2; x++ {
+			var u, v int
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				c := y.ycc[on(2*x+d[0], 2*yy+d[1])]
+				u += int(c[1])
+				v += int(c[2])
+			}
+			cb[yy*y.width/2+x] = byte((u + 2) / 4)
+			cr[yy*y.width/2+x] = byte((v + 2) / 4)
+		}
+	}
+	_, err := y.w.Write(y.buf)
+	return err
+}
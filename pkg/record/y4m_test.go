@@ -0,0 +1,51 @@
+package record
+
+import (
+	"bytes"
+	"github.com/carlosroman/go-chip-8/pkg/display"
+	"github.com/stretchr/testify/assert"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestY4M_WriteFrame(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	p := display.DefaultPalette
+	y := NewY4M(&b, 2, p)
+	assert.NoError(t, y.WriteFrame(testFrame(64, 32, 0)))
+	assert.NoError(t, y.WriteFrame(testFrame(64, 32)))
+	assert.NoError(t, y.WriteFrame(testFrame(128, 64, 0, 1, 128, 129)), "stretched to fit")
+
+	header := "YUV4MPEG2 W128 H64 F60:1 Ip A1:1 C420jpeg XCOLORRANGE=FULL\n"
+	assert.True(t, strings.HasPrefix(b.String(), header))
+	frames := strings.Split(strings.TrimPrefix(b.String(), header), "FRAME\n")
+	assert.Len(t, frames, 4)
+	size := 128*64 + 2*64*32
+	for i, f := range frames[1:] {
+		assert.Len(t, f, size, "frame %d", i)
+	}
+	first := frames[1]
+	assert.Equal(t, []byte{255, 255, 0}, []byte(first[0:3]), "pixel 0,0 is 2x2")
+	assert.Equal(t, byte(255), first[128+1])
+	assert.Equal(t, byte(0), first[128*2])
+	assert.Equal(t, byte(128), first[128*64], "white and black have no chroma")
+	assert.Equal(t, strings.Repeat("\x00", 128*64), frames[2][:128*64])
+	assert.Equal(t, first, frames[3], "a high resolution pixel is half the size")
+}
+
+func TestY4M_WriteFrame_chroma(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	p := display.Palette{Off: color.RGBA{A: 0xFF}, On: color.RGBA{R: 0xFF, A: 0xFF}}
+	y := NewY4M(&b, 1, p)
+	assert.NoError(t, y.WriteFrame(testFrame(64, 32, 0, 1, 64, 65, 3)))
+	raw := b.Bytes()[strings.Index(b.String(), "FRAME\n")+len("FRAME\n"):]
+	_, cbRed, crRed := color.RGBToYCbCr(0xFF, 0, 0)
+	cb, cr := raw[64*32:], raw[64*32+32*16:]
+	assert.Equal(t, cbRed, cb[0])
+	assert.Equal(t, crRed, cr[0])
+	assert.Equal(t, byte((int(crRed)+3*128+2)/4), cr[1], "averaged over 2x2 pixels")
+	assert.Equal(t, byte(128), cr[2])
+}
@@ -0,0 +1,80 @@
+package rom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/octo"
+	"image/gif"
+)
+
+// Options are the options an Octo cartridge runs its program with, as Octo
+// names them.
+type Options struct {
+	TickRate        int    `json:"tickrate,omitempty"`        // Instructions a frame
+	FillColor       string `json:"fillColor,omitempty"`       // Of pixels that are on, as #RRGGBB
+	BackgroundColor string `json:"backgroundColor,omitempty"` // Of pixels that are off
+	ShiftQuirks     bool   `json:"shiftQuirks"`               // 8XY6 and 8XYE shift VX rather than VY
+	LoadStoreQuirks bool   `json:"loadStoreQuirks"`           // FX55 and FX65 leave I as it was
+	VFOrderQuirks   bool   `json:"vfOrderQuirks"`             // 8XYN set VF before VX rather than after
+	ClipQuirks      bool   `json:"clipQuirks"`                // Sprites are clipped rather than wrapped
+	JumpQuirks      bool   `json:"jumpQuirks"`                // BNNN jumps to NNN plus VX rather than V0
+	LogicQuirks     bool   `json:"logicQuirks"`               // 8XY1, 8XY2 and 8XY3 reset VF
+	VBlankQuirks    bool   `json:"vBlankQuirks"`              // DXYN waits for the screen to be drawn
+	MaxSize         int    `json:"maxSize,omitempty"`         // Most the program can be
+}
+
+// cartridge is what an Octo cartridge holds.
+type cartridge struct {
+	Program string   `json:"program"` // Octo source
+	Options *Options `json:"options"`
+}
+
+// readCartridge reads data, the Octo cartridge called name, returning its
+// program assembled and its options. Octo hides them in the GIF's pixels:
+// the low two bits of the colour index of each, four pixels a byte most
+// significant first and frame after frame, are a 32 bit big endian length
+// and then that much JSON.
+func readCartridge(name string, data []byte) ([]byte, *Options, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read cartridge '%s': %v", name, err)
+	}
+	var payload []byte
+	var b byte
+	n := 0
+	for _, frame := range g.Image {
+		r := frame.Rect
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				b = b<<2 | frame.ColorIndexAt(x, y)&0x3
+				if n++; n%4 == 0 {
+					payload = append(payload, b)
+				}
+			}
+		}
+	}
+	if len(payload) < 4 || binary.BigEndian.Uint32(payload) == 0 {
+		return nil, nil, fmt.Errorf("cartridge '%s' holds nothing", name)
+	}
+	size := binary.BigEndian.Uint32(payload)
+	if uint64(size) > uint64(len(payload)-4) {
+		return nil, nil, fmt.Errorf("cartridge '%s' holds %d bytes, not the %d it says it does", name, len(payload)-4, size)
+	}
+	var c cartridge
+	if err = json.Unmarshal(payload[4:4+size], &c); err != nil {
+		return nil, nil, fmt.Errorf("could not read cartridge '%s': %v", name, err)
+	}
+	p, err := octo.Assemble(c.Program)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not assemble the program of cartridge '%s': %v", name, err)
+	}
+	if c.Options == nil {
+		c.Options = &Options{}
+	}
+	if max := c.Options.MaxSize; max > 0 && len(p.ROM) > max {
+		return nil, nil, fmt.Errorf("rom '%s' is %d bytes, at most %d bytes fit as its options say", name, len(p.ROM), max)
+	}
+	return p.ROM, c.Options, nil
+}
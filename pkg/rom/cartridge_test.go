@@ -0,0 +1,82 @@
+package rom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestReadCartridge(t *testing.T) {
+	t.Parallel()
+	data := cartridgeGIF(`{
+		"program": ": main clear loop v0 += 1 again",
+		"options": {"tickrate": 20, "fillColor": "#FFCC00", "backgroundColor": "#996600", "shiftQuirks": true, "clipQuirks": true, "maxSize": 3232}
+	}`)
+	rom, options, err := readCartridge("test.gif", data)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0xE0, 0x70, 0x01, 0x12, 0x02}, rom)
+	assert.Equal(t, &Options{TickRate: 20, FillColor: "#FFCC00", BackgroundColor: "#996600", ShiftQuirks: true, ClipQuirks: true, MaxSize: 3232}, options)
+
+	_, options, err = readCartridge("test.gif", cartridgeGIF(`{"program": "clear"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &Options{}, options)
+}
+
+func TestReadCartridge_errors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		desc string
+		data []byte
+		exp  string
+	}{
+		{desc: "not a gif", data: []byte("GIF89a"), exp: "could not read cartridge 'test.gif': gif: reading header: unexpected EOF"},
+		{desc: "empty", data: gifOf(nil), exp: "cartridge 'test.gif' holds nothing"},
+		{desc: "short", data: gifOf([]byte{0, 0, 1, 0, '{'}), exp: "cartridge 'test.gif' holds 60 bytes, not the 256 it says it does"},
+		{desc: "not json", data: cartridgeGIF(`program`), exp: "could not read cartridge 'test.gif': invalid character 'p' looking for beginning of value"},
+		{desc: "bad program", data: cartridgeGIF(`{"program": "jump nowhere"}`), exp: "could not assemble the program of cartridge 'test.gif': line 1: undefined label 'nowhere'"},
+		{desc: "too big", data: cartridgeGIF(`{"program": "clear clear", "options": {"maxSize": 2}}`), exp: "rom 'test.gif' is 4 bytes, at most 2 bytes fit as its options say"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			_, _, err := readCartridge("test.gif", tc.data)
+			assert.EqualError(t, err, tc.exp)
+		})
+	}
+}
+
+// cartridgeGIF returns an Octo cartridge holding cartridge, its JSON.
+func cartridgeGIF(cartridge string) []byte {
+	payload := make([]byte, 4, 4+len(cartridge))
+	binary.BigEndian.PutUint32(payload, uint32(len(cartridge)))
+	return gifOf(append(payload, cartridge...))
+}
+
+// gifOf returns a GIF hiding payload the way Octo does, across two frames
+// of a 16 by 8 image, padding what is left with zeros.
+func gifOf(payload []byte) []byte {
+	palette := color.Palette{color.Black, color.White, color.Gray{0x40}, color.Gray{0x80}}
+	var pixels []uint8
+	for _, b := range payload {
+		for shift := uint(6); shift < 8; shift -= 2 {
+			pixels = append(pixels, b>>shift&0x3)
+		}
+	}
+	g := &gif.GIF{}
+	for len(g.Image) < 2 || len(pixels) > 0 {
+		frame := image.NewPaletted(image.Rect(0, 0, 16, 8), palette)
+		pixels = pixels[copy(frame.Pix, pixels):]
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 0)
+	}
+	var b bytes.Buffer
+	if err := gif.EncodeAll(&b, g); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,110 @@
+package rom
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// readIntelHex reads the program in data, the Intel HEX file called name.
+// Addresses are where in memory the bytes go when none are below Origin,
+// and where in the program otherwise. Gaps are zeros.
+func readIntelHex(name string, data []byte) ([]byte, error) {
+	type record struct {
+		addr int
+		data []byte
+	}
+	var records []record
+	base, lowest, end := 0, -1, 0
+records:
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d of Intel HEX '%s': %s", n+1, name, fmt.Sprintf(format, args...))
+		}
+		if !strings.HasPrefix(line, ":") {
+			return nil, fail("does not start with a colon")
+		}
+		b, err := hex.DecodeString(line[1:])
+		if err != nil || len(b) < 5 || len(b) != 5+int(b[0]) {
+			return nil, fail("is not a record")
+		}
+		var sum byte
+		for _, c := range b {
+			sum += c
+		}
+		if sum != 0 {
+			return nil, fail("has the wrong checksum")
+		}
+		addr, payload := int(b[1])<<8|int(b[2]), b[4:len(b)-1]
+		switch b[3] {
+		case 0x00:
+			a := base + addr
+			if lowest < 0 || a < lowest {
+				lowest = a
+			}
+			if a+len(payload) > end {
+				end = a + len(payload)
+			}
+			records = append(records, record{a, payload})
+		case 0x01:
+			break records
+		case 0x02, 0x04:
+			if len(payload) != 2 {
+				return nil, fail("is not a record")
+			}
+			base = int(payload[0])<<8 | int(payload[1])
+			if b[3] == 0x02 {
+				base <<= 4
+			} else {
+				base <<= 16
+			}
+		case 0x03, 0x05:
+			// Where to start, which is always Origin
+		default:
+			return nil, fail("has unknown type %#02x", b[3])
+		}
+	}
+	origin := 0
+	if lowest >= Origin {
+		origin = Origin
+	}
+	if size := end - origin; size > MaxSize {
+		return nil, fmt.Errorf("rom '%s' is %d bytes, at most %d bytes fit in memory", name, size, MaxSize)
+	}
+	rom := make([]byte, end-origin)
+	for _, r := range records {
+		copy(rom[r.addr-origin:], r.data)
+	}
+	return rom, nil
+}
+
+// readListing reads the program in data, a hex listing called name: bytes
+// as pairs of hex digits, alone or run together, with or without 0x or $,
+// separated by spaces or commas. Words ending in a colon, such as
+// addresses, and comments after #, ; or // are ignored.
+func readListing(name string, data []byte) ([]byte, error) {
+	var rom []byte
+	for n, line := range strings.Split(string(data), "\n") {
+		for _, c := range []string{"#", ";", "//"} {
+			if i := strings.Index(line, c); i >= 0 {
+				line = line[:i]
+			}
+		}
+		for _, word := range strings.Fields(strings.Replace(line, ",", " ", -1)) {
+			if strings.HasSuffix(word, ":") {
+				continue
+			}
+			digits := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(word, "0x"), "0X"), "$")
+			b, err := hex.DecodeString(digits)
+			if err != nil || len(digits) == 0 {
+				return nil, fmt.Errorf("line %d of hex listing '%s': '%s' is not hex bytes", n+1, name, word)
+			}
+			rom = append(rom, b...)
+		}
+	}
+	return rom, nil
+}
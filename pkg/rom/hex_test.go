@@ -0,0 +1,101 @@
+package rom
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReadIntelHex(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		desc string
+		hex  string
+		exp  []byte
+	}{
+		{desc: "at the origin", hex: ":0402000000E0120206\n:00000001FF", exp: program},
+		{desc: "at the start of the program", hex: ":0400000000E0120208\r\n:00000001FF\r\n", exp: program},
+		{desc: "with a gap", hex: ":0102000000FD\n:01020300E01A\n", exp: []byte{0x00, 0x00, 0x00, 0xE0}},
+		{desc: "with a segment", hex: ":020000020020DC\n:0200000000E01E\n", exp: []byte{0x00, 0xE0}},
+		{desc: "with a start", hex: ":0400000500000200F5\n:0202000000E01C\n", exp: []byte{0x00, 0xE0}},
+		{desc: "after the end", hex: ":0202000000E01C\n:00000001FF\nanything", exp: []byte{0x00, 0xE0}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			rom, err := readIntelHex("test.hex", []byte(tc.hex))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.exp, rom)
+		})
+	}
+}
+
+func TestReadIntelHex_errors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		desc string
+		hex  string
+		exp  string
+	}{
+		{desc: "no colon", hex: ":0202000000E01C\n0202000000E01C", exp: "line 2 of Intel HEX 'test.hex': does not start with a colon"},
+		{desc: "short", hex: ":0202000000E0", exp: "line 1 of Intel HEX 'test.hex': is not a record"},
+		{desc: "not hex", hex: ":0202000000EG1C", exp: "line 1 of Intel HEX 'test.hex': is not a record"},
+		{desc: "checksum", hex: ":0202000000E01D", exp: "line 1 of Intel HEX 'test.hex': has the wrong checksum"},
+		{desc: "type", hex: ":00020006F8", exp: "line 1 of Intel HEX 'test.hex': has unknown type 0x06"},
+		{desc: "too big", hex: ":01100000FFF0", exp: "rom 'test.hex' is 3585 bytes, at most 3584 bytes fit in memory"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			_, err := readIntelHex("test.hex", []byte(tc.hex))
+			assert.EqualError(t, err, tc.exp)
+		})
+	}
+}
+
+func TestReadListing(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		desc    string
+		listing string
+		exp     []byte
+	}{
+		{desc: "pairs", listing: "00 e0 12 02", exp: program},
+		{desc: "words", listing: "00E0\n1202\n", exp: program},
+		{desc: "prefixed", listing: "0x00, 0xE0, $12, 0X02", exp: program},
+		{desc: "addresses", listing: "0x200: 00E0\n0x202: 1202", exp: program},
+		{desc: "comments", listing: "# pong\n00E0 ; clear\n1202 // loop", exp: program},
+		{desc: "empty", listing: "# nothing\n", exp: nil},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			rom, err := readListing("test.txt", []byte(tc.listing))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.exp, rom)
+		})
+	}
+}
+
+func TestReadListing_errors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		desc    string
+		listing string
+		exp     string
+	}{
+		{desc: "odd digits", listing: "00E0 120", exp: "line 1 of hex listing 'test.txt': '120' is not hex bytes"},
+		{desc: "not hex", listing: "00E0\nLD V0, 1", exp: "line 2 of hex listing 'test.txt': 'LD' is not hex bytes"},
+		{desc: "only a prefix", listing: "0x", exp: "line 1 of hex listing 'test.txt': '0x' is not hex bytes"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			_, err := readListing("test.txt", []byte(tc.listing))
+			assert.EqualError(t, err, tc.exp)
+		})
+	}
+}
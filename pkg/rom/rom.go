@@ -0,0 +1,218 @@
+// Package rom reads CHIP-8 programs from the files they are shared as: raw
+// images, gzip and zip archives of them, Intel HEX, hex listings and Octo
+// cartridges.
+package rom
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Origin is where in memory programs are loaded.
+	Origin = 0x200
+	// MaxSize is the most a program can be, the memory from Origin on.
+	MaxSize = 4096 - Origin
+	// maxUnpacked is the most an archive is unpacked to, a cartridge or a
+	// listing being far bigger than the program in it.
+	maxUnpacked = 1 << 20
+)
+
+// Raw are the extensions of files that are always raw images, whatever
+// they look like.
+var Raw = []string{".ch8", ".c8", ".sc8", ".xo8"}
+
+// ROM is a program and what it was read from.
+type ROM struct {
+	Name    string   // Of the file, or of the file in an archive
+	Format  string   // Of the file, as Formats names it
+	Data    []byte   // The program, to load at Origin
+	Options *Options // Of an Octo cartridge, nil for other formats
+}
+
+// Formats names the formats a program can be read from.
+var Formats = []string{"raw", "intel hex", "hex listing", "octo cartridge"}
+
+// Chooser picks which of the programs in an archive to read by name, when
+// there is more than one.
+type Chooser func(names []string) (string, error)
+
+// Load reads the program in the file at path. choose picks one when the
+// file is an archive of several, which is an error when it is nil.
+func Load(path string, choose Chooser) (*ROM, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Read(filepath.Base(path), data, choose)
+}
+
+// Read reads the program in data, which is in a file called name. Files
+// ending in one of Raw are raw images. Otherwise gzip and zip archives are
+// unpacked, GIFs read as Octo cartridges and text as Intel HEX when it
+// starts with a colon or as a hex listing, anything else being raw.
+func Read(name string, data []byte, choose Chooser) (*ROM, error) {
+	r, err := read(name, data, choose, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Data) > MaxSize {
+		return nil, fmt.Errorf("rom '%s' is %d bytes, at most %d bytes fit in memory", r.Name, len(r.Data), MaxSize)
+	}
+	return r, nil
+}
+
+func read(name string, data []byte, choose Chooser, depth int) (*ROM, error) {
+	ext := strings.ToLower(path.Ext(name))
+	r := &ROM{Name: name, Format: "raw", Data: data}
+	var err error
+	switch {
+	case contains(Raw, ext):
+		return r, nil
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")) && depth < 2:
+		if data, err = gunzip(name, data); err != nil {
+			return nil, err
+		}
+		return read(strings.TrimSuffix(name, path.Ext(name)), data, choose, depth+1)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) && depth < 2:
+		if name, data, err = unzip(name, data, choose); err != nil {
+			return nil, err
+		}
+		return read(name, data, choose, depth+1)
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		r.Format = "octo cartridge"
+		r.Data, r.Options, err = readCartridge(name, data)
+	case isText(data):
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte(":")) {
+			r.Format = "intel hex"
+			r.Data, err = readIntelHex(name, data)
+			break
+		}
+		var listing []byte
+		if listing, err = readListing(name, data); err == nil {
+			r.Format, r.Data = "hex listing", listing
+		} else if ext != ".hex" && ext != ".txt" {
+			// Text that happens to be a program
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// gunzip returns what data, a gzip file called name, unpacks to.
+func gunzip(name string, data []byte) ([]byte, error) {
+	z, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("could not unpack '%s': %v", name, err)
+	}
+	return readAll(name, z)
+}
+
+// unzip returns the name and contents of the program in data, a zip file
+// called name, asking choose which when there are several.
+func unzip(name string, data []byte, choose Chooser) (string, []byte, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", nil, fmt.Errorf("could not unpack '%s': %v", name, err)
+	}
+	files := candidates(z.File)
+	var f *zip.File
+	switch {
+	case len(files) == 0:
+		return "", nil, fmt.Errorf("there is no rom in '%s'", name)
+	case len(files) == 1:
+		f = files[0]
+	default:
+		names := make([]string, len(files))
+		for i, c := range files {
+			names[i] = c.Name
+		}
+		if choose == nil {
+			return "", nil, fmt.Errorf("'%s' has %d roms, choose one of %s", name, len(names), strings.Join(names, ", "))
+		}
+		chosen, err := choose(names)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, c := range files {
+			if c.Name == chosen {
+				f = c
+			}
+		}
+		if f == nil {
+			return "", nil, fmt.Errorf("there is no rom '%s' in '%s', choose one of %s", chosen, name, strings.Join(names, ", "))
+		}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", nil, fmt.Errorf("could not unpack '%s' from '%s': %v", f.Name, name, err)
+	}
+	defer rc.Close()
+	b, err := readAll(f.Name, rc)
+	return f.Name, b, err
+}
+
+// candidates returns the files of a zip archive that could be programs,
+// those with the extension of one if there are any and otherwise every
+// file but those macOS adds.
+func candidates(files []*zip.File) []*zip.File {
+	var all, roms []*zip.File
+	for _, f := range files {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+		all = append(all, f)
+		switch ext := strings.ToLower(path.Ext(f.Name)); {
+		case contains(Raw, ext), ext == ".hex", ext == ".gif", ext == ".gz":
+			roms = append(roms, f)
+		}
+	}
+	if len(roms) > 0 {
+		return roms
+	}
+	return all
+}
+
+// readAll reads what r, the contents of the file called name, unpacks to.
+func readAll(name string, r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxUnpacked+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not unpack '%s': %v", name, err)
+	}
+	if len(b) > maxUnpacked {
+		return nil, fmt.Errorf("'%s' unpacks to more than %d bytes", name, maxUnpacked)
+	}
+	return b, nil
+}
+
+// isText reports whether data is printable ASCII and whitespace.
+func isText(data []byte) bool {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return false
+	}
+	for _, b := range data {
+		if (b < ' ' || b > '~') && b != '\n' && b != '\r' && b != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
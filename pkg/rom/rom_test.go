@@ -0,0 +1,130 @@
+package rom
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var program = []byte{0x00, 0xE0, 0x12, 0x02}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		desc   string
+		name   string
+		data   []byte
+		format string
+		exp    []byte
+	}{
+		{desc: "raw", name: "pong.ch8", data: program, format: "raw", exp: program},
+		{desc: "raw whatever it looks like", name: "text.c8", data: []byte("00e0"), format: "raw", exp: []byte("00e0")},
+		{desc: "raw without an extension", name: "pong", data: program, format: "raw", exp: program},
+		{desc: "gzip", name: "pong.ch8.gz", data: gzipped(program), format: "raw", exp: program},
+		{desc: "zip", name: "pong.zip", data: zipped("README", "Pong", "pong.ch8", string(program)), format: "raw", exp: program},
+		{desc: "gzip of a listing", name: "pong.txt.gz", data: gzipped([]byte("00e0 1202")), format: "hex listing", exp: program},
+		{desc: "intel hex", name: "pong.hex", data: []byte(":04020000" + "00E01202" + "06\n:00000001FF\n"), format: "intel hex", exp: program},
+		{desc: "hex listing", name: "pong.txt", data: []byte("200: 00 E0\n202: 0x12, 0x02 # loop\n"), format: "hex listing", exp: program},
+		{desc: "text that is not hex", name: "message", data: []byte("hello"), format: "raw", exp: []byte("hello")},
+		{desc: "octo cartridge", name: "pong.gif", data: cartridgeGIF(`{"program": "clear : l jump l", "options": {}}`), format: "octo cartridge", exp: program},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			r, err := Read(tc.name, tc.data, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.format, r.Format)
+			assert.Equal(t, tc.exp, r.Data)
+		})
+	}
+}
+
+func TestRead_errors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		desc string
+		name string
+		data []byte
+		exp  string
+	}{
+		{desc: "too big", name: "big.ch8", data: make([]byte, MaxSize+1), exp: "rom 'big.ch8' is 3585 bytes, at most 3584 bytes fit in memory"},
+		{desc: "too big gzipped", name: "big.ch8.gz", data: gzipped(make([]byte, 4000)), exp: "rom 'big.ch8' is 4000 bytes, at most 3584 bytes fit in memory"},
+		{desc: "empty zip", name: "empty.zip", data: zipped(".hidden", "x"), exp: "there is no rom in 'empty.zip'"},
+		{desc: "several roms", name: "roms.zip", data: zipped("a.ch8", "a", "b.ch8", "b"), exp: "'roms.zip' has 2 roms, choose one of a.ch8, b.ch8"},
+		{desc: "bad listing", name: "pong.hex", data: []byte("00e0\nhello"), exp: "line 2 of hex listing 'pong.hex': 'hello' is not hex bytes"},
+		{desc: "bad checksum", name: "pong.hex", data: []byte(":0402000000E0120207\n"), exp: "line 1 of Intel HEX 'pong.hex': has the wrong checksum"},
+		{desc: "unpacks too far", name: "bomb.gz", data: gzipped(make([]byte, maxUnpacked+1)), exp: "'bomb.gz' unpacks to more than 1048576 bytes"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			_, err := Read(tc.name, tc.data, nil)
+			assert.EqualError(t, err, tc.exp)
+		})
+	}
+}
+
+func TestRead_choose(t *testing.T) {
+	t.Parallel()
+	data := zipped("__MACOSX/._a.ch8", "x", "roms/", "", "roms/a.ch8", "a", "roms/b.ch8", "b", "readme.txt", "read me")
+	var offered []string
+	r, err := Read("roms.zip", data, func(names []string) (string, error) {
+		offered = names
+		return "roms/b.ch8", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"roms/a.ch8", "roms/b.ch8"}, offered)
+	assert.Equal(t, "roms/b.ch8", r.Name)
+	assert.Equal(t, []byte("b"), r.Data)
+
+	_, err = Read("roms.zip", data, func([]string) (string, error) { return "c.ch8", nil })
+	assert.EqualError(t, err, "there is no rom 'c.ch8' in 'roms.zip', choose one of roms/a.ch8, roms/b.ch8")
+
+	_, err = Read("roms.zip", data, func([]string) (string, error) { return "", errors.New("no terminal") })
+	assert.EqualError(t, err, "no terminal")
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "rom")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pong.ch8.gz")
+	assert.NoError(t, ioutil.WriteFile(path, gzipped(program), 0644))
+
+	r, err := Load(path, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &ROM{Name: "pong.ch8", Format: "raw", Data: program}, r)
+
+	_, err = Load(filepath.Join(dir, "missing.ch8"), nil)
+	assert.Error(t, err)
+}
+
+func gzipped(data []byte) []byte {
+	var b bytes.Buffer
+	z := gzip.NewWriter(&b)
+	z.Write(data)
+	z.Close()
+	return b.Bytes()
+}
+
+// zipped returns a zip archive of files, pairs of names and contents.
+// Names ending in a slash are directories.
+func zipped(files ...string) []byte {
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for i := 0; i < len(files); i += 2 {
+		w, _ := z.Create(files[i])
+		w.Write([]byte(files[i+1]))
+	}
+	z.Close()
+	return b.Bytes()
+}
@@ -0,0 +1,134 @@
+// Package selftest runs test roms and checks that they leave the screen the
+// way their manifests say they should.
+package selftest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Suffix is what the name of a manifest ends in. The manifest of
+// BC_test.ch8 is BC_test.test.json.
+const Suffix = ".test.json"
+
+// Quirks are the quirks a manifest can turn on.
+var Quirks = []string{"wrap"}
+
+// Manifest tells how to run a test rom and what it should leave on the
+// screen, as text, a row each of a # for each pixel on and a . for each
+// off, or as the SHA-256 of the frame buffer.
+type Manifest struct {
+	Path        string   `json:"-"`                     // Of the manifest
+	ROM         string   `json:"rom"`                   // Relative to the manifest
+	Description string   `json:"description,omitempty"` // Of what the rom tests
+	Quirks      []string `json:"quirks,omitempty"`      // See Quirks
+	Cycles      uint64   `json:"cycles"`                // Instructions to execute, fewer if it exits with 00FD
+	IPF         int      `json:"ipf,omitempty"`         // Instructions a frame, 10 when not set
+	Keys        []Key    `json:"keys,omitempty"`        // To press, in the order of the cycles they are pressed at
+	Screen      []string `json:"screen,omitempty"`      // Expected
+	Hash        string   `json:"hash,omitempty"`        // Expected, instead of Screen
+}
+
+// Key is a key pressed while a rom runs, which it is given if it waits for
+// a key before then.
+type Key struct {
+	Key     byte   `json:"key"`
+	Press   uint64 `json:"press"`             // Cycle to press it at
+	Release uint64 `json:"release,omitempty"` // Cycle to release it at, held until the end when not set
+}
+
+// Load reads the manifest at path.
+func Load(path string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{Path: path}
+	if err = json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("could not read manifest '%s': %v", path, err)
+	}
+	if err = m.check(); err != nil {
+		return nil, fmt.Errorf("manifest '%s' is invalid: %v", path, err)
+	}
+	return m, nil
+}
+
+func (m *Manifest) check() error {
+	if m.ROM == "" {
+		m.ROM = strings.TrimSuffix(filepath.Base(m.Path), Suffix) + ".ch8"
+	}
+	if m.IPF == 0 {
+		m.IPF = 10
+	}
+	switch {
+	case m.Cycles == 0:
+		return fmt.Errorf("cycles must be at least 1")
+	case m.IPF < 0:
+		return fmt.Errorf("invalid ipf %d", m.IPF)
+	case (m.Screen == nil) == (m.Hash == ""):
+		return fmt.Errorf("one of screen or hash is required")
+	}
+	for _, q := range m.Quirks {
+		if !contains(Quirks, q) {
+			return fmt.Errorf("unknown quirk '%s', the quirks are %s", q, strings.Join(Quirks, ", "))
+		}
+	}
+	for i, k := range m.Keys {
+		switch {
+		case k.Key > 0xF:
+			return fmt.Errorf("there is no key %#x, keys are 0x0 to 0xF", k.Key)
+		case k.Release != 0 && k.Release <= k.Press:
+			return fmt.Errorf("key %#x is released at cycle %d, before it is pressed at %d", k.Key, k.Release, k.Press)
+		case i > 0 && k.Press < m.Keys[i-1].Press:
+			return fmt.Errorf("key %#x is pressed at cycle %d, before the key before it", k.Key, k.Press)
+		}
+	}
+	return nil
+}
+
+// ROMPath returns the path of the rom.
+func (m *Manifest) ROMPath() string {
+	if filepath.IsAbs(m.ROM) {
+		return m.ROM
+	}
+	return filepath.Join(filepath.Dir(m.Path), m.ROM)
+}
+
+// Save writes the manifest back to its path.
+func (m *Manifest) Save() error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.Path, append(b, '\n'), 0644)
+}
+
+// Find returns the paths of the manifests in dir, sorted by name.
+func Find(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), Suffix) {
+			paths = append(paths, filepath.Join(dir, fi.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("there are no *%s manifests in '%s'", Suffix, dir)
+	}
+	return paths, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
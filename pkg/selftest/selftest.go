@@ -0,0 +1,208 @@
+package selftest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/record"
+	"github.com/carlosroman/go-chip-8/pkg/state"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// Result is how a test rom did.
+type Result struct {
+	Manifest *Manifest
+	Cycles   uint64   // Instructions executed
+	Screen   []string // What it left on the screen, see Manifest
+	Hash     string   // Of the frame buffer it left
+	Err      error    // Why it could not be run to the end
+}
+
+// Passed reports whether the rom ran to the end and left the screen it
+// was expected to.
+func (r Result) Passed() bool {
+	if r.Err != nil {
+		return false
+	}
+	if r.Manifest.Hash != "" {
+		return strings.EqualFold(r.Hash, r.Manifest.Hash)
+	}
+	return equal(r.Screen, r.Manifest.Screen)
+}
+
+// Run runs the rom of m for its cycles, or until it exits with 00FD, with
+// the timers counted down every ipf instructions.
+func Run(m *Manifest) Result {
+	res := Result{Manifest: m}
+	rom, err := ioutil.ReadFile(m.ROMPath())
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	mem := state.InitMemory()
+	if res.Err = mem.LoadMemory(bytes.NewReader(rom)); res.Err != nil {
+		return res
+	}
+	sc := make(chan byte, 1)
+	go func() {
+		for range sc {
+			// Nobody listens
+		}
+	}()
+	defer close(sc)
+	ti := cpu.NewTimer(sc)
+	k := &keys{Keyboard: cpu.NewKeyboard(), keys: m.Keys}
+	k.Clear()
+	c := cpu.NewCPU(mem, rand.New(rand.NewSource(1)), k, ti, &noScreen{})
+	c.SetWrap(contains(m.Quirks, "wrap"))
+	for ; res.Cycles < m.Cycles; res.Cycles++ {
+		k.at(res.Cycles)
+		if res.Cycles > 0 && res.Cycles%uint64(m.IPF) == 0 {
+			if res.Err = ti.Tick(); res.Err != nil {
+				break
+			}
+		}
+		if err = c.Tick(); err == cpu.ErrExit {
+			res.Cycles++
+			break
+		} else if err != nil {
+			res.Err = fmt.Errorf("failed at cycle %d: %v", res.Cycles, err)
+			break
+		}
+		if k.stuck {
+			res.Err = fmt.Errorf("waited for a key at cycle %d with none left to press", res.Cycles)
+			break
+		}
+	}
+	fb := c.FrameBuffer()
+	res.Screen = record.Text(fb)
+	res.Hash = fmt.Sprintf("%x", sha256.Sum256(fb))
+	return res
+}
+
+// Update sets what the manifest expects to what the rom left on the
+// screen, as text unless it expects a hash.
+func (r Result) Update() {
+	if r.Manifest.Hash != "" {
+		r.Manifest.Hash = r.Hash
+		return
+	}
+	r.Manifest.Screen = r.Screen
+}
+
+// Report writes a table of whether each rom passed, and then what was
+// wrong with those that didn't.
+func Report(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROM\tCYCLES\tRESULT\tDESCRIPTION")
+	for _, r := range results {
+		result := "pass"
+		if !r.Passed() {
+			result = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s", filepath.Base(r.Manifest.ROM), r.Cycles, result)
+		if r.Manifest.Description != "" {
+			fmt.Fprintf(tw, "\t%s", r.Manifest.Description)
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Passed() {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", filepath.Base(r.Manifest.ROM))
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(w, "%v\n", r.Err)
+		case r.Manifest.Hash != "":
+			fmt.Fprintf(w, "expected hash %s\nactual hash   %s\n%s\n", r.Manifest.Hash, r.Hash, strings.Join(r.Screen, "\n"))
+		default:
+			fmt.Fprint(w, Diff(r.Manifest.Screen, r.Screen))
+		}
+	}
+	return nil
+}
+
+// Diff returns the rows of two screens, those of expected that differ
+// after a - and those of actual after a +, and the rest after a space.
+func Diff(expected, actual []string) string {
+	var b strings.Builder
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			fmt.Fprintf(&b, "-%s\n", expected[i])
+		case i >= len(expected):
+			fmt.Fprintf(&b, "+%s\n", actual[i])
+		case expected[i] != actual[i]:
+			fmt.Fprintf(&b, "-%s\n+%s\n", expected[i], actual[i])
+		default:
+			fmt.Fprintf(&b, " %s\n", actual[i])
+		}
+	}
+	return b.String()
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// keys presses the keys of a manifest at the cycles it says to.
+type keys struct {
+	cpu.Keyboard
+	keys  []Key
+	held  *Key
+	stuck bool // Whether the rom waited for a key with none left to press
+}
+
+// at presses and releases the keys due at cycle.
+func (k *keys) at(cycle uint64) {
+	if k.held != nil && k.held.Release != 0 && k.held.Release <= cycle {
+		k.held = nil
+		k.Clear()
+	}
+	if len(k.keys) > 0 && k.keys[0].Press <= cycle {
+		k.press()
+	}
+}
+
+// press presses the next key.
+func (k *keys) press() {
+	k.held = &k.keys[0]
+	k.keys = k.keys[1:]
+	k.KeyPressed(k.held.Key)
+}
+
+// PollKeyPressed presses the next key now rather than waiting for its
+// cycle when none was pressed, as nothing happens until one is.
+func (k *keys) PollKeyPressed() (byte, bool) {
+	if key, ok := k.Keyboard.PollKeyPressed(); ok {
+		return key, true
+	}
+	if len(k.keys) == 0 {
+		k.stuck = true
+		return 0, false
+	}
+	k.press()
+	return k.Keyboard.PollKeyPressed()
+}
+
+type noScreen struct{}
+
+func (s *noScreen) Draw(frameBuffer []byte) {}
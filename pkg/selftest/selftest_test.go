@@ -0,0 +1,161 @@
+package selftest
+
+import (
+	"bytes"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testROMs = "../../test/roms"
+
+func TestRun_testROMs(t *testing.T) {
+	log.SetLevel(log.WarnLevel)
+	paths, err := Find(testROMs)
+	assert.NoError(t, err)
+	for _, path := range paths {
+		m, err := Load(path)
+		assert.NoError(t, err)
+		r := Run(m)
+		if !r.Passed() {
+			var b bytes.Buffer
+			assert.NoError(t, Report(&b, []Result{r}))
+			t.Errorf("%s failed:\n%s", path, b.String())
+		}
+	}
+}
+
+// writeROM writes rom and its manifest to dir, returning the manifest.
+func writeROM(t *testing.T, dir string, rom []byte, manifest string) *Manifest {
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "rom.ch8"), rom, 0644))
+	path := filepath.Join(dir, "rom"+Suffix)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(manifest), 0644))
+	m, err := Load(path)
+	assert.NoError(t, err)
+	return m
+}
+
+func TestRun_keys(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "selftest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// Wait for a key, draw its character, wait for key 1 to be pressed,
+	// draw it again
+	rom := []byte{0xF0, 0x0A, 0xF0, 0x29, 0xD1, 0x15, 0x62, 0x01, 0xE2, 0x9E, 0x12, 0x08, 0xD1, 0x15, 0x12, 0x0E}
+	m := writeROM(t, dir, rom, `{"cycles": 100, "keys": [{"key": 7, "press": 50, "release": 60}, {"key": 1, "press": 80}], "hash": "0"}`)
+
+	r := Run(m)
+	assert.NoError(t, r.Err)
+	assert.Equal(t, uint64(100), r.Cycles)
+	assert.Equal(t, "........", r.Screen[0][:8], "erased once 1 was pressed")
+	assert.Equal(t, "........", r.Screen[1][:8])
+
+	m.Keys = m.Keys[:1]
+	r = Run(m)
+	assert.NoError(t, r.Err)
+	assert.Equal(t, "####....", r.Screen[0][:8], "the 7 pressed drawn")
+	assert.Equal(t, "...#....", r.Screen[1][:8])
+
+	m.Keys = nil
+	r = Run(m)
+	assert.EqualError(t, r.Err, "waited for a key at cycle 0 with none left to press")
+	assert.False(t, r.Passed())
+}
+
+func TestRun_exit(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "selftest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// Draw the 0 of the font, exit
+	m := writeROM(t, dir, []byte{0xD0, 0x05, 0x00, 0xFD}, `{"cycles": 100, "screen": []}`)
+	r := Run(m)
+	assert.NoError(t, r.Err)
+	assert.Equal(t, uint64(2), r.Cycles)
+	assert.False(t, r.Passed())
+
+	r.Update()
+	assert.True(t, r.Passed())
+	assert.NoError(t, m.Save())
+	saved, err := Load(m.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, r.Screen, saved.Screen)
+	assert.Equal(t, "####....", saved.Screen[0][:8])
+}
+
+func TestLoad_errors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		manifest string
+		err      string
+	}{
+		{"not json", `cycles: 10`, "could not read manifest '%s': invalid character 'c' looking for beginning of value"},
+		{"no cycles", `{"hash": "0"}`, "manifest '%s' is invalid: cycles must be at least 1"},
+		{"no screen", `{"cycles": 10}`, "manifest '%s' is invalid: one of screen or hash is required"},
+		{"screen and hash", `{"cycles": 10, "screen": [], "hash": "0"}`, "manifest '%s' is invalid: one of screen or hash is required"},
+		{"invalid ipf", `{"cycles": 10, "ipf": -1, "hash": "0"}`, "manifest '%s' is invalid: invalid ipf -1"},
+		{"unknown quirk", `{"cycles": 10, "quirks": ["shift"], "hash": "0"}`, "manifest '%s' is invalid: unknown quirk 'shift', the quirks are wrap"},
+		{"unknown key", `{"cycles": 10, "keys": [{"key": 16}], "hash": "0"}`, "manifest '%s' is invalid: there is no key 0x10, keys are 0x0 to 0xF"},
+		{"released before pressed", `{"cycles": 10, "keys": [{"key": 1, "press": 5, "release": 5}], "hash": "0"}`, "manifest '%s' is invalid: key 0x1 is released at cycle 5, before it is pressed at 5"},
+		{"out of order", `{"cycles": 10, "keys": [{"key": 1, "press": 5}, {"key": 2, "press": 4}], "hash": "0"}`, "manifest '%s' is invalid: key 0x2 is pressed at cycle 4, before the key before it"},
+	}
+	dir, err := ioutil.TempDir("", "manifests")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for i, tc := range testCases {
+		path := filepath.Join(dir, strings.Repeat("m", i+1)+Suffix)
+		assert.NoError(t, ioutil.WriteFile(path, []byte(tc.manifest), 0644))
+		_, err := Load(path)
+		assert.EqualError(t, err, strings.Replace(tc.err, "%s", path, 1), tc.name)
+	}
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+	paths, err := Find(testROMs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(testROMs, "BC_test.test.json"), filepath.Join(testROMs, "C8PIC.test.json")}, paths)
+
+	m, err := Load(paths[0])
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(testROMs, "BC_test.ch8"), m.ROMPath())
+
+	_, err = Find(".")
+	assert.EqualError(t, err, "there are no *.test.json manifests in '.'")
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, " ..\n-#.\n+.#\n ##\n+..\n", Diff([]string{"..", "#.", "##"}, []string{"..", ".#", "##", ".."}))
+	assert.Equal(t, " ..\n-#.\n", Diff([]string{"..", "#."}, []string{".."}))
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+	pass := Result{Manifest: &Manifest{ROM: "pass.ch8", Description: "Passes", Screen: []string{"#."}}, Cycles: 10, Screen: []string{"#."}}
+	screen := Result{Manifest: &Manifest{ROM: "screen.ch8", Screen: []string{"#.", ".."}}, Cycles: 20, Screen: []string{"#.", ".#"}}
+	hash := Result{Manifest: &Manifest{ROM: "hash.ch8", Hash: "ab"}, Cycles: 30, Screen: []string{".#"}, Hash: "cd"}
+	var b bytes.Buffer
+	assert.NoError(t, Report(&b, []Result{pass, screen, hash}))
+	assert.Equal(t, `ROM         CYCLES  RESULT  DESCRIPTION
+pass.ch8    10      pass    Passes
+screen.ch8  20      FAIL
+hash.ch8    30      FAIL
+
+screen.ch8:
+ #.
+-..
++.#
+
+hash.ch8:
+expected hash ab
+actual hash   cd
+.#
+`, b.String())
+}
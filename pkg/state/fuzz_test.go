@@ -0,0 +1,39 @@
+//go:build go1.18
+// +build go1.18
+
+package state
+
+import (
+	"bytes"
+	log "github.com/sirupsen/logrus"
+	"testing"
+)
+
+// FuzzLoadMemory checks that roms that fit are loaded after the font and
+// those that do not are refused, without panicking either way.
+func FuzzLoadMemory(f *testing.F) {
+	log.SetLevel(log.WarnLevel)
+	f.Add([]byte{})
+	f.Add([]byte{0x00, 0xE0, 0x12, 0x00})
+	f.Add(make([]byte, 3584))
+	f.Add(make([]byte, 3585))
+	f.Fuzz(func(t *testing.T, rom []byte) {
+		m := InitMemory()
+		err := m.LoadMemory(bytes.NewReader(rom))
+		if len(rom) > len(m)-ProgramStart {
+			if err == nil {
+				t.Fatalf("loaded a rom of %d bytes", len(rom))
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(m[:80], getFonts()) {
+			t.Fatal("font not loaded")
+		}
+		if !bytes.Equal(m[ProgramStart:ProgramStart+len(rom)], rom) {
+			t.Fatal("rom not loaded at ProgramStart")
+		}
+	})
+}
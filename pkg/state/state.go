@@ -1,6 +1,8 @@
 package state
 
 import (
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"io"
 	"io/ioutil"
@@ -29,20 +31,35 @@ func getFonts() []byte {
 	return f
 }
 
+// ProgramStart is where in memory programs are loaded.
+const ProgramStart = 512
+
+var (
+	// ErrStackOverflow is returned by Push when the stack is full.
+	ErrStackOverflow = errors.New("stack overflow")
+	// ErrStackUnderflow is returned by Pop when the stack is empty.
+	ErrStackUnderflow = errors.New("stack underflow")
+)
+
 type Memory []uint8
 
+// LoadMemory loads the font and then the rom read from r at ProgramStart,
+// returning an error without loading anything when the rom does not fit.
 func (m Memory) LoadMemory(r io.Reader) (err error) {
-	f := getFonts()
-	for i := range f {
-		m[i] = f[i]
-	}
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return err
 	}
+	if limit := len(m) - ProgramStart; len(b) > limit {
+		return fmt.Errorf("rom of %d bytes is too big, at most %d bytes fit", len(b), limit)
+	}
+	f := getFonts()
+	for i := range f {
+		m[i] = f[i]
+	}
 	log.Infof("loading %d bytes", len(b))
 	for i := range b {
-		m[i+512] = b[i]
+		m[i+ProgramStart] = b[i]
 	}
 	return err
 }
@@ -57,19 +74,30 @@ type Stack struct {
 	i int8
 }
 
-func (s *Stack) Pop() (val int16) {
+// Pop removes and returns the value on top of the stack, or returns
+// ErrStackUnderflow when there is none.
+func (s *Stack) Pop() (val int16, err error) {
 	s.l.Lock()
 	defer s.l.Unlock()
+	if s.i < 0 {
+		return 0, ErrStackUnderflow
+	}
 	val = s.s[s.i]
 	s.i -= 1
-	return val
+	return val, nil
 }
 
-func (s *Stack) Push(val int16) {
+// Push puts val on top of the stack, or returns ErrStackOverflow when it
+// is full.
+func (s *Stack) Push(val int16) error {
 	s.l.Lock()
 	defer s.l.Unlock()
+	if int(s.i)+1 >= len(s.s) {
+		return ErrStackOverflow
+	}
 	s.i += 1
 	s.s[s.i] = val
+	return nil
 }
 
 func (s *Stack) Len() (length int8) {
@@ -78,6 +106,13 @@ func (s *Stack) Len() (length int8) {
 	return s.i + 1
 }
 
+// Values returns a copy of what is on the stack, the bottom first.
+func (s *Stack) Values() (vals []int16) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return append(vals, s.s[:s.i+1]...)
+}
+
 func InitStack() *Stack {
 	return &Stack{
 		s: make([]int16, 16),
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"fmt"
 	log "github.com/sirupsen/logrus"
@@ -38,6 +39,16 @@ func TestLoadMemory(t *testing.T) {
 	}
 }
 
+func TestLoadMemory_too_big(t *testing.T) {
+	t.Parallel()
+	m := InitMemory()
+	assert.NoError(t, m.LoadMemory(bytes.NewReader(make([]byte, 3584))), "fills memory")
+	m = InitMemory()
+	err := m.LoadMemory(bytes.NewReader(make([]byte, 3585)))
+	assert.EqualError(t, err, "rom of 3585 bytes is too big, at most 3584 bytes fit")
+	assert.Equal(t, byte(0), m[0], "font not loaded")
+}
+
 func loadMemoryTest(tb testing.TB) Memory {
 	m := InitMemory()
 	f, err := os.Open(C8PIC_path)
@@ -54,15 +65,48 @@ func TestInitStack(t *testing.T) {
 	assert.Len(t, s.s, 16)
 }
 
+func TestStack_Values(t *testing.T) {
+	t.Parallel()
+	s := InitStack()
+	assert.Empty(t, s.Values())
+	assert.NoError(t, s.Push(0x200))
+	assert.NoError(t, s.Push(0x300))
+	vals := s.Values()
+	assert.Equal(t, []int16{0x200, 0x300}, vals)
+	vals[0] = 0
+	val, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, int16(0x300), val)
+	val, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, int16(0x200), val, "values is a copy")
+}
+
 func TestStack_PushThenPop(t *testing.T) {
 	t.Parallel()
 	s := InitStack()
 	ex := int16(1337)
 	for i := int16(0); i < 16; i++ {
-		s.Push(ex + i)
+		assert.NoError(t, s.Push(ex+i))
 	}
 	for i := int16(15); i > -1; i-- {
-		ac := s.Pop()
+		ac, err := s.Pop()
+		assert.NoError(t, err)
 		assert.Equal(t, ex+i, ac)
 	}
 }
+
+func TestStack_overflow_and_underflow(t *testing.T) {
+	t.Parallel()
+	s := InitStack()
+	_, err := s.Pop()
+	assert.Equal(t, ErrStackUnderflow, err)
+	for i := int16(0); i < 16; i++ {
+		assert.NoError(t, s.Push(i))
+	}
+	assert.Equal(t, ErrStackOverflow, s.Push(16))
+	assert.Equal(t, int8(16), s.Len(), "nothing pushed")
+	val, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, int16(15), val)
+}
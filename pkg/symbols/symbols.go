@@ -0,0 +1,241 @@
+package symbols
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table maps addresses to names and back.
+type Table struct {
+	names map[uint16]string
+	addrs map[string]uint16
+}
+
+// New returns a table of labels. When several addresses share a name it
+// refers to the lowest of them.
+func New(labels map[uint16]string) *Table {
+	t := &Table{
+		names: make(map[uint16]string, len(labels)),
+		addrs: make(map[string]uint16, len(labels)),
+	}
+	for a, n := range labels {
+		t.names[a] = n
+		if b, ok := t.addrs[n]; !ok || a < b {
+			t.addrs[n] = a
+		}
+	}
+	return t
+}
+
+// Name returns the name of addr. It can be passed to disasm.Format, and is
+// safe to call on a nil table.
+func (t *Table) Name(addr uint16) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	n, ok := t.names[addr]
+	return n, ok
+}
+
+// Addr returns the address called name.
+func (t *Table) Addr(name string) (uint16, bool) {
+	if t == nil {
+		return 0, false
+	}
+	a, ok := t.addrs[name]
+	return a, ok
+}
+
+// Len is the number of addresses with a name.
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.names)
+}
+
+// Labels returns a copy of the names by address.
+func (t *Table) Labels() map[uint16]string {
+	labels := make(map[uint16]string, t.Len())
+	if t != nil {
+		for a, n := range t.names {
+			labels[a] = n
+		}
+	}
+	return labels
+}
+
+// Resolve turns what a user typed, such as the argument of `break
+// draw_player` or `break 0x2A4`, into an address.
+func (t *Table) Resolve(s string) (uint16, error) {
+	if a, ok := t.Addr(s); ok {
+		return a, nil
+	}
+	if a, err := parseAddr(s); err == nil {
+		return a, nil
+	}
+	return 0, fmt.Errorf("unknown symbol '%s'", s)
+}
+
+// Write writes the table in the text format, in address order.
+func (t *Table) Write(w io.Writer) error {
+	addrs := make([]int, 0, t.Len())
+	for a := range t.Labels() {
+		addrs = append(addrs, int(a))
+	}
+	sort.Ints(addrs)
+	var b strings.Builder
+	for _, a := range addrs {
+		fmt.Fprintf(&b, "0x%03X %s\n", a, t.names[uint16(a)])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Read reads a symbol table in any of the formats it knows, told apart by
+// their first line that isn't blank or a # comment:
+//
+//   - JSON, an object of names and addresses: {"draw_player": "0x2A4"}
+//   - Octo constants, as output for labels: :const draw_player 0x2A4
+//   - text, an address and a name per line: 0x2A4 draw_player
+func Read(r io.Reader) (*Table, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch first(src) {
+	case '{':
+		return readJSON(src)
+	case ':':
+		return readLines(src, readOcto)
+	}
+	return readLines(src, readText)
+}
+
+// Load reads the symbol table at path.
+func Load(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return t, nil
+}
+
+// Sidecar returns the paths a symbol table for the ROM at romPath is looked
+// for at, in order: game.ch8.sym, game.sym, game.labels and game.json.
+func Sidecar(romPath string) []string {
+	base := strings.TrimSuffix(romPath, filepath.Ext(romPath))
+	return []string{romPath + ".sym", base + ".sym", base + ".labels", base + ".json"}
+}
+
+// LoadSidecar loads the first symbol table found next to the ROM at romPath
+// and returns where it was found. The table is empty and path blank when
+// there is none.
+func LoadSidecar(romPath string) (t *Table, path string, err error) {
+	for _, p := range Sidecar(romPath) {
+		if _, err = os.Stat(p); err != nil {
+			continue
+		}
+		t, err = Load(p)
+		return t, p, err
+	}
+	return New(nil), "", nil
+}
+
+func first(src []byte) byte {
+	for _, l := range bytes.Split(src, []byte("\n")) {
+		l = bytes.TrimSpace(l)
+		if len(l) > 0 && l[0] != '#' {
+			return l[0]
+		}
+	}
+	return 0
+}
+
+func readJSON(src []byte) (*Table, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(src, &m); err != nil {
+		return nil, err
+	}
+	labels := make(map[uint16]string, len(m))
+	for n, v := range m {
+		var a uint16
+		var err error
+		switch v := v.(type) {
+		case float64:
+			if v < 0 || v > 0xFFF || v != float64(int(v)) {
+				err = fmt.Errorf("invalid address %v for '%s'", v, n)
+			}
+			a = uint16(v)
+		case string:
+			if a, err = parseAddr(v); err != nil {
+				err = fmt.Errorf("invalid address '%s' for '%s'", v, n)
+			}
+		default:
+			err = fmt.Errorf("invalid address %v for '%s'", v, n)
+		}
+		if err != nil {
+			return nil, err
+		}
+		labels[a] = n
+	}
+	return New(labels), nil
+}
+
+func readLines(src []byte, line func(fields []string) (uint16, string, error)) (*Table, error) {
+	labels := make(map[uint16]string)
+	s := bufio.NewScanner(bytes.NewReader(src))
+	for n := 1; s.Scan(); n++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		a, name, err := line(strings.Fields(text))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		labels[a] = name
+	}
+	return New(labels), s.Err()
+}
+
+func readText(fields []string) (uint16, string, error) {
+	if len(fields) != 2 {
+		return 0, "", fmt.Errorf("expected an address and a name")
+	}
+	a, err := parseAddr(fields[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid address '%s'", fields[0])
+	}
+	return a, fields[1], nil
+}
+
+func readOcto(fields []string) (uint16, string, error) {
+	if len(fields) != 3 || fields[0] != ":const" {
+		return 0, "", fmt.Errorf("expected ':const name address'")
+	}
+	a, err := parseAddr(fields[2])
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid address '%s'", fields[2])
+	}
+	return a, fields[1], nil
+}
+
+func parseAddr(s string) (uint16, error) {
+	a, err := strconv.ParseUint(s, 0, 12)
+	return uint16(a), err
+}
@@ -0,0 +1,142 @@
+package symbols
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+	exp := map[uint16]string{0x200: "main", 0x2A4: "draw_player"}
+	tests := []struct {
+		name string
+		src  string
+		exp  map[uint16]string
+		err  string
+	}{
+		{"text", "# comment\n0x200 main\n\n  0x2A4   draw_player  \n", exp, ""},
+		{"text decimal", "512 main\n676 draw_player\n", exp, ""},
+		{"octo", "# labels\n:const main 0x200\n:const draw_player 0x2A4\n", exp, ""},
+		{"json", `{"main": "0x200", "draw_player": 676}`, exp, ""},
+		{"empty", "", map[uint16]string{}, ""},
+		{"text missing name", "0x200\n", nil, "line 1: expected an address and a name"},
+		{"text invalid address", "# comment\nmain 0x200\n", nil, "line 2: invalid address 'main'"},
+		{"text address too high", "0x1000 main\n", nil, "line 1: invalid address '0x1000'"},
+		{"octo not a constant", ":const main 0x200\n: main\n", nil, "line 2: expected ':const name address'"},
+		{"octo invalid address", ":const main start\n", nil, "line 1: invalid address 'start'"},
+		{"json invalid address", `{"main": "start"}`, nil, "invalid address 'start' for 'main'"},
+		{"json address too high", `{"main": 4096}`, nil, "invalid address 4096 for 'main'"},
+		{"json not an address", `{"main": true}`, nil, "invalid address true for 'main'"},
+		{"json invalid", `{"main"`, nil, "unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s, err := Read(strings.NewReader(tt.src))
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, s.Labels())
+		})
+	}
+}
+
+func TestTable(t *testing.T) {
+	t.Parallel()
+	s := New(map[uint16]string{0x200: "main", 0x2A4: "draw_player", 0x2A0: "draw_player"})
+	n, ok := s.Name(0x2A4)
+	assert.True(t, ok)
+	assert.Equal(t, "draw_player", n)
+	_, ok = s.Name(0x202)
+	assert.False(t, ok)
+	a, ok := s.Addr("draw_player")
+	assert.True(t, ok)
+	assert.Equal(t, uint16(0x2A0), a, "the lowest address with the name")
+	assert.Equal(t, 3, s.Len())
+
+	var b bytes.Buffer
+	assert.NoError(t, s.Write(&b))
+	assert.Equal(t, "0x200 main\n0x2A0 draw_player\n0x2A4 draw_player\n", b.String())
+}
+
+func TestTable_nil(t *testing.T) {
+	t.Parallel()
+	var s *Table
+	_, ok := s.Name(0x200)
+	assert.False(t, ok)
+	_, ok = s.Addr("main")
+	assert.False(t, ok)
+	assert.Equal(t, 0, s.Len())
+	assert.Empty(t, s.Labels())
+	a, err := s.Resolve("0x200")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x200), a)
+}
+
+func TestTable_Resolve(t *testing.T) {
+	t.Parallel()
+	s := New(map[uint16]string{0x2A4: "draw_player"})
+	tests := []struct {
+		spec string
+		exp  uint16
+		err  string
+	}{
+		{"draw_player", 0x2A4, ""},
+		{"0x2A6", 0x2A6, ""},
+		{"512", 0x200, ""},
+		{"draw_enemy", 0, "unknown symbol 'draw_enemy'"},
+		{"0x1000", 0, "unknown symbol '0x1000'"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.spec, func(t *testing.T) {
+			t.Parallel()
+			a, err := s.Resolve(tt.spec)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, a)
+		})
+	}
+}
+
+func TestLoadSidecar(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "symbols")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rom := filepath.Join(dir, "game.ch8")
+	assert.Equal(t, []string{
+		filepath.Join(dir, "game.ch8.sym"),
+		filepath.Join(dir, "game.sym"),
+		filepath.Join(dir, "game.labels"),
+		filepath.Join(dir, "game.json"),
+	}, Sidecar(rom))
+
+	s, path, err := LoadSidecar(rom)
+	assert.NoError(t, err)
+	assert.Equal(t, "", path)
+	assert.Equal(t, 0, s.Len())
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "game.json"), []byte(`{"main": 512}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "game.labels"), []byte(":const start 0x200\n"), 0644))
+	s, path, err = LoadSidecar(rom)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "game.labels"), path)
+	assert.Equal(t, map[uint16]string{0x200: "start"}, s.Labels())
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "game.sym"), []byte("main\n"), 0644))
+	_, path, err = LoadSidecar(rom)
+	assert.EqualError(t, err, filepath.Join(dir, "game.sym")+": line 1: expected an address and a name")
+	assert.Equal(t, filepath.Join(dir, "game.sym"), path)
+}
@@ -0,0 +1,219 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/carlosroman/go-chip-8/pkg/disasm"
+)
+
+// Entry is a single line of a trace, the state of the CPU just before it
+// executed an instruction.
+type Entry struct {
+	Cycle    uint64   `json:"cycle"`
+	PC       uint16   `json:"pc"`
+	Opcode   uint16   `json:"opcode"`
+	Mnemonic string   `json:"mnemonic"`
+	Label    string   `json:"label,omitempty"` // Name of the address, if it has one
+	V        [16]byte `json:"v"`
+	I        uint16   `json:"i"`
+	SP       int8     `json:"sp"`
+	DT       byte     `json:"dt"`
+	ST       byte     `json:"st"`
+}
+
+func (e Entry) String() string {
+	s := fmt.Sprintf("#%d 0x%03X: %04X %-20s v=% X i=0x%03X sp=%d dt=%d st=%d",
+		e.Cycle, e.PC, e.Opcode, e.Mnemonic, e.V[:], e.I, e.SP, e.DT, e.ST)
+	if e.Label != "" {
+		s += " # " + e.Label
+	}
+	return s
+}
+
+// Filter limits what is written to a trace. Zero values do not filter.
+type Filter struct {
+	From  uint16 // Lowest address traced
+	To    uint16 // Highest address traced
+	Start uint64 // First cycle traced
+	End   uint64 // Last cycle traced
+}
+
+func (f Filter) match(s cpu.Step) bool {
+	return s.PC >= f.From && (f.To == 0 || s.PC <= f.To) &&
+		s.Cycle >= f.Start && (f.End == 0 || s.Cycle <= f.End)
+}
+
+// Writer is a cpu.Tracer that writes every instruction matching its filter
+// as a line of JSON.
+type Writer struct {
+	lock sync.Mutex
+	w    *bufio.Writer
+	enc  *json.Encoder
+	f    Filter
+	name func(addr uint16) (string, bool)
+	err  error
+}
+
+func NewWriter(w io.Writer, f Filter) *Writer {
+	bw := bufio.NewWriter(w)
+	return &Writer{
+		w:   bw,
+		enc: json.NewEncoder(bw),
+		f:   f,
+	}
+}
+
+// SetNames names addresses in the entries written from now on, both in the
+// mnemonic and as the label of the address traced.
+func (w *Writer) SetNames(name func(addr uint16) (string, bool)) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.name = name
+}
+
+func (w *Writer) Trace(s cpu.Step) {
+	if !w.f.match(s) {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.err != nil {
+		return
+	}
+	e := Entry{
+		Cycle:    s.Cycle,
+		PC:       s.PC,
+		Opcode:   s.Opcode,
+		Mnemonic: disasm.Decode(s.Opcode).Format(w.name),
+		V:        s.V,
+		I:        s.I,
+		SP:       s.SP,
+		DT:       s.DT,
+		ST:       s.ST,
+	}
+	if w.name != nil {
+		e.Label, _ = w.name(s.PC)
+	}
+	w.err = w.enc.Encode(e)
+}
+
+// Flush writes any buffered entries and returns the first error writing.
+func (w *Writer) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// Divergence is the first point at which two traces differ.
+type Divergence struct {
+	Line    int     // Line of the traces that differs, from 1
+	A, B    *Entry  // The entries that differ, nil when a trace ended
+	Context []Entry // The entries before, which both traces agree on
+}
+
+// Fields returns the names of the fields that differ.
+func (d *Divergence) Fields() (fields []string) {
+	if d.A == nil || d.B == nil {
+		return nil
+	}
+	a, b := *d.A, *d.B
+	checks := []struct {
+		name string
+		same bool
+	}{
+		{"cycle", a.Cycle == b.Cycle},
+		{"pc", a.PC == b.PC},
+		{"opcode", a.Opcode == b.Opcode},
+		{"v", a.V == b.V},
+		{"i", a.I == b.I},
+		{"sp", a.SP == b.SP},
+		{"dt", a.DT == b.DT},
+		{"st", a.ST == b.ST},
+	}
+	for _, c := range checks {
+		if !c.same {
+			fields = append(fields, c.name)
+		}
+	}
+	return fields
+}
+
+func (d *Divergence) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "traces diverge at line %d", d.Line)
+	if f := d.Fields(); len(f) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(f, ", "))
+	}
+	b.WriteString("\n")
+	for _, e := range d.Context {
+		fmt.Fprintf(&b, "  %s\n", e)
+	}
+	for _, s := range []struct {
+		name string
+		e    *Entry
+	}{{"a", d.A}, {"b", d.B}} {
+		if s.e == nil {
+			fmt.Fprintf(&b, "%s <end of trace>\n", s.name)
+		} else {
+			fmt.Fprintf(&b, "%s %s\n", s.name, s.e)
+		}
+	}
+	return b.String()
+}
+
+// Diff reads two traces line by line and returns where they first differ,
+// with up to context entries leading up to it, or nil if they are the same.
+// The mnemonic and label are ignored, as another emulator may spell them
+// differently.
+func Diff(a, b io.Reader, context int) (*Divergence, error) {
+	da, db := json.NewDecoder(a), json.NewDecoder(b)
+	var before []Entry
+	for line := 1; ; line++ {
+		ea, err := next(da)
+		if err != nil {
+			return nil, fmt.Errorf("trace a, line %d: %v", line, err)
+		}
+		eb, err := next(db)
+		if err != nil {
+			return nil, fmt.Errorf("trace b, line %d: %v", line, err)
+		}
+		if ea == nil && eb == nil {
+			return nil, nil
+		}
+		if ea == nil || eb == nil || !same(*ea, *eb) {
+			return &Divergence{Line: line, A: ea, B: eb, Context: before}, nil
+		}
+		if context > 0 {
+			before = append(before, *ea)
+			if len(before) > context {
+				before = before[1:]
+			}
+		}
+	}
+}
+
+func next(d *json.Decoder) (*Entry, error) {
+	var e Entry
+	if err := d.Decode(&e); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+func same(a, b Entry) bool {
+	a.Mnemonic, b.Mnemonic = "", ""
+	a.Label, b.Label = "", ""
+	return a == b
+}
@@ -0,0 +1,166 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/carlosroman/go-chip-8/pkg/cpu"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestWriter_Trace(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	w := NewWriter(&b, Filter{})
+	s := cpu.Step{Cycle: 7, PC: 0x202, Opcode: 0x6A05, I: 0x300, SP: 1, DT: 2, ST: 3}
+	s.V[0xF] = 0x1
+	w.Trace(s)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t,
+		`{"cycle":7,"pc":514,"opcode":27141,"mnemonic":"va := 0x05","v":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,1],"i":768,"sp":1,"dt":2,"st":3}`+"\n",
+		b.String())
+}
+
+func TestWriter_SetNames(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	w := NewWriter(&b, Filter{})
+	w.SetNames(func(addr uint16) (string, bool) {
+		return map[uint16]string{0x200: "main", 0x2A4: "draw_player"}[addr], addr == 0x200 || addr == 0x2A4
+	})
+	w.Trace(cpu.Step{Cycle: 0, PC: 0x200, Opcode: 0x22A4})
+	w.Trace(cpu.Step{Cycle: 1, PC: 0x2A4, Opcode: 0x1200, SP: 1})
+	assert.NoError(t, w.Flush())
+	entries := readAll(t, b.String())
+	assert.Equal(t, "draw_player", entries[0].Mnemonic)
+	assert.Equal(t, "main", entries[0].Label)
+	assert.Equal(t, "jump main", entries[1].Mnemonic)
+	assert.Equal(t, "draw_player", entries[1].Label)
+	assert.Equal(t, "#1 0x2A4: 1200 jump main            v=00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 i=0x000 sp=1 dt=0 st=0 # draw_player",
+		entries[1].String())
+}
+
+func TestWriter_Trace_filter(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name string
+		f    Filter
+		exp  []uint64
+	}{
+		{name: "none", f: Filter{}, exp: []uint64{0, 1, 2, 3, 4, 5}},
+		{name: "address", f: Filter{From: 0x202, To: 0x204}, exp: []uint64{1, 2, 4, 5}},
+		{name: "from address", f: Filter{From: 0x204}, exp: []uint64{2, 5}},
+		{name: "cycles", f: Filter{Start: 2, End: 4}, exp: []uint64{2, 3, 4}},
+		{name: "both", f: Filter{To: 0x202, Start: 1}, exp: []uint64{1, 3, 4}},
+	}
+	pcs := []uint16{0x200, 0x202, 0x204, 0x200, 0x202, 0x204}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var b bytes.Buffer
+			w := NewWriter(&b, tc.f)
+			for c, pc := range pcs {
+				w.Trace(cpu.Step{Cycle: uint64(c), PC: pc})
+			}
+			assert.NoError(t, w.Flush())
+			var cycles []uint64
+			for _, e := range readAll(t, b.String()) {
+				cycles = append(cycles, e.Cycle)
+			}
+			assert.Equal(t, tc.exp, cycles)
+		})
+	}
+}
+
+func TestWriter_Flush_error(t *testing.T) {
+	t.Parallel()
+	w := NewWriter(&failingWriter{}, Filter{})
+	for i := 0; i < 100; i++ {
+		w.Trace(cpu.Step{})
+	}
+	assert.EqualError(t, w.Flush(), "disk full")
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	a := trace(t, 0x200, 0x202, 0x204, 0x206)
+	b := trace(t, 0x200, 0x202, 0x204, 0x208)
+	d, err := Diff(strings.NewReader(a), strings.NewReader(b), 2)
+	assert.NoError(t, err)
+	if assert.NotNil(t, d) {
+		assert.Equal(t, 4, d.Line)
+		assert.Equal(t, uint16(0x206), d.A.PC)
+		assert.Equal(t, uint16(0x208), d.B.PC)
+		assert.Equal(t, []string{"pc"}, d.Fields())
+		assert.Len(t, d.Context, 2)
+		assert.Equal(t, uint16(0x202), d.Context[0].PC)
+		assert.Equal(t, `traces diverge at line 4 (pc)
+  #1 0x202: 0000 0x00 0x00            v=00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 i=0x000 sp=0 dt=0 st=0
+  #2 0x204: 0000 0x00 0x00            v=00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 i=0x000 sp=0 dt=0 st=0
+a #3 0x206: 0000 0x00 0x00            v=00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 i=0x000 sp=0 dt=0 st=0
+b #3 0x208: 0000 0x00 0x00            v=00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 i=0x000 sp=0 dt=0 st=0
+`, d.String())
+	}
+}
+
+func TestDiff_same(t *testing.T) {
+	t.Parallel()
+	a := trace(t, 0x200, 0x202)
+	// Another emulator may use different mnemonics
+	b := strings.Replace(a, "0x00 0x00", "SYS 000", -1)
+	d, err := Diff(strings.NewReader(a), strings.NewReader(b), 2)
+	assert.NoError(t, err)
+	assert.Nil(t, d)
+}
+
+func TestDiff_shorter(t *testing.T) {
+	t.Parallel()
+	a := trace(t, 0x200, 0x202)
+	b := trace(t, 0x200)
+	d, err := Diff(strings.NewReader(a), strings.NewReader(b), 0)
+	assert.NoError(t, err)
+	if assert.NotNil(t, d) {
+		assert.Equal(t, 2, d.Line)
+		assert.Nil(t, d.B)
+		assert.Empty(t, d.Context)
+		assert.Contains(t, d.String(), "b <end of trace>")
+	}
+}
+
+func TestDiff_invalid(t *testing.T) {
+	t.Parallel()
+	a := trace(t, 0x200)
+	_, err := Diff(strings.NewReader(a), strings.NewReader("{nope"), 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "trace b, line 1")
+}
+
+func trace(t *testing.T, pcs ...uint16) string {
+	var b bytes.Buffer
+	w := NewWriter(&b, Filter{})
+	for c, pc := range pcs {
+		w.Trace(cpu.Step{Cycle: uint64(c), PC: pc})
+	}
+	assert.NoError(t, w.Flush())
+	return b.String()
+}
+
+func readAll(t *testing.T, s string) (entries []Entry) {
+	d := json.NewDecoder(strings.NewReader(s))
+	for d.More() {
+		var e Entry
+		assert.NoError(t, d.Decode(&e))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+type failingWriter struct {
+}
+
+func (f *failingWriter) Write(p []byte) (n int, err error) {
+	return 0, errors.New("disk full")
+}